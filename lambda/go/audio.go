@@ -0,0 +1,104 @@
+package workshop
+
+import (
+	"bytes"
+	"mime"
+	"strings"
+)
+
+// AudioSniffLen is the number of bytes from the start of media
+// SniffAudioContentType considers.
+const AudioSniffLen = 512
+
+// mediaContentTypeAliases maps the non-standard, and legacy content types
+// podcast feeds and servers use for audio to the canonical MediaContentTypes.
+var mediaContentTypeAliases = map[string]string{
+	"audio/mp3":       "audio/mpeg",
+	"audio/mpeg3":     "audio/mpeg",
+	"audio/mpg":       "audio/mpeg",
+	"audio/x-mp3":     "audio/mpeg",
+	"audio/x-mpeg":    "audio/mpeg",
+	"audio/x-mpeg-3":  "audio/mpeg",
+	"audio/x-wav":     "audio/wav",
+	"audio/wave":      "audio/wav",
+	"audio/vnd.wave":  "audio/wav",
+	"audio/x-flac":    "audio/flac",
+	"audio/mp4":       "audio/mp4a-latm",
+	"audio/m4a":       "audio/mp4a-latm",
+	"audio/x-m4a":     "audio/mp4a-latm",
+	"audio/x-m4b":     "audio/mp4a-latm",
+	"audio/opus":      "audio/ogg",
+	"audio/vorbis":    "audio/ogg",
+	"audio/x-ogg":     "audio/ogg",
+	"application/ogg": "audio/ogg",
+	"audio/x-amr":     "audio/amr",
+}
+
+// NormalizeMediaContentType returns the canonical content type of the media
+// content type, e.g. audio/mpeg for audio/mp3. The content type's parameters
+// are removed. Content types without an alias are returned lower cased.
+func NormalizeMediaContentType(v string) string {
+	mediaType, _, err := mime.ParseMediaType(v)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(v))
+	}
+	if canonical, ok := mediaContentTypeAliases[mediaType]; ok {
+		return canonical
+	}
+	return mediaType
+}
+
+// SniffAudioContentType returns the canonical content type of the audio
+// container the media starts with, identified by the container's magic bytes.
+// Only the first AudioSniffLen bytes are considered. Returns an empty string
+// if the container is not recognised.
+//
+// MP3 is recognised by either an ID3v2 tag, or an MPEG audio frame header,
+// M4A/AAC by the MP4 ftyp box, Ogg (Opus, Vorbis) by its page capture
+// pattern, and WebM by the EBML header's webm doc type.
+func SniffAudioContentType(b []byte) string {
+	if len(b) > AudioSniffLen {
+		b = b[:AudioSniffLen]
+	}
+
+	switch {
+	case bytes.HasPrefix(b, []byte("ID3")):
+		return "audio/mpeg"
+	case bytes.HasPrefix(b, []byte("fLaC")):
+		return "audio/flac"
+	case bytes.HasPrefix(b, []byte("OggS")):
+		return "audio/ogg"
+	case bytes.HasPrefix(b, []byte("#!AMR")):
+		return "audio/amr"
+	case len(b) >= 12 && bytes.HasPrefix(b, []byte("RIFF")) && bytes.Equal(b[8:12], []byte("WAVE")):
+		return "audio/wav"
+	case len(b) >= 8 && bytes.Equal(b[4:8], []byte("ftyp")):
+		return "audio/mp4a-latm"
+	case bytes.HasPrefix(b, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		// Matroska, and WebM share the EBML header, only WebM's doc type
+		// can be transcribed.
+		if bytes.Contains(b, []byte("webm")) {
+			return "audio/webm"
+		}
+		return ""
+	case isMPEGAudioFrame(b):
+		return "audio/mpeg"
+	}
+	return ""
+}
+
+// isMPEGAudioFrame returns if the media starts with a valid MPEG audio layer
+// I, II, or III frame header, e.g. MP3 without an ID3 tag. The header's
+// version, layer, bitrate, and sample rate must not be reserved values, so
+// AAC ADTS frames, which share the frame sync, are not matched.
+func isMPEGAudioFrame(b []byte) bool {
+	if len(b) < 4 || b[0] != 0xFF || b[1]&0xE0 != 0xE0 {
+		return false
+	}
+	version := (b[1] >> 3) & 0x3
+	layer := (b[1] >> 1) & 0x3
+	bitrate := b[2] >> 4
+	sampleRate := (b[2] >> 2) & 0x3
+
+	return version != 0x1 && layer != 0x0 && bitrate != 0xF && sampleRate != 0x3
+}
@@ -0,0 +1,201 @@
+package workshop_test
+
+import (
+	"bytes"
+	"testing"
+
+	workshop "aws-workshop"
+)
+
+func TestNormalizeMediaContentType(t *testing.T) {
+	cases := map[string]struct {
+		ContentType string
+		Expect      string
+	}{
+		"canonical": {
+			ContentType: "audio/mpeg",
+			Expect:      "audio/mpeg",
+		},
+		"mp3 alias": {
+			ContentType: "audio/mp3",
+			Expect:      "audio/mpeg",
+		},
+		"legacy mp3 alias": {
+			ContentType: "audio/x-mpeg-3",
+			Expect:      "audio/mpeg",
+		},
+		"m4a alias": {
+			ContentType: "audio/x-m4a",
+			Expect:      "audio/mp4a-latm",
+		},
+		"mp4 audio alias": {
+			ContentType: "audio/mp4",
+			Expect:      "audio/mp4a-latm",
+		},
+		"wav alias": {
+			ContentType: "audio/x-wav",
+			Expect:      "audio/wav",
+		},
+		"ogg application alias": {
+			ContentType: "application/ogg",
+			Expect:      "audio/ogg",
+		},
+		"alias with parameters": {
+			ContentType: "audio/opus; codecs=opus",
+			Expect:      "audio/ogg",
+		},
+		"upper case": {
+			ContentType: "Audio/X-M4A",
+			Expect:      "audio/mp4a-latm",
+		},
+		"whitespace": {
+			ContentType: "  audio/mp3 ",
+			Expect:      "audio/mpeg",
+		},
+		"unknown": {
+			ContentType: "Text/HTML",
+			Expect:      "text/html",
+		},
+		"empty": {
+			ContentType: "",
+			Expect:      "",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			if e, a := c.Expect, workshop.NormalizeMediaContentType(c.ContentType); e != a {
+				t.Errorf("expect %q, got %q", e, a)
+			}
+		})
+	}
+}
+
+func TestSniffAudioContentType(t *testing.T) {
+	cases := map[string]struct {
+		Media  []byte
+		Expect string
+	}{
+		"id3 tag": {
+			Media:  []byte("ID3\x04\x00\x00\x00\x00\x00\x00"),
+			Expect: "audio/mpeg",
+		},
+		"mpeg layer iii frame": {
+			Media:  []byte{0xFF, 0xFB, 0x90, 0x64, 0x00},
+			Expect: "audio/mpeg",
+		},
+		"mpeg 2 layer iii frame": {
+			Media:  []byte{0xFF, 0xF3, 0x48, 0xC4},
+			Expect: "audio/mpeg",
+		},
+		"aac adts frame": {
+			// ADTS shares the frame sync, but its layer is always 0.
+			Media:  []byte{0xFF, 0xF1, 0x50, 0x80, 0x02, 0x1F, 0xFC},
+			Expect: "",
+		},
+		"frame sync reserved bitrate": {
+			Media:  []byte{0xFF, 0xFB, 0xF0, 0x64},
+			Expect: "",
+		},
+		"frame sync reserved sample rate": {
+			Media:  []byte{0xFF, 0xFB, 0x9C, 0x64},
+			Expect: "",
+		},
+		"m4a ftyp": {
+			Media:  []byte("\x00\x00\x00\x20ftypM4A \x00\x00\x00\x00"),
+			Expect: "audio/mp4a-latm",
+		},
+		"mp4 ftyp": {
+			Media:  []byte("\x00\x00\x00\x18ftypisom\x00\x00\x02\x00"),
+			Expect: "audio/mp4a-latm",
+		},
+		"ogg": {
+			Media:  []byte("OggS\x00\x02\x00\x00"),
+			Expect: "audio/ogg",
+		},
+		"flac": {
+			Media:  []byte("fLaC\x00\x00\x00\x22"),
+			Expect: "audio/flac",
+		},
+		"riff wave": {
+			Media:  []byte("RIFF\x24\x08\x00\x00WAVEfmt "),
+			Expect: "audio/wav",
+		},
+		"riff not wave": {
+			Media:  []byte("RIFF\x24\x08\x00\x00AVI LIST"),
+			Expect: "",
+		},
+		"amr": {
+			Media:  []byte("#!AMR\n"),
+			Expect: "audio/amr",
+		},
+		"webm": {
+			Media:  []byte("\x1A\x45\xDF\xA3\x9F\x42\x86\x81\x01\x42\x82\x84webm"),
+			Expect: "audio/webm",
+		},
+		"matroska": {
+			Media:  []byte("\x1A\x45\xDF\xA3\x9F\x42\x86\x81\x01\x42\x82\x88matroska"),
+			Expect: "",
+		},
+		"webm doc type after sniff length": {
+			Media: append(append([]byte("\x1A\x45\xDF\xA3"),
+				bytes.Repeat([]byte{0}, workshop.AudioSniffLen)...), "webm"...),
+			Expect: "",
+		},
+		"html": {
+			Media:  []byte("<!DOCTYPE html><html>"),
+			Expect: "",
+		},
+		"nil": {
+			Media:  nil,
+			Expect: "",
+		},
+		"truncated id3": {
+			Media:  []byte("ID"),
+			Expect: "",
+		},
+		"truncated riff": {
+			Media:  []byte("RIFF\x24\x08\x00\x00WA"),
+			Expect: "",
+		},
+		"truncated ftyp": {
+			Media:  []byte("\x00\x00\x00\x20fty"),
+			Expect: "",
+		},
+		"truncated frame sync": {
+			Media:  []byte{0xFF, 0xFB, 0x90},
+			Expect: "",
+		},
+		"single byte": {
+			Media:  []byte{0xFF},
+			Expect: "",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			if e, a := c.Expect, workshop.SniffAudioContentType(c.Media); e != a {
+				t.Errorf("expect %q, got %q", e, a)
+			}
+		})
+	}
+}
+
+func TestSniffAudioContentType_Prefixes(t *testing.T) {
+	// Every prefix of the media must be sniffed without panicking.
+	media := [][]byte{
+		[]byte("ID3\x04\x00\x00\x00\x00\x00\x00"),
+		{0xFF, 0xFB, 0x90, 0x64},
+		[]byte("\x00\x00\x00\x20ftypM4A "),
+		[]byte("OggS\x00\x02"),
+		[]byte("fLaC\x00\x00"),
+		[]byte("RIFF\x24\x08\x00\x00WAVE"),
+		[]byte("#!AMR\n"),
+		[]byte("\x1A\x45\xDF\xA3\x9F\x42\x86\x81\x01\x42\x82\x84webm"),
+	}
+	for _, b := range media {
+		for i := 0; i <= len(b); i++ {
+			workshop.SniffAudioContentType(b[:i])
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package workshop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	ddbav "github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	ddbexp "github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// UnknownPublishedAt is the published_at of episodes whose published date is
+// not known, e.g. episodes added before published_at was recorded. The
+// podcast and status indexes are keyed by published_at, so episodes without
+// it are not listed by podcast or status. Sorts before every known date.
+const UnknownPublishedAt = "0001-01-01T00:00:00Z"
+
+// ScanAPI is the Amazon DynamoDB client API for Scan.
+type ScanAPI interface {
+	Scan(context.Context, *ddb.ScanInput, ...func(*ddb.Options)) (*ddb.ScanOutput, error)
+}
+
+// BackfillPublishedAtAPI is the Amazon DynamoDB client API needed to backfill
+// episodes' published_at.
+type BackfillPublishedAtAPI interface {
+	ScanAPI
+	UpdateItemAPI
+}
+
+// BackfillPublishedAt sets the published_at of the episodes in the table that
+// do not have one, from the episode's published date. Episodes without a
+// published date in a known format use UnknownPublishedAt. Returns the number
+// of episodes updated.
+func BackfillPublishedAt(ctx context.Context, client BackfillPublishedAtAPI, tableName string) (int, error) {
+	exp, err := ddbexp.NewBuilder().
+		WithFilter(ddbexp.AttributeNotExists(ddbexp.Name("published_at"))).
+		WithProjection(ddbexp.NamesList(ddbexp.Name("id"), ddbexp.Name("published"))).
+		Build()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build scan expression, %w", err)
+	}
+
+	input := &ddb.ScanInput{
+		TableName:                 &tableName,
+		FilterExpression:          exp.Filter(),
+		ProjectionExpression:      exp.Projection(),
+		ExpressionAttributeNames:  exp.Names(),
+		ExpressionAttributeValues: exp.Values(),
+	}
+	var updated int
+	for {
+		resp, err := client.Scan(ctx, input)
+		if err != nil {
+			return updated, fmt.Errorf("failed to scan episodes, %w", err)
+		}
+
+		var episodes []Episode
+		if err := ddbav.UnmarshalListOfMaps(resp.Items, &episodes); err != nil {
+			return updated, fmt.Errorf("failed to unmarshal episodes, %w", err)
+		}
+		for _, episode := range episodes {
+			publishedAt, ok := FormatPublishedAt(episode.PublishedDate)
+			if !ok {
+				publishedAt = UnknownPublishedAt
+			}
+			ok, err := setPublishedAt(ctx, client, tableName, episode.ID, publishedAt)
+			if err != nil {
+				return updated, err
+			}
+			if ok {
+				updated++
+			}
+		}
+
+		if len(resp.LastEvaluatedKey) == 0 {
+			return updated, nil
+		}
+		input.ExclusiveStartKey = resp.LastEvaluatedKey
+	}
+}
+
+// setPublishedAt sets the episode's published_at, if the episode exists, and
+// does not already have one. Returns false if the episode was not updated.
+func setPublishedAt(ctx context.Context, client UpdateItemAPI, tableName, episodeID, publishedAt string) (bool, error) {
+	exp, err := ddbexp.NewBuilder().
+		WithUpdate(ddbexp.Set(ddbexp.Name("published_at"), ddbexp.Value(publishedAt))).
+		WithCondition(ddbexp.And(
+			ddbexp.AttributeExists(ddbexp.Name("id")),
+			ddbexp.AttributeNotExists(ddbexp.Name("published_at")),
+		)).
+		Build()
+	if err != nil {
+		return false, fmt.Errorf("failed to build update expression, %w", err)
+	}
+
+	_, err = client.UpdateItem(ctx, &ddb.UpdateItemInput{
+		TableName:                 &tableName,
+		Key:                       Episode{ID: episodeID}.AttributeValuePrimaryKey(),
+		UpdateExpression:          exp.Update(),
+		ConditionExpression:       exp.Condition(),
+		ExpressionAttributeNames:  exp.Names(),
+		ExpressionAttributeValues: exp.Values(),
+	})
+	if err != nil {
+		var condErr *ddbtypes.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to set episode %v published_at, %w", episodeID, err)
+	}
+	return true, nil
+}
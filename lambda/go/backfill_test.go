@@ -0,0 +1,65 @@
+package workshop_test
+
+import (
+	"context"
+	"testing"
+
+	workshop "aws-workshop"
+	"aws-workshop/fakes"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestBackfillPublishedAt(t *testing.T) {
+	client := fakes.NewDynamoDB()
+	client.CreateTable("table", "id", "")
+	for _, item := range []map[string]ddbtypes.AttributeValue{
+		{
+			"id":        &ddbtypes.AttributeValueMemberS{Value: "dated"},
+			"published": &ddbtypes.AttributeValueMemberS{Value: "Wed, 13 Oct 2021 19:32:37 GMT"},
+		},
+		{
+			"id": &ddbtypes.AttributeValueMemberS{Value: "undated"},
+		},
+		{
+			"id":           &ddbtypes.AttributeValueMemberS{Value: "indexed"},
+			"published":    &ddbtypes.AttributeValueMemberS{Value: "Wed, 13 Oct 2021 19:32:37 GMT"},
+			"published_at": &ddbtypes.AttributeValueMemberS{Value: "2021-10-01T00:00:00Z"},
+		},
+	} {
+		_, err := client.PutItem(context.Background(), &ddb.PutItemInput{
+			TableName: aws.String("table"),
+			Item:      item,
+		})
+		if err != nil {
+			t.Fatalf("failed to put item, %v", err)
+		}
+	}
+
+	updated, err := workshop.BackfillPublishedAt(context.Background(), client, "table")
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if e, a := 2, updated; e != a {
+		t.Errorf("expect %v updated, got %v", e, a)
+	}
+
+	expect := map[string]string{
+		"dated":   "2021-10-13T19:32:37Z",
+		"undated": workshop.UnknownPublishedAt,
+		"indexed": "2021-10-01T00:00:00Z",
+	}
+	for _, item := range client.Items("table") {
+		id := item["id"].(*ddbtypes.AttributeValueMemberS).Value
+		publishedAt, ok := item["published_at"].(*ddbtypes.AttributeValueMemberS)
+		if !ok {
+			t.Errorf("expect %v to have published_at", id)
+			continue
+		}
+		if e, a := expect[id], publishedAt.Value; e != a {
+			t.Errorf("expect %v published_at %v, got %v", id, e, a)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	workshop "aws-workshop"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// backfill-published-at sets the published_at of episodes added before it was
+// recorded, so the episodes are included in the listings by podcast and
+// status. The episode table is read from the environment, or the -table flag.
+//
+// Usage:
+//
+//	go run ./cmd/backfill-published-at -table PodcastEpisode
+func main() {
+	var tableName string
+	flag.StringVar(&tableName, "table", "",
+		"name of the episode table, defaults to the environment's episode table")
+	flag.Parse()
+
+	if tableName == "" {
+		tableName = workshop.LoadEnvConfig().PodcastEpisodeTableName
+	}
+	if tableName == "" {
+		log.Fatalf("episode table name not set")
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		log.Fatalf("failed to load config, %v", err)
+	}
+
+	updated, err := workshop.BackfillPublishedAt(context.Background(), ddb.NewFromConfig(cfg), tableName)
+	log.Printf("updated published_at of %v episodes", updated)
+	if err != nil {
+		log.Fatalf("failed to backfill published_at, %v", err)
+	}
+}
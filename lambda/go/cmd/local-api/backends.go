@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+
+	workshop "aws-workshop"
+	"aws-workshop/handlers/addpodcasts"
+	"aws-workshop/handlers/exportpodcasts"
+	"aws-workshop/handlers/getimport"
+	"aws-workshop/handlers/getpodcast"
+	"aws-workshop/handlers/listpodcasts"
+	"aws-workshop/handlers/playpodcast"
+	"aws-workshop/local"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sfn"
+	"github.com/aws/smithy-go/rand"
+)
+
+// newAWSAPIHandlers returns the API handlers using AWS service clients. If
+// endpointURL is set, all API calls are sent to that endpoint instead of AWS.
+func newAWSAPIHandlers(envCfg workshop.EnvConfig, endpointURL string) (*apiHandlers, error) {
+	var optFns []func(*config.LoadOptions) error
+	if endpointURL != "" {
+		optFns = append(optFns, config.WithEndpointResolver(
+			aws.EndpointResolverFunc(func(service, region string) (aws.Endpoint, error) {
+				return aws.Endpoint{
+					URL:               endpointURL,
+					HostnameImmutable: true,
+					SigningRegion:     region,
+				}, nil
+			}),
+		))
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.Background(), optFns...)
+	if err != nil {
+		return nil, err
+	}
+
+	ddbClient := ddb.NewFromConfig(cfg)
+	s3Client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.UsePathStyle = endpointURL != ""
+	})
+
+	return &apiHandlers{
+		ListPodcasts: &listpodcasts.Handler{
+			DDBClient:        ddbClient,
+			EpisodeTableName: envCfg.PodcastEpisodeTableName,
+			PodcastIndexName: envCfg.PodcastIndexName,
+			StatusIndexName:  envCfg.StatusIndexName,
+			PageTokenKey:     []byte(envCfg.PageTokenKey),
+		},
+		AddPodcasts: &addpodcasts.Handler{
+			SFNClient: sfn.NewFromConfig(cfg),
+			DDBClient: ddbClient,
+
+			MaxNumEpisodes:            envCfg.MaxNumEpisodeImport,
+			ImportConcurrency:         envCfg.ImportConcurrency,
+			EpisodeTableName:          envCfg.PodcastEpisodeTableName,
+			TranscribeStateMachineARN: envCfg.TranscribeStateMachineARN,
+			FeedTableName:             envCfg.PodcastFeedTableName,
+			ImportJobTableName:        envCfg.ImportJobTableName,
+
+			HTTPClient:   workshop.NewHTTPClient(envCfg.HTTPClientOptions()),
+			UUIDProvider: rand.NewUUID(rand.Reader),
+		},
+		GetPodcast: &getpodcast.Handler{
+			DDBClient:        ddbClient,
+			EpisodeTableName: envCfg.PodcastEpisodeTableName,
+		},
+		ExportPodcasts: &exportpodcasts.Handler{
+			DDBClient:        ddbClient,
+			EpisodeTableName: envCfg.PodcastEpisodeTableName,
+		},
+		GetImport: &getimport.Handler{
+			DDBClient:          ddbClient,
+			ImportJobTableName: envCfg.ImportJobTableName,
+		},
+		PlayPodcast: &playpodcast.Handler{
+			S3PresignClient: s3.NewPresignClient(s3Client),
+			S3ObjectWaiter:  s3.NewObjectExistsWaiter(s3Client),
+			DDBClient:       ddbClient,
+
+			AWSRegion:        cfg.Region,
+			BucketName:       envCfg.PodcastDataBucketName,
+			MediaKeyPrefix:   envCfg.PodcastDataKeyPrefix,
+			EpisodeTableName: envCfg.PodcastEpisodeTableName,
+		},
+	}, nil
+}
+
+// newInMemoryAPIHandlers returns the API handlers using the in-memory
+// services.
+func newInMemoryAPIHandlers(envCfg workshop.EnvConfig, services *local.InMemoryServices) *apiHandlers {
+	return &apiHandlers{
+		ListPodcasts: &listpodcasts.Handler{
+			DDBClient:        services.DynamoDB,
+			EpisodeTableName: envCfg.PodcastEpisodeTableName,
+			PodcastIndexName: envCfg.PodcastIndexName,
+			StatusIndexName:  envCfg.StatusIndexName,
+			PageTokenKey:     []byte(envCfg.PageTokenKey),
+		},
+		AddPodcasts: &addpodcasts.Handler{
+			SFNClient: services.StepFunctions,
+			DDBClient: services.DynamoDB,
+
+			MaxNumEpisodes:            envCfg.MaxNumEpisodeImport,
+			ImportConcurrency:         envCfg.ImportConcurrency,
+			EpisodeTableName:          envCfg.PodcastEpisodeTableName,
+			TranscribeStateMachineARN: envCfg.TranscribeStateMachineARN,
+			FeedTableName:             envCfg.PodcastFeedTableName,
+			ImportJobTableName:        envCfg.ImportJobTableName,
+
+			HTTPClient:   workshop.NewHTTPClient(envCfg.HTTPClientOptions()),
+			UUIDProvider: rand.NewUUID(rand.Reader),
+		},
+		GetPodcast: &getpodcast.Handler{
+			DDBClient:        services.DynamoDB,
+			EpisodeTableName: envCfg.PodcastEpisodeTableName,
+		},
+		ExportPodcasts: &exportpodcasts.Handler{
+			DDBClient:        services.DynamoDB,
+			EpisodeTableName: envCfg.PodcastEpisodeTableName,
+		},
+		GetImport: &getimport.Handler{
+			DDBClient:          services.DynamoDB,
+			ImportJobTableName: envCfg.ImportJobTableName,
+		},
+		PlayPodcast: &playpodcast.Handler{
+			S3PresignClient: services.S3,
+			S3ObjectWaiter:  services.S3,
+			DDBClient:       services.DynamoDB,
+
+			AWSRegion:        local.InMemoryRegion,
+			BucketName:       envCfg.PodcastDataBucketName,
+			MediaKeyPrefix:   envCfg.PodcastDataKeyPrefix,
+			EpisodeTableName: envCfg.PodcastEpisodeTableName,
+		},
+	}
+}
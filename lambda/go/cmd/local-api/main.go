@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	workshop "aws-workshop"
+	"aws-workshop/fakes"
+	"aws-workshop/handlers/addpodcasts"
+	"aws-workshop/handlers/exportpodcasts"
+	"aws-workshop/handlers/getimport"
+	"aws-workshop/handlers/getpodcast"
+	"aws-workshop/handlers/listpodcasts"
+	"aws-workshop/handlers/playpodcast"
+	"aws-workshop/local"
+
+	"github.com/aws/aws-lambda-go/events"
+	ddbav "github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// local-api serves the podcast HTTP API on the local host. HTTP requests are
+// translated into API Gateway HTTP API events for the Lambda handler of the
+// matching route in lib/api-gateway.ts, and the handler's response is written
+// back to the client.
+//
+// Usage:
+//
+//	go run ./cmd/local-api -addr localhost:3000
+//	curl localhost:3000/podcast
+//
+// With -in-memory the handlers use in-memory fakes instead of AWS, episodes
+// added are transcribed by the local state machine, and import jobs are run
+// by the local server.
+//
+// With -refresh-interval subscribed feeds are refreshed periodically, as the
+// scheduled refresh-feeds Lambda does.
+func main() {
+	var (
+		addr           string
+		endpointURL    string
+		inMemory       bool
+		transcribeWait time.Duration
+		refreshEvery   time.Duration
+	)
+	flag.StringVar(&addr, "addr", "localhost:3000",
+		"address the HTTP API is served on")
+	flag.StringVar(&endpointURL, "endpoint-url", "",
+		"URL of local stand-in for AWS services, e.g. http://localhost:4566")
+	flag.BoolVar(&inMemory, "in-memory", false,
+		"use in-memory fakes for all AWS services instead of AWS")
+	flag.DurationVar(&transcribeWait, "transcribe-wait", 5*time.Second,
+		"time to wait between checks of the in-memory transcription job status")
+	flag.DurationVar(&refreshEvery, "refresh-interval", 0,
+		"interval subscribed feeds are refreshed at, disabled if 0")
+	flag.Parse()
+
+	envCfg := workshop.LoadEnvConfig()
+	if envCfg.PageTokenKey == "" {
+		// Page tokens only need to be valid for the lifetime of the local
+		// server, so use a random key if one is not provided.
+		key := make([]byte, 32)
+		if _, err := cryptorand.Read(key); err != nil {
+			log.Fatalf("failed to create page token key, %v", err)
+		}
+		envCfg.PageTokenKey = string(key)
+	}
+
+	var handlers *apiHandlers
+	if inMemory {
+		services := local.NewInMemoryServices(&envCfg)
+		stateMachine := services.TranscribeStateMachine(envCfg)
+		stateMachine.TranscribeWait = transcribeWait
+		services.StepFunctions.OnStartExecution = func(e fakes.Execution) {
+			go runExecution(stateMachine, e)
+		}
+		handlers = newInMemoryAPIHandlers(envCfg, services)
+
+		// Run import jobs when they are created, as the import-worker Lambda
+		// does with the import job table's stream.
+		services.DynamoDB.OnPutItem = func(tableName string, item map[string]ddbtypes.AttributeValue) {
+			if tableName == envCfg.ImportJobTableName {
+				go runImportJob(handlers.AddPodcasts, item)
+			}
+		}
+	} else {
+		var err error
+		handlers, err = newAWSAPIHandlers(envCfg, endpointURL)
+		if err != nil {
+			log.Fatalf("failed to create API handlers, %v", err)
+		}
+	}
+
+	if refreshEvery > 0 {
+		go refreshFeeds(handlers.AddPodcasts, refreshEvery)
+	}
+
+	router := local.NewAPIGatewayV2Router()
+	router.Handle("GET", "/podcast", handlers.ListPodcasts.Handle)
+	router.Handle("POST", "/podcast", handlers.AddPodcasts.Handle)
+	router.Handle("GET", "/podcast/{id}", handlers.GetPodcast.Handle)
+	router.Handle("GET", "/podcast/{id}/play", handlers.PlayPodcast.Handle)
+	router.Handle("GET", "/opml", handlers.ExportPodcasts.Handle)
+	router.Handle("GET", "/imports/{id}", handlers.GetImport.Handle)
+
+	log.Printf("serving podcast API on http://%v", addr)
+	if err := http.ListenAndServe(addr, router); err != nil {
+		log.Fatalf("local API server failed, %v", err)
+	}
+}
+
+// apiHandlers are the Lambda handlers of the HTTP API routes.
+type apiHandlers struct {
+	ListPodcasts *listpodcasts.Handler
+	AddPodcasts  *addpodcasts.Handler
+	GetPodcast   *getpodcast.Handler
+	PlayPodcast  *playpodcast.Handler
+
+	ExportPodcasts *exportpodcasts.Handler
+	GetImport      *getimport.Handler
+}
+
+// refreshFeeds refreshes the subscribed feeds every interval.
+func refreshFeeds(handler *addpodcasts.Handler, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		err := handler.HandleRefresh(context.Background(), events.CloudWatchEvent{
+			DetailType: "Scheduled Event",
+			Source:     "local-api",
+			Time:       time.Now().UTC(),
+		})
+		if err != nil {
+			log.Printf("ERROR: failed to refresh feeds, %v", err)
+		}
+	}
+}
+
+// runImportJob runs the import job created with the in-memory DynamoDB.
+func runImportJob(handler *addpodcasts.Handler, item map[string]ddbtypes.AttributeValue) {
+	var job workshop.ImportJob
+	if err := ddbav.UnmarshalMap(item, &job); err != nil {
+		log.Printf("ERROR: invalid import job, %v", err)
+		return
+	}
+
+	err := handler.HandleImportJobs(context.Background(), events.DynamoDBEvent{
+		Records: []events.DynamoDBEventRecord{{
+			EventName: string(events.DynamoDBOperationTypeInsert),
+			Change: events.DynamoDBStreamRecord{
+				Keys: map[string]events.DynamoDBAttributeValue{
+					"id": events.NewStringAttribute(job.ID),
+				},
+			},
+		}},
+	})
+	if err != nil {
+		log.Printf("ERROR: import job %v failed, %v", job.ID, err)
+	}
+}
+
+// runExecution runs the local state machine for an execution started with
+// the in-memory Step Functions.
+func runExecution(stateMachine *local.TranscribeStateMachine, e fakes.Execution) {
+	var input workshop.TranscribeStateMachineInput
+	if err := json.Unmarshal([]byte(e.Input), &input); err != nil {
+		log.Printf("ERROR: execution %v invalid input, %v", e.Name, err)
+		return
+	}
+
+	if _, err := stateMachine.Execute(context.Background(), input); err != nil {
+		log.Printf("ERROR: execution %v failed, %v", e.Name, err)
+		return
+	}
+	log.Printf("execution %v succeeded", e.Name)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+
+	workshop "aws-workshop"
+	"aws-workshop/handlers/checktranscription"
+	"aws-workshop/handlers/processtranscription"
+	"aws-workshop/handlers/starttranscription"
+	"aws-workshop/handlers/updateepisodestatus"
+	"aws-workshop/handlers/uploadpodcast"
+	"aws-workshop/local"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	tr "github.com/aws/aws-sdk-go-v2/service/transcribe"
+	"github.com/aws/smithy-go/rand"
+)
+
+// newAWSStateMachine returns a state machine with handlers using AWS service
+// clients. If endpointURL is set, all API calls are sent to that endpoint
+// instead of AWS.
+func newAWSStateMachine(envCfg workshop.EnvConfig, endpointURL string) (*local.TranscribeStateMachine, error) {
+	var optFns []func(*config.LoadOptions) error
+	if endpointURL != "" {
+		optFns = append(optFns, config.WithEndpointResolver(
+			aws.EndpointResolverFunc(func(service, region string) (aws.Endpoint, error) {
+				return aws.Endpoint{
+					URL:               endpointURL,
+					HostnameImmutable: true,
+					SigningRegion:     region,
+				}, nil
+			}),
+		))
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.Background(), optFns...)
+	if err != nil {
+		return nil, err
+	}
+
+	s3Client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.UsePathStyle = endpointURL != ""
+	})
+	var s3EndpointResolver s3.EndpointResolver = s3.NewDefaultEndpointResolver()
+	if endpointURL != "" {
+		s3EndpointResolver = s3.EndpointResolverFromURL(endpointURL)
+	}
+	ddbClient := ddb.NewFromConfig(cfg)
+	trClient := tr.NewFromConfig(cfg)
+
+	return &local.TranscribeStateMachine{
+		UpdateEpisodeStatus: &updateepisodestatus.Handler{
+			DDBClient:        ddbClient,
+			S3Client:         s3Client,
+			EpisodeTableName: envCfg.PodcastEpisodeTableName,
+			BucketName:       envCfg.PodcastDataBucketName,
+		},
+		UploadPodcast: &uploadpodcast.Handler{
+			HTTPClient:     workshop.NewHTTPClient(envCfg.HTTPClientOptions()),
+			S3Uploader:     manager.NewUploader(s3Client),
+			S3Client:       s3Client,
+			DDBClient:      ddbClient,
+			BucketName:     envCfg.PodcastDataBucketName,
+			MediaKeyPrefix: envCfg.PodcastDataKeyPrefix,
+
+			EpisodeTableName: envCfg.PodcastEpisodeTableName,
+			QuotaTableName:   envCfg.QuotaTableName,
+			Quotas:           envCfg.MediaQuotas(),
+		},
+		StartTranscription: &starttranscription.Handler{
+			S3EndpointResolver: s3EndpointResolver,
+			Region:             cfg.Region,
+			TranscribeClient:   trClient,
+			BucketAccessRole:   envCfg.TranscribeAccessRoleARN,
+			BucketName:         envCfg.PodcastDataBucketName,
+			MediaKeyPrefix:     envCfg.PodcastDataKeyPrefix,
+			DDBClient:          ddbClient,
+
+			EpisodeTableName: envCfg.PodcastEpisodeTableName,
+			QuotaTableName:   envCfg.QuotaTableName,
+			Quotas:           envCfg.MediaQuotas(),
+
+			UUIDProvider: rand.NewUUID(rand.Reader),
+		},
+		CheckTranscription: &checktranscription.Handler{
+			TranscribeClient: trClient,
+		},
+		ProcessTranscription: &processtranscription.Handler{
+			S3Uploader:   manager.NewUploader(s3Client),
+			S3Downloader: manager.NewDownloader(s3Client),
+			DDBClient:    ddbClient,
+
+			BucketName:       envCfg.PodcastDataBucketName,
+			MediaKeyPrefix:   envCfg.PodcastDataKeyPrefix,
+			EpisodeTableName: envCfg.PodcastEpisodeTableName,
+		},
+	}, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	workshop "aws-workshop"
+	"aws-workshop/local"
+)
+
+// local-pipeline runs the podcast transcribe state machine on the local host
+// with the Lambda handlers invoked in-process. The state machine input is read
+// as JSON from the file specified, or stdin, and the final execution state is
+// written to stdout.
+//
+// Usage:
+//
+//	go run ./cmd/local-pipeline -input episode.json
+//
+// With -in-memory the handlers use in-memory fakes instead of AWS, so the
+// pipeline can be run without AWS credentials or deployed resources.
+func main() {
+	var (
+		inputFile      string
+		endpointURL    string
+		inMemory       bool
+		transcribeWait time.Duration
+	)
+	flag.StringVar(&inputFile, "input", "",
+		"file containing the state machine input JSON, defaults to stdin")
+	flag.StringVar(&endpointURL, "endpoint-url", "",
+		"URL of local stand-in for AWS services, e.g. http://localhost:4566")
+	flag.BoolVar(&inMemory, "in-memory", false,
+		"use in-memory fakes for all AWS services instead of AWS")
+	flag.DurationVar(&transcribeWait, "transcribe-wait", 30*time.Second,
+		"time to wait between checks of the transcription job status")
+	flag.Parse()
+
+	input, err := loadInput(inputFile)
+	if err != nil {
+		log.Fatalf("failed to load state machine input, %v", err)
+	}
+
+	envCfg := workshop.LoadEnvConfig()
+
+	var stateMachine *local.TranscribeStateMachine
+	if inMemory {
+		stateMachine = local.NewInMemoryServices(&envCfg).TranscribeStateMachine(envCfg)
+	} else {
+		stateMachine, err = newAWSStateMachine(envCfg, endpointURL)
+		if err != nil {
+			log.Fatalf("failed to create state machine, %v", err)
+		}
+	}
+	stateMachine.TranscribeWait = transcribeWait
+
+	state, err := stateMachine.Execute(context.Background(), input)
+	if printErr := printState(os.Stdout, state); printErr != nil {
+		log.Printf("failed to print execution state, %v", printErr)
+	}
+
+	if err != nil {
+		log.Fatalf("local pipeline failed, %v", err)
+	}
+}
+
+func loadInput(filename string) (workshop.TranscribeStateMachineInput, error) {
+	var r io.Reader = os.Stdin
+	if filename != "" {
+		f, err := os.Open(filename)
+		if err != nil {
+			return workshop.TranscribeStateMachineInput{}, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var input workshop.TranscribeStateMachineInput
+	if err := json.NewDecoder(r).Decode(&input); err != nil {
+		return workshop.TranscribeStateMachineInput{}, err
+	}
+	return input, nil
+}
+
+func printState(w io.Writer, state local.ExecutionState) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(state)
+}
@@ -0,0 +1,243 @@
+package workshop
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Maximum number of keys, and write requests, of a single Amazon DynamoDB
+// BatchGetItem, and BatchWriteItem request.
+const (
+	MaxBatchGetItemKeys       = 100
+	MaxBatchWriteItemRequests = 25
+)
+
+// BatchGetItemAPI is the Amazon DynamoDB client API for BatchGetItem.
+type BatchGetItemAPI interface {
+	BatchGetItem(context.Context, *ddb.BatchGetItemInput, ...func(*ddb.Options)) (
+		*ddb.BatchGetItemOutput, error,
+	)
+}
+
+// BatchWriteItemAPI is the Amazon DynamoDB client API for BatchWriteItem.
+type BatchWriteItemAPI interface {
+	BatchWriteItem(context.Context, *ddb.BatchWriteItemInput, ...func(*ddb.Options)) (
+		*ddb.BatchWriteItemOutput, error,
+	)
+}
+
+// BatchOptions provides the options for batch operations split into
+// multiple requests. The zero value uses the defaults.
+type BatchOptions struct {
+	// Maximum number of requests made at the same time. Defaults to 4.
+	MaxConcurrency int
+
+	// Maximum number of attempts of a request with unprocessed items.
+	// Defaults to 8.
+	MaxAttempts int
+
+	// Range of the exponential backoff between attempts of a request with
+	// unprocessed items. The delay is chosen at random up to the backoff,
+	// doubling with each attempt. Defaults to 50ms, and 5s.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+func (o BatchOptions) withDefaults() BatchOptions {
+	if o.MaxConcurrency <= 0 {
+		o.MaxConcurrency = 4
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 8
+	}
+	if o.MinBackoff <= 0 {
+		o.MinBackoff = 50 * time.Millisecond
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = 5 * time.Second
+	}
+	return o
+}
+
+// BatchGetItems gets the items of the keys from the table, with as many
+// BatchGetItem requests as needed. Keys not found are not included in the
+// items returned, and items are not in the order of the keys.
+func BatchGetItems(
+	ctx context.Context, client BatchGetItemAPI, tableName string,
+	keys []map[string]ddbtypes.AttributeValue, opts BatchOptions,
+) ([]map[string]ddbtypes.AttributeValue, error) {
+	var mu sync.Mutex
+	var items []map[string]ddbtypes.AttributeValue
+
+	err := runBatches(ctx, len(keys), MaxBatchGetItemKeys, opts,
+		func(ctx context.Context, start, end int) error {
+			var chunkItems []map[string]ddbtypes.AttributeValue
+			unprocessed := map[string]ddbtypes.KeysAndAttributes{
+				tableName: {Keys: keys[start:end]},
+			}
+
+			err := retryUnprocessed(ctx, opts, func() (int, error) {
+				resp, err := client.BatchGetItem(ctx, &ddb.BatchGetItemInput{
+					RequestItems: unprocessed,
+				})
+				if err != nil {
+					return 0, fmt.Errorf("failed to batch get items, %w", err)
+				}
+				chunkItems = append(chunkItems, resp.Responses[tableName]...)
+				unprocessed = resp.UnprocessedKeys
+				return len(unprocessed[tableName].Keys), nil
+			})
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
+			items = append(items, chunkItems...)
+			mu.Unlock()
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// BatchWriteItems makes the put and delete write requests to the table, with
+// as many BatchWriteItem requests as needed.
+func BatchWriteItems(
+	ctx context.Context, client BatchWriteItemAPI, tableName string,
+	requests []ddbtypes.WriteRequest, opts BatchOptions,
+) error {
+	return runBatches(ctx, len(requests), MaxBatchWriteItemRequests, opts,
+		func(ctx context.Context, start, end int) error {
+			unprocessed := map[string][]ddbtypes.WriteRequest{
+				tableName: requests[start:end],
+			}
+
+			return retryUnprocessed(ctx, opts, func() (int, error) {
+				resp, err := client.BatchWriteItem(ctx, &ddb.BatchWriteItemInput{
+					RequestItems: unprocessed,
+				})
+				if err != nil {
+					return 0, fmt.Errorf("failed to batch write items, %w", err)
+				}
+				unprocessed = resp.UnprocessedItems
+				return len(unprocessed[tableName]), nil
+			})
+		})
+}
+
+// runBatches calls fn with the start and end of each batch of the n items,
+// with up to the option's max concurrency batches at the same time. Returns
+// the first error of a batch, canceling the batches not yet finished.
+func runBatches(
+	ctx context.Context, n, batchSize int, opts BatchOptions,
+	fn func(ctx context.Context, start, end int) error,
+) error {
+	opts = opts.withDefaults()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	sem := make(chan struct{}, opts.MaxConcurrency)
+
+	for start := 0; start < n; start += batchSize {
+		end := start + batchSize
+		if end > n {
+			end = n
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := fn(ctx, start, end); err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(start, end)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// retryUnprocessed calls fn until it returns no unprocessed items, waiting
+// with jittered exponential backoff between attempts. Returns an error if
+// items are still unprocessed after the max attempts, or if the context's
+// deadline would pass before the next attempt.
+func retryUnprocessed(ctx context.Context, opts BatchOptions, fn func() (int, error)) error {
+	opts = opts.withDefaults()
+
+	backoff := opts.MinBackoff
+	for attempt := 1; ; attempt++ {
+		numUnprocessed, err := fn()
+		if err != nil {
+			return err
+		}
+		if numUnprocessed == 0 {
+			return nil
+		}
+		if attempt >= opts.MaxAttempts {
+			return fmt.Errorf("%v items unprocessed after %v attempts", numUnprocessed, attempt)
+		}
+
+		delay := jitter(backoff)
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return fmt.Errorf("%v items unprocessed, deadline exceeded before retry", numUnprocessed)
+		}
+		log.Printf("%v items unprocessed, retrying in %v", numUnprocessed, delay)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%v items unprocessed, %w", numUnprocessed, ctx.Err())
+		}
+
+		if backoff *= 2; backoff > opts.MaxBackoff {
+			backoff = opts.MaxBackoff
+		}
+	}
+}
+
+var (
+	jitterMu   sync.Mutex
+	jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// jitter returns a random duration up to d.
+func jitter(d time.Duration) time.Duration {
+	jitterMu.Lock()
+	defer jitterMu.Unlock()
+
+	return time.Duration(jitterRand.Int63n(int64(d) + 1))
+}
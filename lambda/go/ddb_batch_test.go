@@ -0,0 +1,360 @@
+package workshop_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	workshop "aws-workshop"
+
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const testBatchTableName = "PodcastEpisode"
+
+// fakeBatchClient is a DynamoDB batch client recording the number of items of
+// each request. The last items of a request are left unprocessed, as many as
+// the unprocessed func returns.
+type fakeBatchClient struct {
+	// Returns the number of the request's items left unprocessed. Called with
+	// the number of the call, starting at 1, and the request's items.
+	unprocessed func(call, n int) int
+	err         error
+
+	mu    sync.Mutex
+	calls []int
+}
+
+func (c *fakeBatchClient) call(n int) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.calls = append(c.calls, n)
+	if c.err != nil {
+		return 0, c.err
+	}
+	if c.unprocessed == nil {
+		return 0, nil
+	}
+	return c.unprocessed(len(c.calls), n), nil
+}
+
+func (c *fakeBatchClient) requests() []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]int{}, c.calls...)
+}
+
+func (c *fakeBatchClient) BatchGetItem(ctx context.Context, params *ddb.BatchGetItemInput, optFns ...func(*ddb.Options)) (
+	*ddb.BatchGetItemOutput, error,
+) {
+	keys := params.RequestItems[testBatchTableName].Keys
+	numUnprocessed, err := c.call(len(keys))
+	if err != nil {
+		return nil, err
+	}
+
+	processed := len(keys) - numUnprocessed
+	resp := &ddb.BatchGetItemOutput{
+		Responses: map[string][]map[string]ddbtypes.AttributeValue{
+			testBatchTableName: keys[:processed],
+		},
+	}
+	if numUnprocessed != 0 {
+		resp.UnprocessedKeys = map[string]ddbtypes.KeysAndAttributes{
+			testBatchTableName: {Keys: keys[processed:]},
+		}
+	}
+	return resp, nil
+}
+
+func (c *fakeBatchClient) BatchWriteItem(ctx context.Context, params *ddb.BatchWriteItemInput, optFns ...func(*ddb.Options)) (
+	*ddb.BatchWriteItemOutput, error,
+) {
+	requests := params.RequestItems[testBatchTableName]
+	numUnprocessed, err := c.call(len(requests))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &ddb.BatchWriteItemOutput{}
+	if numUnprocessed != 0 {
+		resp.UnprocessedItems = map[string][]ddbtypes.WriteRequest{
+			testBatchTableName: requests[len(requests)-numUnprocessed:],
+		}
+	}
+	return resp, nil
+}
+
+func makeTestBatchKeys(n int) []map[string]ddbtypes.AttributeValue {
+	keys := make([]map[string]ddbtypes.AttributeValue, 0, n)
+	for i := 0; i < n; i++ {
+		keys = append(keys, map[string]ddbtypes.AttributeValue{
+			"id": &ddbtypes.AttributeValueMemberS{Value: strconv.Itoa(i)},
+		})
+	}
+	return keys
+}
+
+func makeTestWriteRequests(n int) []ddbtypes.WriteRequest {
+	requests := make([]ddbtypes.WriteRequest, 0, n)
+	for _, key := range makeTestBatchKeys(n) {
+		requests = append(requests, ddbtypes.WriteRequest{
+			PutRequest: &ddbtypes.PutRequest{Item: key},
+		})
+	}
+	return requests
+}
+
+// unprocessedHalf leaves half of the items unprocessed for the first n calls.
+func unprocessedHalf(n int) func(call, numItems int) int {
+	return func(call, numItems int) int {
+		if call > n {
+			return 0
+		}
+		return numItems / 2
+	}
+}
+
+// testBatchOptions returns batch options making requests one at a time,
+// without waiting between attempts.
+func testBatchOptions(maxAttempts int) workshop.BatchOptions {
+	return workshop.BatchOptions{
+		MaxConcurrency: 1,
+		MaxAttempts:    maxAttempts,
+		MinBackoff:     time.Nanosecond,
+		MaxBackoff:     time.Nanosecond,
+	}
+}
+
+func TestBatchGetItems(t *testing.T) {
+	cases := map[string]struct {
+		NumKeys        int
+		Unprocessed    func(call, n int) int
+		Err            error
+		MaxAttempts    int
+		ExpectRequests []int
+		ExpectErr      string
+	}{
+		"no keys": {
+			NumKeys: 0,
+		},
+		"single request": {
+			NumKeys:        100,
+			ExpectRequests: []int{100},
+		},
+		"chunk boundary": {
+			NumKeys:        101,
+			ExpectRequests: []int{100, 1},
+		},
+		"multiple chunks": {
+			NumKeys:        250,
+			ExpectRequests: []int{100, 100, 50},
+		},
+		"unprocessed keys retried": {
+			NumKeys:        150,
+			Unprocessed:    unprocessedHalf(2),
+			ExpectRequests: []int{100, 50, 25, 50},
+		},
+		"unprocessed keys after max attempts": {
+			NumKeys:        10,
+			Unprocessed:    func(call, n int) int { return 1 },
+			MaxAttempts:    3,
+			ExpectRequests: []int{10, 1, 1},
+			ExpectErr:      "1 items unprocessed after 3 attempts",
+		},
+		"request error": {
+			NumKeys:        150,
+			Err:            fmt.Errorf("throttled"),
+			ExpectRequests: []int{100},
+			ExpectErr:      "failed to batch get items, throttled",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			client := &fakeBatchClient{unprocessed: c.Unprocessed, err: c.Err}
+			keys := makeTestBatchKeys(c.NumKeys)
+
+			items, err := workshop.BatchGetItems(context.Background(), client, testBatchTableName,
+				keys, testBatchOptions(c.MaxAttempts))
+			if c.ExpectErr != "" {
+				if err == nil {
+					t.Fatalf("expect error, got none")
+				}
+				if e, a := c.ExpectErr, err.Error(); !strings.Contains(a, e) {
+					t.Errorf("expect %q error, got %q", e, a)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("expect no error, got %v", err)
+				}
+				if e, a := len(keys), len(items); e != a {
+					t.Errorf("expect %v items, got %v", e, a)
+				}
+			}
+
+			if e, a := c.ExpectRequests, client.requests(); len(e) != 0 || len(a) != 0 {
+				if !reflect.DeepEqual(e, a) {
+					t.Errorf("expect %v requests, got %v", e, a)
+				}
+			}
+		})
+	}
+}
+
+func TestBatchWriteItems(t *testing.T) {
+	cases := map[string]struct {
+		NumRequests    int
+		Unprocessed    func(call, n int) int
+		Err            error
+		MaxAttempts    int
+		ExpectRequests []int
+		ExpectErr      string
+	}{
+		"no requests": {
+			NumRequests: 0,
+		},
+		"single request": {
+			NumRequests:    25,
+			ExpectRequests: []int{25},
+		},
+		"chunk boundary": {
+			NumRequests:    26,
+			ExpectRequests: []int{25, 1},
+		},
+		"multiple chunks": {
+			NumRequests:    60,
+			ExpectRequests: []int{25, 25, 10},
+		},
+		"unprocessed items retried": {
+			NumRequests:    30,
+			Unprocessed:    unprocessedHalf(2),
+			ExpectRequests: []int{25, 12, 6, 5},
+		},
+		"unprocessed items after max attempts": {
+			NumRequests:    10,
+			Unprocessed:    func(call, n int) int { return 2 },
+			MaxAttempts:    4,
+			ExpectRequests: []int{10, 2, 2, 2},
+			ExpectErr:      "2 items unprocessed after 4 attempts",
+		},
+		"request error": {
+			NumRequests:    30,
+			Err:            fmt.Errorf("throttled"),
+			ExpectRequests: []int{25},
+			ExpectErr:      "failed to batch write items, throttled",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			client := &fakeBatchClient{unprocessed: c.Unprocessed, err: c.Err}
+
+			err := workshop.BatchWriteItems(context.Background(), client, testBatchTableName,
+				makeTestWriteRequests(c.NumRequests), testBatchOptions(c.MaxAttempts))
+			if c.ExpectErr != "" {
+				if err == nil {
+					t.Fatalf("expect error, got none")
+				}
+				if e, a := c.ExpectErr, err.Error(); !strings.Contains(a, e) {
+					t.Errorf("expect %q error, got %q", e, a)
+				}
+			} else if err != nil {
+				t.Fatalf("expect no error, got %v", err)
+			}
+
+			if e, a := c.ExpectRequests, client.requests(); len(e) != 0 || len(a) != 0 {
+				if !reflect.DeepEqual(e, a) {
+					t.Errorf("expect %v requests, got %v", e, a)
+				}
+			}
+		})
+	}
+}
+
+func TestBatchWriteItems_Context(t *testing.T) {
+	waitOptions := workshop.BatchOptions{
+		MaxConcurrency: 1,
+		MinBackoff:     time.Hour,
+		MaxBackoff:     time.Hour,
+	}
+
+	cases := map[string]struct {
+		CancelBefore    bool
+		CancelOnRequest bool
+		Timeout         time.Duration
+		Options         workshop.BatchOptions
+		ExpectErr       string
+		MaxRequests     int
+	}{
+		"canceled before first request": {
+			CancelBefore: true,
+			ExpectErr:    "context canceled",
+			MaxRequests:  0,
+		},
+		"canceled while waiting to retry": {
+			CancelOnRequest: true,
+			Options:         waitOptions,
+			ExpectErr:       "context canceled",
+			MaxRequests:     1,
+		},
+		"deadline before retry": {
+			Timeout:     10 * time.Millisecond,
+			Options:     waitOptions,
+			ExpectErr:   "deadline exceeded",
+			MaxRequests: 1,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if c.Timeout != 0 {
+				ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+				defer cancel()
+			}
+			if c.CancelBefore {
+				cancel()
+			}
+
+			client := &fakeBatchClient{
+				unprocessed: func(call, n int) int {
+					if c.CancelOnRequest {
+						cancel()
+					}
+					return n
+				},
+			}
+
+			done := make(chan error, 1)
+			go func() {
+				done <- workshop.BatchWriteItems(ctx, client, testBatchTableName,
+					makeTestWriteRequests(50), c.Options)
+			}()
+
+			var err error
+			select {
+			case err = <-done:
+			case <-time.After(10 * time.Second):
+				t.Fatalf("expect batch to stop, still running")
+			}
+			if err == nil {
+				t.Fatalf("expect error, got none")
+			}
+			if e, a := c.ExpectErr, err.Error(); !strings.Contains(a, e) {
+				t.Errorf("expect %q error, got %q", e, a)
+			}
+			if e, a := c.MaxRequests, len(client.requests()); a > e {
+				t.Errorf("expect at most %v requests, got %v", e, a)
+			}
+		})
+	}
+}
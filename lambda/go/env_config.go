@@ -3,39 +3,124 @@ package workshop
 import (
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 const (
 	envKeyPrefix                    = "AWS_SDK_WORKSHOP_"
 	envKeyTranscribeStateMachineARN = envKeyPrefix + "TRANSCRIBE_STATEMACHINE_ARN"
 	envKeyPodcastEpisodeTableName   = envKeyPrefix + "PODCAST_EPISODE_TABLE_NAME"
+	envKeyPodcastIndexName          = envKeyPrefix + "PODCAST_EPISODE_PODCAST_INDEX_NAME"
+	envKeyStatusIndexName           = envKeyPrefix + "PODCAST_EPISODE_STATUS_INDEX_NAME"
+	envKeyPodcastFeedTableName      = envKeyPrefix + "PODCAST_FEED_TABLE_NAME"
+	envKeyImportJobTableName        = envKeyPrefix + "PODCAST_IMPORT_JOB_TABLE_NAME"
+	envKeyQuotaTableName            = envKeyPrefix + "PODCAST_QUOTA_TABLE_NAME"
 	envKeyPodcastDataBucketName     = envKeyPrefix + "PODCAST_DATA_BUCKET_NAME"
 	envKeyTranscribeAccessRoleARN   = envKeyPrefix + "TRANSCRIBE_ACCESS_ROLE_ARN"
+	envKeyPageTokenKey              = envKeyPrefix + "PAGE_TOKEN_KEY"
+	envKeyPageTokenKeySecretARN     = envKeyPrefix + "PAGE_TOKEN_KEY_SECRET_ARN"
 
 	envKeyPodcastDataKeyPrefix = envKeyPrefix + "PODCAST_DATA_KEY_PREFIX"
 	envKeyMaxNumEpisodeImport  = envKeyPrefix + "MAX_NUM_EPISODE_IMPORT"
+	envKeyImportConcurrency    = envKeyPrefix + "IMPORT_CONCURRENCY"
+	envKeyHTTPAllowedHosts     = envKeyPrefix + "HTTP_ALLOWED_HOSTS"
+
+	envKeyMaxMediaSize                = envKeyPrefix + "MAX_MEDIA_SIZE"
+	envKeyMaxMediaDurationSeconds     = envKeyPrefix + "MAX_MEDIA_DURATION_SECONDS"
+	envKeyMaxEpisodesPerPodcastPerDay = envKeyPrefix + "MAX_EPISODES_PER_PODCAST_PER_DAY"
 )
 
 type EnvConfig struct {
 	TranscribeStateMachineARN string
 	PodcastEpisodeTableName   string
+	PodcastIndexName          string
+	StatusIndexName           string
+	PodcastFeedTableName      string
+	ImportJobTableName        string
+	QuotaTableName            string
 	PodcastDataBucketName     string
 	TranscribeAccessRoleARN   string
+	PageTokenKey              string
+
+	// Secret the page token key is loaded from when the list podcasts
+	// function starts. Not used if PageTokenKey is set, e.g. running locally.
+	PageTokenKeySecretARN string
 
 	PodcastDataKeyPrefix string
 	MaxNumEpisodeImport  int
+
+	// Maximum number of episodes whose transcribe is started concurrently
+	// when importing episodes.
+	ImportConcurrency int
+
+	// Hosts feeds and media may be fetched from, even if their addresses are
+	// blocked, e.g. an internal feed host. Comma separated in the
+	// environment.
+	HTTPAllowedHosts []string
+
+	// Maximum size, in bytes, and duration of an episode's media, and
+	// number of episodes of a podcast transcribed a day. Unlimited if 0.
+	MaxMediaSize                int64
+	MaxMediaDuration            time.Duration
+	MaxEpisodesPerPodcastPerDay int
 }
 
 func LoadEnvConfig() EnvConfig {
 	maxNumEpisodes, _ := strconv.ParseInt(os.Getenv(envKeyMaxNumEpisodeImport), 10, 64)
+	importConcurrency, _ := strconv.ParseInt(os.Getenv(envKeyImportConcurrency), 10, 64)
+	maxMediaSize, _ := strconv.ParseInt(os.Getenv(envKeyMaxMediaSize), 10, 64)
+	maxMediaDuration, _ := strconv.ParseInt(os.Getenv(envKeyMaxMediaDurationSeconds), 10, 64)
+	maxEpisodesPerDay, _ := strconv.ParseInt(os.Getenv(envKeyMaxEpisodesPerPodcastPerDay), 10, 64)
 
 	return EnvConfig{
 		TranscribeStateMachineARN: os.Getenv(envKeyTranscribeStateMachineARN),
 		PodcastEpisodeTableName:   os.Getenv(envKeyPodcastEpisodeTableName),
+		PodcastIndexName:          os.Getenv(envKeyPodcastIndexName),
+		StatusIndexName:           os.Getenv(envKeyStatusIndexName),
+		PodcastFeedTableName:      os.Getenv(envKeyPodcastFeedTableName),
+		ImportJobTableName:        os.Getenv(envKeyImportJobTableName),
+		QuotaTableName:            os.Getenv(envKeyQuotaTableName),
 		PodcastDataBucketName:     os.Getenv(envKeyPodcastDataBucketName),
 		TranscribeAccessRoleARN:   os.Getenv(envKeyTranscribeAccessRoleARN),
+		PageTokenKey:              os.Getenv(envKeyPageTokenKey),
+		PageTokenKeySecretARN:     os.Getenv(envKeyPageTokenKeySecretARN),
 
 		PodcastDataKeyPrefix: os.Getenv(envKeyPodcastDataKeyPrefix),
 		MaxNumEpisodeImport:  int(maxNumEpisodes),
+		ImportConcurrency:    int(importConcurrency),
+		HTTPAllowedHosts:     splitList(os.Getenv(envKeyHTTPAllowedHosts)),
+
+		MaxMediaSize:                maxMediaSize,
+		MaxMediaDuration:            time.Duration(maxMediaDuration) * time.Second,
+		MaxEpisodesPerPodcastPerDay: int(maxEpisodesPerDay),
+	}
+}
+
+// MediaQuotas returns the limits on the episodes transcribed.
+func (c EnvConfig) MediaQuotas() MediaQuotas {
+	return MediaQuotas{
+		MaxMediaSize:                c.MaxMediaSize,
+		MaxMediaDuration:            c.MaxMediaDuration,
+		MaxEpisodesPerPodcastPerDay: c.MaxEpisodesPerPodcastPerDay,
+	}
+}
+
+// HTTPClientOptions returns the options of the HTTP client for fetching feeds
+// and media.
+func (c EnvConfig) HTTPClientOptions() HTTPClientOptions {
+	return HTTPClientOptions{
+		AllowedHosts: c.HTTPAllowedHosts,
+	}
+}
+
+// splitList returns the non-empty values of the comma separated list.
+func splitList(v string) []string {
+	var values []string
+	for _, value := range strings.Split(v, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
 	}
+	return values
 }
@@ -3,6 +3,8 @@ package workshop
 import (
 	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
 	ddbexp "github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
 	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
@@ -38,15 +40,115 @@ type Episode struct {
 	Title                  string        `json:"title" dynamodbav:"title"`
 	Description            string        `json:"description" dynamodbav:"description"`
 	PublishedDate          string        `json:"published" dynamodbav:"published"`
-	Podcast                string        `json:"podcast" dynamodbav:"podcast"`
+	PublishedAt            string        `json:"published_at,omitempty" dynamodbav:"published_at,omitempty"`
+	Podcast                string        `json:"podcast" dynamodbav:"podcast,omitempty"`
+	FeedURL                string        `json:"feed_url,omitempty" dynamodbav:"feed_url,omitempty"`
+	Author                 string        `json:"author,omitempty" dynamodbav:"author,omitempty"`
+	Language               string        `json:"language,omitempty" dynamodbav:"language,omitempty"`
+	Categories             []string      `json:"categories,omitempty" dynamodbav:"categories,omitempty"`
+	ImageURL               string        `json:"image_url,omitempty" dynamodbav:"image_url,omitempty"`
+	EpisodeNumber          int           `json:"episode_number,omitempty" dynamodbav:"episode_number,omitempty"`
+	SeasonNumber           int           `json:"season_number,omitempty" dynamodbav:"season_number,omitempty"`
+	DurationSeconds        int64         `json:"duration_seconds,omitempty" dynamodbav:"duration_seconds,omitempty"`
+	Explicit               bool          `json:"explicit,omitempty" dynamodbav:"explicit,omitempty"`
+	Transcripts            []Transcript  `json:"transcripts,omitempty" dynamodbav:"transcripts,omitempty"`
+	ChaptersURL            string        `json:"chapters_url,omitempty" dynamodbav:"chapters_url,omitempty"`
 	MediaURL               string        `json:"media_url" dynamodbav:"media_url"`
 	MediaContentType       string        `json:"media_content_type" dynamodbav:"media_content_type"`
 	MediaKey               string        `json:"media_key" dynamodbav:"media_key"`
+	MediaSize              int64         `json:"media_size,omitempty" dynamodbav:"media_size,omitempty"`
+	MediaSHA256            string        `json:"media_sha256,omitempty" dynamodbav:"media_sha256,omitempty"`
+	MediaDurationSeconds   float64       `json:"media_duration_seconds,omitempty" dynamodbav:"media_duration_seconds,omitempty"`
+	MediaBitrate           int           `json:"media_bitrate,omitempty" dynamodbav:"media_bitrate,omitempty"`
+	MediaSampleRate        int           `json:"media_sample_rate,omitempty" dynamodbav:"media_sample_rate,omitempty"`
+	MediaChannels          int           `json:"media_channels,omitempty" dynamodbav:"media_channels,omitempty"`
+	MediaTitle             string        `json:"media_title,omitempty" dynamodbav:"media_title,omitempty"`
+	MediaArtist            string        `json:"media_artist,omitempty" dynamodbav:"media_artist,omitempty"`
+	MediaChapters          []Chapter     `json:"media_chapters,omitempty" dynamodbav:"media_chapters,omitempty"`
+	MediaArtworkKey        string        `json:"media_artwork_key,omitempty" dynamodbav:"media_artwork_key,omitempty"`
 	TranscribeExecutionARN string        `json:"transcribe_execution_arn,omitempty" dynamodbav:"transcribe_execution_arn,omitempty"`
+	ImportAttempt          int           `json:"import_attempt,omitempty" dynamodbav:"import_attempt,omitempty"`
 	TranscribeJobID        string        `json:"transcribe_job_id,omitempty" dynamodbav:"transcription_job_id,omitempty"`
+	TranscribeStartedAt    string        `json:"transcribe_started_at,omitempty" dynamodbav:"transcribe_started_at,omitempty"`
 	TranscribeMetadataKey  string        `json:"transcribe_metadata_key,omitempty" dynamodbav:"transcribe_metadata_key,omitempty"`
 	TranscriptionKey       string        `json:"transcription_key,omitempty" dynamodbav:"transcription_key,omitempty"`
 	Status                 EpisodeStatus `json:"status" dynamodbav:"status"`
+	FailureReason          string        `json:"failure_reason,omitempty" dynamodbav:"failure_reason,omitempty"`
+}
+
+// Transcript is a transcript of the episode published with the podcast's
+// feed.
+type Transcript struct {
+	URL      string `json:"url" dynamodbav:"url"`
+	Type     string `json:"type,omitempty" dynamodbav:"type,omitempty"`
+	Language string `json:"language,omitempty" dynamodbav:"language,omitempty"`
+	Rel      string `json:"rel,omitempty" dynamodbav:"rel,omitempty"`
+}
+
+// Chapter is a chapter of the episode embedded in the episode's media, e.g.
+// an ID3 CHAP frame.
+type Chapter struct {
+	Title        string  `json:"title,omitempty" dynamodbav:"title,omitempty"`
+	StartSeconds float64 `json:"start_seconds" dynamodbav:"start_seconds"`
+	EndSeconds   float64 `json:"end_seconds,omitempty" dynamodbav:"end_seconds,omitempty"`
+}
+
+// publishedDateLayouts are the date formats found in podcast feeds' published
+// dates. RSS uses RFC 822 dates, but feeds commonly omit the leading zero of
+// the day, or the seconds.
+var publishedDateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"Mon, 2 Jan 2006 15:04 -0700",
+	"Mon, 2 Jan 2006 15:04 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 MST",
+	time.RFC822Z,
+	time.RFC822,
+	time.RFC3339,
+}
+
+// publishedDateZones are the UTC offsets, in hours, of the time zone
+// abbreviations RFC 822 allows in published dates. time.Parse treats unknown
+// abbreviations as UTC, so dates with other abbreviations are rejected
+// instead of being recorded at the wrong time.
+var publishedDateZones = map[string]int{
+	"GMT": 0,
+	"UTC": 0,
+	"EST": -5,
+	"EDT": -4,
+	"CST": -6,
+	"CDT": -5,
+	"MST": -7,
+	"MDT": -6,
+	"PST": -8,
+	"PDT": -7,
+}
+
+// FormatPublishedAt returns the published date as a RFC 3339 UTC timestamp,
+// which sorts in time order, and true. Returns false if the published date's
+// format or time zone is not known.
+func FormatPublishedAt(published string) (string, bool) {
+	published = strings.TrimSpace(published)
+	for _, layout := range publishedDateLayouts {
+		t, err := time.Parse(layout, published)
+		if err != nil {
+			continue
+		}
+		if strings.HasSuffix(layout, "MST") {
+			name, _ := t.Zone()
+			offset, ok := publishedDateZones[name]
+			if !ok {
+				return "", false
+			}
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(),
+				t.Nanosecond(), time.FixedZone(name, offset*60*60))
+		}
+		return t.UTC().Format(time.RFC3339), true
+	}
+	return "", false
 }
 
 // AttributeValuePrimaryKey returns the DynamoDB key for the episode.
@@ -58,9 +160,16 @@ func (e Episode) AttributeValuePrimaryKey() map[string]ddbtypes.AttributeValue {
 
 // ListEpisodeItem provides a type for public fields when listing episodes.
 type ListEpisodeItem struct {
-	ID      string `json:"id" dynamodbav:"id"`
-	Title   string `json:"title" dynamodbav:"title"`
-	Podcast string `json:"podcast" dynamodbav:"podcast"`
+	ID              string        `json:"id" dynamodbav:"id"`
+	Title           string        `json:"title" dynamodbav:"title"`
+	Podcast         string        `json:"podcast" dynamodbav:"podcast"`
+	Status          EpisodeStatus `json:"status" dynamodbav:"status"`
+	PublishedDate   string        `json:"published" dynamodbav:"published"`
+	PublishedAt     string        `json:"published_at,omitempty" dynamodbav:"published_at"`
+	ImageURL        string        `json:"image_url,omitempty" dynamodbav:"image_url"`
+	EpisodeNumber   int           `json:"episode_number,omitempty" dynamodbav:"episode_number"`
+	SeasonNumber    int           `json:"season_number,omitempty" dynamodbav:"season_number"`
+	DurationSeconds int64         `json:"duration_seconds,omitempty" dynamodbav:"duration_seconds"`
 }
 
 // ListEpisodesProjection returns a DynamoDB expression Projection builder
@@ -70,16 +179,45 @@ func ListEpisodesProjection() ddbexp.ProjectionBuilder {
 		ddbexp.Name("id"),
 		ddbexp.Name("title"),
 		ddbexp.Name("podcast"),
+		ddbexp.Name("status"),
+		ddbexp.Name("published"),
+		ddbexp.Name("published_at"),
+		ddbexp.Name("image_url"),
+		ddbexp.Name("episode_number"),
+		ddbexp.Name("season_number"),
+		ddbexp.Name("duration_seconds"),
 	)
 }
 
 // DescribeEpisode provides a type for public fields of an Episode.
 type DescribeEpisode struct {
-	ID          string        `json:"id" dynamodbav:"id"`
-	Title       string        `json:"title" dynamodbav:"title"`
-	Description string        `json:"description" dynamodbav:"description"`
-	Podcast     string        `json:"podcast" dynamodbav:"podcast"`
-	Status      EpisodeStatus `json:"status" dynamodbav:"status"`
+	ID              string        `json:"id" dynamodbav:"id"`
+	Title           string        `json:"title" dynamodbav:"title"`
+	Description     string        `json:"description" dynamodbav:"description"`
+	Podcast         string        `json:"podcast" dynamodbav:"podcast"`
+	Status          EpisodeStatus `json:"status" dynamodbav:"status"`
+	FailureReason   string        `json:"failure_reason,omitempty" dynamodbav:"failure_reason"`
+	PublishedDate   string        `json:"published,omitempty" dynamodbav:"published"`
+	Author          string        `json:"author,omitempty" dynamodbav:"author"`
+	Language        string        `json:"language,omitempty" dynamodbav:"language"`
+	Categories      []string      `json:"categories,omitempty" dynamodbav:"categories"`
+	ImageURL        string        `json:"image_url,omitempty" dynamodbav:"image_url"`
+	EpisodeNumber   int           `json:"episode_number,omitempty" dynamodbav:"episode_number"`
+	SeasonNumber    int           `json:"season_number,omitempty" dynamodbav:"season_number"`
+	DurationSeconds int64         `json:"duration_seconds,omitempty" dynamodbav:"duration_seconds"`
+	Explicit        bool          `json:"explicit,omitempty" dynamodbav:"explicit"`
+	Transcripts     []Transcript  `json:"transcripts,omitempty" dynamodbav:"transcripts"`
+	ChaptersURL     string        `json:"chapters_url,omitempty" dynamodbav:"chapters_url"`
+	ImportAttempt   int           `json:"import_attempt,omitempty" dynamodbav:"import_attempt"`
+
+	MediaDurationSeconds float64   `json:"media_duration_seconds,omitempty" dynamodbav:"media_duration_seconds"`
+	MediaBitrate         int       `json:"media_bitrate,omitempty" dynamodbav:"media_bitrate"`
+	MediaSampleRate      int       `json:"media_sample_rate,omitempty" dynamodbav:"media_sample_rate"`
+	MediaChannels        int       `json:"media_channels,omitempty" dynamodbav:"media_channels"`
+	MediaTitle           string    `json:"media_title,omitempty" dynamodbav:"media_title"`
+	MediaArtist          string    `json:"media_artist,omitempty" dynamodbav:"media_artist"`
+	MediaChapters        []Chapter `json:"media_chapters,omitempty" dynamodbav:"media_chapters"`
+	MediaArtworkKey      string    `json:"media_artwork_key,omitempty" dynamodbav:"media_artwork_key"`
 }
 
 // DescribeEpisodeProjection returns a DynamoDB expression Projection builder
@@ -91,6 +229,27 @@ func DescribeEpisodeProjection() ddbexp.ProjectionBuilder {
 		ddbexp.Name("description"),
 		ddbexp.Name("podcast"),
 		ddbexp.Name("status"),
+		ddbexp.Name("failure_reason"),
+		ddbexp.Name("published"),
+		ddbexp.Name("author"),
+		ddbexp.Name("language"),
+		ddbexp.Name("categories"),
+		ddbexp.Name("image_url"),
+		ddbexp.Name("episode_number"),
+		ddbexp.Name("season_number"),
+		ddbexp.Name("duration_seconds"),
+		ddbexp.Name("explicit"),
+		ddbexp.Name("transcripts"),
+		ddbexp.Name("chapters_url"),
+		ddbexp.Name("import_attempt"),
+		ddbexp.Name("media_duration_seconds"),
+		ddbexp.Name("media_bitrate"),
+		ddbexp.Name("media_sample_rate"),
+		ddbexp.Name("media_channels"),
+		ddbexp.Name("media_title"),
+		ddbexp.Name("media_artist"),
+		ddbexp.Name("media_chapters"),
+		ddbexp.Name("media_artwork_key"),
 	)
 }
 
@@ -114,7 +273,7 @@ func (e *EpisodeStatus) UnmarshalJSON(b []byte) error {
 	if err != nil {
 		return fmt.Errorf("failed to unquote EpisodeStatus, %w", err)
 	}
-	ee, err := parseEpisodeStatus(v)
+	ee, err := ParseEpisodeStatus(v)
 	if err != nil {
 		return err
 	}
@@ -130,7 +289,7 @@ func (e *EpisodeStatus) UnmarshalDynamoDBAttributeValue(av ddbtypes.AttributeVal
 		return fmt.Errorf("expect string attribute value for episode status, got %T, %v", av, av)
 	}
 
-	ee, err := parseEpisodeStatus(avS.Value)
+	ee, err := ParseEpisodeStatus(avS.Value)
 	if err != nil {
 		return err
 	}
@@ -141,7 +300,9 @@ func (e EpisodeStatus) MarshalDynamoDBAttributeValue() (ddbtypes.AttributeValue,
 	return &ddbtypes.AttributeValueMemberS{Value: e.String()}, nil
 }
 
-func parseEpisodeStatus(v string) (EpisodeStatus, error) {
+// ParseEpisodeStatus returns the EpisodeStatus of the value. Returns
+// EpisodeStatusUnknown if the value is not a known status.
+func ParseEpisodeStatus(v string) (EpisodeStatus, error) {
 	switch EpisodeStatus(v) {
 	case EpisodeStatusPending:
 		return EpisodeStatusPending, nil
@@ -170,6 +331,10 @@ func MakeEpisodeRawMediaPath(prefix, episodeID string) string {
 	return makeEpisodePrefixPath(prefix, episodeID) + "raw-media"
 }
 
+func MakeEpisodeArtworkPath(prefix, episodeID string) string {
+	return makeEpisodePrefixPath(prefix, episodeID) + "artwork"
+}
+
 func MakeEpisodeTranscribeMetadataPath(prefix, episodeID string) string {
 	return makeEpisodePrefixPath(prefix, episodeID) + "transcribe-metadata.json"
 }
@@ -0,0 +1,64 @@
+package workshop_test
+
+import (
+	"testing"
+
+	workshop "aws-workshop"
+)
+
+func TestFormatPublishedAt(t *testing.T) {
+	cases := map[string]struct {
+		Published string
+		Expect    string
+		ExpectOK  bool
+	}{
+		"rfc 1123 numeric offset": {
+			Published: "Wed, 13 Oct 2021 19:32:37 -0400",
+			Expect:    "2021-10-13T23:32:37Z",
+			ExpectOK:  true,
+		},
+		"gmt": {
+			Published: "Wed, 13 Oct 2021 19:32:37 GMT",
+			Expect:    "2021-10-13T19:32:37Z",
+			ExpectOK:  true,
+		},
+		"est": {
+			Published: "Wed, 13 Oct 2021 19:32:37 EST",
+			Expect:    "2021-10-14T00:32:37Z",
+			ExpectOK:  true,
+		},
+		"pdt without seconds": {
+			Published: "Wed, 3 Nov 2021 09:15 PDT",
+			Expect:    "2021-11-03T16:15:00Z",
+			ExpectOK:  true,
+		},
+		"rfc 822 cst": {
+			Published: "13 Oct 21 19:32 CST",
+			Expect:    "2021-10-14T01:32:00Z",
+			ExpectOK:  true,
+		},
+		"rfc 3339": {
+			Published: " 2021-10-13T19:32:37+02:00 ",
+			Expect:    "2021-10-13T17:32:37Z",
+			ExpectOK:  true,
+		},
+		"unknown zone": {
+			Published: "Wed, 13 Oct 2021 19:32:37 AEST",
+		},
+		"unknown format": {
+			Published: "October 13th, 2021",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			actual, ok := workshop.FormatPublishedAt(c.Published)
+			if e, a := c.ExpectOK, ok; e != a {
+				t.Fatalf("expect ok %v, got %v", e, a)
+			}
+			if e, a := c.Expect, actual; e != a {
+				t.Errorf("expect %v, got %v", e, a)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	workshop "aws-workshop"
+	"aws-workshop/handlers/exportpodcasts"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+func main() {
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		log.Fatalf("failed to load config, %v", err)
+	}
+
+	envCfg := workshop.LoadEnvConfig()
+	handler := &exportpodcasts.Handler{
+		DDBClient:        ddb.NewFromConfig(cfg),
+		EpisodeTableName: envCfg.PodcastEpisodeTableName,
+	}
+
+	lambda.Start(handler.Handle)
+}
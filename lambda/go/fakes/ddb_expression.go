@@ -0,0 +1,1367 @@
+package fakes
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// exprAttributes are the expression attribute names and values placeholders
+// in an expression are resolved with.
+type exprAttributes struct {
+	names  map[string]string
+	values map[string]ddbtypes.AttributeValue
+}
+
+// parseConditionExpression parses a condition, filter, or key condition
+// expression.
+func parseConditionExpression(expr string, attrs exprAttributes) (exprCondition, error) {
+	p, err := newExprParser(expr, attrs)
+	if err != nil {
+		return nil, err
+	}
+	cond, err := p.parseCondition()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectEOF(); err != nil {
+		return nil, err
+	}
+	return cond, nil
+}
+
+// parseProjectionExpression parses a projection expression into the list of
+// document paths it selects.
+func parseProjectionExpression(expr string, attrs exprAttributes) ([]attrPath, error) {
+	p, err := newExprParser(expr, attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []attrPath
+	for {
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+		if !p.acceptPunct(",") {
+			break
+		}
+	}
+	if err := p.expectEOF(); err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+// parseUpdateExpression parses an update expression into the list of actions
+// to apply to an item.
+func parseUpdateExpression(expr string, attrs exprAttributes) ([]updateAction, error) {
+	p, err := newExprParser(expr, attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	var actions []updateAction
+	for p.peek().kind != tokenEOF {
+		t := p.next()
+		kind := strings.ToUpper(t.text)
+		if t.kind != tokenIdent ||
+			(kind != "SET" && kind != "REMOVE" && kind != "ADD" && kind != "DELETE") {
+			return nil, newValidationError("Invalid UpdateExpression: Syntax error; token: %q", t.text)
+		}
+
+		for {
+			action := updateAction{kind: kind}
+			if action.path, err = p.parsePath(); err != nil {
+				return nil, err
+			}
+
+			switch kind {
+			case "SET":
+				if err := p.expectPunct("="); err != nil {
+					return nil, err
+				}
+				if action.value, err = p.parseSetValue(); err != nil {
+					return nil, err
+				}
+			case "ADD", "DELETE":
+				if action.value, err = p.parseOperand(); err != nil {
+					return nil, err
+				}
+			}
+			actions = append(actions, action)
+
+			if !p.acceptPunct(",") {
+				break
+			}
+		}
+	}
+	if len(actions) == 0 {
+		return nil, newValidationError("Invalid UpdateExpression: The expression can not be empty")
+	}
+	return actions, nil
+}
+
+//------------------------------
+// Tokenizer
+//------------------------------
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenName
+	tokenValue
+	tokenNumber
+	tokenPunct
+)
+
+type exprToken struct {
+	kind tokenKind
+	text string
+}
+
+func tokenizeExpression(expr string) ([]exprToken, error) {
+	var tokens []exprToken
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '#' || c == ':':
+			j := i + 1
+			for j < len(expr) && isIdentChar(expr[j]) {
+				j++
+			}
+			if j == i+1 {
+				return nil, newValidationError("Invalid expression: Syntax error; token: %q", string(c))
+			}
+			kind := tokenName
+			if c == ':' {
+				kind = tokenValue
+			}
+			tokens = append(tokens, exprToken{kind: kind, text: expr[i:j]})
+			i = j
+
+		case c >= '0' && c <= '9':
+			j := i + 1
+			for j < len(expr) && expr[j] >= '0' && expr[j] <= '9' {
+				j++
+			}
+			tokens = append(tokens, exprToken{kind: tokenNumber, text: expr[i:j]})
+			i = j
+
+		case isIdentChar(c):
+			j := i + 1
+			for j < len(expr) && isIdentChar(expr[j]) {
+				j++
+			}
+			tokens = append(tokens, exprToken{kind: tokenIdent, text: expr[i:j]})
+			i = j
+
+		case strings.HasPrefix(expr[i:], "<>"),
+			strings.HasPrefix(expr[i:], "<="),
+			strings.HasPrefix(expr[i:], ">="):
+			tokens = append(tokens, exprToken{kind: tokenPunct, text: expr[i : i+2]})
+			i += 2
+
+		case strings.IndexByte("()[],.=<>+-", c) != -1:
+			tokens = append(tokens, exprToken{kind: tokenPunct, text: expr[i : i+1]})
+			i++
+
+		default:
+			return nil, newValidationError("Invalid expression: Syntax error; token: %q", string(c))
+		}
+	}
+
+	return append(tokens, exprToken{kind: tokenEOF}), nil
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+//------------------------------
+// Parser
+//------------------------------
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+	attrs  exprAttributes
+}
+
+func newExprParser(expr string, attrs exprAttributes) (*exprParser, error) {
+	tokens, err := tokenizeExpression(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &exprParser{tokens: tokens, attrs: attrs}, nil
+}
+
+func (p *exprParser) peek() exprToken { return p.tokens[p.pos] }
+func (p *exprParser) peekN(n int) exprToken {
+	if p.pos+n >= len(p.tokens) {
+		return exprToken{kind: tokenEOF}
+	}
+	return p.tokens[p.pos+n]
+}
+
+func (p *exprParser) next() exprToken {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *exprParser) acceptPunct(v string) bool {
+	if t := p.peek(); t.kind == tokenPunct && t.text == v {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) expectPunct(v string) error {
+	if !p.acceptPunct(v) {
+		return p.syntaxError()
+	}
+	return nil
+}
+
+func (p *exprParser) acceptKeyword(v string) bool {
+	if t := p.peek(); t.kind == tokenIdent && strings.EqualFold(t.text, v) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) expectEOF() error {
+	if p.peek().kind != tokenEOF {
+		return p.syntaxError()
+	}
+	return nil
+}
+
+func (p *exprParser) syntaxError() error {
+	t := p.peek()
+	if t.kind == tokenEOF {
+		return newValidationError("Invalid expression: Syntax error; token: <EOF>")
+	}
+	return newValidationError("Invalid expression: Syntax error; token: %q", t.text)
+}
+
+func (p *exprParser) parseCondition() (exprCondition, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orCondition{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprCondition, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andCondition{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseNot() (exprCondition, error) {
+	if p.acceptKeyword("NOT") {
+		cond, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notCondition{cond: cond}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (exprCondition, error) {
+	if p.acceptPunct("(") {
+		cond, err := p.parseCondition()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct(")"); err != nil {
+			return nil, err
+		}
+		return cond, nil
+	}
+
+	if t := p.peek(); t.kind == tokenIdent && isPunct(p.peekN(1), "(") {
+		switch fn := strings.ToLower(t.text); fn {
+		case "attribute_exists", "attribute_not_exists", "attribute_type", "begins_with", "contains":
+			p.next()
+			return p.parseFunctionCondition(fn)
+		}
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	t := p.peek()
+	switch {
+	case t.kind == tokenPunct && isComparator(t.text):
+		p.next()
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return compareCondition{op: t.text, left: left, right: right}, nil
+
+	case p.acceptKeyword("BETWEEN"):
+		low, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if !p.acceptKeyword("AND") {
+			return nil, p.syntaxError()
+		}
+		high, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return betweenCondition{value: left, low: low, high: high}, nil
+
+	case p.acceptKeyword("IN"):
+		if err := p.expectPunct("("); err != nil {
+			return nil, err
+		}
+		cond := inCondition{value: left}
+		for {
+			v, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			cond.list = append(cond.list, v)
+			if !p.acceptPunct(",") {
+				break
+			}
+		}
+		if err := p.expectPunct(")"); err != nil {
+			return nil, err
+		}
+		return cond, nil
+
+	default:
+		return nil, p.syntaxError()
+	}
+}
+
+func (p *exprParser) parseFunctionCondition(fn string) (exprCondition, error) {
+	if err := p.expectPunct("("); err != nil {
+		return nil, err
+	}
+	path, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+
+	cond := functionCondition{fn: fn, path: path}
+	if fn != "attribute_exists" && fn != "attribute_not_exists" {
+		if err := p.expectPunct(","); err != nil {
+			return nil, err
+		}
+		if cond.arg, err = p.parseOperand(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectPunct(")"); err != nil {
+		return nil, err
+	}
+	return cond, nil
+}
+
+// parseOperand parses a document path, value placeholder, or size function.
+func (p *exprParser) parseOperand() (exprOperand, error) {
+	t := p.peek()
+	switch {
+	case t.kind == tokenValue:
+		p.next()
+		v, ok := p.attrs.values[t.text]
+		if !ok {
+			return nil, newValidationError(
+				"An expression attribute value used in expression is not defined; attribute value: %v", t.text)
+		}
+		return valueOperand{value: v}, nil
+
+	case t.kind == tokenIdent && strings.EqualFold(t.text, "size") && isPunct(p.peekN(1), "("):
+		p.next()
+		p.next()
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct(")"); err != nil {
+			return nil, err
+		}
+		return sizeOperand{path: path}, nil
+
+	default:
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		return pathOperand{path: path}, nil
+	}
+}
+
+// parseSetValue parses the value of an update expression SET action.
+func (p *exprParser) parseSetValue() (exprOperand, error) {
+	left, err := p.parseSetOperand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var minus bool
+		switch {
+		case p.acceptPunct("+"):
+		case p.acceptPunct("-"):
+			minus = true
+		default:
+			return left, nil
+		}
+		right, err := p.parseSetOperand()
+		if err != nil {
+			return nil, err
+		}
+		left = arithmeticOperand{left: left, right: right, minus: minus}
+	}
+}
+
+func (p *exprParser) parseSetOperand() (exprOperand, error) {
+	t := p.peek()
+	if t.kind != tokenIdent || !isPunct(p.peekN(1), "(") {
+		return p.parseOperand()
+	}
+
+	switch fn := strings.ToLower(t.text); fn {
+	case "if_not_exists":
+		p.next()
+		p.next()
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct(","); err != nil {
+			return nil, err
+		}
+		fallback, err := p.parseSetValue()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct(")"); err != nil {
+			return nil, err
+		}
+		return ifNotExistsOperand{path: path, fallback: fallback}, nil
+
+	case "list_append":
+		p.next()
+		p.next()
+		left, err := p.parseSetValue()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct(","); err != nil {
+			return nil, err
+		}
+		right, err := p.parseSetValue()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct(")"); err != nil {
+			return nil, err
+		}
+		return listAppendOperand{left: left, right: right}, nil
+
+	default:
+		return p.parseOperand()
+	}
+}
+
+func (p *exprParser) parsePath() (attrPath, error) {
+	name, err := p.parsePathName()
+	if err != nil {
+		return nil, err
+	}
+	path := attrPath{{name: name}}
+
+	for {
+		switch {
+		case p.acceptPunct("."):
+			name, err := p.parsePathName()
+			if err != nil {
+				return nil, err
+			}
+			path = append(path, pathElement{name: name})
+
+		case p.acceptPunct("["):
+			t := p.next()
+			if t.kind != tokenNumber {
+				return nil, newValidationError("Invalid expression: Syntax error; token: %q", t.text)
+			}
+			index, err := strconv.Atoi(t.text)
+			if err != nil {
+				return nil, newValidationError("Invalid expression: list index %q is invalid", t.text)
+			}
+			if err := p.expectPunct("]"); err != nil {
+				return nil, err
+			}
+			path = append(path, pathElement{index: index, isIndex: true})
+
+		default:
+			return path, nil
+		}
+	}
+}
+
+func (p *exprParser) parsePathName() (string, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenName:
+		name, ok := p.attrs.names[t.text]
+		if !ok {
+			return "", newValidationError(
+				"An expression attribute name used in the document path is not defined; attribute name: %v", t.text)
+		}
+		return name, nil
+	case tokenIdent:
+		return t.text, nil
+	default:
+		p.pos--
+		return "", p.syntaxError()
+	}
+}
+
+func isPunct(t exprToken, v string) bool {
+	return t.kind == tokenPunct && t.text == v
+}
+
+func isComparator(v string) bool {
+	switch v {
+	case "=", "<>", "<", "<=", ">", ">=":
+		return true
+	default:
+		return false
+	}
+}
+
+//------------------------------
+// Document paths
+//------------------------------
+
+type pathElement struct {
+	name    string
+	index   int
+	isIndex bool
+}
+
+// attrPath is a document path to an attribute within an item.
+type attrPath []pathElement
+
+func (p attrPath) String() string {
+	var sb strings.Builder
+	for i, e := range p {
+		if e.isIndex {
+			fmt.Fprintf(&sb, "[%d]", e.index)
+			continue
+		}
+		if i != 0 {
+			sb.WriteString(".")
+		}
+		sb.WriteString(e.name)
+	}
+	return sb.String()
+}
+
+// getPath returns the value at the path within the item, or nil if no value
+// exists at that path.
+func getPath(item map[string]ddbtypes.AttributeValue, path attrPath) ddbtypes.AttributeValue {
+	var current ddbtypes.AttributeValue = &ddbtypes.AttributeValueMemberM{Value: item}
+	for _, e := range path {
+		switch v := current.(type) {
+		case *ddbtypes.AttributeValueMemberM:
+			if e.isIndex {
+				return nil
+			}
+			next, ok := v.Value[e.name]
+			if !ok {
+				return nil
+			}
+			current = next
+
+		case *ddbtypes.AttributeValueMemberL:
+			if !e.isIndex || e.index >= len(v.Value) {
+				return nil
+			}
+			current = v.Value[e.index]
+
+		default:
+			return nil
+		}
+	}
+	return current
+}
+
+// setPath sets the value at the path within the item. The parent of the path
+// must already exist.
+func setPath(item map[string]ddbtypes.AttributeValue, path attrPath, value ddbtypes.AttributeValue) error {
+	parent := getPath(item, path[:len(path)-1])
+	last := path[len(path)-1]
+
+	switch v := parent.(type) {
+	case *ddbtypes.AttributeValueMemberM:
+		if !last.isIndex {
+			v.Value[last.name] = value
+			return nil
+		}
+	case *ddbtypes.AttributeValueMemberL:
+		if last.isIndex {
+			if last.index >= len(v.Value) {
+				v.Value = append(v.Value, value)
+			} else {
+				v.Value[last.index] = value
+			}
+			return nil
+		}
+	}
+	return newValidationError("The document path provided in the update expression is invalid for update, %v", path)
+}
+
+// removePath removes the value at the path within the item, if it exists.
+func removePath(item map[string]ddbtypes.AttributeValue, path attrPath) {
+	parent := getPath(item, path[:len(path)-1])
+	last := path[len(path)-1]
+
+	switch v := parent.(type) {
+	case *ddbtypes.AttributeValueMemberM:
+		if !last.isIndex {
+			delete(v.Value, last.name)
+		}
+	case *ddbtypes.AttributeValueMemberL:
+		if last.isIndex && last.index < len(v.Value) {
+			v.Value = append(v.Value[:last.index], v.Value[last.index+1:]...)
+		}
+	}
+}
+
+// projectItem returns a copy of the item containing only the attributes
+// selected by the projection paths. If paths is empty the whole item is
+// returned.
+func projectItem(item map[string]ddbtypes.AttributeValue, paths []attrPath) map[string]ddbtypes.AttributeValue {
+	if len(paths) == 0 {
+		return copyItem(item)
+	}
+
+	var projected ddbtypes.AttributeValue = &ddbtypes.AttributeValueMemberM{
+		Value: map[string]ddbtypes.AttributeValue{},
+	}
+	for _, path := range paths {
+		v := getPath(item, path)
+		if v == nil {
+			continue
+		}
+		projected = mergeProjected(projected, path, copyAttributeValue(v))
+	}
+	return projected.(*ddbtypes.AttributeValueMemberM).Value
+}
+
+func mergeProjected(dst ddbtypes.AttributeValue, path attrPath, v ddbtypes.AttributeValue) ddbtypes.AttributeValue {
+	if len(path) == 0 {
+		return v
+	}
+
+	e := path[0]
+	if e.isIndex {
+		l, ok := dst.(*ddbtypes.AttributeValueMemberL)
+		if !ok {
+			l = &ddbtypes.AttributeValueMemberL{}
+		}
+		l.Value = append(l.Value, mergeProjected(nil, path[1:], v))
+		return l
+	}
+
+	m, ok := dst.(*ddbtypes.AttributeValueMemberM)
+	if !ok {
+		m = &ddbtypes.AttributeValueMemberM{Value: map[string]ddbtypes.AttributeValue{}}
+	}
+	m.Value[e.name] = mergeProjected(m.Value[e.name], path[1:], v)
+	return m
+}
+
+//------------------------------
+// Operands
+//------------------------------
+
+// exprOperand is a value within an expression resolved against an item. A nil
+// value is returned if the operand refers to an attribute that does not exist.
+type exprOperand interface {
+	evaluate(item map[string]ddbtypes.AttributeValue) (ddbtypes.AttributeValue, error)
+}
+
+type valueOperand struct {
+	value ddbtypes.AttributeValue
+}
+
+func (o valueOperand) evaluate(map[string]ddbtypes.AttributeValue) (ddbtypes.AttributeValue, error) {
+	return o.value, nil
+}
+
+type pathOperand struct {
+	path attrPath
+}
+
+func (o pathOperand) evaluate(item map[string]ddbtypes.AttributeValue) (ddbtypes.AttributeValue, error) {
+	return getPath(item, o.path), nil
+}
+
+type sizeOperand struct {
+	path attrPath
+}
+
+func (o sizeOperand) evaluate(item map[string]ddbtypes.AttributeValue) (ddbtypes.AttributeValue, error) {
+	var size int
+	switch v := getPath(item, o.path).(type) {
+	case *ddbtypes.AttributeValueMemberS:
+		size = utf8.RuneCountInString(v.Value)
+	case *ddbtypes.AttributeValueMemberB:
+		size = len(v.Value)
+	case *ddbtypes.AttributeValueMemberSS:
+		size = len(v.Value)
+	case *ddbtypes.AttributeValueMemberNS:
+		size = len(v.Value)
+	case *ddbtypes.AttributeValueMemberBS:
+		size = len(v.Value)
+	case *ddbtypes.AttributeValueMemberL:
+		size = len(v.Value)
+	case *ddbtypes.AttributeValueMemberM:
+		size = len(v.Value)
+	default:
+		return nil, nil
+	}
+	return &ddbtypes.AttributeValueMemberN{Value: strconv.Itoa(size)}, nil
+}
+
+type arithmeticOperand struct {
+	left, right exprOperand
+	minus       bool
+}
+
+func (o arithmeticOperand) evaluate(item map[string]ddbtypes.AttributeValue) (ddbtypes.AttributeValue, error) {
+	left, err := evaluateRequired(o.left, item)
+	if err != nil {
+		return nil, err
+	}
+	right, err := evaluateRequired(o.right, item)
+	if err != nil {
+		return nil, err
+	}
+
+	a, aOK := parseNumberValue(left)
+	b, bOK := parseNumberValue(right)
+	if !aOK || !bOK {
+		return nil, newValidationError("An operand in the update expression has an incorrect data type")
+	}
+	if o.minus {
+		return formatNumber(new(big.Float).Sub(a, b)), nil
+	}
+	return formatNumber(new(big.Float).Add(a, b)), nil
+}
+
+type ifNotExistsOperand struct {
+	path     attrPath
+	fallback exprOperand
+}
+
+func (o ifNotExistsOperand) evaluate(item map[string]ddbtypes.AttributeValue) (ddbtypes.AttributeValue, error) {
+	if v := getPath(item, o.path); v != nil {
+		return v, nil
+	}
+	return evaluateRequired(o.fallback, item)
+}
+
+type listAppendOperand struct {
+	left, right exprOperand
+}
+
+func (o listAppendOperand) evaluate(item map[string]ddbtypes.AttributeValue) (ddbtypes.AttributeValue, error) {
+	left, err := evaluateRequired(o.left, item)
+	if err != nil {
+		return nil, err
+	}
+	right, err := evaluateRequired(o.right, item)
+	if err != nil {
+		return nil, err
+	}
+
+	a, aOK := left.(*ddbtypes.AttributeValueMemberL)
+	b, bOK := right.(*ddbtypes.AttributeValueMemberL)
+	if !aOK || !bOK {
+		return nil, newValidationError("An operand in the update expression has an incorrect data type")
+	}
+
+	list := make([]ddbtypes.AttributeValue, 0, len(a.Value)+len(b.Value))
+	list = append(list, a.Value...)
+	list = append(list, b.Value...)
+	return &ddbtypes.AttributeValueMemberL{Value: list}, nil
+}
+
+func evaluateRequired(o exprOperand, item map[string]ddbtypes.AttributeValue) (ddbtypes.AttributeValue, error) {
+	v, err := o.evaluate(item)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, newValidationError(
+			"The provided expression refers to an attribute that does not exist in the item")
+	}
+	return v, nil
+}
+
+//------------------------------
+// Conditions
+//------------------------------
+
+// exprCondition is a condition, filter, or key condition expression matched
+// against an item.
+type exprCondition interface {
+	match(item map[string]ddbtypes.AttributeValue) bool
+}
+
+type andCondition struct{ left, right exprCondition }
+
+func (c andCondition) match(item map[string]ddbtypes.AttributeValue) bool {
+	return c.left.match(item) && c.right.match(item)
+}
+
+type orCondition struct{ left, right exprCondition }
+
+func (c orCondition) match(item map[string]ddbtypes.AttributeValue) bool {
+	return c.left.match(item) || c.right.match(item)
+}
+
+type notCondition struct{ cond exprCondition }
+
+func (c notCondition) match(item map[string]ddbtypes.AttributeValue) bool {
+	return !c.cond.match(item)
+}
+
+type compareCondition struct {
+	op          string
+	left, right exprOperand
+}
+
+func (c compareCondition) match(item map[string]ddbtypes.AttributeValue) bool {
+	left, _ := c.left.evaluate(item)
+	right, _ := c.right.evaluate(item)
+	if left == nil || right == nil {
+		return false
+	}
+
+	switch c.op {
+	case "=":
+		return attributeValuesEqual(left, right)
+	case "<>":
+		return !attributeValuesEqual(left, right)
+	}
+
+	cmp, ok := compareAttributeValues(left, right)
+	if !ok {
+		return false
+	}
+	switch c.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	default:
+		return false
+	}
+}
+
+type betweenCondition struct {
+	value, low, high exprOperand
+}
+
+func (c betweenCondition) match(item map[string]ddbtypes.AttributeValue) bool {
+	v, _ := c.value.evaluate(item)
+	low, _ := c.low.evaluate(item)
+	high, _ := c.high.evaluate(item)
+	if v == nil || low == nil || high == nil {
+		return false
+	}
+
+	lowCmp, ok := compareAttributeValues(v, low)
+	if !ok {
+		return false
+	}
+	highCmp, ok := compareAttributeValues(v, high)
+	if !ok {
+		return false
+	}
+	return lowCmp >= 0 && highCmp <= 0
+}
+
+type inCondition struct {
+	value exprOperand
+	list  []exprOperand
+}
+
+func (c inCondition) match(item map[string]ddbtypes.AttributeValue) bool {
+	v, _ := c.value.evaluate(item)
+	if v == nil {
+		return false
+	}
+	for _, o := range c.list {
+		if other, _ := o.evaluate(item); other != nil && attributeValuesEqual(v, other) {
+			return true
+		}
+	}
+	return false
+}
+
+type functionCondition struct {
+	fn   string
+	path attrPath
+	arg  exprOperand
+}
+
+func (c functionCondition) match(item map[string]ddbtypes.AttributeValue) bool {
+	v := getPath(item, c.path)
+	switch c.fn {
+	case "attribute_exists":
+		return v != nil
+	case "attribute_not_exists":
+		return v == nil
+	}
+	if v == nil {
+		return false
+	}
+
+	arg, _ := c.arg.evaluate(item)
+	if arg == nil {
+		return false
+	}
+
+	switch c.fn {
+	case "attribute_type":
+		t, ok := arg.(*ddbtypes.AttributeValueMemberS)
+		return ok && attributeValueType(v) == t.Value
+
+	case "begins_with":
+		switch v := v.(type) {
+		case *ddbtypes.AttributeValueMemberS:
+			prefix, ok := arg.(*ddbtypes.AttributeValueMemberS)
+			return ok && strings.HasPrefix(v.Value, prefix.Value)
+		case *ddbtypes.AttributeValueMemberB:
+			prefix, ok := arg.(*ddbtypes.AttributeValueMemberB)
+			return ok && bytes.HasPrefix(v.Value, prefix.Value)
+		}
+		return false
+
+	case "contains":
+		switch v := v.(type) {
+		case *ddbtypes.AttributeValueMemberS:
+			sub, ok := arg.(*ddbtypes.AttributeValueMemberS)
+			return ok && strings.Contains(v.Value, sub.Value)
+		case *ddbtypes.AttributeValueMemberSS, *ddbtypes.AttributeValueMemberNS,
+			*ddbtypes.AttributeValueMemberBS:
+			for _, member := range setMembers(v) {
+				if attributeValuesEqual(member, arg) {
+					return true
+				}
+			}
+		case *ddbtypes.AttributeValueMemberL:
+			for _, member := range v.Value {
+				if attributeValuesEqual(member, arg) {
+					return true
+				}
+			}
+		}
+		return false
+
+	default:
+		return false
+	}
+}
+
+//------------------------------
+// Update actions
+//------------------------------
+
+type updateAction struct {
+	kind  string
+	path  attrPath
+	value exprOperand
+}
+
+// applyUpdateActions returns a copy of the item with the update actions
+// applied. All operands are evaluated against the item as it was before the
+// update.
+func applyUpdateActions(item map[string]ddbtypes.AttributeValue, actions []updateAction) (
+	map[string]ddbtypes.AttributeValue, error,
+) {
+	values := make([]ddbtypes.AttributeValue, len(actions))
+	for i, action := range actions {
+		if action.value == nil {
+			continue
+		}
+		v, err := evaluateRequired(action.value, item)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = copyAttributeValue(v)
+	}
+
+	updated := copyItem(item)
+	for i, action := range actions {
+		switch action.kind {
+		case "SET":
+			if err := setPath(updated, action.path, values[i]); err != nil {
+				return nil, err
+			}
+
+		case "REMOVE":
+			removePath(updated, action.path)
+
+		case "ADD":
+			v, err := addAttributeValues(getPath(updated, action.path), values[i])
+			if err != nil {
+				return nil, err
+			}
+			if err := setPath(updated, action.path, v); err != nil {
+				return nil, err
+			}
+
+		case "DELETE":
+			current := getPath(updated, action.path)
+			if current == nil {
+				continue
+			}
+			v, err := deleteSetMembers(current, values[i])
+			if err != nil {
+				return nil, err
+			}
+			if v == nil {
+				removePath(updated, action.path)
+			} else if err := setPath(updated, action.path, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return updated, nil
+}
+
+func addAttributeValues(current, v ddbtypes.AttributeValue) (ddbtypes.AttributeValue, error) {
+	if current == nil {
+		switch v.(type) {
+		case *ddbtypes.AttributeValueMemberN, *ddbtypes.AttributeValueMemberSS,
+			*ddbtypes.AttributeValueMemberNS, *ddbtypes.AttributeValueMemberBS:
+			return v, nil
+		}
+		return nil, newValidationError("An operand in the update expression has an incorrect data type")
+	}
+
+	if a, ok := parseNumberValue(current); ok {
+		b, ok := parseNumberValue(v)
+		if !ok {
+			return nil, newValidationError("An operand in the update expression has an incorrect data type")
+		}
+		return formatNumber(new(big.Float).Add(a, b)), nil
+	}
+
+	if attributeValueType(current) != attributeValueType(v) {
+		return nil, newValidationError("An operand in the update expression has an incorrect data type")
+	}
+	members := setMembers(current)
+	for _, m := range setMembers(v) {
+		if !containsAttributeValue(members, m) {
+			members = append(members, m)
+		}
+	}
+	return makeSet(current, members), nil
+}
+
+func deleteSetMembers(current, v ddbtypes.AttributeValue) (ddbtypes.AttributeValue, error) {
+	if attributeValueType(current) != attributeValueType(v) || setMembers(current) == nil {
+		return nil, newValidationError("An operand in the update expression has an incorrect data type")
+	}
+
+	remove := setMembers(v)
+	var members []ddbtypes.AttributeValue
+	for _, m := range setMembers(current) {
+		if !containsAttributeValue(remove, m) {
+			members = append(members, m)
+		}
+	}
+	if len(members) == 0 {
+		return nil, nil
+	}
+	return makeSet(current, members), nil
+}
+
+//------------------------------
+// Attribute values
+//------------------------------
+
+func attributeValueType(v ddbtypes.AttributeValue) string {
+	switch v.(type) {
+	case *ddbtypes.AttributeValueMemberS:
+		return "S"
+	case *ddbtypes.AttributeValueMemberN:
+		return "N"
+	case *ddbtypes.AttributeValueMemberB:
+		return "B"
+	case *ddbtypes.AttributeValueMemberBOOL:
+		return "BOOL"
+	case *ddbtypes.AttributeValueMemberNULL:
+		return "NULL"
+	case *ddbtypes.AttributeValueMemberSS:
+		return "SS"
+	case *ddbtypes.AttributeValueMemberNS:
+		return "NS"
+	case *ddbtypes.AttributeValueMemberBS:
+		return "BS"
+	case *ddbtypes.AttributeValueMemberL:
+		return "L"
+	case *ddbtypes.AttributeValueMemberM:
+		return "M"
+	default:
+		return ""
+	}
+}
+
+func attributeValuesEqual(a, b ddbtypes.AttributeValue) bool {
+	switch a := a.(type) {
+	case *ddbtypes.AttributeValueMemberS:
+		b, ok := b.(*ddbtypes.AttributeValueMemberS)
+		return ok && a.Value == b.Value
+	case *ddbtypes.AttributeValueMemberN:
+		cmp, ok := compareAttributeValues(a, b)
+		return ok && cmp == 0
+	case *ddbtypes.AttributeValueMemberB:
+		b, ok := b.(*ddbtypes.AttributeValueMemberB)
+		return ok && bytes.Equal(a.Value, b.Value)
+	case *ddbtypes.AttributeValueMemberBOOL:
+		b, ok := b.(*ddbtypes.AttributeValueMemberBOOL)
+		return ok && a.Value == b.Value
+	case *ddbtypes.AttributeValueMemberNULL:
+		b, ok := b.(*ddbtypes.AttributeValueMemberNULL)
+		return ok && a.Value == b.Value
+	case *ddbtypes.AttributeValueMemberSS, *ddbtypes.AttributeValueMemberNS,
+		*ddbtypes.AttributeValueMemberBS:
+		if attributeValueType(a) != attributeValueType(b) {
+			return false
+		}
+		as, bs := setMembers(a), setMembers(b)
+		if len(as) != len(bs) {
+			return false
+		}
+		for _, m := range as {
+			if !containsAttributeValue(bs, m) {
+				return false
+			}
+		}
+		return true
+	case *ddbtypes.AttributeValueMemberL:
+		b, ok := b.(*ddbtypes.AttributeValueMemberL)
+		if !ok || len(a.Value) != len(b.Value) {
+			return false
+		}
+		for i := range a.Value {
+			if !attributeValuesEqual(a.Value[i], b.Value[i]) {
+				return false
+			}
+		}
+		return true
+	case *ddbtypes.AttributeValueMemberM:
+		b, ok := b.(*ddbtypes.AttributeValueMemberM)
+		if !ok || len(a.Value) != len(b.Value) {
+			return false
+		}
+		for k, v := range a.Value {
+			other, ok := b.Value[k]
+			if !ok || !attributeValuesEqual(v, other) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// compareAttributeValues returns the ordering of a to b, and if the values are
+// comparable. Only string, number, and binary values of the same type can be
+// ordered.
+func compareAttributeValues(a, b ddbtypes.AttributeValue) (int, bool) {
+	switch a := a.(type) {
+	case *ddbtypes.AttributeValueMemberS:
+		b, ok := b.(*ddbtypes.AttributeValueMemberS)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(a.Value, b.Value), true
+	case *ddbtypes.AttributeValueMemberN:
+		x, xOK := parseNumberValue(a)
+		y, yOK := parseNumberValue(b)
+		if !xOK || !yOK {
+			return 0, false
+		}
+		return x.Cmp(y), true
+	case *ddbtypes.AttributeValueMemberB:
+		b, ok := b.(*ddbtypes.AttributeValueMemberB)
+		if !ok {
+			return 0, false
+		}
+		return bytes.Compare(a.Value, b.Value), true
+	default:
+		return 0, false
+	}
+}
+
+func parseNumberValue(v ddbtypes.AttributeValue) (*big.Float, bool) {
+	n, ok := v.(*ddbtypes.AttributeValueMemberN)
+	if !ok {
+		return nil, false
+	}
+	f, ok := new(big.Float).SetString(n.Value)
+	return f, ok
+}
+
+func formatNumber(f *big.Float) *ddbtypes.AttributeValueMemberN {
+	return &ddbtypes.AttributeValueMemberN{Value: f.Text('f', -1)}
+}
+
+func setMembers(v ddbtypes.AttributeValue) []ddbtypes.AttributeValue {
+	var members []ddbtypes.AttributeValue
+	switch v := v.(type) {
+	case *ddbtypes.AttributeValueMemberSS:
+		for _, m := range v.Value {
+			members = append(members, &ddbtypes.AttributeValueMemberS{Value: m})
+		}
+	case *ddbtypes.AttributeValueMemberNS:
+		for _, m := range v.Value {
+			members = append(members, &ddbtypes.AttributeValueMemberN{Value: m})
+		}
+	case *ddbtypes.AttributeValueMemberBS:
+		for _, m := range v.Value {
+			members = append(members, &ddbtypes.AttributeValueMemberB{Value: m})
+		}
+	}
+	return members
+}
+
+func makeSet(like ddbtypes.AttributeValue, members []ddbtypes.AttributeValue) ddbtypes.AttributeValue {
+	switch like.(type) {
+	case *ddbtypes.AttributeValueMemberSS:
+		set := &ddbtypes.AttributeValueMemberSS{}
+		for _, m := range members {
+			set.Value = append(set.Value, m.(*ddbtypes.AttributeValueMemberS).Value)
+		}
+		return set
+	case *ddbtypes.AttributeValueMemberNS:
+		set := &ddbtypes.AttributeValueMemberNS{}
+		for _, m := range members {
+			set.Value = append(set.Value, m.(*ddbtypes.AttributeValueMemberN).Value)
+		}
+		return set
+	case *ddbtypes.AttributeValueMemberBS:
+		set := &ddbtypes.AttributeValueMemberBS{}
+		for _, m := range members {
+			set.Value = append(set.Value, m.(*ddbtypes.AttributeValueMemberB).Value)
+		}
+		return set
+	default:
+		return nil
+	}
+}
+
+func containsAttributeValue(list []ddbtypes.AttributeValue, v ddbtypes.AttributeValue) bool {
+	for _, m := range list {
+		if attributeValuesEqual(m, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func copyItem(item map[string]ddbtypes.AttributeValue) map[string]ddbtypes.AttributeValue {
+	if item == nil {
+		return nil
+	}
+	c := make(map[string]ddbtypes.AttributeValue, len(item))
+	for k, v := range item {
+		c[k] = copyAttributeValue(v)
+	}
+	return c
+}
+
+func copyAttributeValue(v ddbtypes.AttributeValue) ddbtypes.AttributeValue {
+	switch v := v.(type) {
+	case *ddbtypes.AttributeValueMemberS:
+		return &ddbtypes.AttributeValueMemberS{Value: v.Value}
+	case *ddbtypes.AttributeValueMemberN:
+		return &ddbtypes.AttributeValueMemberN{Value: v.Value}
+	case *ddbtypes.AttributeValueMemberB:
+		return &ddbtypes.AttributeValueMemberB{Value: append([]byte(nil), v.Value...)}
+	case *ddbtypes.AttributeValueMemberBOOL:
+		return &ddbtypes.AttributeValueMemberBOOL{Value: v.Value}
+	case *ddbtypes.AttributeValueMemberNULL:
+		return &ddbtypes.AttributeValueMemberNULL{Value: v.Value}
+	case *ddbtypes.AttributeValueMemberSS:
+		return &ddbtypes.AttributeValueMemberSS{Value: append([]string(nil), v.Value...)}
+	case *ddbtypes.AttributeValueMemberNS:
+		return &ddbtypes.AttributeValueMemberNS{Value: append([]string(nil), v.Value...)}
+	case *ddbtypes.AttributeValueMemberBS:
+		set := &ddbtypes.AttributeValueMemberBS{}
+		for _, b := range v.Value {
+			set.Value = append(set.Value, append([]byte(nil), b...))
+		}
+		return set
+	case *ddbtypes.AttributeValueMemberL:
+		l := &ddbtypes.AttributeValueMemberL{Value: make([]ddbtypes.AttributeValue, 0, len(v.Value))}
+		for _, e := range v.Value {
+			l.Value = append(l.Value, copyAttributeValue(e))
+		}
+		return l
+	case *ddbtypes.AttributeValueMemberM:
+		return &ddbtypes.AttributeValueMemberM{Value: copyItem(v.Value)}
+	default:
+		return v
+	}
+}
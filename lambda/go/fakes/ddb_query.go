@@ -0,0 +1,207 @@
+package fakes
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ddbIndex is a global secondary index of a table, projecting all
+// attributes. Items without the index's key attributes are not in the index.
+type ddbIndex struct {
+	name         string
+	partitionKey string
+	sortKey      string
+}
+
+func (i *ddbIndex) keyNames() []string {
+	if i.sortKey == "" {
+		return []string{i.partitionKey}
+	}
+	return []string{i.partitionKey, i.sortKey}
+}
+
+// CreateGlobalSecondaryIndex adds an index with the partition key, and
+// optional sort key attribute names, to the table. The index projects all
+// attributes of the table's items.
+func (d *DynamoDB) CreateGlobalSecondaryIndex(tableName, indexName, partitionKey, sortKey string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	t, err := d.table(aws.String(tableName))
+	if err != nil {
+		return err
+	}
+	if t.indexes == nil {
+		t.indexes = map[string]*ddbIndex{}
+	}
+	t.indexes[indexName] = &ddbIndex{
+		name:         indexName,
+		partitionKey: partitionKey,
+		sortKey:      sortKey,
+	}
+	return nil
+}
+
+// validateIndexKeys returns a ValidationException if the item has an index key
+// attribute that is not a valid key value.
+func (t *ddbTable) validateIndexKeys(item map[string]ddbtypes.AttributeValue) error {
+	for _, index := range t.indexes {
+		for _, name := range index.keyNames() {
+			av, ok := item[name]
+			if !ok {
+				continue
+			}
+
+			var valid bool
+			switch v := av.(type) {
+			case *ddbtypes.AttributeValueMemberS:
+				valid = v.Value != ""
+			case *ddbtypes.AttributeValueMemberN:
+				valid = v.Value != ""
+			case *ddbtypes.AttributeValueMemberB:
+				valid = len(v.Value) != 0
+			}
+			if !valid {
+				return newValidationError(
+					"One or more parameter values are not valid. A value specified for a secondary index key is not supported. IndexName: %v, IndexKey: %v",
+					index.name, name)
+			}
+		}
+	}
+	return nil
+}
+
+func (d *DynamoDB) Query(ctx context.Context, params *ddb.QueryInput, optFns ...func(*ddb.Options)) (
+	*ddb.QueryOutput, error,
+) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	t, err := d.startOperation(ctx, "Query", params.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	index := &ddbIndex{partitionKey: t.partitionKey, sortKey: t.sortKey}
+	if params.IndexName != nil {
+		var ok bool
+		if index, ok = t.indexes[aws.ToString(params.IndexName)]; !ok {
+			return nil, newValidationError(
+				"The table does not have the specified index: %v", aws.ToString(params.IndexName))
+		}
+	}
+
+	attrs := exprAttributes{
+		names:  params.ExpressionAttributeNames,
+		values: params.ExpressionAttributeValues,
+	}
+	if params.KeyConditionExpression == nil {
+		return nil, newValidationError("Either the KeyConditions or KeyConditionExpression parameter must be specified in the request.")
+	}
+	keyCond, err := parseConditionExpression(aws.ToString(params.KeyConditionExpression), attrs)
+	if err != nil {
+		return nil, err
+	}
+	var filter exprCondition
+	if params.FilterExpression != nil {
+		if filter, err = parseConditionExpression(aws.ToString(params.FilterExpression), attrs); err != nil {
+			return nil, err
+		}
+	}
+	projection, err := parseOptionalProjection(params.ProjectionExpression, attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := t.queryItems(index, keyCond)
+	if err != nil {
+		return nil, err
+	}
+	if params.ScanIndexForward != nil && !*params.ScanIndexForward {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+
+	start := 0
+	if len(params.ExclusiveStartKey) != 0 {
+		startKey, err := t.encodeKey(t.keyAttributes(params.ExclusiveStartKey), true)
+		if err != nil {
+			return nil, err
+		}
+		for i, item := range items {
+			if key, _ := t.encodeKey(item, false); key == startKey {
+				start = i + 1
+				break
+			}
+		}
+	}
+
+	output := &ddb.QueryOutput{}
+	for i := start; i < len(items); i++ {
+		item := items[i]
+		output.ScannedCount++
+
+		if filter == nil || filter.match(item) {
+			output.Items = append(output.Items, projectItem(item, projection))
+			output.Count++
+		}
+
+		// Limit is the number of items evaluated, not the number of items
+		// that matched the filter.
+		if params.Limit != nil && output.ScannedCount >= *params.Limit && i+1 < len(items) {
+			lastKey := t.keyAttributes(item)
+			for _, name := range index.keyNames() {
+				lastKey[name] = copyAttributeValue(item[name])
+			}
+			output.LastEvaluatedKey = lastKey
+			break
+		}
+	}
+	return output, nil
+}
+
+// queryItems returns the items in the index matching the key condition,
+// ordered by the index's sort key. Items with the same index sort key are
+// ordered by the table's key.
+func (t *ddbTable) queryItems(index *ddbIndex, keyCond exprCondition) (
+	[]map[string]ddbtypes.AttributeValue, error,
+) {
+	var items []map[string]ddbtypes.AttributeValue
+	for _, key := range t.sortedKeys() {
+		item := t.items[key]
+
+		inIndex := true
+		for _, name := range index.keyNames() {
+			if _, ok := item[name]; !ok {
+				inIndex = false
+				break
+			}
+		}
+		if inIndex && keyCond.match(item) {
+			items = append(items, item)
+		}
+	}
+
+	if len(items) != 0 {
+		partition := items[0][index.partitionKey]
+		for _, item := range items[1:] {
+			if !attributeValuesEqual(partition, item[index.partitionKey]) {
+				return nil, fmt.Errorf("fake Query only supports key conditions on a single partition key value")
+			}
+		}
+	}
+
+	if index.sortKey != "" {
+		sort.SliceStable(items, func(i, j int) bool {
+			cmp, _ := compareAttributeValues(items[i][index.sortKey], items[j][index.sortKey])
+			return cmp < 0
+		})
+	}
+	return items, nil
+}
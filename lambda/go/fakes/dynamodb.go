@@ -0,0 +1,580 @@
+package fakes
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+)
+
+const (
+	maxBatchGetItemKeys       = 100
+	maxBatchWriteItemRequests = 25
+)
+
+// DynamoDB provides a stateful in-memory stand-in for the Amazon DynamoDB
+// API operations used by the workshop's Lambda handlers. Expressions created
+// with the SDK's expression builder are evaluated against the stored items.
+type DynamoDB struct {
+	// OnPutItem if set is called with the table name and item of each item
+	// put with PutItem. Use this to stand in for the table's stream, e.g. to
+	// invoke a handler in a separate goroutine.
+	OnPutItem func(tableName string, item map[string]ddbtypes.AttributeValue)
+
+	mu     sync.Mutex
+	tables map[string]*ddbTable
+	errs   map[string]error
+}
+
+// NewDynamoDB returns an empty in-memory DynamoDB.
+func NewDynamoDB() *DynamoDB {
+	return &DynamoDB{
+		tables: map[string]*ddbTable{},
+		errs:   map[string]error{},
+	}
+}
+
+// CreateTable adds an empty table with the partition key, and optional sort
+// key attribute names.
+func (d *DynamoDB) CreateTable(name, partitionKey, sortKey string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.tables[name] = &ddbTable{
+		name:         name,
+		partitionKey: partitionKey,
+		sortKey:      sortKey,
+		items:        map[string]map[string]ddbtypes.AttributeValue{},
+	}
+}
+
+// SetOperationError sets the error the named operation, e.g. "Scan", will
+// return instead of being performed. A nil error clears the error.
+func (d *DynamoDB) SetOperationError(operation string, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err == nil {
+		delete(d.errs, operation)
+		return
+	}
+	d.errs[operation] = err
+}
+
+// Items returns a copy of all items in the table ordered by key.
+func (d *DynamoDB) Items(tableName string) []map[string]ddbtypes.AttributeValue {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	t, ok := d.tables[tableName]
+	if !ok {
+		return nil
+	}
+
+	items := make([]map[string]ddbtypes.AttributeValue, 0, len(t.items))
+	for _, key := range t.sortedKeys() {
+		items = append(items, copyItem(t.items[key]))
+	}
+	return items
+}
+
+func (d *DynamoDB) GetItem(ctx context.Context, params *ddb.GetItemInput, optFns ...func(*ddb.Options)) (
+	*ddb.GetItemOutput, error,
+) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	t, err := d.startOperation(ctx, "GetItem", params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	key, err := t.encodeKey(params.Key, true)
+	if err != nil {
+		return nil, err
+	}
+	projection, err := parseOptionalProjection(params.ProjectionExpression, exprAttributes{
+		names: params.ExpressionAttributeNames,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	output := &ddb.GetItemOutput{}
+	if item, ok := t.items[key]; ok {
+		output.Item = projectItem(item, projection)
+	}
+	return output, nil
+}
+
+func (d *DynamoDB) PutItem(ctx context.Context, params *ddb.PutItemInput, optFns ...func(*ddb.Options)) (
+	*ddb.PutItemOutput, error,
+) {
+	output, err := d.putItem(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	onPut := d.OnPutItem
+	d.mu.Unlock()
+	if onPut != nil {
+		onPut(aws.ToString(params.TableName), copyItem(params.Item))
+	}
+
+	return output, nil
+}
+
+func (d *DynamoDB) putItem(ctx context.Context, params *ddb.PutItemInput) (*ddb.PutItemOutput, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	t, err := d.startOperation(ctx, "PutItem", params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	key, err := t.encodeKey(params.Item, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := t.validateIndexKeys(params.Item); err != nil {
+		return nil, err
+	}
+
+	existing := t.items[key]
+	if err := checkCondition(params.ConditionExpression, exprAttributes{
+		names:  params.ExpressionAttributeNames,
+		values: params.ExpressionAttributeValues,
+	}, existing); err != nil {
+		return nil, err
+	}
+
+	t.items[key] = copyItem(params.Item)
+
+	output := &ddb.PutItemOutput{}
+	if params.ReturnValues == ddbtypes.ReturnValueAllOld && existing != nil {
+		output.Attributes = copyItem(existing)
+	}
+	return output, nil
+}
+
+func (d *DynamoDB) UpdateItem(ctx context.Context, params *ddb.UpdateItemInput, optFns ...func(*ddb.Options)) (
+	*ddb.UpdateItemOutput, error,
+) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	t, err := d.startOperation(ctx, "UpdateItem", params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	key, err := t.encodeKey(params.Key, true)
+	if err != nil {
+		return nil, err
+	}
+	attrs := exprAttributes{
+		names:  params.ExpressionAttributeNames,
+		values: params.ExpressionAttributeValues,
+	}
+
+	existing := t.items[key]
+	if err := checkCondition(params.ConditionExpression, attrs, existing); err != nil {
+		return nil, err
+	}
+
+	item := existing
+	if item == nil {
+		// UpdateItem creates the item if it does not already exist.
+		item = copyItem(params.Key)
+	}
+
+	if params.UpdateExpression != nil {
+		actions, err := parseUpdateExpression(aws.ToString(params.UpdateExpression), attrs)
+		if err != nil {
+			return nil, err
+		}
+		for _, action := range actions {
+			if t.isKeyAttribute(action.path[0].name) {
+				return nil, newValidationError(
+					"One or more parameter values were invalid: Cannot update attribute %v. This attribute is part of the key",
+					action.path[0].name)
+			}
+		}
+		if item, err = applyUpdateActions(item, actions); err != nil {
+			return nil, err
+		}
+	}
+	if err := t.validateIndexKeys(item); err != nil {
+		return nil, err
+	}
+	t.items[key] = item
+
+	output := &ddb.UpdateItemOutput{}
+	switch params.ReturnValues {
+	case ddbtypes.ReturnValueAllNew:
+		output.Attributes = copyItem(item)
+	case ddbtypes.ReturnValueAllOld:
+		output.Attributes = copyItem(existing)
+	}
+	return output, nil
+}
+
+func (d *DynamoDB) DeleteItem(ctx context.Context, params *ddb.DeleteItemInput, optFns ...func(*ddb.Options)) (
+	*ddb.DeleteItemOutput, error,
+) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	t, err := d.startOperation(ctx, "DeleteItem", params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	key, err := t.encodeKey(params.Key, true)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := t.items[key]
+	if err := checkCondition(params.ConditionExpression, exprAttributes{
+		names:  params.ExpressionAttributeNames,
+		values: params.ExpressionAttributeValues,
+	}, existing); err != nil {
+		return nil, err
+	}
+	delete(t.items, key)
+
+	output := &ddb.DeleteItemOutput{}
+	if params.ReturnValues == ddbtypes.ReturnValueAllOld && existing != nil {
+		output.Attributes = existing
+	}
+	return output, nil
+}
+
+func (d *DynamoDB) Scan(ctx context.Context, params *ddb.ScanInput, optFns ...func(*ddb.Options)) (
+	*ddb.ScanOutput, error,
+) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	t, err := d.startOperation(ctx, "Scan", params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	attrs := exprAttributes{
+		names:  params.ExpressionAttributeNames,
+		values: params.ExpressionAttributeValues,
+	}
+
+	var filter exprCondition
+	if params.FilterExpression != nil {
+		if filter, err = parseConditionExpression(aws.ToString(params.FilterExpression), attrs); err != nil {
+			return nil, err
+		}
+	}
+	projection, err := parseOptionalProjection(params.ProjectionExpression, attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := t.sortedKeys()
+	start := 0
+	if len(params.ExclusiveStartKey) != 0 {
+		startKey, err := t.encodeKey(params.ExclusiveStartKey, true)
+		if err != nil {
+			return nil, err
+		}
+		start = sort.SearchStrings(keys, startKey)
+		if start < len(keys) && keys[start] == startKey {
+			start++
+		}
+	}
+
+	output := &ddb.ScanOutput{}
+	for i := start; i < len(keys); i++ {
+		item := t.items[keys[i]]
+		output.ScannedCount++
+
+		if filter == nil || filter.match(item) {
+			output.Items = append(output.Items, projectItem(item, projection))
+			output.Count++
+		}
+
+		// Limit is the number of items evaluated, not the number of items
+		// that matched the filter.
+		if params.Limit != nil && output.ScannedCount >= *params.Limit && i+1 < len(keys) {
+			output.LastEvaluatedKey = t.keyAttributes(item)
+			break
+		}
+	}
+	return output, nil
+}
+
+func (d *DynamoDB) BatchGetItem(ctx context.Context, params *ddb.BatchGetItemInput, optFns ...func(*ddb.Options)) (
+	*ddb.BatchGetItemOutput, error,
+) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.operationError(ctx, "BatchGetItem"); err != nil {
+		return nil, err
+	}
+
+	var numKeys int
+	for _, request := range params.RequestItems {
+		numKeys += len(request.Keys)
+	}
+	if numKeys == 0 {
+		return nil, newValidationError("The requestItems parameter is required for BatchGetItem")
+	}
+	if numKeys > maxBatchGetItemKeys {
+		return nil, newValidationError("Too many items requested for the BatchGetItem call")
+	}
+
+	output := &ddb.BatchGetItemOutput{
+		Responses:       map[string][]map[string]ddbtypes.AttributeValue{},
+		UnprocessedKeys: map[string]ddbtypes.KeysAndAttributes{},
+	}
+	for tableName, request := range params.RequestItems {
+		t, err := d.table(aws.String(tableName))
+		if err != nil {
+			return nil, err
+		}
+		projection, err := parseOptionalProjection(request.ProjectionExpression, exprAttributes{
+			names: request.ExpressionAttributeNames,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		seen := map[string]bool{}
+		items := []map[string]ddbtypes.AttributeValue{}
+		for _, k := range request.Keys {
+			key, err := t.encodeKey(k, true)
+			if err != nil {
+				return nil, err
+			}
+			if seen[key] {
+				return nil, newValidationError("Provided list of item keys contains duplicates")
+			}
+			seen[key] = true
+
+			if item, ok := t.items[key]; ok {
+				items = append(items, projectItem(item, projection))
+			}
+		}
+		output.Responses[tableName] = items
+	}
+	return output, nil
+}
+
+func (d *DynamoDB) BatchWriteItem(ctx context.Context, params *ddb.BatchWriteItemInput, optFns ...func(*ddb.Options)) (
+	*ddb.BatchWriteItemOutput, error,
+) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.operationError(ctx, "BatchWriteItem"); err != nil {
+		return nil, err
+	}
+
+	var numRequests int
+	for _, requests := range params.RequestItems {
+		numRequests += len(requests)
+	}
+	if numRequests == 0 {
+		return nil, newValidationError("The requestItems parameter is required for BatchWriteItem")
+	}
+	if numRequests > maxBatchWriteItemRequests {
+		return nil, newValidationError(
+			"Too many items requested for the BatchWriteItem call, must be less than or equal to %d",
+			maxBatchWriteItemRequests)
+	}
+
+	// Validate all requests before any are applied, the same as the service.
+	type write struct {
+		table *ddbTable
+		key   string
+		item  map[string]ddbtypes.AttributeValue
+	}
+	var writes []write
+	for tableName, requests := range params.RequestItems {
+		t, err := d.table(aws.String(tableName))
+		if err != nil {
+			return nil, err
+		}
+
+		seen := map[string]bool{}
+		for _, request := range requests {
+			var w write
+			var err error
+			switch {
+			case request.PutRequest != nil:
+				if w.key, err = t.encodeKey(request.PutRequest.Item, false); err == nil {
+					err = t.validateIndexKeys(request.PutRequest.Item)
+				}
+				w.item = request.PutRequest.Item
+			case request.DeleteRequest != nil:
+				w.key, err = t.encodeKey(request.DeleteRequest.Key, true)
+			default:
+				err = newValidationError("Supplied WriteRequest must contain a PutRequest or DeleteRequest")
+			}
+			if err != nil {
+				return nil, err
+			}
+			if seen[w.key] {
+				return nil, newValidationError("Provided list of item keys contains duplicates")
+			}
+			seen[w.key] = true
+
+			w.table = t
+			writes = append(writes, w)
+		}
+	}
+
+	for _, w := range writes {
+		if w.item == nil {
+			delete(w.table.items, w.key)
+		} else {
+			w.table.items[w.key] = copyItem(w.item)
+		}
+	}
+
+	return &ddb.BatchWriteItemOutput{
+		UnprocessedItems: map[string][]ddbtypes.WriteRequest{},
+	}, nil
+}
+
+func (d *DynamoDB) startOperation(ctx context.Context, operation string, tableName *string) (*ddbTable, error) {
+	if err := d.operationError(ctx, operation); err != nil {
+		return nil, err
+	}
+	return d.table(tableName)
+}
+
+// operationError returns the error set for the operation. Operations fail
+// if the context is canceled, the same as the SDK's clients.
+func (d *DynamoDB) operationError(ctx context.Context, operation string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return d.errs[operation]
+}
+
+func (d *DynamoDB) table(name *string) (*ddbTable, error) {
+	t, ok := d.tables[aws.ToString(name)]
+	if !ok {
+		return nil, &ddbtypes.ResourceNotFoundException{
+			Message: aws.String("Requested resource not found: Table: " + aws.ToString(name) + " not found"),
+		}
+	}
+	return t, nil
+}
+
+type ddbTable struct {
+	name         string
+	partitionKey string
+	sortKey      string
+	indexes      map[string]*ddbIndex
+
+	items map[string]map[string]ddbtypes.AttributeValue
+}
+
+func (t *ddbTable) isKeyAttribute(name string) bool {
+	return name == t.partitionKey || (t.sortKey != "" && name == t.sortKey)
+}
+
+// encodeKey returns the string encoding of the item's primary key. If
+// exactKey is set, the attributes must only include the key attributes.
+func (t *ddbTable) encodeKey(item map[string]ddbtypes.AttributeValue, exactKey bool) (string, error) {
+	keyNames := []string{t.partitionKey}
+	if t.sortKey != "" {
+		keyNames = append(keyNames, t.sortKey)
+	}
+	if exactKey && len(item) != len(keyNames) {
+		return "", newValidationError("The provided key element does not match the schema")
+	}
+
+	parts := make([]string, 0, len(keyNames))
+	for _, name := range keyNames {
+		var part string
+		switch v := item[name].(type) {
+		case *ddbtypes.AttributeValueMemberS:
+			part = "S:" + v.Value
+		case *ddbtypes.AttributeValueMemberN:
+			part = "N:" + v.Value
+		case *ddbtypes.AttributeValueMemberB:
+			part = "B:" + string(v.Value)
+		default:
+			return "", newValidationError(
+				"One or more parameter values were invalid: Missing the key %v in the item", name)
+		}
+		if len(part) == 2 {
+			return "", newValidationError(
+				"One or more parameter values are not valid. The AttributeValue for a key attribute cannot contain an empty value. Key: %v",
+				name)
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "\x00"), nil
+}
+
+func (t *ddbTable) keyAttributes(item map[string]ddbtypes.AttributeValue) map[string]ddbtypes.AttributeValue {
+	key := map[string]ddbtypes.AttributeValue{
+		t.partitionKey: copyAttributeValue(item[t.partitionKey]),
+	}
+	if t.sortKey != "" {
+		key[t.sortKey] = copyAttributeValue(item[t.sortKey])
+	}
+	return key
+}
+
+func (t *ddbTable) sortedKeys() []string {
+	keys := make([]string, 0, len(t.items))
+	for k := range t.items {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func parseOptionalProjection(expr *string, attrs exprAttributes) ([]attrPath, error) {
+	if expr == nil {
+		return nil, nil
+	}
+	return parseProjectionExpression(*expr, attrs)
+}
+
+// checkCondition returns a ConditionalCheckFailedException if the condition
+// expression, if any, does not match the existing item.
+func checkCondition(expr *string, attrs exprAttributes, existing map[string]ddbtypes.AttributeValue) error {
+	if expr == nil {
+		return nil
+	}
+	cond, err := parseConditionExpression(*expr, attrs)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		existing = map[string]ddbtypes.AttributeValue{}
+	}
+	if !cond.match(existing) {
+		return &ddbtypes.ConditionalCheckFailedException{
+			Message: aws.String("The conditional request failed"),
+		}
+	}
+	return nil
+}
+
+func newValidationError(format string, args ...interface{}) error {
+	return &smithy.GenericAPIError{
+		Code:    "ValidationException",
+		Message: fmt.Sprintf(format, args...),
+		Fault:   smithy.FaultClient,
+	}
+}
@@ -0,0 +1,203 @@
+package fakes
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ddbexp "github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestDynamoDB_UpdateItem(t *testing.T) {
+	cases := map[string]struct {
+		Existing     map[string]ddbtypes.AttributeValue
+		Update       ddbexp.UpdateBuilder
+		Condition    *ddbexp.ConditionBuilder
+		ExpectItem   map[string]ddbtypes.AttributeValue
+		ExpectFailed bool
+	}{
+		"set creates item": {
+			Update: ddbexp.Set(ddbexp.Name("title"), ddbexp.Value("intro")),
+			ExpectItem: map[string]ddbtypes.AttributeValue{
+				"id":    &ddbtypes.AttributeValueMemberS{Value: "1"},
+				"title": &ddbtypes.AttributeValueMemberS{Value: "intro"},
+			},
+		},
+		"add to missing number": {
+			Update: ddbexp.Add(ddbexp.Name("count"), ddbexp.Value(1)),
+			ExpectItem: map[string]ddbtypes.AttributeValue{
+				"id":    &ddbtypes.AttributeValueMemberS{Value: "1"},
+				"count": &ddbtypes.AttributeValueMemberN{Value: "1"},
+			},
+		},
+		"add with condition": {
+			Existing: map[string]ddbtypes.AttributeValue{
+				"id":    &ddbtypes.AttributeValueMemberS{Value: "1"},
+				"count": &ddbtypes.AttributeValueMemberN{Value: "1"},
+			},
+			Update: ddbexp.Add(ddbexp.Name("count"), ddbexp.Value(1)),
+			Condition: conditionPtr(ddbexp.Or(
+				ddbexp.AttributeNotExists(ddbexp.Name("count")),
+				ddbexp.Name("count").LessThan(ddbexp.Value(2)),
+			)),
+			ExpectItem: map[string]ddbtypes.AttributeValue{
+				"id":    &ddbtypes.AttributeValueMemberS{Value: "1"},
+				"count": &ddbtypes.AttributeValueMemberN{Value: "2"},
+			},
+		},
+		"condition failed": {
+			Existing: map[string]ddbtypes.AttributeValue{
+				"id":    &ddbtypes.AttributeValueMemberS{Value: "1"},
+				"count": &ddbtypes.AttributeValueMemberN{Value: "2"},
+			},
+			Update:       ddbexp.Add(ddbexp.Name("count"), ddbexp.Value(1)),
+			Condition:    conditionPtr(ddbexp.Name("count").LessThan(ddbexp.Value(2))),
+			ExpectFailed: true,
+			ExpectItem: map[string]ddbtypes.AttributeValue{
+				"id":    &ddbtypes.AttributeValueMemberS{Value: "1"},
+				"count": &ddbtypes.AttributeValueMemberN{Value: "2"},
+			},
+		},
+		"remove and list append": {
+			Existing: map[string]ddbtypes.AttributeValue{
+				"id":    &ddbtypes.AttributeValueMemberS{Value: "1"},
+				"title": &ddbtypes.AttributeValueMemberS{Value: "intro"},
+				"tags": &ddbtypes.AttributeValueMemberL{Value: []ddbtypes.AttributeValue{
+					&ddbtypes.AttributeValueMemberS{Value: "a"},
+				}},
+			},
+			Update: ddbexp.Remove(ddbexp.Name("title")).
+				Set(ddbexp.Name("tags"), ddbexp.ListAppend(ddbexp.Name("tags"),
+					ddbexp.Value([]string{"b"}))),
+			ExpectItem: map[string]ddbtypes.AttributeValue{
+				"id": &ddbtypes.AttributeValueMemberS{Value: "1"},
+				"tags": &ddbtypes.AttributeValueMemberL{Value: []ddbtypes.AttributeValue{
+					&ddbtypes.AttributeValueMemberS{Value: "a"},
+					&ddbtypes.AttributeValueMemberS{Value: "b"},
+				}},
+			},
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			client := NewDynamoDB()
+			client.CreateTable("table", "id", "")
+			if c.Existing != nil {
+				_, err := client.PutItem(context.Background(), &ddb.PutItemInput{
+					TableName: aws.String("table"),
+					Item:      c.Existing,
+				})
+				if err != nil {
+					t.Fatalf("failed to put item, %v", err)
+				}
+			}
+
+			builder := ddbexp.NewBuilder().WithUpdate(c.Update)
+			if c.Condition != nil {
+				builder = builder.WithCondition(*c.Condition)
+			}
+			exp, err := builder.Build()
+			if err != nil {
+				t.Fatalf("failed to build expression, %v", err)
+			}
+
+			_, err = client.UpdateItem(context.Background(), &ddb.UpdateItemInput{
+				TableName: aws.String("table"),
+				Key: map[string]ddbtypes.AttributeValue{
+					"id": &ddbtypes.AttributeValueMemberS{Value: "1"},
+				},
+				UpdateExpression:          exp.Update(),
+				ConditionExpression:       exp.Condition(),
+				ExpressionAttributeNames:  exp.Names(),
+				ExpressionAttributeValues: exp.Values(),
+			})
+			var condErr *ddbtypes.ConditionalCheckFailedException
+			if e, a := c.ExpectFailed, errors.As(err, &condErr); e != a {
+				t.Fatalf("expect condition failed %v, got %v", e, err)
+			}
+			if err != nil && !c.ExpectFailed {
+				t.Fatalf("expect no error, got %v", err)
+			}
+
+			items := client.Items("table")
+			if e, a := 1, len(items); e != a {
+				t.Fatalf("expect %v items, got %v", e, a)
+			}
+			if e, a := c.ExpectItem, items[0]; !reflect.DeepEqual(e, a) {
+				t.Errorf("expect item %v, got %v", e, a)
+			}
+		})
+	}
+}
+
+func TestDynamoDB_ScanFilter(t *testing.T) {
+	client := NewDynamoDB()
+	client.CreateTable("table", "id", "")
+	for _, item := range []map[string]ddbtypes.AttributeValue{
+		{"id": &ddbtypes.AttributeValueMemberS{Value: "1"}, "title": &ddbtypes.AttributeValueMemberS{Value: "Go generics"}},
+		{"id": &ddbtypes.AttributeValueMemberS{Value: "2"}, "title": &ddbtypes.AttributeValueMemberS{Value: "Rust traits"}},
+		{"id": &ddbtypes.AttributeValueMemberS{Value: "3"}},
+	} {
+		if _, err := client.PutItem(context.Background(), &ddb.PutItemInput{
+			TableName: aws.String("table"),
+			Item:      item,
+		}); err != nil {
+			t.Fatalf("failed to put item, %v", err)
+		}
+	}
+
+	cases := map[string]struct {
+		Filter    ddbexp.ConditionBuilder
+		ExpectIDs []string
+	}{
+		"contains": {
+			Filter:    ddbexp.Name("title").Contains("Go"),
+			ExpectIDs: []string{"1"},
+		},
+		"not exists": {
+			Filter:    ddbexp.AttributeNotExists(ddbexp.Name("title")),
+			ExpectIDs: []string{"3"},
+		},
+		"in": {
+			Filter:    ddbexp.Name("id").In(ddbexp.Value("2"), ddbexp.Value("3")),
+			ExpectIDs: []string{"2", "3"},
+		},
+		"not begins with": {
+			Filter:    ddbexp.Not(ddbexp.Name("title").BeginsWith("Go")),
+			ExpectIDs: []string{"2", "3"},
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			exp, err := ddbexp.NewBuilder().WithFilter(c.Filter).Build()
+			if err != nil {
+				t.Fatalf("failed to build expression, %v", err)
+			}
+			resp, err := client.Scan(context.Background(), &ddb.ScanInput{
+				TableName:                 aws.String("table"),
+				FilterExpression:          exp.Filter(),
+				ExpressionAttributeNames:  exp.Names(),
+				ExpressionAttributeValues: exp.Values(),
+			})
+			if err != nil {
+				t.Fatalf("expect no error, got %v", err)
+			}
+
+			var ids []string
+			for _, item := range resp.Items {
+				ids = append(ids, item["id"].(*ddbtypes.AttributeValueMemberS).Value)
+			}
+			if e, a := c.ExpectIDs, ids; !reflect.DeepEqual(e, a) {
+				t.Errorf("expect %v items, got %v", e, a)
+			}
+		})
+	}
+}
+
+func conditionPtr(c ddbexp.ConditionBuilder) *ddbexp.ConditionBuilder { return &c }
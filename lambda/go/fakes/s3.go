@@ -0,0 +1,299 @@
+package fakes
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Object is an object stored in the in-memory S3 bucket.
+type Object struct {
+	Body         []byte
+	ContentType  string
+	Metadata     map[string]string
+	ETag         string
+	LastModified time.Time
+}
+
+// S3 provides a stateful in-memory stand-in for the Amazon S3 upload,
+// download, copy, head, multipart upload, presign, and object exists waiter
+// APIs used by the workshop's Lambda handlers.
+type S3 struct {
+	// Base URL presigned URLs are created for. Defaults to
+	// https://s3.amazonaws.com.
+	PresignBaseURL string
+
+	mu      sync.Mutex
+	buckets map[string]map[string]Object
+	uploads map[string]*multipartUpload
+}
+
+// NewS3 returns an in-memory S3 with the empty buckets.
+func NewS3(buckets ...string) *S3 {
+	s := &S3{
+		buckets: map[string]map[string]Object{},
+	}
+	for _, b := range buckets {
+		s.buckets[b] = map[string]Object{}
+	}
+	return s
+}
+
+// PutObject stores the object in the bucket, creating the bucket if needed.
+// The object's ETag and LastModified are set if not provided.
+func (s *S3) PutObject(bucket, key string, obj Object) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.buckets[bucket]; !ok {
+		s.buckets[bucket] = map[string]Object{}
+	}
+	s.putObject(bucket, key, obj)
+}
+
+// GetObject returns a copy of the object stored in the bucket, and if the
+// object exists.
+func (s *S3) GetObject(bucket, key string) (Object, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	obj, ok := s.buckets[bucket][key]
+	if !ok {
+		return Object{}, false
+	}
+	return copyObject(obj), true
+}
+
+// Keys returns the keys of all objects in the bucket.
+func (s *S3) Keys(bucket string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]string, 0, len(s.buckets[bucket]))
+	for k := range s.buckets[bucket] {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (s *S3) Upload(ctx context.Context, input *s3.PutObjectInput, opts ...func(*manager.Uploader)) (
+	*manager.UploadOutput, error,
+) {
+	bucket, key := aws.ToString(input.Bucket), aws.ToString(input.Key)
+	if key == "" {
+		return nil, fmt.Errorf("upload object key is required")
+	}
+
+	var body []byte
+	if input.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(input.Body); err != nil {
+			return nil, fmt.Errorf("failed to read upload body, %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.buckets[bucket]; !ok {
+		return nil, &s3types.NoSuchBucket{Message: aws.String("The specified bucket does not exist")}
+	}
+	s.putObject(bucket, key, Object{
+		Body:        body,
+		ContentType: aws.ToString(input.ContentType),
+		Metadata:    input.Metadata,
+	})
+
+	return &manager.UploadOutput{
+		Location: "https://" + bucket + ".s3.amazonaws.com/" + key,
+	}, nil
+}
+
+// CopyObject copies the object of the copy source, "bucket/key", to the
+// input's bucket and key. The source's content type and metadata are
+// replaced by the input's if the metadata directive is REPLACE.
+func (s *S3) CopyObject(ctx context.Context, input *s3.CopyObjectInput, optFns ...func(*s3.Options)) (
+	*s3.CopyObjectOutput, error,
+) {
+	source, err := url.PathUnescape(strings.TrimPrefix(aws.ToString(input.CopySource), "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid copy source, %w", err)
+	}
+	parts := strings.SplitN(source, "/", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, fmt.Errorf("invalid copy source, %v", source)
+	}
+
+	obj, err := s.lookupObject(parts[0], parts[1])
+	if err != nil {
+		return nil, err
+	}
+	if input.MetadataDirective == s3types.MetadataDirectiveReplace {
+		obj.ContentType = aws.ToString(input.ContentType)
+		obj.Metadata = input.Metadata
+	}
+	obj.LastModified = time.Time{}
+
+	bucket, key := aws.ToString(input.Bucket), aws.ToString(input.Key)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.buckets[bucket]; !ok {
+		return nil, &s3types.NoSuchBucket{Message: aws.String("The specified bucket does not exist")}
+	}
+	s.putObject(bucket, key, obj)
+	obj = s.buckets[bucket][key]
+
+	return &s3.CopyObjectOutput{
+		CopyObjectResult: &s3types.CopyObjectResult{
+			ETag:         aws.String(obj.ETag),
+			LastModified: aws.Time(obj.LastModified),
+		},
+	}, nil
+}
+
+// HeadObject returns the object's metadata, or a NotFound error if the
+// object does not exist.
+func (s *S3) HeadObject(ctx context.Context, input *s3.HeadObjectInput, optFns ...func(*s3.Options)) (
+	*s3.HeadObjectOutput, error,
+) {
+	obj, err := s.lookupObject(aws.ToString(input.Bucket), aws.ToString(input.Key))
+	if err != nil {
+		var noSuchKey *s3types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, &s3types.NotFound{Message: aws.String("Not Found")}
+		}
+		return nil, err
+	}
+
+	return &s3.HeadObjectOutput{
+		ContentLength: int64(len(obj.Body)),
+		ContentType:   aws.String(obj.ContentType),
+		ETag:          aws.String(obj.ETag),
+		LastModified:  aws.Time(obj.LastModified),
+		Metadata:      obj.Metadata,
+	}, nil
+}
+
+func (s *S3) Download(ctx context.Context, w io.WriterAt, input *s3.GetObjectInput, options ...func(*manager.Downloader)) (
+	int64, error,
+) {
+	obj, err := s.lookupObject(aws.ToString(input.Bucket), aws.ToString(input.Key))
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.WriteAt(obj.Body, 0)
+	return int64(n), err
+}
+
+func (s *S3) PresignGetObject(ctx context.Context, input *s3.GetObjectInput, optFns ...func(*s3.PresignOptions)) (
+	*v4.PresignedHTTPRequest, error,
+) {
+	var options s3.PresignOptions
+	for _, fn := range optFns {
+		fn(&options)
+	}
+	if options.Expires == 0 {
+		options.Expires = 15 * time.Minute
+	}
+
+	baseURL := s.PresignBaseURL
+	if baseURL == "" {
+		baseURL = "https://s3.amazonaws.com"
+	}
+
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/") + "/" +
+		aws.ToString(input.Bucket) + "/" + aws.ToString(input.Key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build presigned URL, %w", err)
+	}
+	u.RawQuery = url.Values{
+		"X-Amz-Expires": []string{fmt.Sprintf("%d", int64(options.Expires/time.Second))},
+	}.Encode()
+
+	return &v4.PresignedHTTPRequest{
+		URL:    u.String(),
+		Method: "GET",
+	}, nil
+}
+
+// Wait blocks until the object exists or the max wait duration elapses,
+// matching the behavior of the SDK's ObjectExistsWaiter.
+func (s *S3) Wait(ctx context.Context, input *s3.HeadObjectInput, maxWaitDur time.Duration, optFns ...func(*s3.ObjectExistsWaiterOptions)) error {
+	if maxWaitDur <= 0 {
+		return fmt.Errorf("maximum wait time for waiter must be greater than zero")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, maxWaitDur)
+	defer cancel()
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.lookupObject(aws.ToString(input.Bucket), aws.ToString(input.Key)); err == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("exceeded max wait time for ObjectExists waiter")
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *S3) lookupObject(bucket, key string) (Object, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	objects, ok := s.buckets[bucket]
+	if !ok {
+		return Object{}, &s3types.NoSuchBucket{Message: aws.String("The specified bucket does not exist")}
+	}
+	obj, ok := objects[key]
+	if !ok {
+		return Object{}, &s3types.NoSuchKey{Message: aws.String("The specified key does not exist.")}
+	}
+	return copyObject(obj), nil
+}
+
+func (s *S3) putObject(bucket, key string, obj Object) {
+	obj = copyObject(obj)
+	if obj.ETag == "" {
+		sum := md5.Sum(obj.Body)
+		obj.ETag = `"` + hex.EncodeToString(sum[:]) + `"`
+	}
+	if obj.LastModified.IsZero() {
+		obj.LastModified = time.Now().UTC()
+	}
+	s.buckets[bucket][key] = obj
+}
+
+func copyObject(obj Object) Object {
+	obj.Body = append([]byte(nil), obj.Body...)
+	if obj.Metadata != nil {
+		metadata := make(map[string]string, len(obj.Metadata))
+		for k, v := range obj.Metadata {
+			metadata[k] = v
+		}
+		obj.Metadata = metadata
+	}
+	return obj
+}
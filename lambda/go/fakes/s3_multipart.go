@@ -0,0 +1,241 @@
+package fakes
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// minMultipartPartSize is the minimum size of every part of a multipart
+// upload, except the last.
+const minMultipartPartSize = 5 * 1024 * 1024
+
+// multipartUpload is an in progress multipart upload of the in-memory S3.
+type multipartUpload struct {
+	bucket      string
+	key         string
+	contentType string
+	metadata    map[string]string
+	initiated   time.Time
+	parts       map[int32]multipartPart
+}
+
+type multipartPart struct {
+	body []byte
+	etag string
+}
+
+// CreateMultipartUpload starts a multipart upload of the object.
+func (s *S3) CreateMultipartUpload(ctx context.Context, input *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (
+	*s3.CreateMultipartUploadOutput, error,
+) {
+	bucket, key := aws.ToString(input.Bucket), aws.ToString(input.Key)
+	if key == "" {
+		return nil, fmt.Errorf("upload object key is required")
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to create upload ID, %w", err)
+	}
+	uploadID := hex.EncodeToString(id)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.buckets[bucket]; !ok {
+		return nil, &s3types.NoSuchBucket{Message: aws.String("The specified bucket does not exist")}
+	}
+	if s.uploads == nil {
+		s.uploads = map[string]*multipartUpload{}
+	}
+	s.uploads[uploadID] = &multipartUpload{
+		bucket:      bucket,
+		key:         key,
+		contentType: aws.ToString(input.ContentType),
+		metadata:    copyObject(Object{Metadata: input.Metadata}).Metadata,
+		initiated:   time.Now().UTC(),
+		parts:       map[int32]multipartPart{},
+	}
+
+	return &s3.CreateMultipartUploadOutput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	}, nil
+}
+
+// UploadPart stores the part of the multipart upload, replacing the part with
+// the same number if already uploaded.
+func (s *S3) UploadPart(ctx context.Context, input *s3.UploadPartInput, optFns ...func(*s3.Options)) (
+	*s3.UploadPartOutput, error,
+) {
+	var body []byte
+	if input.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(input.Body); err != nil {
+			return nil, fmt.Errorf("failed to read upload part body, %w", err)
+		}
+	}
+	if input.PartNumber < 1 || input.PartNumber > 10000 {
+		return nil, fmt.Errorf("invalid part number %v", input.PartNumber)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	upload, err := s.lookupUpload(input.Bucket, input.Key, input.UploadId)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := md5.Sum(body)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	upload.parts[input.PartNumber] = multipartPart{body: body, etag: etag}
+
+	return &s3.UploadPartOutput{
+		ETag: aws.String(etag),
+	}, nil
+}
+
+// CompleteMultipartUpload stores the object of the parts of the multipart
+// upload. The parts must be in ascending order, match the uploaded parts'
+// ETags, and every part but the last must be at least 5 MiB.
+func (s *S3) CompleteMultipartUpload(ctx context.Context, input *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (
+	*s3.CompleteMultipartUploadOutput, error,
+) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	upload, err := s.lookupUpload(input.Bucket, input.Key, input.UploadId)
+	if err != nil {
+		return nil, err
+	}
+	if input.MultipartUpload == nil || len(input.MultipartUpload.Parts) == 0 {
+		return nil, fmt.Errorf("multipart upload must have at least one part")
+	}
+
+	var body bytes.Buffer
+	var etags []byte
+	parts := input.MultipartUpload.Parts
+	for i, completed := range parts {
+		if i > 0 && completed.PartNumber <= parts[i-1].PartNumber {
+			return nil, fmt.Errorf("multipart upload parts must be in ascending order")
+		}
+		part, ok := upload.parts[completed.PartNumber]
+		if !ok || part.etag != aws.ToString(completed.ETag) {
+			return nil, fmt.Errorf("multipart upload part %v not found, or ETag does not match",
+				completed.PartNumber)
+		}
+		if i < len(parts)-1 && len(part.body) < minMultipartPartSize {
+			return nil, fmt.Errorf("multipart upload part %v is smaller than the minimum size",
+				completed.PartNumber)
+		}
+		body.Write(part.body)
+		etagSum, _ := hex.DecodeString(strings.Trim(part.etag, `"`))
+		etags = append(etags, etagSum...)
+	}
+
+	sum := md5.Sum(etags)
+	etag := fmt.Sprintf(`"%v-%v"`, hex.EncodeToString(sum[:]), len(parts))
+	s.putObject(upload.bucket, upload.key, Object{
+		Body:        body.Bytes(),
+		ContentType: upload.contentType,
+		Metadata:    upload.metadata,
+		ETag:        etag,
+	})
+	delete(s.uploads, aws.ToString(input.UploadId))
+
+	return &s3.CompleteMultipartUploadOutput{
+		Bucket: aws.String(upload.bucket),
+		Key:    aws.String(upload.key),
+		ETag:   aws.String(etag),
+	}, nil
+}
+
+// AbortMultipartUpload discards the multipart upload, and its parts.
+func (s *S3) AbortMultipartUpload(ctx context.Context, input *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (
+	*s3.AbortMultipartUploadOutput, error,
+) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.lookupUpload(input.Bucket, input.Key, input.UploadId); err != nil {
+		return nil, err
+	}
+	delete(s.uploads, aws.ToString(input.UploadId))
+
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+// ListMultipartUploads returns the in progress multipart uploads of the
+// bucket with keys starting with the prefix, ordered by key, and time
+// initiated. All uploads are returned in a single page.
+func (s *S3) ListMultipartUploads(ctx context.Context, input *s3.ListMultipartUploadsInput, optFns ...func(*s3.Options)) (
+	*s3.ListMultipartUploadsOutput, error,
+) {
+	bucket, prefix := aws.ToString(input.Bucket), aws.ToString(input.Prefix)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.buckets[bucket]; !ok {
+		return nil, &s3types.NoSuchBucket{Message: aws.String("The specified bucket does not exist")}
+	}
+
+	var uploads []s3types.MultipartUpload
+	for id, upload := range s.uploads {
+		if upload.bucket != bucket || !strings.HasPrefix(upload.key, prefix) {
+			continue
+		}
+		uploads = append(uploads, s3types.MultipartUpload{
+			Key:       aws.String(upload.key),
+			UploadId:  aws.String(id),
+			Initiated: aws.Time(upload.initiated),
+		})
+	}
+	sort.Slice(uploads, func(i, j int) bool {
+		if ki, kj := aws.ToString(uploads[i].Key), aws.ToString(uploads[j].Key); ki != kj {
+			return ki < kj
+		}
+		return uploads[i].Initiated.Before(*uploads[j].Initiated)
+	})
+
+	return &s3.ListMultipartUploadsOutput{
+		Bucket:  aws.String(bucket),
+		Prefix:  input.Prefix,
+		Uploads: uploads,
+	}, nil
+}
+
+// MultipartUploadParts returns the number of parts uploaded of the multipart
+// upload, and true if the upload is in progress.
+func (s *S3) MultipartUploadParts(uploadID string) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	upload, ok := s.uploads[uploadID]
+	if !ok {
+		return 0, false
+	}
+	return len(upload.parts), true
+}
+
+func (s *S3) lookupUpload(bucket, key, uploadID *string) (*multipartUpload, error) {
+	upload, ok := s.uploads[aws.ToString(uploadID)]
+	if !ok || upload.bucket != aws.ToString(bucket) || upload.key != aws.ToString(key) {
+		return nil, &s3types.NoSuchUpload{Message: aws.String("The specified upload does not exist.")}
+	}
+	return upload, nil
+}
@@ -0,0 +1,112 @@
+package fakes
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sfn"
+	sfntypes "github.com/aws/aws-sdk-go-v2/service/sfn/types"
+	"github.com/aws/smithy-go/rand"
+)
+
+// Execution is a state machine execution started with the fake Step
+// Functions.
+type Execution struct {
+	ARN             string
+	Name            string
+	StateMachineARN string
+	Input           string
+	StartDate       time.Time
+}
+
+// StepFunctions provides an in-memory stand-in for the AWS Step Functions
+// StartExecution API that records the executions started.
+type StepFunctions struct {
+	// OnStartExecution if set is called with each execution started. Use this
+	// to run the state machine, e.g. in a separate goroutine.
+	OnStartExecution func(Execution)
+
+	mu         sync.Mutex
+	executions []Execution
+}
+
+// NewStepFunctions returns a fake Step Functions with no executions.
+func NewStepFunctions() *StepFunctions {
+	return &StepFunctions{}
+}
+
+// Executions returns the executions started in order.
+func (s *StepFunctions) Executions() []Execution {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Execution(nil), s.executions...)
+}
+
+func (s *StepFunctions) StartExecution(ctx context.Context, params *sfn.StartExecutionInput, optFns ...func(*sfn.Options)) (
+	*sfn.StartExecutionOutput, error,
+) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	stateMachineARN := aws.ToString(params.StateMachineArn)
+	if !strings.Contains(stateMachineARN, ":stateMachine:") {
+		return nil, &sfntypes.InvalidArn{
+			Message: aws.String("Invalid Arn: '" + stateMachineARN + "'"),
+		}
+	}
+
+	name := aws.ToString(params.Name)
+	if name == "" {
+		var err error
+		if name, err = rand.NewUUID(rand.Reader).GetUUID(); err != nil {
+			return nil, fmt.Errorf("failed to get execution name UUID, %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	arn := strings.Replace(stateMachineARN, ":stateMachine:", ":execution:", 1) + ":" + name
+
+	for _, e := range s.executions {
+		if e.ARN != arn {
+			continue
+		}
+		s.mu.Unlock()
+
+		// Starting an execution with the same name and input is idempotent.
+		if e.Input != aws.ToString(params.Input) {
+			return nil, &sfntypes.ExecutionAlreadyExists{
+				Message: aws.String("Execution Already Exists: '" + arn + "'"),
+			}
+		}
+		return &sfn.StartExecutionOutput{
+			ExecutionArn: aws.String(e.ARN),
+			StartDate:    aws.Time(e.StartDate),
+		}, nil
+	}
+
+	execution := Execution{
+		ARN:             arn,
+		Name:            name,
+		StateMachineARN: stateMachineARN,
+		Input:           aws.ToString(params.Input),
+		StartDate:       time.Now().UTC(),
+	}
+	s.executions = append(s.executions, execution)
+	onStart := s.OnStartExecution
+	s.mu.Unlock()
+
+	if onStart != nil {
+		onStart(execution)
+	}
+
+	return &sfn.StartExecutionOutput{
+		ExecutionArn: aws.String(execution.ARN),
+		StartDate:    aws.Time(execution.StartDate),
+	}, nil
+}
@@ -0,0 +1,278 @@
+package fakes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	tr "github.com/aws/aws-sdk-go-v2/service/transcribe"
+	trtypes "github.com/aws/aws-sdk-go-v2/service/transcribe/types"
+)
+
+// TranscriptionScript describes how a fake transcription job progresses.
+type TranscriptionScript struct {
+	// Number of GetTranscriptionJob calls the job is reported IN_PROGRESS for
+	// before the job completes.
+	InProgressChecks int
+
+	// If set the job fails with this reason instead of completing.
+	FailureReason string
+
+	// Language code and transcript text written to the job's output.
+	LanguageCode string
+	Transcript   string
+}
+
+// DefaultTranscriptionScript is used for jobs if the fake Transcribe does not
+// have a Script function.
+var DefaultTranscriptionScript = TranscriptionScript{
+	InProgressChecks: 1,
+	LanguageCode:     "en-US",
+	Transcript:       "Hello and welcome to the podcast. Today we are talking about the AWS SDKs.",
+}
+
+// Transcribe provides a scriptable in-memory stand-in for the Amazon
+// Transcribe StartTranscriptionJob and GetTranscriptionJob APIs. Completed jobs
+// write output JSON in the same format as Amazon Transcribe to the fake S3.
+type Transcribe struct {
+	// Object store the job's media is read from, and output written to.
+	Store *S3
+
+	// Script if set returns how the job started with the input will progress.
+	Script func(*tr.StartTranscriptionJobInput) TranscriptionScript
+
+	mu   sync.Mutex
+	jobs map[string]*transcriptionJob
+}
+
+// NewTranscribe returns a fake Transcribe that reads media from, and writes
+// output to the store.
+func NewTranscribe(store *S3) *Transcribe {
+	return &Transcribe{
+		Store: store,
+		jobs:  map[string]*transcriptionJob{},
+	}
+}
+
+type transcriptionJob struct {
+	job    trtypes.TranscriptionJob
+	script TranscriptionScript
+	checks int
+
+	outputBucket string
+	outputKey    string
+}
+
+func (t *Transcribe) StartTranscriptionJob(ctx context.Context, params *tr.StartTranscriptionJobInput, optFns ...func(*tr.Options)) (
+	*tr.StartTranscriptionJobOutput, error,
+) {
+	name := aws.ToString(params.TranscriptionJobName)
+	if name == "" {
+		return nil, &trtypes.BadRequestException{Message: aws.String("TranscriptionJobName is required")}
+	}
+	if params.Media == nil || aws.ToString(params.Media.MediaFileUri) == "" {
+		return nil, &trtypes.BadRequestException{Message: aws.String("Media.MediaFileUri is required")}
+	}
+
+	script := DefaultTranscriptionScript
+	if t.Script != nil {
+		script = t.Script(params)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.jobs[name]; ok {
+		return nil, &trtypes.ConflictException{
+			Message: aws.String("The requested job name already exists. Use a different job name."),
+		}
+	}
+
+	now := time.Now().UTC()
+	job := &transcriptionJob{
+		job: trtypes.TranscriptionJob{
+			TranscriptionJobName:   aws.String(name),
+			TranscriptionJobStatus: trtypes.TranscriptionJobStatusInProgress,
+			MediaFormat:            params.MediaFormat,
+			Media:                  params.Media,
+			LanguageCode:           params.LanguageCode,
+			IdentifyLanguage:       params.IdentifyLanguage,
+			CreationTime:           aws.Time(now),
+			StartTime:              aws.Time(now),
+		},
+		script:       script,
+		outputBucket: aws.ToString(params.OutputBucketName),
+		outputKey:    aws.ToString(params.OutputKey),
+	}
+	if job.outputKey == "" || strings.HasSuffix(job.outputKey, "/") {
+		job.outputKey += name + ".json"
+	}
+	t.jobs[name] = job
+
+	j := job.job
+	return &tr.StartTranscriptionJobOutput{TranscriptionJob: &j}, nil
+}
+
+func (t *Transcribe) GetTranscriptionJob(ctx context.Context, params *tr.GetTranscriptionJobInput, optFns ...func(*tr.Options)) (
+	*tr.GetTranscriptionJobOutput, error,
+) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	job, ok := t.jobs[aws.ToString(params.TranscriptionJobName)]
+	if !ok {
+		return nil, &trtypes.NotFoundException{
+			Message: aws.String("The requested job couldn't be found. Check the job name and try your request again."),
+		}
+	}
+
+	if job.job.TranscriptionJobStatus == trtypes.TranscriptionJobStatusInProgress {
+		job.checks++
+		if job.checks > job.script.InProgressChecks {
+			t.finishJob(job)
+		}
+	}
+
+	j := job.job
+	return &tr.GetTranscriptionJobOutput{TranscriptionJob: &j}, nil
+}
+
+func (t *Transcribe) finishJob(job *transcriptionJob) {
+	job.job.CompletionTime = aws.Time(time.Now().UTC())
+
+	if job.script.FailureReason != "" {
+		t.failJob(job, job.script.FailureReason)
+		return
+	}
+
+	bucket, key, err := parseMediaFileURI(aws.ToString(job.job.Media.MediaFileUri))
+	if err != nil {
+		t.failJob(job, err.Error())
+		return
+	}
+	if _, ok := t.Store.GetObject(bucket, key); !ok {
+		t.failJob(job, "The media file could not be found at the specified URI. Check the URI and try again.")
+		return
+	}
+
+	output, err := json.Marshal(makeTranscribeOutput(
+		aws.ToString(job.job.TranscriptionJobName), job.script))
+	if err != nil {
+		t.failJob(job, fmt.Sprintf("failed to encode transcription output, %v", err))
+		return
+	}
+	t.Store.PutObject(job.outputBucket, job.outputKey, Object{
+		Body:        output,
+		ContentType: "application/json",
+	})
+
+	job.job.TranscriptionJobStatus = trtypes.TranscriptionJobStatusCompleted
+	job.job.LanguageCode = trtypes.LanguageCode(job.script.LanguageCode)
+	job.job.Transcript = &trtypes.Transcript{
+		TranscriptFileUri: aws.String("https://s3.amazonaws.com/" + job.outputBucket + "/" + job.outputKey),
+	}
+}
+
+func (t *Transcribe) failJob(job *transcriptionJob, reason string) {
+	job.job.TranscriptionJobStatus = trtypes.TranscriptionJobStatusFailed
+	job.job.FailureReason = aws.String(reason)
+}
+
+// parseMediaFileURI returns the bucket and key of a media file URI, either an
+// s3:// URI or path style HTTPS URL.
+func parseMediaFileURI(v string) (bucket, key string, err error) {
+	u, err := url.Parse(v)
+	if err != nil {
+		return "", "", fmt.Errorf("The media file URI is invalid, %v", err)
+	}
+
+	path := strings.TrimPrefix(u.Path, "/")
+	if u.Scheme == "s3" {
+		return u.Host, path, nil
+	}
+
+	parts := strings.SplitN(path, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("The media file URI is invalid, %v", v)
+	}
+	return parts[0], parts[1], nil
+}
+
+type transcribeOutput struct {
+	JobName   string                  `json:"jobName"`
+	AccountID string                  `json:"accountId"`
+	Results   transcribeOutputResults `json:"results"`
+	Status    string                  `json:"status"`
+}
+
+type transcribeOutputResults struct {
+	LanguageCode string                       `json:"language_code"`
+	Transcripts  []transcribeOutputTranscript `json:"transcripts"`
+	Items        []transcribeOutputItem       `json:"items"`
+}
+
+type transcribeOutputTranscript struct {
+	Transcript string `json:"transcript"`
+}
+
+type transcribeOutputItem struct {
+	StartTime    string                        `json:"start_time,omitempty"`
+	EndTime      string                        `json:"end_time,omitempty"`
+	Alternatives []transcribeOutputAlternative `json:"alternatives"`
+	Type         string                        `json:"type"`
+}
+
+type transcribeOutputAlternative struct {
+	Confidence string `json:"confidence"`
+	Content    string `json:"content"`
+}
+
+// makeTranscribeOutput returns the transcription output document for the
+// script, with a pronunciation item per word, and punctuation items.
+func makeTranscribeOutput(jobName string, script TranscriptionScript) transcribeOutput {
+	output := transcribeOutput{
+		JobName:   jobName,
+		AccountID: "123456789012",
+		Results: transcribeOutputResults{
+			LanguageCode: script.LanguageCode,
+			Transcripts: []transcribeOutputTranscript{
+				{Transcript: script.Transcript},
+			},
+			Items: []transcribeOutputItem{},
+		},
+		Status: string(trtypes.TranscriptionJobStatusCompleted),
+	}
+
+	var start float64
+	for _, word := range strings.Fields(script.Transcript) {
+		content := strings.TrimRight(word, ".,?!")
+		punctuation := word[len(content):]
+
+		if content != "" {
+			output.Results.Items = append(output.Results.Items, transcribeOutputItem{
+				StartTime: fmt.Sprintf("%.2f", start),
+				EndTime:   fmt.Sprintf("%.2f", start+0.4),
+				Alternatives: []transcribeOutputAlternative{
+					{Confidence: "0.99", Content: content},
+				},
+				Type: "pronunciation",
+			})
+			start += 0.5
+		}
+		for _, p := range punctuation {
+			output.Results.Items = append(output.Results.Items, transcribeOutputItem{
+				Alternatives: []transcribeOutputAlternative{
+					{Confidence: "0.0", Content: string(p)},
+				},
+				Type: "punctuation",
+			})
+		}
+	}
+
+	return output
+}
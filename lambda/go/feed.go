@@ -0,0 +1,33 @@
+package workshop
+
+import (
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// PodcastFeed provides the structure for storing a podcast feed subscription
+// in Amazon DynamoDB. Subscribed feeds are refreshed periodically to import
+// new episodes.
+type PodcastFeed struct {
+	URL            string `json:"url" dynamodbav:"url"`
+	Title          string `json:"title,omitempty" dynamodbav:"title,omitempty"`
+	MaxNumEpisodes int    `json:"max_num_episodes,omitempty" dynamodbav:"max_num_episodes,omitempty"`
+	SubscribedAt   string `json:"subscribed_at,omitempty" dynamodbav:"subscribed_at,omitempty"`
+
+	// Result of the last fetch of the feed. The ETag and Last-Modified
+	// headers of the feed's response are used to make conditional requests
+	// for the feed.
+	LastFetchedAt string `json:"last_fetched_at,omitempty" dynamodbav:"last_fetched_at,omitempty"`
+	ETag          string `json:"etag,omitempty" dynamodbav:"etag,omitempty"`
+	LastModified  string `json:"last_modified,omitempty" dynamodbav:"last_modified,omitempty"`
+
+	// Error of the last fetch of the feed, if the fetch failed.
+	LastError   string `json:"last_error,omitempty" dynamodbav:"last_error,omitempty"`
+	LastErrorAt string `json:"last_error_at,omitempty" dynamodbav:"last_error_at,omitempty"`
+}
+
+// AttributeValuePrimaryKey returns the DynamoDB key for the feed.
+func (f PodcastFeed) AttributeValuePrimaryKey() map[string]ddbtypes.AttributeValue {
+	return map[string]ddbtypes.AttributeValue{
+		"url": &ddbtypes.AttributeValueMemberS{Value: f.URL},
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	workshop "aws-workshop"
+	"aws-workshop/handlers/getimport"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+func main() {
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		log.Fatalf("failed to load config, %v", err)
+	}
+
+	envCfg := workshop.LoadEnvConfig()
+	handler := &getimport.Handler{
+		DDBClient:          ddb.NewFromConfig(cfg),
+		ImportJobTableName: envCfg.ImportJobTableName,
+	}
+
+	lambda.Start(handler.Handle)
+}
@@ -0,0 +1,111 @@
+package addpodcasts
+
+import "strconv"
+
+const atomNamespace = "http://www.w3.org/2005/Atom"
+
+// AtomFeed is an Atom feed of a podcast, with episodes' media linked with
+// rel="enclosure" links.
+type AtomFeed struct {
+	Title      string         `xml:"http://www.w3.org/2005/Atom title"`
+	Subtitle   string         `xml:"http://www.w3.org/2005/Atom subtitle"`
+	Language   string         `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+	Authors    []AtomPerson   `xml:"http://www.w3.org/2005/Atom author"`
+	Logo       string         `xml:"http://www.w3.org/2005/Atom logo"`
+	Icon       string         `xml:"http://www.w3.org/2005/Atom icon"`
+	Categories []AtomCategory `xml:"http://www.w3.org/2005/Atom category"`
+	Entries    []AtomEntry    `xml:"http://www.w3.org/2005/Atom entry"`
+}
+
+type AtomEntry struct {
+	ID        string       `xml:"http://www.w3.org/2005/Atom id"`
+	Title     string       `xml:"http://www.w3.org/2005/Atom title"`
+	Summary   string       `xml:"http://www.w3.org/2005/Atom summary"`
+	Content   string       `xml:"http://www.w3.org/2005/Atom content"`
+	Published string       `xml:"http://www.w3.org/2005/Atom published"`
+	Updated   string       `xml:"http://www.w3.org/2005/Atom updated"`
+	Authors   []AtomPerson `xml:"http://www.w3.org/2005/Atom author"`
+	Links     []AtomLink   `xml:"http://www.w3.org/2005/Atom link"`
+
+	ITunesDuration string      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+	ITunesEpisode  string      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd episode"`
+	ITunesSeason   string      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd season"`
+	ITunesImage    ITunesImage `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+	ITunesExplicit string      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd explicit"`
+}
+
+type AtomPerson struct {
+	Name string `xml:"http://www.w3.org/2005/Atom name"`
+}
+
+type AtomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+type AtomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+// channel returns the RSS channel equivalent of the Atom feed. Entries'
+// enclosure links are the items' enclosures.
+func (f AtomFeed) channel() Channel {
+	channel := Channel{
+		Title:       f.Title,
+		Description: f.Subtitle,
+		Language:    f.Language,
+		ITunesImage: ITunesImage{Href: f.Logo},
+		Items:       make([]Item, 0, len(f.Entries)),
+	}
+	if channel.ITunesImage.Href == "" {
+		channel.ITunesImage.Href = f.Icon
+	}
+	if len(f.Authors) != 0 {
+		channel.ITunesAuthor = f.Authors[0].Name
+	}
+	for _, category := range f.Categories {
+		name := category.Label
+		if name == "" {
+			name = category.Term
+		}
+		channel.Categories = append(channel.Categories, name)
+	}
+
+	for _, entry := range f.Entries {
+		item := Item{
+			Title:          entry.Title,
+			Description:    entry.Summary,
+			Guid:           entry.ID,
+			PublishedDate:  entry.Published,
+			ITunesDuration: entry.ITunesDuration,
+			ITunesEpisode:  entry.ITunesEpisode,
+			ITunesSeason:   entry.ITunesSeason,
+			ITunesImage:    entry.ITunesImage,
+			ITunesExplicit: entry.ITunesExplicit,
+		}
+		if item.Description == "" {
+			item.Description = entry.Content
+		}
+		if item.PublishedDate == "" {
+			item.PublishedDate = entry.Updated
+		}
+		if len(entry.Authors) != 0 {
+			item.ITunesAuthor = entry.Authors[0].Name
+		}
+		for _, link := range entry.Links {
+			if link.Rel != "enclosure" {
+				continue
+			}
+			length, _ := strconv.ParseInt(link.Length, 10, 64)
+			item.Enclosure = Enclosure{URL: link.Href, Length: length, Type: link.Type}
+			break
+		}
+
+		channel.Items = append(channel.Items, item)
+	}
+
+	return channel
+}
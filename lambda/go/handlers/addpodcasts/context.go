@@ -0,0 +1,21 @@
+package addpodcasts
+
+import (
+	"context"
+	"time"
+)
+
+// detachedContext is a context with the values of its parent, that is not
+// canceled, and has no deadline, when its parent is. Used to record the
+// outcome of work stopped by the parent's cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
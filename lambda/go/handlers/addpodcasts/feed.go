@@ -0,0 +1,110 @@
+package addpodcasts
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+)
+
+// feedFormat is the format of a podcast feed.
+type feedFormat string
+
+const (
+	feedFormatUnknown  feedFormat = ""
+	feedFormatRSS      feedFormat = "RSS"
+	feedFormatAtom     feedFormat = "Atom"
+	feedFormatJSONFeed feedFormat = "JSON Feed"
+)
+
+// feedSniffLen is the number of bytes at the start of a feed its format is
+// detected from, if the feed's content type is not specific to a feed format.
+const feedSniffLen = 8 * 1024
+
+// detectFeedFormat returns the format of the feed from its content type. If
+// the content type is not specific to a feed format, the format is detected
+// from the feed's root element, within the start of the feed's body.
+func detectFeedFormat(contentType string, body []byte) feedFormat {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/rss+xml":
+		return feedFormatRSS
+	case "application/atom+xml":
+		return feedFormatAtom
+	case "application/feed+json":
+		return feedFormatJSONFeed
+	}
+
+	trimmed := bytes.TrimLeft(body, " \t\r\n\ufeff")
+	if len(trimmed) != 0 && trimmed[0] == '{' {
+		return feedFormatJSONFeed
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.Strict = false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return feedFormatUnknown
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case start.Name.Local == "rss":
+			return feedFormatRSS
+		case start.Name.Local == "feed" && start.Name.Space == atomNamespace:
+			return feedFormatAtom
+		default:
+			return feedFormatUnknown
+		}
+	}
+}
+
+// decodeFeed returns the channel of the feed, decoded from the feed's format.
+// Atom and JSON Feed feeds are converted to the RSS channel, so episodes are
+// imported the same way for all feed formats. The feed is decoded as it is
+// read from the body.
+func decodeFeed(contentType string, r io.Reader) (Channel, feedFormat, error) {
+	body := bufio.NewReaderSize(r, feedSniffLen)
+	start, err := body.Peek(feedSniffLen)
+	if err != nil && err != io.EOF {
+		return Channel{}, feedFormatUnknown, fmt.Errorf("failed to read feed, %w", err)
+	}
+
+	format := detectFeedFormat(contentType, start)
+	switch format {
+	case feedFormatRSS:
+		var rss RSS
+		if err := xml.NewDecoder(body).Decode(&rss); err != nil {
+			return Channel{}, format, fmt.Errorf("failed to decode RSS feed, %w", err)
+		}
+		return rss.Channel, format, nil
+
+	case feedFormatAtom:
+		var feed AtomFeed
+		if err := xml.NewDecoder(body).Decode(&feed); err != nil {
+			return Channel{}, format, fmt.Errorf("failed to decode Atom feed, %w", err)
+		}
+		return feed.channel(), format, nil
+
+	case feedFormatJSONFeed:
+		var feed JSONFeed
+		if err := json.NewDecoder(body).Decode(&feed); err != nil {
+			return Channel{}, format, fmt.Errorf("failed to decode JSON Feed, %w", err)
+		}
+		if !strings.HasPrefix(feed.Version, jsonFeedVersionPrefix) {
+			return Channel{}, format, fmt.Errorf("unsupported JSON Feed version, %v", feed.Version)
+		}
+		return feed.channel(), format, nil
+
+	default:
+		return Channel{}, format, fmt.Errorf("unknown feed format, %v", contentType)
+	}
+}
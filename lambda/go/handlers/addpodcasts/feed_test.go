@@ -0,0 +1,201 @@
+package addpodcasts
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	workshop "aws-workshop"
+)
+
+func TestDetectFeedFormat(t *testing.T) {
+	cases := map[string]struct {
+		ContentType string
+		Body        string
+		Expect      feedFormat
+	}{
+		"rss content type": {
+			ContentType: "application/rss+xml; charset=utf-8",
+			Expect:      feedFormatRSS,
+		},
+		"atom content type": {
+			ContentType: "application/atom+xml",
+			Expect:      feedFormatAtom,
+		},
+		"json feed content type": {
+			ContentType: "application/feed+json",
+			Expect:      feedFormatJSONFeed,
+		},
+		"rss root element": {
+			ContentType: "text/xml",
+			Body:        `<?xml version="1.0"?><!-- feed --><rss version="2.0"><channel/></rss>`,
+			Expect:      feedFormatRSS,
+		},
+		"atom root element": {
+			ContentType: "application/xml",
+			Body:        `<feed xmlns="http://www.w3.org/2005/Atom"></feed>`,
+			Expect:      feedFormatAtom,
+		},
+		"feed root element without atom namespace": {
+			ContentType: "application/xml",
+			Body:        `<feed></feed>`,
+			Expect:      feedFormatUnknown,
+		},
+		"json object": {
+			ContentType: "application/json",
+			Body:        "\ufeff\n  {\"version\": \"https://jsonfeed.org/version/1.1\"}",
+			Expect:      feedFormatJSONFeed,
+		},
+		"html": {
+			ContentType: "text/html",
+			Body:        `<html><body>not a feed</body></html>`,
+			Expect:      feedFormatUnknown,
+		},
+		"empty": {
+			Expect: feedFormatUnknown,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			format := detectFeedFormat(c.ContentType, []byte(c.Body))
+			if e, a := c.Expect, format; e != a {
+				t.Errorf("expect %q format, got %q", e, a)
+			}
+		})
+	}
+}
+
+func TestImportRSSFeed(t *testing.T) {
+	cases := map[string]struct {
+		Fixture     string
+		ContentType string
+	}{
+		"rss": {
+			Fixture:     "feed.rss",
+			ContentType: "application/rss+xml",
+		},
+		"rss detected from root element": {
+			Fixture:     "feed.rss",
+			ContentType: "text/xml",
+		},
+		"atom": {
+			Fixture:     "feed.atom",
+			ContentType: "application/atom+xml",
+		},
+		"json feed": {
+			Fixture:     "feed.json",
+			ContentType: "application/feed+json",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			fixture, err := os.ReadFile(filepath.Join("testdata", c.Fixture))
+			if err != nil {
+				t.Fatalf("failed to read fixture, %v", err)
+			}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", c.ContentType)
+				w.Write(fixture)
+			}))
+			defer server.Close()
+
+			h, _, sfnClient := newTestHandler(t)
+			h.HTTPClient = server.Client()
+
+			feedURL := server.URL + "/podcast/feed"
+			episodes, fetched, err := h.importRSSFeed(context.Background(), &ImportRSSFeed{URL: feedURL}, feedResponse{})
+			if err != nil {
+				t.Fatalf("expect no error, got %v", err)
+			}
+			if e, a := "Go Time", fetched.Title; e != a {
+				t.Errorf("expect %q title, got %q", e, a)
+			}
+
+			mustEpisodeID := func(guid string) string {
+				id, err := makeEpisodeID(guid, nil)
+				if err != nil {
+					t.Fatalf("failed to make episode ID, %v", err)
+				}
+				return id
+			}
+			artworkURL := server.URL + "/podcast/artwork.jpg"
+			expect := []workshop.Episode{
+				{
+					ID: mustEpisodeID("episode-1"), Title: "Intro to Go",
+					MediaURL:    "https://cdn.example.com/1.mp3",
+					ImageURL:    artworkURL,
+					PublishedAt: "2022-04-04T17:00:00Z",
+				},
+				{
+					// Relative enclosure and artwork URLs are resolved
+					// relative to the feed's URL.
+					ID: mustEpisodeID("episode-2"), Title: "Go generics",
+					MediaURL:    server.URL + "/media/2.mp3",
+					ImageURL:    server.URL + "/podcast/images/2.jpg",
+					PublishedAt: "2022-04-11T17:00:00Z",
+				},
+				{
+					// Items without an enclosure have no media URL.
+					ID: mustEpisodeID("episode-3"), Title: "Show notes only",
+					ImageURL:    artworkURL,
+					PublishedAt: "2022-04-18T17:00:00Z",
+				},
+				{
+					// Items repeating a GUID have the same ID.
+					ID: mustEpisodeID("episode-1"), Title: "Intro to Go (repost)",
+					MediaURL:    "https://cdn.example.com/1-repost.mp3",
+					ImageURL:    artworkURL,
+					PublishedAt: "2022-04-25T17:00:00Z",
+				},
+			}
+			if e, a := len(expect), len(episodes); e != a {
+				t.Fatalf("expect %v episodes, got %v", e, a)
+			}
+			for i, episode := range episodes {
+				actual := workshop.Episode{
+					ID:          episode.ID,
+					Title:       episode.Title,
+					MediaURL:    episode.MediaURL,
+					ImageURL:    episode.ImageURL,
+					PublishedAt: episode.PublishedAt,
+				}
+				if e, a := expect[i], actual; !reflect.DeepEqual(e, a) {
+					t.Errorf("%v: expect %+v episode, got %+v", i, e, a)
+				}
+				if e, a := "Go Time", episode.Podcast; e != a {
+					t.Errorf("%v: expect %q podcast, got %q", i, e, a)
+				}
+				if e, a := workshop.EpisodeStatusPending, episode.Status; e != a {
+					t.Errorf("%v: expect %v status, got %v", i, e, a)
+				}
+			}
+
+			_, results, err := h.addEpisodes(context.Background(), episodes, nil)
+			if err != nil {
+				t.Fatalf("expect no error, got %v", err)
+			}
+			outcomes := map[string]workshop.EpisodeOutcome{}
+			for _, result := range results {
+				outcomes[result.Title] = result.Outcome
+			}
+			expectOutcomes := map[string]workshop.EpisodeOutcome{
+				"Intro to Go":          workshop.EpisodeOutcomeStarted,
+				"Go generics":          workshop.EpisodeOutcomeStarted,
+				"Show notes only":      workshop.EpisodeOutcomeSkippedNoMedia,
+				"Intro to Go (repost)": workshop.EpisodeOutcomeSkippedDuplicate,
+			}
+			if e, a := expectOutcomes, outcomes; !reflect.DeepEqual(e, a) {
+				t.Errorf("expect %v outcomes, got %v", e, a)
+			}
+			if e, a := 2, len(sfnClient.Executions()); e != a {
+				t.Errorf("expect %v executions, got %v", e, a)
+			}
+		})
+	}
+}
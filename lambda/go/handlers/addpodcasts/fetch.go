@@ -0,0 +1,195 @@
+package addpodcasts
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	workshop "aws-workshop"
+)
+
+// defaultMaxFeedSize is the maximum size of a feed, after decompression, if
+// the Handler does not set MaxFeedSize.
+const defaultMaxFeedSize = 20 * 1024 * 1024
+
+// feedResponse is the metadata of a feed's response. The ETag and
+// Last-Modified validators of a previous response are sent with the request
+// for the feed, so the feed is only downloaded if it has changed.
+type feedResponse struct {
+	Title        string
+	ContentType  string
+	ETag         string
+	LastModified string
+
+	// NotModified is true if the feed has not changed since the response
+	// the validators are from.
+	NotModified bool
+}
+
+// fetchFeed returns the body of the feed, decompressed, and the feed's
+// response metadata. If the feed has not been modified since the cached
+// response, the body is nil, and the cached validators are returned.
+func (h *Handler) fetchFeed(ctx context.Context, url string, cached feedResponse) (
+	io.ReadCloser, feedResponse, error,
+) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, feedResponse{}, err
+	}
+
+	// Setting Accept-Encoding disables the transparent gzip decompression of
+	// the http.Client's transport, the feed's content encoding is decoded
+	// below.
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	if cached.ETag != "" {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+	if cached.LastModified != "" {
+		req.Header.Set("If-Modified-Since", cached.LastModified)
+	}
+
+	resp, err := h.HTTPClient.Do(req)
+	if err != nil {
+		return nil, feedResponse{}, fmt.Errorf("failed to make request for feed, %w", blockedRequestError(err))
+	}
+
+	fetched := feedResponse{
+		ContentType:  resp.Header.Get("Content-Type"),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		resp.Body.Close()
+		log.Printf("feed not modified, %v", url)
+		if fetched.ETag == "" {
+			fetched.ETag = cached.ETag
+		}
+		if fetched.LastModified == "" {
+			fetched.LastModified = cached.LastModified
+		}
+		fetched.NotModified = true
+		return nil, fetched, nil
+	default:
+		resp.Body.Close()
+		return nil, feedResponse{}, fmt.Errorf("failed to get feed, status %v", resp.StatusCode)
+	}
+
+	maxSize := h.MaxFeedSize
+	if maxSize == 0 {
+		maxSize = defaultMaxFeedSize
+	}
+	if resp.ContentLength > maxSize {
+		resp.Body.Close()
+		return nil, feedResponse{}, &feedTooLargeError{maxSize: maxSize}
+	}
+
+	body, err := decodeContentEncoding(resp.Header.Get("Content-Encoding"), resp.Body)
+	if err != nil {
+		resp.Body.Close()
+		return nil, feedResponse{}, err
+	}
+
+	return &feedBody{
+		Reader: &maxSizeReader{reader: body, remaining: maxSize, maxSize: maxSize},
+		closer: resp.Body,
+	}, fetched, nil
+}
+
+// decodeContentEncoding returns a reader decoding the body's gzip or deflate
+// content encoding.
+func decodeContentEncoding(encoding string, body io.Reader) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return body, nil
+
+	case "gzip", "x-gzip":
+		r, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode gzip feed, %w", err)
+		}
+		return r, nil
+
+	case "deflate":
+		// Deflate content encoding is zlib wrapped deflate, but some servers
+		// send raw deflate data without the zlib header.
+		br := bufio.NewReader(body)
+		header, err := br.Peek(2)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode deflate feed, %w", err)
+		}
+		if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+			r, err := zlib.NewReader(br)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode deflate feed, %w", err)
+			}
+			return r, nil
+		}
+		return flate.NewReader(br), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported feed content encoding, %v", encoding)
+	}
+}
+
+// feedBody is the decoded body of a feed, closing the response's body.
+type feedBody struct {
+	io.Reader
+	closer io.Closer
+}
+
+func (b *feedBody) Close() error { return b.closer.Close() }
+
+// maxSizeReader returns a feedTooLargeError if more than maxSize bytes are
+// read from the reader.
+type maxSizeReader struct {
+	reader    io.Reader
+	remaining int64
+	maxSize   int64
+}
+
+func (r *maxSizeReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		// Check if the reader has more data than the max size.
+		var b [1]byte
+		if n, _ := r.reader.Read(b[:]); n != 0 {
+			return 0, &feedTooLargeError{maxSize: r.maxSize}
+		}
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.reader.Read(p)
+	r.remaining -= int64(n)
+	return n, err
+}
+
+type feedTooLargeError struct {
+	maxSize int64
+}
+
+func (e *feedTooLargeError) Error() string {
+	return fmt.Sprintf("feed exceeds the maximum size of %v bytes", e.maxSize)
+}
+
+// blockedRequestError returns a requestError if the request failed because
+// the URL's host is blocked, otherwise the error is returned unchanged.
+func blockedRequestError(err error) error {
+	var blockedErr *workshop.BlockedAddressError
+	if errors.As(err, &blockedErr) {
+		return &requestError{message: fmt.Sprintf("URL host %v is not allowed", blockedErr.Host)}
+	}
+	return err
+}
@@ -0,0 +1,826 @@
+package addpodcasts
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	workshop "aws-workshop"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ddbav "github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	ddbexp "github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sfn"
+	sfntypes "github.com/aws/aws-sdk-go-v2/service/sfn/types"
+)
+
+type Handler struct {
+	SFNClient SFNAPI
+	DDBClient DDBAPI
+
+	MaxNumEpisodes            int
+	EpisodeTableName          string
+	TranscribeStateMachineARN string
+
+	// Maximum size of a feed in bytes, after decompression. Defaults to
+	// 20 MiB if 0.
+	MaxFeedSize int64
+
+	// Maximum number of episodes whose transcribe is started concurrently.
+	// Defaults to 8 if 0.
+	ImportConcurrency int
+
+	// Options of the batch requests getting, and writing episodes.
+	BatchOptions workshop.BatchOptions
+
+	// Table feeds imported are subscribed to. Feeds are not subscribed to if
+	// empty.
+	FeedTableName string
+
+	// Table asynchronous import jobs are recorded in. Asynchronous imports
+	// are not supported if empty.
+	ImportJobTableName string
+
+	HTTPClient   HTTPDoer
+	UUIDProvider UUIDProvider
+}
+
+// APIInput provides the input for adding podcast episodes. At least one of
+// the imports is required. Fields are validated by the rules of their
+// validate tags, see workshop.Validate.
+//
+// If Async is set, the import is run as an import job in the background, and
+// the response is the job queued.
+type APIInput struct {
+	ImportEpisode *ImportEpisode `json:"import_episode,omitempty"`
+	ImportRSSFeed *ImportRSSFeed `json:"import_rss_feed,omitempty"`
+	ImportOPML    *ImportOPML    `json:"import_opml,omitempty"`
+	Async         bool           `json:"async,omitempty"`
+}
+
+// Validate returns an error if the input has no imports.
+func (i APIInput) Validate() workshop.FieldErrors {
+	if i.ImportEpisode == nil && i.ImportRSSFeed == nil && i.ImportOPML == nil {
+		return workshop.FieldErrors{{
+			Message: "one of import_episode, import_rss_feed, or import_opml is required",
+		}}
+	}
+	return nil
+}
+
+// ImportEpisode provides the input for importing a single episode. The
+// content type is optional if it can be obtained when the media is
+// downloaded.
+type ImportEpisode struct {
+	ID          string `json:"id" validate:"max=256"`
+	Title       string `json:"title" validate:"required,max=1024"`
+	Description string `json:"description" validate:"max=65536"`
+	Podcast     string `json:"podcast" validate:"max=1024"`
+	URL         string `json:"url" validate:"required,max=2048,url"`
+	ContentType string `json:"content_type" validate:"max=256,media_content_type"`
+}
+
+// ImportRSSFeed provides the input for importing the episodes of a feed.
+type ImportRSSFeed struct {
+	Title          string `json:"title,omitempty" validate:"max=1024"`
+	URL            string `json:"url,omitempty" validate:"required,max=2048,url"`
+	MaxNumEpisodes int    `json:"max_num_episodes" validate:"min=0"`
+}
+
+// APIOutput is the response of adding podcast episodes. Episodes are the
+// episodes recorded, and Results the outcome of each episode imported,
+// including episodes skipped. The response status is 207 Multi-Status if any
+// episode, or feed, failed to import.
+type APIOutput struct {
+	Message  string                   `json:"message,omitempty"`
+	Episodes []workshop.Episode       `json:"episodes"`
+	Results  []workshop.EpisodeResult `json:"results,omitempty"`
+	Feeds    []FeedImportResult       `json:"feeds,omitempty"`
+}
+
+func (h *Handler) Handle(ctx context.Context, input events.APIGatewayV2HTTPRequest) (
+	*events.APIGatewayV2HTTPResponse, error,
+) {
+	log.Printf("Request:\n%#v", input)
+
+	var apiInput APIInput
+	if err := json.Unmarshal([]byte(input.Body), &apiInput); err != nil {
+		log.Printf("ERROR: failed to unmarshal request body, %v", err)
+		return workshop.NewBadRequestErrorResponse("invalid add podcast request body")
+	}
+	if errs := workshop.Validate(apiInput); errs != nil {
+		log.Printf("ERROR: invalid add podcast request, %v", errs)
+		return workshop.NewValidationErrorResponse(errs)
+	}
+
+	if apiInput.Async {
+		return h.createImportJob(ctx, apiInput)
+	}
+
+	status, output, err := h.runImport(ctx, apiInput, nil)
+	if err != nil {
+		var reqErr *requestError
+		if errors.As(err, &reqErr) {
+			return workshop.NewBadRequestErrorResponse(reqErr.message)
+		}
+		return nil, err
+	}
+	if status == http.StatusBadRequest {
+		return workshop.NewJSONResponse(status, nil, messageOutput{
+			Message: output.Message,
+		})
+	}
+	if status == http.StatusMultiStatus {
+		log.Printf("ERROR: some episodes failed to import")
+	}
+	return workshop.NewJSONResponse(status, nil, output)
+}
+
+// runImport imports the episodes of the input, returning the output and
+// status of the response. The progress of the import is counted if progress
+// is not nil. Errors of the input are returned as a requestError.
+func (h *Handler) runImport(ctx context.Context, apiInput APIInput, progress *jobProgress) (
+	int, APIOutput, error,
+) {
+	var episodes []workshop.Episode
+	if apiInput.ImportEpisode != nil {
+		episode, err := h.importEpisode(apiInput.ImportEpisode)
+		if err != nil {
+			return 0, APIOutput{}, fmt.Errorf("failed to import episode, %w", err)
+		}
+		episodes = append(episodes, episode)
+	}
+
+	var fetched feedResponse
+	if apiInput.ImportRSSFeed != nil {
+		var es []workshop.Episode
+		var err error
+		es, fetched, err = h.importFeed(ctx, apiInput.ImportRSSFeed, feedResponse{})
+		if err != nil {
+			return 0, APIOutput{}, fmt.Errorf("failed to import episodes from RSS feed, %w", err)
+		}
+		episodes = append(episodes, es...)
+	}
+
+	var feeds []FeedImportResult
+	if apiInput.ImportOPML != nil {
+		body, err := h.getOPMLDocument(ctx, apiInput.ImportOPML)
+		if err != nil {
+			return 0, APIOutput{}, fmt.Errorf("failed to get OPML document, %w", err)
+		}
+		opml, err := decodeOPML(body)
+		if err != nil {
+			log.Printf("ERROR: failed to decode OPML document, %v", err)
+			return 0, APIOutput{}, &requestError{message: "invalid OPML document"}
+		}
+		feeds = h.importOPMLFeeds(ctx, opml, apiInput.ImportOPML.MaxNumEpisodes, progress)
+
+		// Episodes of the OPML document's feeds are reported per feed.
+		if len(episodes) == 0 {
+			return outputStatus(nil, feeds), APIOutput{
+				Episodes: []workshop.Episode{},
+				Feeds:    feeds,
+			}, nil
+		}
+	}
+
+	if len(episodes) == 0 {
+		return http.StatusBadRequest, APIOutput{
+			Message: "RSS feed did not contain any episodes",
+		}, nil
+	}
+
+	episodes, results, err := h.addEpisodes(ctx, episodes, progress)
+	if err != nil {
+		return 0, APIOutput{}, err
+	}
+	if apiInput.ImportRSSFeed != nil {
+		h.recordFeedImported(ctx, apiInput.ImportRSSFeed, fetched, results)
+	}
+
+	output := APIOutput{
+		Episodes: episodes,
+		Results:  results,
+		Feeds:    feeds,
+	}
+	if len(episodes) == 0 && feeds == nil {
+		output.Message = "All episodes in RSS feed up to max number episodes are already imported"
+	}
+
+	return outputStatus(results, feeds), output, nil
+}
+
+// requestError is an error importing episodes caused by the request's input.
+type requestError struct {
+	message string
+}
+
+func (e *requestError) Error() string { return e.message }
+
+// outputStatus returns 207 Multi-Status if any of the episodes, or feeds
+// failed to import, otherwise 200 OK.
+func outputStatus(results []workshop.EpisodeResult, feeds []FeedImportResult) int {
+	if hasFailedEpisode(results) {
+		return http.StatusMultiStatus
+	}
+	for _, feed := range feeds {
+		if feed.Error != "" || hasFailedEpisode(feed.Results) {
+			return http.StatusMultiStatus
+		}
+	}
+	return http.StatusOK
+}
+
+// addEpisodes records the episodes not already imported, and starts their
+// transcribe. Returns the episodes added, and the outcome of every episode.
+// Episodes whose transcribe could not be started are recorded as failed,
+// and do not fail the other episodes. Episodes still pending from an import
+// that stopped before starting their transcribe are started again.
+func (h *Handler) addEpisodes(
+	ctx context.Context, episodes []workshop.Episode, progress *jobProgress,
+) ([]workshop.Episode, []workshop.EpisodeResult, error) {
+	if len(episodes) == 0 {
+		return episodes, nil, nil
+	}
+	progress.found(ctx, len(episodes))
+
+	episodes, resumed, duplicates, err := h.filterEpisodes(ctx, episodes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to filter episodes, %w", err)
+	}
+
+	results := make([]workshop.EpisodeResult, 0, len(episodes)+len(resumed)+len(duplicates))
+	for _, episode := range duplicates {
+		results = append(results, newEpisodeResult(episode, workshop.EpisodeOutcomeSkippedDuplicate, nil))
+	}
+	progress.done(ctx, results...)
+	if len(episodes) == 0 && len(resumed) == 0 {
+		return episodes, results, nil
+	}
+
+	// Record the episodes. Resumed episodes are already recorded.
+	if len(episodes) != 0 {
+		if err := h.writeEpisodes(ctx, episodes); err != nil {
+			return nil, nil, fmt.Errorf("failed to record episodes, %w", err)
+		}
+	}
+	episodes = append(episodes, resumed...)
+
+	// Kick off imports of episodes. Failed episodes are reported in their
+	// results, and do not fail the other episodes.
+	started, err := h.startImport(ctx, episodes, progress)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+	}
+	results = append(results, started...)
+
+	return episodes, results, nil
+}
+
+type messageOutput struct {
+	Message string `json:"message"`
+}
+
+func (h *Handler) importEpisode(ep *ImportEpisode) (_ workshop.Episode, err error) {
+	log.Printf("importing episode")
+
+	var id string
+	if ep.ID != "" {
+		id = ep.ID
+	} else {
+		id, err = makeEpisodeID("", h.UUIDProvider)
+		if err != nil {
+			return workshop.Episode{}, err
+		}
+	}
+
+	// Episodes imported directly have no published date, use the time of
+	// import so the episode is included in the indexes by published date.
+	return workshop.Episode{
+		ID:               id,
+		Title:            ep.Title,
+		Description:      ep.Description,
+		PublishedAt:      time.Now().UTC().Format(time.RFC3339),
+		Podcast:          ep.Podcast,
+		MediaURL:         ep.URL,
+		MediaContentType: workshop.NormalizeMediaContentType(ep.ContentType),
+		Status:           workshop.EpisodeStatusPending,
+	}, nil
+}
+
+// importRSSFeed returns the episodes of the feed, and the feed's response
+// metadata. If the feed has not been modified since the cached response, no
+// episodes are returned.
+func (h *Handler) importRSSFeed(ctx context.Context, feed *ImportRSSFeed, cached feedResponse) (
+	[]workshop.Episode, feedResponse, error,
+) {
+	log.Printf("attempting to import episodes from feed")
+	body, fetched, err := h.fetchFeed(ctx, feed.URL, cached)
+	if err != nil {
+		return nil, feedResponse{}, err
+	}
+	if fetched.NotModified {
+		return nil, fetched, nil
+	}
+	defer body.Close()
+
+	channel, format, err := decodeFeed(fetched.ContentType, body)
+	if err != nil {
+		return nil, feedResponse{}, err
+	}
+	fetched.Title = channel.Title
+	if base, err := url.Parse(feed.URL); err == nil {
+		channel.resolveURLs(base)
+	}
+
+	categories := channel.categories()
+	items := limitItems(channel.Items, feed.MaxNumEpisodes, h.MaxNumEpisodes)
+	episodes := make([]workshop.Episode, 0, len(items))
+	log.Printf("found %v episodes in feed, format %v", len(items), format)
+
+	for _, item := range items {
+		log.Printf("episode from feed: %#v", item)
+
+		baseID := item.Guid
+		if baseID == "" {
+			baseID = item.Enclosure.URL
+		}
+
+		id, err := makeEpisodeID(baseID, h.UUIDProvider)
+		if err != nil {
+			return nil, feedResponse{}, err
+		}
+
+		publishedAt, ok := workshop.FormatPublishedAt(item.PublishedDate)
+		if !ok {
+			if item.PublishedDate != "" {
+				log.Printf("unknown published date format, %v", item.PublishedDate)
+			}
+			publishedAt = time.Now().UTC().Format(time.RFC3339)
+		}
+
+		episodes = append(episodes, makeRSSEpisode(id, channel, item, categories, publishedAt))
+	}
+
+	return episodes, fetched, nil
+}
+
+// makeRSSEpisode returns the episode for the RSS feed item. The channel's
+// author, artwork, and explicit flag are used if the item does not set them.
+func makeRSSEpisode(id string, channel Channel, item Item, categories []string, publishedAt string) workshop.Episode {
+	episode := workshop.Episode{
+		ID:            id,
+		Title:         item.Title,
+		Description:   item.Description,
+		PublishedDate: item.PublishedDate,
+		PublishedAt:   publishedAt,
+		Podcast:       channel.Title,
+		Author:        item.ITunesAuthor,
+		Language:      channel.Language,
+		Categories:    categories,
+		ImageURL:      item.ITunesImage.Href,
+		EpisodeNumber: parseITunesNumber(item.ITunesEpisode),
+		SeasonNumber:  parseITunesNumber(item.ITunesSeason),
+		Explicit:      parseITunesExplicit(item.ITunesExplicit),
+		ChaptersURL:   item.Chapters.URL,
+		MediaURL:      item.Enclosure.URL,
+		Status:        workshop.EpisodeStatusPending,
+	}
+	if episode.Author == "" {
+		episode.Author = channel.ITunesAuthor
+	}
+	if episode.ImageURL == "" {
+		episode.ImageURL = channel.ITunesImage.Href
+	}
+	if item.ITunesExplicit == "" {
+		episode.Explicit = parseITunesExplicit(channel.ITunesExplicit)
+	}
+
+	if duration, ok := parseITunesDuration(item.ITunesDuration); ok {
+		episode.DurationSeconds = duration
+	} else if item.ITunesDuration != "" {
+		log.Printf("unknown duration format, %v", item.ITunesDuration)
+	}
+
+	for _, transcript := range item.Transcripts {
+		if transcript.URL == "" {
+			continue
+		}
+		episode.Transcripts = append(episode.Transcripts, workshop.Transcript{
+			URL:      transcript.URL,
+			Type:     transcript.Type,
+			Language: transcript.Language,
+			Rel:      transcript.Rel,
+		})
+	}
+
+	return episode
+}
+
+// filterEpisodes returns the episodes not already imported, the recorded
+// episodes whose transcribe may not have been started, and the duplicate
+// episodes already imported. Episodes that previously failed are imported
+// again.
+func (h *Handler) filterEpisodes(ctx context.Context, episodes []workshop.Episode) (
+	_ []workshop.Episode, resumed []workshop.Episode, duplicates []workshop.Episode, err error,
+) {
+	log.Printf("filtering on %v episodes", len(episodes))
+
+	// Batch requests cannot include the same key more than once, episodes
+	// repeated in the feed are duplicates of the first.
+	keys := make([]map[string]ddbtypes.AttributeValue, 0, len(episodes))
+	seen := make(map[string]bool, len(episodes))
+	unique := make([]workshop.Episode, 0, len(episodes))
+	for _, episode := range episodes {
+		if seen[episode.ID] {
+			log.Printf("filtering out repeated episode %v", episode.ID)
+			duplicates = append(duplicates, episode)
+			continue
+		}
+		seen[episode.ID] = true
+		unique = append(unique, episode)
+
+		log.Printf("searching for episode, %v", episode.ID)
+		keys = append(keys, episode.AttributeValuePrimaryKey())
+	}
+
+	foundItems, err := workshop.BatchGetItems(ctx, h.DDBClient, h.EpisodeTableName, keys, h.BatchOptions)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to get episodes from DynamoDB, %w", err)
+	}
+	log.Printf("BatchGetItem returned %v existing episodes", len(foundItems))
+
+	foundEpisodes := make([]workshop.Episode, 0, len(foundItems))
+	if err = ddbav.UnmarshalListOfMaps(foundItems, &foundEpisodes); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed decode existing episodes in DynamoDB, %w", err)
+	}
+
+	// Episodes that failed are imported again as the next attempt of the
+	// episode, with the attempt's own transcribe execution.
+	filteredEpisodes := make([]workshop.Episode, 0, len(unique))
+	for _, episode := range unique {
+		episode.ImportAttempt = 1
+		if ep, ok := workshop.GetEpisodeByID(foundEpisodes, episode.ID); ok {
+			if ep.Status == workshop.EpisodeStatusPending && ep.TranscribeExecutionARN == "" {
+				// The previous import recorded the episode, but may have
+				// stopped before its transcribe was started. Starting the
+				// attempt's execution again is a no-op if it was started.
+				log.Printf("resuming pending episode %v, attempt %v", ep.ID, ep.ImportAttempt)
+				resumed = append(resumed, ep)
+				continue
+			}
+			if ep.Status != workshop.EpisodeStatusFailure {
+				log.Printf("filtering out known non failed episode %v", episode.ID)
+				duplicates = append(duplicates, episode)
+				continue
+			}
+			episode.ImportAttempt = ep.ImportAttempt + 1
+			log.Printf("importing failed episode %v again, attempt %v", episode.ID, episode.ImportAttempt)
+		}
+		filteredEpisodes = append(filteredEpisodes, episode)
+	}
+
+	return filteredEpisodes, resumed, duplicates, nil
+}
+
+func (h *Handler) writeEpisodes(ctx context.Context, episodes []workshop.Episode) error {
+	writeRequests := make([]ddbtypes.WriteRequest, 0, len(episodes))
+
+	for _, episode := range episodes {
+		av, err := ddbav.MarshalMap(episode)
+		if err != nil {
+			return fmt.Errorf("failed to marshal episodes for DynamoDB, %w", err)
+		}
+
+		writeRequests = append(writeRequests, ddbtypes.WriteRequest{
+			PutRequest: &ddbtypes.PutRequest{
+				Item: av,
+			},
+		})
+	}
+
+	err := workshop.BatchWriteItems(ctx, h.DDBClient, h.EpisodeTableName, writeRequests, h.BatchOptions)
+	if err != nil {
+		return fmt.Errorf("failed to write episodes to DynamoDB, %w", err)
+	}
+
+	return nil
+}
+
+// defaultImportConcurrency is the number of episodes whose transcribe is
+// started concurrently if the handler's ImportConcurrency is not set.
+const defaultImportConcurrency = 8
+
+// startImport starts the transcribe of each episode, updating the episodes
+// with their status and execution ARN. Returns the outcome of each episode,
+// in the order of the episodes. Episodes that fail to start are updated, and
+// recorded, as failed. Episodes are started concurrently, up to the
+// handler's ImportConcurrency, and episodes not started before the context
+// is canceled are failed.
+//
+// The returned error aggregates the errors of the failed episodes, and is
+// nil if no episode failed.
+func (h *Handler) startImport(
+	ctx context.Context, episodes []workshop.Episode, progress *jobProgress,
+) ([]workshop.EpisodeResult, error) {
+	concurrency := h.ImportConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultImportConcurrency
+	}
+
+	results := make([]workshop.EpisodeResult, len(episodes))
+	errs := make([]error, len(episodes))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i := range episodes {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if err := ctx.Err(); err != nil {
+			for j := i; j < len(episodes); j++ {
+				errs[j] = fmt.Errorf("transcribe not started, %w", err)
+				results[j] = h.failEpisode(ctx, &episodes[j], errs[j])
+			}
+			progress.done(ctx, results[i:]...)
+			break
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			results[i], errs[i] = h.startEpisode(ctx, &episodes[i])
+			progress.done(ctx, results[i])
+		}(i)
+	}
+	wg.Wait()
+
+	var failed episodeErrors
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, episodeError{ID: episodes[i].ID, Err: err})
+		}
+	}
+	if len(failed) != 0 {
+		return results, failed
+	}
+	return results, nil
+}
+
+// startEpisode starts the transcribe of the episode, updating the episode
+// with its status and execution ARN. Returns the outcome of the episode, and
+// the reason the episode failed, if it failed.
+func (h *Handler) startEpisode(ctx context.Context, episode *workshop.Episode) (
+	workshop.EpisodeResult, error,
+) {
+	if episode.MediaURL == "" {
+		log.Printf("skipping episode %v, has no media URL", episode.ID)
+		episode.Status = workshop.EpisodeStatusComplete
+		if err := h.updateEpisodeStatus(ctx, *episode); err != nil {
+			return h.failEpisode(ctx, episode, err), err
+		}
+		return newEpisodeResult(*episode, workshop.EpisodeOutcomeSkippedNoMedia, nil), nil
+	}
+
+	executionARN, err := h.startTranscribe(ctx, *episode)
+	if err != nil {
+		return h.failEpisode(ctx, episode, err), err
+	}
+	log.Printf("starting transcribe for %v, %v", episode.ID, executionARN)
+	episode.TranscribeExecutionARN = executionARN
+
+	// Update execution ARN in for episode in table. The transcribe is
+	// already started, so the episode is not failed if the update fails.
+	err = h.updateEpisodeExecutionARN(ctx, *episode)
+	if err != nil {
+		log.Printf("ERROR: failed to update episode %v execution ARN, %v", episode.ID, err)
+		err = fmt.Errorf("transcribe started, but failed to record execution ARN, %w", err)
+	}
+	return newEpisodeResult(*episode, workshop.EpisodeOutcomeStarted, err), nil
+}
+
+// startTranscribe starts the transcribe state machine execution for the
+// episode, returning the execution's ARN. The execution is named for the
+// episode's import attempt, so starting the same attempt again does not start
+// another execution.
+func (h *Handler) startTranscribe(ctx context.Context, episode workshop.Episode) (string, error) {
+	input, err := json.Marshal(workshop.TranscribeStateMachineInput{Episode: episode})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal transcribe input, %w", err)
+	}
+
+	name := executionName(episode)
+	resp, err := h.SFNClient.StartExecution(ctx, &sfn.StartExecutionInput{
+		StateMachineArn: &h.TranscribeStateMachineARN,
+		Name:            &name,
+		Input:           aws.String(string(input)),
+	})
+	if err != nil {
+		// The attempt's execution was already started, e.g. by a retry of
+		// the same request.
+		var existsErr *sfntypes.ExecutionAlreadyExists
+		if errors.As(err, &existsErr) {
+			log.Printf("transcribe execution %v already exists", name)
+			return executionARN(h.TranscribeStateMachineARN, name), nil
+		}
+		return "", fmt.Errorf("failed to start episode transcribe, %w", err)
+	}
+	return aws.ToString(resp.ExecutionArn), nil
+}
+
+// maxExecutionNameLen is the maximum length of a Step Functions execution
+// name.
+const maxExecutionNameLen = 80
+
+// executionName returns the name of the transcribe execution of the
+// episode's import attempt. Episode IDs that are not valid in execution
+// names are hashed.
+func executionName(episode workshop.Episode) string {
+	suffix := "-" + strconv.Itoa(episode.ImportAttempt)
+
+	id := episode.ID
+	if !isExecutionNameSafe(id) || len(id)+len(suffix) > maxExecutionNameLen {
+		sum := sha256.Sum256([]byte(id))
+		id = hex.EncodeToString(sum[:])
+	}
+	return id + suffix
+}
+
+// isExecutionNameSafe returns if the value only contains characters valid in
+// execution names, and also safe in URLs and logs.
+func isExecutionNameSafe(v string) bool {
+	if v == "" {
+		return false
+	}
+	for _, r := range v {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// executionARN returns the ARN of the state machine's execution.
+func executionARN(stateMachineARN, name string) string {
+	return strings.Replace(stateMachineARN, ":stateMachine:", ":execution:", 1) + ":" + name
+}
+
+// failEpisodeTimeout is the maximum time spent recording an episode as
+// failed.
+const failEpisodeTimeout = 5 * time.Second
+
+// failEpisode records the episode as failed, returning the episode's failed
+// outcome with the reason. The failure is recorded even if the context is
+// canceled, e.g. the episode failed because the import's deadline passed.
+func (h *Handler) failEpisode(ctx context.Context, episode *workshop.Episode, reason error) workshop.EpisodeResult {
+	log.Printf("ERROR: failed to import episode %v, %v", episode.ID, reason)
+
+	ctx, cancel := context.WithTimeout(detachedContext{parent: ctx}, failEpisodeTimeout)
+	defer cancel()
+
+	episode.Status = workshop.EpisodeStatusFailure
+	if err := h.updateEpisodeStatus(ctx, *episode); err != nil {
+		log.Printf("ERROR: failed to record episode %v as failed, %v", episode.ID, err)
+		reason = fmt.Errorf("%v, and failed to record failure, %w", reason, err)
+	}
+	return newEpisodeResult(*episode, workshop.EpisodeOutcomeFailed, reason)
+}
+
+func (h *Handler) updateEpisodeStatus(ctx context.Context, episode workshop.Episode) error {
+	log.Printf("updating episode %v with status, %v",
+		episode.ID, episode.Status)
+
+	exp, err := ddbexp.NewBuilder().WithUpdate(
+		ddbexp.Set(
+			ddbexp.Name("status"),
+			ddbexp.Value(episode.Status),
+		),
+	).Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression, %w", err)
+	}
+
+	_, err = h.DDBClient.UpdateItem(ctx, &ddb.UpdateItemInput{
+		TableName: &h.EpisodeTableName,
+		Key: workshop.Episode{
+			ID: episode.ID,
+		}.AttributeValuePrimaryKey(),
+		UpdateExpression:          exp.Update(),
+		ExpressionAttributeNames:  exp.Names(),
+		ExpressionAttributeValues: exp.Values(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update episode, %w", err)
+	}
+
+	return nil
+}
+
+func (h *Handler) updateEpisodeExecutionARN(ctx context.Context, episode workshop.Episode) error {
+	log.Printf("updating episode %v with execution ARN, %v",
+		episode.ID, episode.TranscribeExecutionARN)
+
+	exp, err := ddbexp.NewBuilder().WithUpdate(
+		ddbexp.Set(
+			ddbexp.Name("transcribe_execution_arn"),
+			ddbexp.Value(episode.TranscribeExecutionARN),
+		),
+	).Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression, %w", err)
+	}
+
+	_, err = h.DDBClient.UpdateItem(ctx, &ddb.UpdateItemInput{
+		TableName: &h.EpisodeTableName,
+		Key: workshop.Episode{
+			ID: episode.ID,
+		}.AttributeValuePrimaryKey(),
+		UpdateExpression:          exp.Update(),
+		ExpressionAttributeNames:  exp.Names(),
+		ExpressionAttributeValues: exp.Values(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update episode, %w", err)
+	}
+
+	return nil
+}
+
+type SFNAPI interface {
+	StartExecution(context.Context, *sfn.StartExecutionInput, ...func(*sfn.Options)) (
+		*sfn.StartExecutionOutput, error,
+	)
+}
+
+type DDBAPI interface {
+	workshop.BatchWriteItemAPI
+	workshop.BatchGetItemAPI
+	PutItem(context.Context, *ddb.PutItemInput, ...func(*ddb.Options)) (
+		*ddb.PutItemOutput, error,
+	)
+	UpdateItem(context.Context, *ddb.UpdateItemInput, ...func(*ddb.Options)) (
+		*ddb.UpdateItemOutput, error,
+	)
+	Scan(context.Context, *ddb.ScanInput, ...func(*ddb.Options)) (
+		*ddb.ScanOutput, error,
+	)
+}
+
+type HTTPDoer interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+type UUIDProvider interface {
+	GetUUID() (string, error)
+}
+
+func makeEpisodeID(id string, provider UUIDProvider) (_ string, err error) {
+	if id != "" {
+		// RSS feed GUID are an opaque values, in order to prevent issues with
+		// various places the Id is used, create a hash of the original GUID
+		// and store that instead.
+		h := sha256.New()
+		h.Write([]byte(id))
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	id, err = provider.GetUUID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get new UUID, %w", err)
+	}
+	return id, nil
+}
+
+func limitItems(items []Item, ask, max int) []Item {
+	if ask == 0 && max == 0 {
+		return items
+	}
+	if ask == 0 || ask > max {
+		ask = max
+	}
+
+	if len(items) < ask {
+		return items
+	}
+
+	return items[:ask]
+}
@@ -0,0 +1,147 @@
+package addpodcasts
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	workshop "aws-workshop"
+	"aws-workshop/fakes"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ddbav "github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+const (
+	testEpisodeTableName = "PodcastEpisode"
+	testStateMachineARN  = "arn:aws:states:us-west-2:123456789012:stateMachine:transcribe"
+)
+
+func newTestHandler(t *testing.T, episodes ...workshop.Episode) (*Handler, *fakes.DynamoDB, *fakes.StepFunctions) {
+	t.Helper()
+
+	client := fakes.NewDynamoDB()
+	client.CreateTable(testEpisodeTableName, "id", "")
+	for _, episode := range episodes {
+		item, err := ddbav.MarshalMap(episode)
+		if err != nil {
+			t.Fatalf("failed to marshal episode, %v", err)
+		}
+		_, err = client.PutItem(context.Background(), &ddb.PutItemInput{
+			TableName: aws.String(testEpisodeTableName),
+			Item:      item,
+		})
+		if err != nil {
+			t.Fatalf("failed to put episode, %v", err)
+		}
+	}
+	sfnClient := fakes.NewStepFunctions()
+
+	return &Handler{
+		SFNClient:                 sfnClient,
+		DDBClient:                 client,
+		EpisodeTableName:          testEpisodeTableName,
+		TranscribeStateMachineARN: testStateMachineARN,
+	}, client, sfnClient
+}
+
+func getTestEpisode(t *testing.T, client *fakes.DynamoDB, id string) workshop.Episode {
+	t.Helper()
+
+	resp, err := client.GetItem(context.Background(), &ddb.GetItemInput{
+		TableName: aws.String(testEpisodeTableName),
+		Key:       workshop.Episode{ID: id}.AttributeValuePrimaryKey(),
+	})
+	if err != nil {
+		t.Fatalf("failed to get episode, %v", err)
+	}
+	var episode workshop.Episode
+	if err := ddbav.UnmarshalMap(resp.Item, &episode); err != nil {
+		t.Fatalf("failed to unmarshal episode, %v", err)
+	}
+	return episode
+}
+
+func TestStartImport_Canceled(t *testing.T) {
+	episodes := []workshop.Episode{
+		{ID: "1", Title: "Intro to Go", MediaURL: "https://example.com/1.mp3",
+			Status: workshop.EpisodeStatusPending, ImportAttempt: 1},
+		{ID: "2", Title: "Go generics", MediaURL: "https://example.com/2.mp3",
+			Status: workshop.EpisodeStatusPending, ImportAttempt: 1},
+	}
+	h, client, sfnClient := newTestHandler(t, episodes...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results, err := h.startImport(ctx, episodes, nil)
+	if err == nil {
+		t.Fatalf("expect error, got none")
+	}
+	if e, a := 0, len(sfnClient.Executions()); e != a {
+		t.Errorf("expect %v executions, got %v", e, a)
+	}
+
+	// The episodes' failure is recorded even though the context is canceled.
+	for i, result := range results {
+		if e, a := workshop.EpisodeOutcomeFailed, result.Outcome; e != a {
+			t.Errorf("%v: expect %v outcome, got %v", i, e, a)
+		}
+		if e, a := workshop.EpisodeStatusFailure, getTestEpisode(t, client, episodes[i].ID).Status; e != a {
+			t.Errorf("%v: expect %v status, got %v", i, e, a)
+		}
+	}
+}
+
+func TestAddEpisodes_ResumePending(t *testing.T) {
+	stopped := workshop.Episode{
+		ID: "1", Title: "Intro to Go", MediaURL: "https://example.com/1.mp3",
+		Status: workshop.EpisodeStatusPending, ImportAttempt: 2,
+	}
+	started := workshop.Episode{
+		ID: "2", Title: "Go generics", MediaURL: "https://example.com/2.mp3",
+		Status: workshop.EpisodeStatusPending, ImportAttempt: 1,
+		TranscribeExecutionARN: testStateMachineARN + ":2-1",
+	}
+	h, client, sfnClient := newTestHandler(t, stopped, started)
+
+	feed := []workshop.Episode{
+		{ID: "1", Title: "Intro to Go", MediaURL: "https://example.com/1.mp3"},
+		{ID: "2", Title: "Go generics", MediaURL: "https://example.com/2.mp3"},
+	}
+	for i := 0; i < 2; i++ {
+		_, results, err := h.addEpisodes(context.Background(), append([]workshop.Episode{}, feed...), nil)
+		if err != nil {
+			t.Fatalf("%v: expect no error, got %v", i, err)
+		}
+
+		outcomes := map[string]workshop.EpisodeOutcome{}
+		for _, result := range results {
+			outcomes[result.ID] = result.Outcome
+		}
+		expect := map[string]workshop.EpisodeOutcome{
+			"1": workshop.EpisodeOutcomeStarted,
+			"2": workshop.EpisodeOutcomeSkippedDuplicate,
+		}
+		if i != 0 {
+			// The resumed episode's execution is recorded, so it is not
+			// started again.
+			expect["1"] = workshop.EpisodeOutcomeSkippedDuplicate
+		}
+		if e, a := expect, outcomes; !reflect.DeepEqual(e, a) {
+			t.Errorf("%v: expect %v outcomes, got %v", i, e, a)
+		}
+	}
+
+	executions := sfnClient.Executions()
+	if e, a := 1, len(executions); e != a {
+		t.Fatalf("expect %v executions, got %v", e, a)
+	}
+	if e, a := executionName(stopped), executions[0].Name; e != a {
+		t.Errorf("expect %v execution, got %v", e, a)
+	}
+	if e, a := executions[0].ARN, getTestEpisode(t, client, "1").TranscribeExecutionARN; e != a {
+		t.Errorf("expect %v execution ARN, got %v", e, a)
+	}
+}
@@ -0,0 +1,439 @@
+package addpodcasts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	workshop "aws-workshop"
+
+	"github.com/aws/aws-lambda-go/events"
+	ddbav "github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	ddbexp "github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	// importJobTTL is how long import jobs are kept after they are created.
+	importJobTTL = 7 * 24 * time.Hour
+
+	// importJobProgressInterval is the minimum time between updates of a
+	// running job's progress.
+	importJobProgressInterval = time.Second
+
+	// importJobFinishTime is the time reserved at the end of the worker's
+	// invocation to record the job's result.
+	importJobFinishTime = 10 * time.Second
+
+	// importJobLease is how long a job is claimed for, if the worker's
+	// invocation has no deadline. Otherwise the claim expires at the
+	// deadline, when the worker is stopped.
+	importJobLease = 15 * time.Minute
+
+	// importJobMaxResultsSize is the maximum encoded size of the results,
+	// and feeds, recorded in the job's item. Leaves room for the job's other
+	// attributes within DynamoDB's 400 KB item size limit.
+	importJobMaxResultsSize = 300 * 1024
+)
+
+// createImportJob records an import job for the input, to be run by the
+// import-worker Lambda. Responds with 202 Accepted, and the job's location.
+func (h *Handler) createImportJob(ctx context.Context, input APIInput) (
+	*events.APIGatewayV2HTTPResponse, error,
+) {
+	if h.ImportJobTableName == "" {
+		return workshop.NewBadRequestErrorResponse("asynchronous imports are not supported")
+	}
+
+	id, err := h.UUIDProvider.GetUUID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get import job ID, %w", err)
+	}
+
+	input.Async = false
+	request, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal import job request, %w", err)
+	}
+
+	now := time.Now().UTC()
+	job := workshop.ImportJob{
+		ID:        id,
+		Status:    workshop.ImportJobStatusQueued,
+		Request:   string(request),
+		CreatedAt: now.Format(time.RFC3339),
+		ExpiresAt: now.Add(importJobTTL).Unix(),
+	}
+
+	item, err := ddbav.MarshalMap(job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal import job, %w", err)
+	}
+
+	exp, err := ddbexp.NewBuilder().WithCondition(
+		ddbexp.AttributeNotExists(ddbexp.Name("id")),
+	).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build condition expression, %w", err)
+	}
+
+	_, err = h.DDBClient.PutItem(ctx, &ddb.PutItemInput{
+		TableName:                 &h.ImportJobTableName,
+		Item:                      item,
+		ConditionExpression:       exp.Condition(),
+		ExpressionAttributeNames:  exp.Names(),
+		ExpressionAttributeValues: exp.Values(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record import job, %w", err)
+	}
+	log.Printf("created import job %v", id)
+
+	header := http.Header{}
+	header.Set("Location", "/imports/"+id)
+	return workshop.NewJSONResponse(http.StatusAccepted, header, job)
+}
+
+// HandleImportJobs runs the import jobs inserted into the import job table.
+// Invoked with the table's stream. The result of each job is recorded in the
+// job, only errors recording the job are returned.
+func (h *Handler) HandleImportJobs(ctx context.Context, event events.DynamoDBEvent) error {
+	for _, record := range event.Records {
+		if record.EventName != string(events.DynamoDBOperationTypeInsert) {
+			continue
+		}
+
+		id := record.Change.Keys["id"].String()
+		if err := h.runImportJob(ctx, id); err != nil {
+			return fmt.Errorf("failed to run import job %v, %w", id, err)
+		}
+	}
+	return nil
+}
+
+// runImportJob runs the queued import job, recording the job's progress, and
+// result. Jobs not queued, e.g. already run, are skipped, unless the job's
+// previous worker stopped before the job finished.
+func (h *Handler) runImportJob(ctx context.Context, id string) error {
+	job, err := h.claimImportJob(ctx, id)
+	if err != nil {
+		return err
+	}
+	if job == nil {
+		log.Printf("import job %v not queued, skipping", id)
+		return nil
+	}
+	log.Printf("running import job %v", id)
+
+	// Stop importing before the invocation's deadline, so the job's result
+	// can still be recorded.
+	importCtx := ctx
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		importCtx, cancel = context.WithDeadline(ctx, deadline.Add(-importJobFinishTime))
+		defer cancel()
+	}
+
+	progress := &jobProgress{handler: h, jobID: id}
+	output, err := h.runImportJobRequest(importCtx, *job, progress)
+
+	job.Status = workshop.ImportJobStatusComplete
+	job.Progress = progress.snapshot()
+	job.Message = output.Message
+	job.Results = output.Results
+	for _, feed := range output.Feeds {
+		job.Results = append(job.Results, feed.Results...)
+		job.Feeds = append(job.Feeds, workshop.ImportJobFeed{
+			Title:       feed.Title,
+			URL:         feed.URL,
+			NumEpisodes: len(feed.Results),
+			Error:       feed.Error,
+		})
+	}
+	if err != nil {
+		log.Printf("ERROR: import job %v failed, %v", id, err)
+		job.Status = workshop.ImportJobStatusFailed
+		job.Error = err.Error()
+	}
+	limitImportJobResults(job)
+
+	if err := h.finishImportJob(ctx, *job); err != nil {
+		return err
+	}
+	log.Printf("import job %v %v, %+v", id, job.Status, job.Progress)
+	return nil
+}
+
+// runImportJobRequest runs the job's import. A panic importing is returned
+// as an error, so the job is recorded as failed instead of left running.
+func (h *Handler) runImportJobRequest(ctx context.Context, job workshop.ImportJob, progress *jobProgress) (
+	output APIOutput, err error,
+) {
+	defer func() {
+		if r := recover(); r != nil {
+			output, err = APIOutput{}, fmt.Errorf("import job panicked, %v", r)
+		}
+	}()
+
+	var input APIInput
+	if err := json.Unmarshal([]byte(job.Request), &input); err != nil {
+		return APIOutput{}, fmt.Errorf("invalid import job request, %w", err)
+	}
+
+	status, output, err := h.runImport(ctx, input, progress)
+	if err == nil && status >= 400 {
+		err = errors.New(output.Message)
+		output.Message = ""
+	}
+	return output, err
+}
+
+// claimImportJob updates the queued job to running, and returns the job.
+// Running jobs whose claim has expired are claimed again. If the job is not
+// queued, or is claimed by another worker, nil is returned.
+func (h *Handler) claimImportJob(ctx context.Context, id string) (*workshop.ImportJob, error) {
+	now := time.Now().UTC()
+	leaseExpiresAt := now.Add(importJobLease)
+	if deadline, ok := ctx.Deadline(); ok {
+		leaseExpiresAt = deadline
+	}
+
+	exp, err := ddbexp.NewBuilder().WithUpdate(
+		ddbexp.Set(
+			ddbexp.Name("status"), ddbexp.Value(workshop.ImportJobStatusRunning),
+		).Set(
+			ddbexp.Name("updated_at"), ddbexp.Value(now.Format(time.RFC3339)),
+		).Set(
+			ddbexp.Name("claimed_at"), ddbexp.Value(now.Format(time.RFC3339Nano)),
+		).Set(
+			ddbexp.Name("lease_expires_at"), ddbexp.Value(leaseExpiresAt.Unix()),
+		),
+	).WithCondition(
+		ddbexp.Or(
+			ddbexp.Name("status").Equal(ddbexp.Value(workshop.ImportJobStatusQueued)),
+			ddbexp.And(
+				ddbexp.Name("status").Equal(ddbexp.Value(workshop.ImportJobStatusRunning)),
+				ddbexp.Name("lease_expires_at").LessThanEqual(ddbexp.Value(now.Unix())),
+			),
+		),
+	).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build update expression, %w", err)
+	}
+
+	resp, err := h.DDBClient.UpdateItem(ctx, &ddb.UpdateItemInput{
+		TableName:                 &h.ImportJobTableName,
+		Key:                       workshop.ImportJob{ID: id}.AttributeValuePrimaryKey(),
+		UpdateExpression:          exp.Update(),
+		ConditionExpression:       exp.Condition(),
+		ExpressionAttributeNames:  exp.Names(),
+		ExpressionAttributeValues: exp.Values(),
+		ReturnValues:              ddbtypes.ReturnValueAllNew,
+	})
+	if err != nil {
+		var condErr *ddbtypes.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to claim import job, %w", err)
+	}
+
+	var job workshop.ImportJob
+	if err := ddbav.UnmarshalMap(resp.Attributes, &job); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal import job, %w", err)
+	}
+	return &job, nil
+}
+
+// finishImportJob records the result of the job, if the job is still
+// claimed by this worker.
+func (h *Handler) finishImportJob(ctx context.Context, job workshop.ImportJob) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	update := ddbexp.Set(ddbexp.Name("status"), ddbexp.Value(job.Status)).
+		Set(ddbexp.Name("updated_at"), ddbexp.Value(now)).
+		Set(ddbexp.Name("completed_at"), ddbexp.Value(now)).
+		Set(ddbexp.Name("progress"), ddbexp.Value(job.Progress)).
+		Remove(ddbexp.Name("lease_expires_at"))
+	update = setOrRemove(update, "message", job.Message)
+	update = setOrRemove(update, "error", job.Error)
+	if len(job.Results) != 0 {
+		update = update.Set(ddbexp.Name("results"), ddbexp.Value(job.Results))
+	}
+	if len(job.Feeds) != 0 {
+		update = update.Set(ddbexp.Name("feeds"), ddbexp.Value(job.Feeds))
+	}
+	if job.ResultsOmitted != 0 {
+		update = update.Set(ddbexp.Name("results_omitted"), ddbexp.Value(job.ResultsOmitted))
+	}
+	if job.FeedsOmitted != 0 {
+		update = update.Set(ddbexp.Name("feeds_omitted"), ddbexp.Value(job.FeedsOmitted))
+	}
+
+	exp, err := ddbexp.NewBuilder().WithUpdate(update).WithCondition(
+		ddbexp.Name("claimed_at").Equal(ddbexp.Value(job.ClaimedAt)),
+	).Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression, %w", err)
+	}
+
+	_, err = h.DDBClient.UpdateItem(ctx, &ddb.UpdateItemInput{
+		TableName:                 &h.ImportJobTableName,
+		Key:                       workshop.ImportJob{ID: job.ID}.AttributeValuePrimaryKey(),
+		UpdateExpression:          exp.Update(),
+		ConditionExpression:       exp.Condition(),
+		ExpressionAttributeNames:  exp.Names(),
+		ExpressionAttributeValues: exp.Values(),
+	})
+	if err != nil {
+		var condErr *ddbtypes.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			log.Printf("import job %v claimed by another worker, result not recorded", job.ID)
+			return nil
+		}
+		return fmt.Errorf("failed to record import job result, %w", err)
+	}
+	return nil
+}
+
+// limitImportJobResults omits the job's feeds, and results, beyond those
+// that fit in importJobMaxResultsSize, counting the number omitted. Feeds
+// are kept before results, as there are fewer of them.
+func limitImportJobResults(job *workshop.ImportJob) {
+	remaining := importJobMaxResultsSize
+
+	n := 0
+	for ; n < len(job.Feeds); n++ {
+		if remaining = remaining - encodedSize(job.Feeds[n]); remaining < 0 {
+			break
+		}
+	}
+	job.FeedsOmitted = len(job.Feeds) - n
+	job.Feeds = job.Feeds[:n]
+
+	n = 0
+	for ; n < len(job.Results); n++ {
+		if remaining = remaining - encodedSize(job.Results[n]); remaining < 0 {
+			break
+		}
+	}
+	job.ResultsOmitted = len(job.Results) - n
+	job.Results = job.Results[:n]
+}
+
+// encodedSize returns the size of the value's JSON encoding, an estimate of
+// the size of the value's DynamoDB attribute.
+func encodedSize(v interface{}) int {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return 0
+	}
+	return len(b)
+}
+
+func (h *Handler) updateImportJob(ctx context.Context, id string, update ddbexp.UpdateBuilder) error {
+	exp, err := ddbexp.NewBuilder().WithUpdate(update).Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression, %w", err)
+	}
+
+	_, err = h.DDBClient.UpdateItem(ctx, &ddb.UpdateItemInput{
+		TableName:                 &h.ImportJobTableName,
+		Key:                       workshop.ImportJob{ID: id}.AttributeValuePrimaryKey(),
+		UpdateExpression:          exp.Update(),
+		ExpressionAttributeNames:  exp.Names(),
+		ExpressionAttributeValues: exp.Values(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update import job, %w", err)
+	}
+	return nil
+}
+
+// jobProgress counts the episodes of a running import job, periodically
+// recording the progress in the job. A nil jobProgress counts nothing, for
+// imports not run as a job.
+type jobProgress struct {
+	handler *Handler
+	jobID   string
+
+	mu         sync.Mutex
+	progress   workshop.ImportJobProgress
+	lastUpdate time.Time
+	updating   bool
+}
+
+// found adds the number of episodes found to the total.
+func (p *jobProgress) found(ctx context.Context, n int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.progress.Total += n
+	progress, ok := p.startUpdate()
+	p.mu.Unlock()
+
+	if ok {
+		p.update(ctx, progress)
+	}
+}
+
+// done counts the outcomes of the episodes.
+func (p *jobProgress) done(ctx context.Context, results ...workshop.EpisodeResult) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	for _, result := range results {
+		p.progress.Add(result.Outcome)
+	}
+	progress, ok := p.startUpdate()
+	p.mu.Unlock()
+
+	if ok {
+		p.update(ctx, progress)
+	}
+}
+
+func (p *jobProgress) snapshot() workshop.ImportJobProgress {
+	if p == nil {
+		return workshop.ImportJobProgress{}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.progress
+}
+
+// startUpdate returns a snapshot of the progress to record in the job, if the
+// progress was not recorded recently, and is not being recorded. Must be
+// called with the mutex held.
+func (p *jobProgress) startUpdate() (workshop.ImportJobProgress, bool) {
+	if p.updating || time.Since(p.lastUpdate) < importJobProgressInterval {
+		return workshop.ImportJobProgress{}, false
+	}
+	p.updating = true
+	p.lastUpdate = time.Now()
+	return p.progress, true
+}
+
+// update records the snapshot of the progress in the job. The mutex is not
+// held while the job is updated, so counting episodes is not blocked by the
+// request. Errors are logged, and do not fail the import.
+func (p *jobProgress) update(ctx context.Context, progress workshop.ImportJobProgress) {
+	err := p.handler.updateImportJob(ctx, p.jobID,
+		ddbexp.Set(ddbexp.Name("progress"), ddbexp.Value(progress)).
+			Set(ddbexp.Name("updated_at"), ddbexp.Value(time.Now().UTC().Format(time.RFC3339))))
+	if err != nil {
+		log.Printf("ERROR: failed to update import job %v progress, %v", p.jobID, err)
+	}
+
+	p.mu.Lock()
+	p.updating = false
+	p.mu.Unlock()
+}
@@ -0,0 +1,206 @@
+package addpodcasts
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	workshop "aws-workshop"
+	"aws-workshop/fakes"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ddbav "github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	ddbexp "github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+const testImportJobTableName = "PodcastImportJob"
+
+func newTestJobHandler(t *testing.T, jobs ...workshop.ImportJob) (*Handler, *fakes.DynamoDB) {
+	t.Helper()
+
+	client := fakes.NewDynamoDB()
+	client.CreateTable(testImportJobTableName, "id", "")
+	for _, job := range jobs {
+		item, err := ddbav.MarshalMap(job)
+		if err != nil {
+			t.Fatalf("failed to marshal import job, %v", err)
+		}
+		_, err = client.PutItem(context.Background(), &ddb.PutItemInput{
+			TableName: aws.String(testImportJobTableName),
+			Item:      item,
+		})
+		if err != nil {
+			t.Fatalf("failed to put import job, %v", err)
+		}
+	}
+
+	return &Handler{
+		DDBClient:          client,
+		ImportJobTableName: testImportJobTableName,
+	}, client
+}
+
+func getTestImportJob(t *testing.T, client *fakes.DynamoDB, id string) workshop.ImportJob {
+	t.Helper()
+
+	resp, err := client.GetItem(context.Background(), &ddb.GetItemInput{
+		TableName: aws.String(testImportJobTableName),
+		Key:       workshop.ImportJob{ID: id}.AttributeValuePrimaryKey(),
+	})
+	if err != nil {
+		t.Fatalf("failed to get import job, %v", err)
+	}
+	var job workshop.ImportJob
+	if err := ddbav.UnmarshalMap(resp.Item, &job); err != nil {
+		t.Fatalf("failed to unmarshal import job, %v", err)
+	}
+	return job
+}
+
+func TestClaimImportJob(t *testing.T) {
+	now := time.Now()
+
+	cases := map[string]struct {
+		Job         workshop.ImportJob
+		ExpectClaim bool
+	}{
+		"queued": {
+			Job:         workshop.ImportJob{ID: "1", Status: workshop.ImportJobStatusQueued},
+			ExpectClaim: true,
+		},
+		"running": {
+			Job: workshop.ImportJob{ID: "1", Status: workshop.ImportJobStatusRunning,
+				LeaseExpiresAt: now.Add(time.Minute).Unix()},
+		},
+		"running lease expired": {
+			Job: workshop.ImportJob{ID: "1", Status: workshop.ImportJobStatusRunning,
+				LeaseExpiresAt: now.Add(-time.Minute).Unix()},
+			ExpectClaim: true,
+		},
+		"complete": {
+			Job: workshop.ImportJob{ID: "1", Status: workshop.ImportJobStatusComplete},
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			h, client := newTestJobHandler(t, c.Job)
+
+			ctx, cancel := context.WithDeadline(context.Background(), now.Add(5*time.Minute))
+			defer cancel()
+
+			job, err := h.claimImportJob(ctx, c.Job.ID)
+			if err != nil {
+				t.Fatalf("expect no error, got %v", err)
+			}
+			if e, a := c.ExpectClaim, job != nil; e != a {
+				t.Fatalf("expect claimed %v, got %v", e, a)
+			}
+			if !c.ExpectClaim {
+				if e, a := c.Job, getTestImportJob(t, client, c.Job.ID); !reflect.DeepEqual(e, a) {
+					t.Errorf("expect job unchanged %v, got %v", e, a)
+				}
+				return
+			}
+
+			if e, a := workshop.ImportJobStatusRunning, job.Status; e != a {
+				t.Errorf("expect %v status, got %v", e, a)
+			}
+			if job.ClaimedAt == "" {
+				t.Errorf("expect claimed at")
+			}
+			if e, a := now.Add(5*time.Minute).Unix(), job.LeaseExpiresAt; e != a {
+				t.Errorf("expect lease to expire at %v, got %v", e, a)
+			}
+
+			// The claimed job cannot be claimed again until the lease expires.
+			again, err := h.claimImportJob(ctx, c.Job.ID)
+			if err != nil {
+				t.Fatalf("expect no error, got %v", err)
+			}
+			if again != nil {
+				t.Errorf("expect job not claimed again")
+			}
+		})
+	}
+}
+
+func TestFinishImportJob(t *testing.T) {
+	h, client := newTestJobHandler(t, workshop.ImportJob{ID: "1", Status: workshop.ImportJobStatusQueued})
+
+	first, err := h.claimImportJob(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	// Expire the first worker's claim, so the job is claimed by a retry.
+	expire := ddbexp.Set(ddbexp.Name("lease_expires_at"), ddbexp.Value(time.Now().Add(-time.Minute).Unix()))
+	if err := h.updateImportJob(context.Background(), "1", expire); err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	second, err := h.claimImportJob(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if second == nil {
+		t.Fatalf("expect job claimed by retry")
+	}
+
+	// The first worker's result is not recorded over the retry's claim.
+	first.Status = workshop.ImportJobStatusFailed
+	first.Error = "stopped"
+	if err := h.finishImportJob(context.Background(), *first); err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if e, a := workshop.ImportJobStatusRunning, getTestImportJob(t, client, "1").Status; e != a {
+		t.Errorf("expect %v status, got %v", e, a)
+	}
+
+	second.Status = workshop.ImportJobStatusComplete
+	if err := h.finishImportJob(context.Background(), *second); err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	job := getTestImportJob(t, client, "1")
+	if e, a := workshop.ImportJobStatusComplete, job.Status; e != a {
+		t.Errorf("expect %v status, got %v", e, a)
+	}
+	if job.LeaseExpiresAt != 0 {
+		t.Errorf("expect lease removed, got %v", job.LeaseExpiresAt)
+	}
+}
+
+func TestLimitImportJobResults(t *testing.T) {
+	result := workshop.EpisodeResult{
+		ID:      strings.Repeat("a", 64),
+		Title:   strings.Repeat("t", 1024),
+		Outcome: workshop.EpisodeOutcomeFailed,
+		Error:   strings.Repeat("e", 1024),
+	}
+	job := workshop.ImportJob{
+		Feeds: []workshop.ImportJobFeed{{URL: "https://example.com/feed.xml", NumEpisodes: 1000}},
+	}
+	for i := 0; i < 1000; i++ {
+		job.Results = append(job.Results, result)
+	}
+
+	limitImportJobResults(&job)
+
+	if e, a := 1, len(job.Feeds); e != a {
+		t.Errorf("expect %v feeds, got %v", e, a)
+	}
+	if e, a := 0, job.FeedsOmitted; e != a {
+		t.Errorf("expect %v feeds omitted, got %v", e, a)
+	}
+	if e, a := 1000, len(job.Results)+job.ResultsOmitted; e != a {
+		t.Errorf("expect %v results counted, got %v", e, a)
+	}
+	if job.ResultsOmitted == 0 {
+		t.Errorf("expect results omitted")
+	}
+	// DynamoDB's item size limit.
+	if size := encodedSize(job); size > 400*1024 {
+		t.Errorf("expect job within item size limit, got %v bytes", size)
+	}
+}
@@ -0,0 +1,123 @@
+package addpodcasts
+
+import (
+	"strconv"
+	"strings"
+)
+
+// jsonFeedVersionPrefix is the prefix of the version URL of JSON Feed 1.0 and
+// 1.1 feeds.
+const jsonFeedVersionPrefix = "https://jsonfeed.org/version/1"
+
+// JSONFeed is a JSON Feed of a podcast, with episodes' media as item
+// attachments.
+type JSONFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	Description string           `json:"description"`
+	Language    string           `json:"language"`
+	Icon        string           `json:"icon"`
+	Authors     []JSONFeedAuthor `json:"authors"`
+	Author      *JSONFeedAuthor  `json:"author"` // JSON Feed 1.0
+	Items       []JSONFeedItem   `json:"items"`
+}
+
+type JSONFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+type JSONFeedItem struct {
+	ID            string               `json:"id"`
+	Title         string               `json:"title"`
+	Summary       string               `json:"summary"`
+	ContentText   string               `json:"content_text"`
+	ContentHTML   string               `json:"content_html"`
+	Image         string               `json:"image"`
+	DatePublished string               `json:"date_published"`
+	DateModified  string               `json:"date_modified"`
+	Authors       []JSONFeedAuthor     `json:"authors"`
+	Author        *JSONFeedAuthor      `json:"author"` // JSON Feed 1.0
+	Attachments   []JSONFeedAttachment `json:"attachments"`
+}
+
+type JSONFeedAttachment struct {
+	URL               string  `json:"url"`
+	MimeType          string  `json:"mime_type"`
+	SizeInBytes       int64   `json:"size_in_bytes"`
+	DurationInSeconds float64 `json:"duration_in_seconds"`
+}
+
+// channel returns the RSS channel equivalent of the JSON Feed. The first audio
+// or video attachment of each item is the item's enclosure.
+func (f JSONFeed) channel() Channel {
+	channel := Channel{
+		Title:        f.Title,
+		Description:  f.Description,
+		Language:     f.Language,
+		ITunesImage:  ITunesImage{Href: f.Icon},
+		ITunesAuthor: jsonFeedAuthorName(f.Authors, f.Author),
+		Items:        make([]Item, 0, len(f.Items)),
+	}
+
+	for _, feedItem := range f.Items {
+		item := Item{
+			Title:         feedItem.Title,
+			Description:   feedItem.Summary,
+			Guid:          feedItem.ID,
+			PublishedDate: feedItem.DatePublished,
+			ITunesImage:   ITunesImage{Href: feedItem.Image},
+			ITunesAuthor:  jsonFeedAuthorName(feedItem.Authors, feedItem.Author),
+		}
+		if item.Description == "" {
+			item.Description = feedItem.ContentText
+		}
+		if item.Description == "" {
+			item.Description = feedItem.ContentHTML
+		}
+		if item.PublishedDate == "" {
+			item.PublishedDate = feedItem.DateModified
+		}
+
+		if attachment, ok := jsonFeedMediaAttachment(feedItem.Attachments); ok {
+			item.Enclosure = Enclosure{
+				URL:    attachment.URL,
+				Length: attachment.SizeInBytes,
+				Type:   attachment.MimeType,
+			}
+			if attachment.DurationInSeconds > 0 {
+				item.ITunesDuration = strconv.FormatInt(int64(attachment.DurationInSeconds), 10)
+			}
+		}
+
+		channel.Items = append(channel.Items, item)
+	}
+
+	return channel
+}
+
+// jsonFeedAuthorName returns the name of the first author, using the JSON
+// Feed 1.0 author if there are no authors.
+func jsonFeedAuthorName(authors []JSONFeedAuthor, author *JSONFeedAuthor) string {
+	if len(authors) != 0 {
+		return authors[0].Name
+	}
+	if author != nil {
+		return author.Name
+	}
+	return ""
+}
+
+// jsonFeedMediaAttachment returns the first audio or video attachment, or
+// the first attachment if none are audio or video.
+func jsonFeedMediaAttachment(attachments []JSONFeedAttachment) (JSONFeedAttachment, bool) {
+	for _, attachment := range attachments {
+		if strings.HasPrefix(attachment.MimeType, "audio/") ||
+			strings.HasPrefix(attachment.MimeType, "video/") {
+			return attachment, true
+		}
+	}
+	if len(attachments) != 0 {
+		return attachments[0], true
+	}
+	return JSONFeedAttachment{}, false
+}
@@ -0,0 +1,170 @@
+package addpodcasts
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	workshop "aws-workshop"
+)
+
+// maxOPMLDocumentSize is the maximum size in bytes of an OPML document,
+// inline in the input, or downloaded from the input's URL.
+const maxOPMLDocumentSize = 1024 * 1024
+
+// ImportOPML provides the input for importing the feeds listed in an OPML
+// document. Either the document, or URL of the document is required.
+type ImportOPML struct {
+	Document       string `json:"document,omitempty" validate:"max=1048576"`
+	URL            string `json:"url,omitempty" validate:"max=2048,url"`
+	MaxNumEpisodes int    `json:"max_num_episodes" validate:"min=0"` // per feed
+}
+
+// Validate returns an error unless exactly one of the document or URL is
+// set.
+func (i ImportOPML) Validate() workshop.FieldErrors {
+	if (i.Document == "") == (i.URL == "") {
+		return workshop.FieldErrors{{
+			Message: "one of document or url is required, but not both",
+		}}
+	}
+	return nil
+}
+
+// FeedImportResult is the result of importing a feed listed in an OPML
+// document, with the outcome of each of the feed's episodes. Error is set if
+// the feed's episodes could not be imported.
+type FeedImportResult struct {
+	Title    string                   `json:"title,omitempty"`
+	URL      string                   `json:"url"`
+	Episodes []workshop.Episode       `json:"episodes"`
+	Results  []workshop.EpisodeResult `json:"results,omitempty"`
+	Error    string                   `json:"error,omitempty"`
+}
+
+// getOPMLDocument returns the OPML document inline in the input, or
+// downloaded from the input's URL. Documents larger than the maximum size
+// are returned as a requestError.
+func (h *Handler) getOPMLDocument(ctx context.Context, input *ImportOPML) ([]byte, error) {
+	if input.Document != "" {
+		return []byte(input.Document), nil
+	}
+
+	log.Printf("downloading OPML document")
+	req, err := http.NewRequestWithContext(ctx, "GET", input.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := h.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request for OPML document, %w", blockedRequestError(err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get OPML document, status %v", resp.StatusCode)
+	}
+
+	tooLarge := &requestError{
+		message: fmt.Sprintf("OPML document exceeds the maximum size of %v bytes", maxOPMLDocumentSize),
+	}
+	if resp.ContentLength > maxOPMLDocumentSize {
+		return nil, tooLarge
+	}
+
+	var body bytes.Buffer
+	reader := &maxSizeReader{reader: resp.Body, remaining: maxOPMLDocumentSize, maxSize: maxOPMLDocumentSize}
+	if _, err = io.Copy(&body, reader); err != nil {
+		var sizeErr *feedTooLargeError
+		if errors.As(err, &sizeErr) {
+			return nil, tooLarge
+		}
+		return nil, fmt.Errorf("failed to read OPML document, %w", err)
+	}
+	return body.Bytes(), nil
+}
+
+// decodeOPML returns the OPML document decoded from the body.
+func decodeOPML(body []byte) (workshop.OPML, error) {
+	var opml workshop.OPML
+	if err := xml.NewDecoder(bytes.NewReader(body)).Decode(&opml); err != nil {
+		return workshop.OPML{}, err
+	}
+	return opml, nil
+}
+
+// importOPMLFeeds imports the episodes of each feed listed in the OPML
+// document, returning the result of each feed. Feeds are imported
+// independently, a feed failing to import does not prevent the remaining
+// feeds from being imported. The episodes of all feeds are counted in the
+// progress.
+func (h *Handler) importOPMLFeeds(
+	ctx context.Context, opml workshop.OPML, maxNumEpisodes int, progress *jobProgress,
+) []FeedImportResult {
+	outlines := opml.FeedOutlines()
+	log.Printf("found %v feeds in OPML document", len(outlines))
+
+	results := make([]FeedImportResult, 0, len(outlines))
+	seen := map[string]bool{}
+	for _, outline := range outlines {
+		feedURL := strings.TrimSpace(outline.XMLURL)
+		if seen[feedURL] {
+			continue
+		}
+		seen[feedURL] = true
+
+		title := outline.Title
+		if title == "" {
+			title = outline.Text
+		}
+		result := FeedImportResult{
+			Title:    title,
+			URL:      feedURL,
+			Episodes: []workshop.Episode{},
+		}
+
+		if err := ctx.Err(); err != nil {
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+
+		feed := &ImportRSSFeed{
+			Title:          title,
+			URL:            feedURL,
+			MaxNumEpisodes: maxNumEpisodes,
+		}
+		if errs := workshop.Validate(feed); errs != nil {
+			result.Error = errs.Error()
+			results = append(results, result)
+			continue
+		}
+
+		episodes, fetched, err := h.importFeed(ctx, feed, feedResponse{})
+		var episodeResults []workshop.EpisodeResult
+		if err == nil {
+			episodes, episodeResults, err = h.addEpisodes(ctx, episodes, progress)
+		}
+		if err == nil {
+			h.recordFeedImported(ctx, feed, fetched, episodeResults)
+		}
+		if err != nil {
+			log.Printf("ERROR: failed to import feed %v, %v", feedURL, err)
+			result.Error = err.Error()
+		} else {
+			result.Episodes = episodes
+			result.Results = episodeResults
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
@@ -0,0 +1,73 @@
+package addpodcasts
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestHandle_OPMLDocumentSize(t *testing.T) {
+	const opml = `<?xml version="1.0"?><opml version="2.0"><head/><body/></opml>`
+	oversized := opml + strings.Repeat(" ", maxOPMLDocumentSize)
+
+	cases := map[string]struct {
+		Document      string
+		ContentLength bool
+		ExpectStatus  int
+	}{
+		"within max size": {
+			Document:     opml,
+			ExpectStatus: http.StatusOK,
+		},
+		"oversized content length": {
+			Document:      oversized,
+			ContentLength: true,
+			ExpectStatus:  http.StatusBadRequest,
+		},
+		"oversized chunked": {
+			Document:     oversized,
+			ExpectStatus: http.StatusBadRequest,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/x-opml")
+				if c.ContentLength {
+					w.Header().Set("Content-Length", strconv.Itoa(len(c.Document)))
+				}
+				w.Write([]byte(c.Document))
+			}))
+			defer server.Close()
+
+			h, _, _ := newTestHandler(t)
+			h.HTTPClient = server.Client()
+
+			body, err := json.Marshal(APIInput{
+				ImportOPML: &ImportOPML{URL: server.URL + "/subscriptions.opml"},
+			})
+			if err != nil {
+				t.Fatalf("failed to marshal input, %v", err)
+			}
+			resp, err := h.Handle(context.Background(), events.APIGatewayV2HTTPRequest{Body: string(body)})
+			if err != nil {
+				t.Fatalf("expect no error, got %v", err)
+			}
+			if e, a := c.ExpectStatus, resp.StatusCode; e != a {
+				t.Errorf("expect %v status, got %v, %v", e, a, resp.Body)
+			}
+			if c.ExpectStatus == http.StatusBadRequest {
+				if e, a := "maximum size", resp.Body; !strings.Contains(a, e) {
+					t.Errorf("expect %q in body, got %v", e, a)
+				}
+			}
+		})
+	}
+}
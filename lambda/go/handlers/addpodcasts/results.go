@@ -0,0 +1,68 @@
+package addpodcasts
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	workshop "aws-workshop"
+)
+
+func newEpisodeResult(episode workshop.Episode, outcome workshop.EpisodeOutcome, err error) workshop.EpisodeResult {
+	result := workshop.EpisodeResult{
+		ID:      episode.ID,
+		Title:   episode.Title,
+		Outcome: outcome,
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// hasFailedEpisode returns if any of the results are failed.
+func hasFailedEpisode(results []workshop.EpisodeResult) bool {
+	for _, result := range results {
+		if result.Outcome == workshop.EpisodeOutcomeFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// episodeError is the reason an episode failed to import.
+type episodeError struct {
+	ID  string
+	Err error
+}
+
+// episodeErrors aggregates the errors of the episodes that failed to import.
+type episodeErrors []episodeError
+
+// maxEpisodeErrorsListed is the maximum number of episode errors included in
+// the aggregated error's message.
+const maxEpisodeErrorsListed = 5
+
+func (e episodeErrors) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "failed to import %v episodes", len(e))
+	for i, err := range e {
+		if i == maxEpisodeErrorsListed {
+			fmt.Fprintf(&sb, "; and %v more", len(e)-i)
+			break
+		}
+		fmt.Fprintf(&sb, "; %v, %v", err.ID, err.Err)
+	}
+	return sb.String()
+}
+
+// Is returns if any of the episodes' errors is the target, e.g.
+// context.DeadlineExceeded.
+func (e episodeErrors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err.Err, target) {
+			return true
+		}
+	}
+	return false
+}
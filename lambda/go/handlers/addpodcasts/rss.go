@@ -0,0 +1,182 @@
+package addpodcasts
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// RSS feed of a podcast. Elements of the iTunes
+// (http://www.itunes.com/dtds/podcast-1.0.dtd) and Podcasting 2.0
+// (https://podcastindex.org/namespace/1.0) namespaces are matched by namespace
+// URL, not the prefix the feed uses for the namespace. Fields without a
+// namespace match elements of any namespace, so namespaced fields are
+// declared first to match the namespaced elements.
+type RSS struct {
+	Channel Channel `xml:"channel"`
+}
+
+type Channel struct {
+	ITunesTitle      string           `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd title"`
+	ITunesAuthor     string           `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd author"`
+	ITunesImage      ITunesImage      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+	ITunesExplicit   string           `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd explicit"`
+	ITunesCategories []ITunesCategory `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd category"`
+
+	Title       string   `xml:"title"`
+	Description string   `xml:"description"`
+	Language    string   `xml:"language"`
+	Categories  []string `xml:"category"`
+	Items       []Item   `xml:"item"`
+}
+
+type Item struct {
+	ITunesTitle    string      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd title"`
+	ITunesDuration string      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+	ITunesEpisode  string      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd episode"`
+	ITunesSeason   string      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd season"`
+	ITunesImage    ITunesImage `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+	ITunesExplicit string      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd explicit"`
+	ITunesAuthor   string      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd author"`
+
+	Transcripts []PodcastTranscript `xml:"https://podcastindex.org/namespace/1.0 transcript"`
+	Chapters    PodcastChapters     `xml:"https://podcastindex.org/namespace/1.0 chapters"`
+
+	Title         string    `xml:"title"`
+	Description   string    `xml:"description"`
+	Guid          string    `xml:"guid"`
+	Enclosure     Enclosure `xml:"enclosure"`
+	PublishedDate string    `xml:"pubDate"`
+}
+
+type Enclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type ITunesImage struct {
+	Href string `xml:"href,attr"`
+}
+
+// ITunesCategory is a category of the podcast, with optional subcategories.
+type ITunesCategory struct {
+	Text          string           `xml:"text,attr"`
+	Subcategories []ITunesCategory `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd category"`
+}
+
+type PodcastTranscript struct {
+	URL      string `xml:"url,attr"`
+	Type     string `xml:"type,attr"`
+	Language string `xml:"language,attr"`
+	Rel      string `xml:"rel,attr"`
+}
+
+type PodcastChapters struct {
+	URL  string `xml:"url,attr"`
+	Type string `xml:"type,attr"`
+}
+
+// categories returns the names of the channel's RSS and iTunes categories,
+// including subcategories, without duplicates.
+func (c Channel) categories() []string {
+	var names []string
+	seen := map[string]bool{}
+	add := func(name string) {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			return
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+
+	for _, name := range c.Categories {
+		add(name)
+	}
+	var addITunes func([]ITunesCategory)
+	addITunes = func(categories []ITunesCategory) {
+		for _, category := range categories {
+			add(category.Text)
+			addITunes(category.Subcategories)
+		}
+	}
+	addITunes(c.ITunesCategories)
+
+	return names
+}
+
+// resolveURLs resolves the channel's and items' artwork, enclosure, chapters,
+// and transcript URLs relative to the feed's URL.
+func (c *Channel) resolveURLs(base *url.URL) {
+	c.ITunesImage.Href = resolveFeedURL(base, c.ITunesImage.Href)
+	for i := range c.Items {
+		item := &c.Items[i]
+		item.ITunesImage.Href = resolveFeedURL(base, item.ITunesImage.Href)
+		item.Enclosure.URL = resolveFeedURL(base, item.Enclosure.URL)
+		item.Chapters.URL = resolveFeedURL(base, item.Chapters.URL)
+		for j := range item.Transcripts {
+			item.Transcripts[j].URL = resolveFeedURL(base, item.Transcripts[j].URL)
+		}
+	}
+}
+
+// resolveFeedURL returns the link resolved relative to the feed's URL. Empty
+// links, and links that are not valid URLs are returned unchanged.
+func resolveFeedURL(base *url.URL, link string) string {
+	link = strings.TrimSpace(link)
+	if link == "" {
+		return link
+	}
+	ref, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	return base.ResolveReference(ref).String()
+}
+
+// parseITunesDuration returns the number of seconds of the itunes:duration
+// value, either seconds, or HH:MM:SS or MM:SS. Returns false if the value is
+// not a valid duration.
+func parseITunesDuration(v string) (int64, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+
+	parts := strings.Split(v, ":")
+	if len(parts) > 3 {
+		return 0, false
+	}
+
+	var seconds float64
+	for _, part := range parts {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil || n < 0 {
+			return 0, false
+		}
+		seconds = seconds*60 + n
+	}
+	return int64(seconds), true
+}
+
+// parseITunesNumber returns the positive integer value of the itunes:episode
+// or itunes:season element, or 0 if the value is not a positive integer.
+func parseITunesNumber(v string) int {
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// parseITunesExplicit returns if the itunes:explicit value marks the content
+// as explicit. Values other than true, yes, and explicit are not explicit.
+func parseITunesExplicit(v string) bool {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "true", "yes", "explicit":
+		return true
+	default:
+		return false
+	}
+}
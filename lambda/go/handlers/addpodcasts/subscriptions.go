@@ -0,0 +1,245 @@
+package addpodcasts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	workshop "aws-workshop"
+
+	"github.com/aws/aws-lambda-go/events"
+	ddbav "github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	ddbexp "github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// importFeed returns the episodes of the feed, subscribing to the feed, and
+// recording the result of fetching the feed in the feed's subscription. The
+// feed is only downloaded if it was modified since the cached response. The
+// fetched response's validators are recorded with recordFeedImported once the
+// episodes are imported.
+func (h *Handler) importFeed(ctx context.Context, feed *ImportRSSFeed, cached feedResponse) (
+	[]workshop.Episode, feedResponse, error,
+) {
+	episodes, fetched, err := h.importRSSFeed(ctx, feed, cached)
+	if err != nil {
+		if recordErr := h.recordFeedError(ctx, feed, err); recordErr != nil {
+			log.Printf("ERROR: failed to record feed %v error, %v", feed.URL, recordErr)
+		}
+		return nil, feedResponse{}, err
+	}
+
+	if err := h.recordFeedFetched(ctx, feed, fetched); err != nil {
+		return nil, feedResponse{}, err
+	}
+	for i := range episodes {
+		episodes[i].FeedURL = feed.URL
+	}
+
+	return episodes, fetched, nil
+}
+
+// HandleRefresh refreshes all subscribed feeds, importing episodes of the
+// feeds not already imported. Invoked on a schedule. Feeds are refreshed
+// independently, with errors refreshing a feed recorded in the feed's
+// subscription.
+func (h *Handler) HandleRefresh(ctx context.Context, event events.CloudWatchEvent) error {
+	log.Printf("Event:\n%#v", event)
+
+	feeds, err := h.getSubscribedFeeds(ctx)
+	if err != nil {
+		return err
+	}
+	log.Printf("refreshing %v subscribed feeds", len(feeds))
+
+	var numFailed, numImported, numEpisodesFailed int
+	for _, feed := range feeds {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("failed to refresh feeds, %w", err)
+		}
+
+		input := &ImportRSSFeed{
+			Title:          feed.Title,
+			URL:            feed.URL,
+			MaxNumEpisodes: feed.MaxNumEpisodes,
+		}
+		episodes, fetched, err := h.importFeed(ctx, input, feedResponse{
+			ETag:         feed.ETag,
+			LastModified: feed.LastModified,
+		})
+		if err != nil {
+			log.Printf("ERROR: failed to refresh feed %v, %v", feed.URL, err)
+			numFailed++
+			continue
+		}
+
+		episodes, results, err := h.addEpisodes(ctx, episodes, nil)
+		if err != nil {
+			log.Printf("ERROR: failed to import feed %v episodes, %v", feed.URL, err)
+			if recordErr := h.recordFeedError(ctx, input, err); recordErr != nil {
+				log.Printf("ERROR: failed to record feed %v error, %v", feed.URL, recordErr)
+			}
+			numFailed++
+			continue
+		}
+		log.Printf("imported %v new episodes from feed %v", len(episodes), feed.URL)
+		numImported += len(episodes)
+		h.recordFeedImported(ctx, input, fetched, results)
+
+		// Failed episodes are imported again when the feed is next refreshed.
+		for _, result := range results {
+			if result.Outcome == workshop.EpisodeOutcomeFailed {
+				numEpisodesFailed++
+			}
+		}
+	}
+
+	log.Printf("refreshed %v feeds, %v failed, %v new episodes, %v episodes failed",
+		len(feeds), numFailed, numImported, numEpisodesFailed)
+	return nil
+}
+
+// getSubscribedFeeds returns all feeds in the feed table.
+func (h *Handler) getSubscribedFeeds(ctx context.Context) ([]workshop.PodcastFeed, error) {
+	if h.FeedTableName == "" {
+		return nil, fmt.Errorf("feed table name not set")
+	}
+
+	var feeds []workshop.PodcastFeed
+	var startKey map[string]ddbtypes.AttributeValue
+	for {
+		resp, err := h.DDBClient.Scan(ctx, &ddb.ScanInput{
+			TableName:         &h.FeedTableName,
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get subscribed feeds, %w", err)
+		}
+
+		var items []workshop.PodcastFeed
+		if err := ddbav.UnmarshalListOfMaps(resp.Items, &items); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal feed items, %w", err)
+		}
+		feeds = append(feeds, items...)
+
+		if len(resp.LastEvaluatedKey) == 0 {
+			return feeds, nil
+		}
+		startKey = resp.LastEvaluatedKey
+	}
+}
+
+// recordFeedFetched subscribes to the feed if not already subscribed, and
+// records the feed was fetched successfully.
+func (h *Handler) recordFeedFetched(ctx context.Context, feed *ImportRSSFeed, fetched feedResponse) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	title := feed.Title
+	if title == "" {
+		title = fetched.Title
+	}
+
+	update := subscribeFeedUpdate(feed, now).
+		Set(ddbexp.Name("last_fetched_at"), ddbexp.Value(now)).
+		Remove(ddbexp.Name("last_error")).
+		Remove(ddbexp.Name("last_error_at"))
+	if title != "" {
+		update = update.Set(ddbexp.Name("title"), ddbexp.Value(title))
+	}
+
+	return h.updateFeed(ctx, feed, update, ddbexp.ConditionBuilder{})
+}
+
+// recordFeedImported records the ETag and Last-Modified validators of the
+// feed's response, after the feed's episodes are imported. The validators are
+// not recorded if any episode failed to import, so the feed is downloaded
+// again, and the failed episodes imported, the next time the feed is
+// refreshed. Errors recording the validators are logged, since the episodes
+// are already imported.
+func (h *Handler) recordFeedImported(ctx context.Context, feed *ImportRSSFeed,
+	fetched feedResponse, results []workshop.EpisodeResult,
+) {
+	if hasFailedEpisode(results) {
+		return
+	}
+
+	update := setOrRemove(ddbexp.UpdateBuilder{}, "etag", fetched.ETag)
+	update = setOrRemove(update, "last_modified", fetched.LastModified)
+
+	err := h.updateFeed(ctx, feed, update, ddbexp.AttributeExists(ddbexp.Name("url")))
+	var notSubscribed *ddbtypes.ConditionalCheckFailedException
+	if err != nil && !errors.As(err, &notSubscribed) {
+		log.Printf("ERROR: failed to record feed %v validators, %v", feed.URL, err)
+	}
+}
+
+// recordFeedError records the error importing the feed, if the feed is
+// subscribed to. Feeds that fail to import are not subscribed to.
+func (h *Handler) recordFeedError(ctx context.Context, feed *ImportRSSFeed, importErr error) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	update := ddbexp.Set(ddbexp.Name("last_error"), ddbexp.Value(importErr.Error())).
+		Set(ddbexp.Name("last_error_at"), ddbexp.Value(now))
+
+	err := h.updateFeed(ctx, feed, update, ddbexp.AttributeExists(ddbexp.Name("url")))
+	var notSubscribed *ddbtypes.ConditionalCheckFailedException
+	if errors.As(err, &notSubscribed) {
+		return nil
+	}
+	return err
+}
+
+// subscribeFeedUpdate returns the update expression for subscribing to the
+// feed, keeping the time of the first subscription.
+func subscribeFeedUpdate(feed *ImportRSSFeed, now string) ddbexp.UpdateBuilder {
+	update := ddbexp.Set(ddbexp.Name("subscribed_at"),
+		ddbexp.IfNotExists(ddbexp.Name("subscribed_at"), ddbexp.Value(now)))
+	if feed.MaxNumEpisodes != 0 {
+		update = update.Set(ddbexp.Name("max_num_episodes"), ddbexp.Value(feed.MaxNumEpisodes))
+	}
+	return update
+}
+
+// setOrRemove returns the update setting the attribute to the value, or
+// removing the attribute if the value is empty.
+func setOrRemove(update ddbexp.UpdateBuilder, name, value string) ddbexp.UpdateBuilder {
+	if value == "" {
+		return update.Remove(ddbexp.Name(name))
+	}
+	return update.Set(ddbexp.Name(name), ddbexp.Value(value))
+}
+
+// updateFeed updates the feed's subscription, with the optional condition.
+func (h *Handler) updateFeed(ctx context.Context, feed *ImportRSSFeed,
+	update ddbexp.UpdateBuilder, cond ddbexp.ConditionBuilder,
+) error {
+	if h.FeedTableName == "" {
+		return nil
+	}
+
+	builder := ddbexp.NewBuilder().WithUpdate(update)
+	if cond.IsSet() {
+		builder = builder.WithCondition(cond)
+	}
+	exp, err := builder.Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression, %w", err)
+	}
+
+	_, err = h.DDBClient.UpdateItem(ctx, &ddb.UpdateItemInput{
+		TableName:                 &h.FeedTableName,
+		Key:                       workshop.PodcastFeed{URL: feed.URL}.AttributeValuePrimaryKey(),
+		UpdateExpression:          exp.Update(),
+		ConditionExpression:       exp.Condition(),
+		ExpressionAttributeNames:  exp.Names(),
+		ExpressionAttributeValues: exp.Values(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update feed %v subscription, %w", feed.URL, err)
+	}
+
+	return nil
+}
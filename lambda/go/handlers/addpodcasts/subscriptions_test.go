@@ -0,0 +1,124 @@
+package addpodcasts
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	workshop "aws-workshop"
+	"aws-workshop/fakes"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ddbav "github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+const testFeedTableName = "PodcastFeed"
+
+func getTestFeed(t *testing.T, client *fakes.DynamoDB, url string) workshop.PodcastFeed {
+	t.Helper()
+
+	resp, err := client.GetItem(context.Background(), &ddb.GetItemInput{
+		TableName: aws.String(testFeedTableName),
+		Key:       workshop.PodcastFeed{URL: url}.AttributeValuePrimaryKey(),
+	})
+	if err != nil {
+		t.Fatalf("failed to get feed, %v", err)
+	}
+	var feed workshop.PodcastFeed
+	if err := ddbav.UnmarshalMap(resp.Item, &feed); err != nil {
+		t.Fatalf("failed to unmarshal feed, %v", err)
+	}
+	return feed
+}
+
+func TestHandleRefresh_EpisodeWriteFailed(t *testing.T) {
+	fixture, err := os.ReadFile(filepath.Join("testdata", "feed.rss"))
+	if err != nil {
+		t.Fatalf("failed to read fixture, %v", err)
+	}
+	const etag = `"v1"`
+	var numDownloads int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		atomic.AddInt32(&numDownloads, 1)
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write(fixture)
+	}))
+	defer server.Close()
+
+	h, client, sfnClient := newTestHandler(t)
+	h.HTTPClient = server.Client()
+	h.FeedTableName = testFeedTableName
+	client.CreateTable(testFeedTableName, "url", "")
+
+	feedURL := server.URL + "/podcast/feed"
+	item, err := ddbav.MarshalMap(workshop.PodcastFeed{URL: feedURL})
+	if err != nil {
+		t.Fatalf("failed to marshal feed, %v", err)
+	}
+	_, err = client.PutItem(context.Background(), &ddb.PutItemInput{
+		TableName: aws.String(testFeedTableName),
+		Item:      item,
+	})
+	if err != nil {
+		t.Fatalf("failed to put feed, %v", err)
+	}
+
+	// The first refresh fails to record the feed's episodes, so the feed's
+	// validators are not recorded.
+	client.SetOperationError("BatchWriteItem", errors.New("write failed"))
+	if err := h.HandleRefresh(context.Background(), events.CloudWatchEvent{}); err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	feed := getTestFeed(t, client, feedURL)
+	if e, a := "", feed.ETag; e != a {
+		t.Errorf("expect %q etag, got %q", e, a)
+	}
+	if feed.LastError == "" {
+		t.Errorf("expect feed error recorded")
+	}
+	if e, a := 0, len(sfnClient.Executions()); e != a {
+		t.Errorf("expect %v executions, got %v", e, a)
+	}
+
+	// The second refresh downloads the feed again, and imports the episodes.
+	client.SetOperationError("BatchWriteItem", nil)
+	if err := h.HandleRefresh(context.Background(), events.CloudWatchEvent{}); err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	feed = getTestFeed(t, client, feedURL)
+	if e, a := etag, feed.ETag; e != a {
+		t.Errorf("expect %q etag, got %q", e, a)
+	}
+	if e, a := "", feed.LastError; e != a {
+		t.Errorf("expect %q error, got %q", e, a)
+	}
+	if e, a := int32(2), atomic.LoadInt32(&numDownloads); e != a {
+		t.Errorf("expect %v downloads, got %v", e, a)
+	}
+	if e, a := 2, len(sfnClient.Executions()); e != a {
+		t.Errorf("expect %v executions, got %v", e, a)
+	}
+
+	// The feed is not downloaded again once its episodes are imported.
+	if err := h.HandleRefresh(context.Background(), events.CloudWatchEvent{}); err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if e, a := int32(2), atomic.LoadInt32(&numDownloads); e != a {
+		t.Errorf("expect %v downloads, got %v", e, a)
+	}
+	if e, a := 2, len(sfnClient.Executions()); e != a {
+		t.Errorf("expect %v executions, got %v", e, a)
+	}
+}
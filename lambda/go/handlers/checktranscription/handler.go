@@ -0,0 +1,53 @@
+package checktranscription
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	workshop "aws-workshop"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	tr "github.com/aws/aws-sdk-go-v2/service/transcribe"
+)
+
+type Handler struct {
+	TranscribeClient TranscribeAPI
+}
+
+type InputEvent struct {
+	Episode workshop.Episode `json:"episode"`
+}
+
+type OutputEvent struct {
+	Status        string `json:"status"`
+	FailureReason string `json:"failure_reason,omitempty"`
+}
+
+func (h *Handler) Handle(ctx context.Context, input workshop.TranscribeStateMachineInput) (
+	OutputEvent, error,
+) {
+	log.Println("checking transcription,", input)
+
+	resp, err := h.TranscribeClient.GetTranscriptionJob(ctx,
+		&tr.GetTranscriptionJobInput{
+			TranscriptionJobName: &input.Episode.TranscribeJobID,
+		},
+	)
+	if err != nil {
+		return OutputEvent{}, fmt.Errorf("failed to check transcription job, %w", err)
+	}
+
+	output := OutputEvent{
+		Status:        string(resp.TranscriptionJob.TranscriptionJobStatus),
+		FailureReason: aws.ToString(resp.TranscriptionJob.FailureReason),
+	}
+	log.Println("transcription job status:", output.Status,
+		"failure reason:", output.FailureReason)
+
+	return output, nil
+}
+
+type TranscribeAPI interface {
+	GetTranscriptionJob(context.Context, *tr.GetTranscriptionJobInput, ...func(*tr.Options)) (*tr.GetTranscriptionJobOutput, error)
+}
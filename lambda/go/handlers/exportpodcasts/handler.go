@@ -0,0 +1,127 @@
+package exportpodcasts
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	workshop "aws-workshop"
+
+	"github.com/aws/aws-lambda-go/events"
+	ddbav "github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	ddbexp "github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type Handler struct {
+	DDBClient DDBAPI
+
+	EpisodeTableName string
+}
+
+// podcastItem is the podcast fields of an episode.
+type podcastItem struct {
+	Podcast string `dynamodbav:"podcast"`
+	FeedURL string `dynamodbav:"feed_url"`
+}
+
+// Handle responds with an OPML 2.0 document listing the podcasts of all
+// episodes, with the URL of the podcast's feed, if known.
+func (h *Handler) Handle(ctx context.Context, input events.APIGatewayV2HTTPRequest) (
+	*events.APIGatewayV2HTTPResponse, error,
+) {
+	log.Printf("Request:\n%#v", input)
+
+	feedURLs, err := h.getPodcasts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	podcasts := make([]string, 0, len(feedURLs))
+	for podcast := range feedURLs {
+		podcasts = append(podcasts, podcast)
+	}
+	sort.Strings(podcasts)
+
+	opml := workshop.OPML{
+		Version: "2.0",
+		Head: workshop.OPMLHead{
+			Title:       "Podcasts",
+			DateCreated: time.Now().UTC().Format(time.RFC1123Z),
+		},
+	}
+	for _, podcast := range podcasts {
+		outline := workshop.OPMLOutline{
+			Text:   podcast,
+			Title:  podcast,
+			XMLURL: feedURLs[podcast],
+		}
+		if outline.XMLURL != "" {
+			outline.Type = "rss"
+		}
+		opml.Body.Outlines = append(opml.Body.Outlines, outline)
+	}
+	log.Printf("exporting %v podcasts", len(podcasts))
+
+	header := http.Header{}
+	header.Set("Content-Type", "text/x-opml; charset=utf-8")
+	header.Set("Content-Disposition", `attachment; filename="podcasts.opml"`)
+	return workshop.NewXMLResponse(200, header, opml)
+}
+
+// getPodcasts returns the podcasts of all episodes, mapped to the podcast's
+// feed URL. The feed URL is empty if no episode of the podcast was imported
+// from a feed.
+func (h *Handler) getPodcasts(ctx context.Context) (map[string]string, error) {
+	expr, err := ddbexp.NewBuilder().
+		WithProjection(ddbexp.NamesList(
+			ddbexp.Name("podcast"),
+			ddbexp.Name("feed_url"),
+		)).
+		Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build expression projection, %w", err)
+	}
+
+	feedURLs := map[string]string{}
+	var startKey map[string]ddbtypes.AttributeValue
+	for {
+		result, err := h.DDBClient.Scan(ctx, &ddb.ScanInput{
+			TableName:                &h.EpisodeTableName,
+			ExpressionAttributeNames: expr.Names(),
+			ProjectionExpression:     expr.Projection(),
+			ExclusiveStartKey:        startKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan episodes, %w", err)
+		}
+
+		var items []podcastItem
+		if err := ddbav.UnmarshalListOfMaps(result.Items, &items); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal episode items, %w", err)
+		}
+		for _, item := range items {
+			if item.Podcast == "" {
+				continue
+			}
+			if feedURLs[item.Podcast] == "" {
+				feedURLs[item.Podcast] = item.FeedURL
+			}
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			return feedURLs, nil
+		}
+		startKey = result.LastEvaluatedKey
+	}
+}
+
+type DDBAPI interface {
+	Scan(context.Context, *ddb.ScanInput, ...func(*ddb.Options)) (
+		*ddb.ScanOutput, error,
+	)
+}
@@ -0,0 +1,63 @@
+package getimport
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	workshop "aws-workshop"
+
+	"github.com/aws/aws-lambda-go/events"
+	ddbav "github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// Handler responds with the status, progress, and results of an
+// asynchronous import job created by add-podcasts.
+type Handler struct {
+	DDBClient DDBAPI
+
+	ImportJobTableName string
+}
+
+func (h *Handler) Handle(ctx context.Context, input events.APIGatewayV2HTTPRequest) (
+	*events.APIGatewayV2HTTPResponse, error,
+) {
+	log.Printf("Request:\n%#v", input)
+
+	jobID, ok := input.PathParameters["id"]
+	if !ok || jobID == "" {
+		return workshop.NewBadRequestErrorResponse("Import job id not provided")
+	}
+
+	result, err := h.DDBClient.GetItem(ctx, &ddb.GetItemInput{
+		TableName: &h.ImportJobTableName,
+		Key:       workshop.ImportJob{ID: jobID}.AttributeValuePrimaryKey(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get import job from table, %w", err)
+	}
+	if len(result.Item) == 0 {
+		return workshop.NewNotFoundErrorResponse("Import job not found")
+	}
+
+	var job workshop.ImportJob
+	if err := ddbav.UnmarshalMap(result.Item, &job); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal import job item, %w", err)
+	}
+	if job.LeaseExpired(time.Now()) {
+		// The job's worker stopped before the job finished, and the job was
+		// not claimed again by a retry.
+		job.Status = workshop.ImportJobStatusFailed
+		job.Error = "import job stopped before it finished"
+	}
+
+	return workshop.NewJSONResponse(200, nil, job)
+}
+
+type DDBAPI interface {
+	GetItem(context.Context, *ddb.GetItemInput, ...func(*ddb.Options)) (
+		*ddb.GetItemOutput, error,
+	)
+}
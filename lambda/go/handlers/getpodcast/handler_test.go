@@ -0,0 +1,91 @@
+package getpodcast
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	workshop "aws-workshop"
+	"aws-workshop/fakes"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ddbav "github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+func TestHandle(t *testing.T) {
+	const tableName = "PodcastEpisode"
+
+	client := fakes.NewDynamoDB()
+	client.CreateTable(tableName, "id", "")
+	item, err := ddbav.MarshalMap(workshop.Episode{
+		ID:       "1234",
+		Title:    "Intro to Go",
+		Podcast:  "go",
+		MediaKey: "media/1234",
+		Status:   workshop.EpisodeStatusComplete,
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal episode, %v", err)
+	}
+	_, err = client.PutItem(context.Background(), &ddb.PutItemInput{
+		TableName: aws.String(tableName),
+		Item:      item,
+	})
+	if err != nil {
+		t.Fatalf("failed to put episode, %v", err)
+	}
+
+	h := &Handler{
+		DDBClient:        client,
+		EpisodeTableName: tableName,
+	}
+
+	cases := map[string]struct {
+		ID          string
+		ExpectCode  int
+		ExpectTitle string
+	}{
+		"found": {
+			ID:          "1234",
+			ExpectCode:  200,
+			ExpectTitle: "Intro to Go",
+		},
+		"not found": {
+			ID:         "5678",
+			ExpectCode: 404,
+		},
+		"no id": {
+			ExpectCode: 400,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			resp, err := h.Handle(context.Background(), events.APIGatewayV2HTTPRequest{
+				PathParameters: map[string]string{"id": c.ID},
+			})
+			if err != nil {
+				t.Fatalf("expect no error, got %v", err)
+			}
+			if e, a := c.ExpectCode, resp.StatusCode; e != a {
+				t.Fatalf("expect %v status, got %v", e, a)
+			}
+			if c.ExpectCode != 200 {
+				return
+			}
+
+			var episode map[string]interface{}
+			if err := json.Unmarshal([]byte(resp.Body), &episode); err != nil {
+				t.Fatalf("failed to unmarshal response, %v", err)
+			}
+			if e, a := c.ExpectTitle, episode["title"]; e != a {
+				t.Errorf("expect %v title, got %v", e, a)
+			}
+			if _, ok := episode["media_key"]; ok {
+				t.Errorf("expect media key not to be described")
+			}
+		})
+	}
+}
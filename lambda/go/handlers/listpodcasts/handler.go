@@ -0,0 +1,180 @@
+package listpodcasts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	workshop "aws-workshop"
+
+	"github.com/aws/aws-lambda-go/events"
+	ddbav "github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	ddbexp "github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+type Handler struct {
+	DDBClient DDBAPI
+
+	EpisodeTableName string
+	PodcastIndexName string
+	StatusIndexName  string
+
+	// Key used to sign and verify the next_token page tokens.
+	PageTokenKey []byte
+}
+
+// NextTokenHeader is the header of the response the next_token of the next
+// page of episodes is returned in, if there may be more episodes to list.
+// The response's body is the page's array of episodes.
+const NextTokenHeader = "X-Next-Token"
+
+func (h *Handler) Handle(ctx context.Context, input events.APIGatewayV2HTTPRequest) (
+	*events.APIGatewayV2HTTPResponse, error,
+) {
+	log.Printf("Request:\n%#v", input)
+
+	limit, err := getPageLimitFromQueryString(input.QueryStringParameters)
+	if err != nil {
+		return workshop.NewBadRequestErrorResponse(err.Error())
+	}
+
+	query := canonicalFilterQuery(input.QueryStringParameters)
+	var cursor pageCursor
+	if v := input.QueryStringParameters["next_token"]; v != "" {
+		if len(h.PageTokenKey) == 0 {
+			return nil, fmt.Errorf("page token key not configured")
+		}
+		cursor, err = decodePageToken(h.PageTokenKey, v, query)
+		if err != nil {
+			log.Printf("ERROR: invalid next_token, %v", err)
+			return workshop.NewBadRequestErrorResponse("invalid next_token")
+		}
+	}
+
+	listQuery, err := parseListEpisodesQuery(input.QueryStringParameters)
+	if err != nil {
+		return workshop.NewBadRequestErrorResponse(err.Error())
+	}
+	if _, ok := h.getListIndex(listQuery); !ok && listQuery.Sort != "" && h.StatusIndexName == "" {
+		// Sorted listings without a filter are merged from the status index.
+		return workshop.NewBadRequestErrorResponse("sort requires the podcast or status filter")
+	}
+
+	// Call out to Amazon DynamoDB to get a page of episodes, starting after
+	// the last episode of the previous page.
+	episodes, next, resp, err := h.listEpisodes(ctx, listQuery, cursor, limit)
+	if err != nil {
+		return nil, fmt.Errorf("get episodes failed, %w", err)
+	}
+	if resp != nil {
+		return resp, nil
+	}
+
+	header := http.Header{}
+	if !next.empty() {
+		if len(h.PageTokenKey) == 0 {
+			return nil, fmt.Errorf("page token key not configured")
+		}
+		nextToken, err := encodePageToken(h.PageTokenKey, next, query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create next_token, %w", err)
+		}
+		header.Set(NextTokenHeader, nextToken)
+		header.Set("Link", "<"+makeNextPageURL(input, nextToken)+">; rel=\"next\"")
+	}
+
+	// Respond back with the episode fields selected in the projection.
+	return workshop.NewJSONResponse(200, header, episodes)
+}
+
+// filterCondition returns the condition for filtering the episodes listed,
+// if any. Conditions served by the index's key condition are not included.
+func (q listEpisodesQuery) filterCondition(index *listIndex) (
+	builder ddbexp.ConditionBuilder, hasCondition bool,
+) {
+	if q.Podcast != "" && (index == nil || index.PartitionKey != "podcast") {
+		builder, hasCondition = addCondition(builder, hasCondition,
+			ddbexp.Name("podcast").Equal(ddbexp.Value(q.Podcast)))
+	}
+	if q.Status != workshop.EpisodeStatusUnknown && (index == nil || index.PartitionKey != "status") {
+		builder, hasCondition = addCondition(builder, hasCondition,
+			ddbexp.Name("status").Equal(ddbexp.Value(q.Status)))
+	}
+
+	if q.InTitle != "" {
+		// Using the expression (aliased as ddbexp) package's
+		// ConditionBuilder set the inTitleCondition to the condition of the
+		// "title" attribute containing the value of "in-title" parameter in
+		// the query string.
+		inTitleCondition := ddbexp.Name("title").Contains(q.InTitle)
+		builder, hasCondition = addCondition(builder, hasCondition, inTitleCondition)
+	}
+
+	publishedAt := ddbexp.Name("published_at")
+	if q.PublishedAfter != "" && index == nil {
+		builder, hasCondition = addCondition(builder, hasCondition,
+			publishedAt.GreaterThanEqual(ddbexp.Value(q.PublishedAfter)))
+	}
+	if q.PublishedBefore != "" && (index == nil || q.PublishedAfter != "") {
+		// The key condition's between includes the end of the range.
+		builder, hasCondition = addCondition(builder, hasCondition,
+			publishedAt.LessThan(ddbexp.Value(q.PublishedBefore)))
+	}
+
+	return builder, hasCondition
+}
+
+// addCondition returns the condition combined with the builder, if the
+// builder has a condition. Otherwise returns the condition.
+func addCondition(builder ddbexp.ConditionBuilder, hasCondition bool, cond ddbexp.ConditionBuilder) (
+	ddbexp.ConditionBuilder, bool,
+) {
+	if !hasCondition {
+		return cond, true
+	}
+	return builder.And(cond), true
+}
+
+func handleListError(err error) (*events.APIGatewayV2HTTPResponse, error) {
+	var throttleErr *ddbtypes.ProvisionedThroughputExceededException
+	if errors.As(err, &throttleErr) {
+		log.Printf("Received exception: %v. Returning 429 HTTP Response", err)
+		return workshop.NewTooManyRequestsErrorResponse("Please slow down request rate")
+	}
+
+	return nil, err
+}
+
+func unmarshalEpisodeItems(items []map[string]ddbtypes.AttributeValue) (
+	[]workshop.ListEpisodeItem, error,
+) {
+	episodes := make([]workshop.ListEpisodeItem, 0, len(items))
+	if err := ddbav.UnmarshalListOfMaps(items, &episodes); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal episode item, %w", err)
+	}
+	return episodes, nil
+}
+
+func printResponseDebugInformation(count int, lastKey map[string]ddbtypes.AttributeValue) {
+	log.Println("Number of podcasts returned in response: ", count)
+	if lastKey != nil {
+		log.Println("Response contains LastEvaluatedKey. There are still more data to be scanned.")
+	} else {
+		log.Println("Response does not contains LastEvaluatedKey. There is no more data to be scanned.")
+	}
+}
+
+type DDBAPI interface {
+	Scan(context.Context, *ddb.ScanInput, ...func(*ddb.Options)) (*ddb.ScanOutput, error)
+	Query(context.Context, *ddb.QueryInput, ...func(*ddb.Options)) (*ddb.QueryOutput, error)
+}
+type SecretsAPI interface {
+	GetSecretValue(context.Context, *secretsmanager.GetSecretValueInput, ...func(*secretsmanager.Options)) (
+		*secretsmanager.GetSecretValueOutput, error,
+	)
+}
@@ -0,0 +1,389 @@
+package listpodcasts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	workshop "aws-workshop"
+	"aws-workshop/fakes"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ddbav "github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+const (
+	testTableName        = "PodcastEpisode"
+	testPodcastIndexName = "podcast-published"
+	testStatusIndexName  = "status-published"
+)
+
+var testEpisodes = []workshop.Episode{
+	{ID: "1", Title: "Intro to Go", Podcast: "go", PublishedAt: "2021-11-01T00:00:00Z",
+		Status: workshop.EpisodeStatusComplete},
+	{ID: "2", Title: "Go generics", Podcast: "go", PublishedAt: "2021-11-08T00:00:00Z",
+		Status: workshop.EpisodeStatusPending},
+	{ID: "3", Title: "Go modules", Podcast: "go", PublishedAt: "2021-11-15T00:00:00Z",
+		Status: workshop.EpisodeStatusComplete},
+	{ID: "4", Title: "Rust traits", Podcast: "rust", PublishedAt: "2021-11-02T00:00:00Z",
+		Status: workshop.EpisodeStatusComplete},
+}
+
+func newTestHandler(t *testing.T, episodes []workshop.Episode) *Handler {
+	t.Helper()
+
+	client := fakes.NewDynamoDB()
+	client.CreateTable(testTableName, "id", "")
+	if err := client.CreateGlobalSecondaryIndex(testTableName, testPodcastIndexName, "podcast", "published_at"); err != nil {
+		t.Fatalf("failed to create podcast index, %v", err)
+	}
+	if err := client.CreateGlobalSecondaryIndex(testTableName, testStatusIndexName, "status", "published_at"); err != nil {
+		t.Fatalf("failed to create status index, %v", err)
+	}
+	for _, episode := range episodes {
+		item, err := ddbav.MarshalMap(episode)
+		if err != nil {
+			t.Fatalf("failed to marshal episode, %v", err)
+		}
+		_, err = client.PutItem(context.Background(), &ddb.PutItemInput{
+			TableName: aws.String(testTableName),
+			Item:      item,
+		})
+		if err != nil {
+			t.Fatalf("failed to put episode, %v", err)
+		}
+	}
+
+	return &Handler{
+		DDBClient:        client,
+		EpisodeTableName: testTableName,
+		PodcastIndexName: testPodcastIndexName,
+		StatusIndexName:  testStatusIndexName,
+		PageTokenKey:     []byte("test-key"),
+	}
+}
+
+// listEpisodesPage is a page of the episode listing, and the next_token of
+// the next page, if any.
+type listEpisodesPage struct {
+	Episodes  []workshop.ListEpisodeItem
+	NextToken string
+}
+
+func listEpisodes(t *testing.T, h *Handler, query map[string]string) (int, listEpisodesPage) {
+	t.Helper()
+
+	resp, err := h.Handle(context.Background(), events.APIGatewayV2HTTPRequest{
+		QueryStringParameters: query,
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+
+	var output listEpisodesPage
+	if resp.StatusCode == 200 {
+		// The page's episodes are a bare array, the same as a listing of a
+		// single page.
+		if err := json.Unmarshal([]byte(resp.Body), &output.Episodes); err != nil {
+			t.Fatalf("failed to unmarshal response, %v", err)
+		}
+		output.NextToken = resp.Headers[strings.ToLower(NextTokenHeader)]
+		if e, a := output.NextToken != "", resp.Headers["link"] != ""; e != a {
+			t.Errorf("expect Link header %v, got %v", e, resp.Headers["link"])
+		}
+	}
+	return resp.StatusCode, output
+}
+
+func episodeIDs(episodes []workshop.ListEpisodeItem) []string {
+	ids := make([]string, 0, len(episodes))
+	for _, episode := range episodes {
+		ids = append(ids, episode.ID)
+	}
+	return ids
+}
+
+func TestHandle(t *testing.T) {
+	cases := map[string]struct {
+		Query     map[string]string
+		ExpectIDs []string
+	}{
+		"all episodes": {
+			ExpectIDs: []string{"1", "2", "3", "4"},
+		},
+		"podcast newest first": {
+			Query:     map[string]string{"podcast": "go"},
+			ExpectIDs: []string{"3", "2", "1"},
+		},
+		"podcast oldest first": {
+			Query:     map[string]string{"podcast": "go", "sort": "oldest"},
+			ExpectIDs: []string{"1", "2", "3"},
+		},
+		"podcast and status": {
+			Query:     map[string]string{"podcast": "go", "status": "complete"},
+			ExpectIDs: []string{"3", "1"},
+		},
+		"status published range": {
+			Query: map[string]string{"status": "complete",
+				"published_after": "2021-11-02", "published_before": "2021-11-15"},
+			ExpectIDs: []string{"4"},
+		},
+		"all episodes newest first": {
+			Query:     map[string]string{"sort": "newest"},
+			ExpectIDs: []string{"3", "2", "4", "1"},
+		},
+		"published range oldest first": {
+			Query:     map[string]string{"published_after": "2021-11-02", "sort": "oldest"},
+			ExpectIDs: []string{"4", "2", "3"},
+		},
+		"in title": {
+			Query:     map[string]string{"in-title": "generics"},
+			ExpectIDs: []string{"2"},
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			h := newTestHandler(t, testEpisodes)
+
+			status, output := listEpisodes(t, h, c.Query)
+			if e, a := 200, status; e != a {
+				t.Fatalf("expect %v status, got %v", e, a)
+			}
+			if e, a := c.ExpectIDs, episodeIDs(output.Episodes); !reflect.DeepEqual(e, a) {
+				t.Errorf("expect %v episodes, got %v", e, a)
+			}
+			if output.NextToken != "" {
+				t.Errorf("expect no next token, got %v", output.NextToken)
+			}
+		})
+	}
+}
+
+func TestHandle_Pages(t *testing.T) {
+	h := newTestHandler(t, testEpisodes)
+
+	var ids []string
+	query := map[string]string{"podcast": "go", "limit": "2"}
+	for i := 0; ; i++ {
+		if i > len(testEpisodes) {
+			t.Fatalf("expect listing to finish, got %v pages", i)
+		}
+		status, output := listEpisodes(t, h, query)
+		if e, a := 200, status; e != a {
+			t.Fatalf("expect %v status, got %v", e, a)
+		}
+		ids = append(ids, episodeIDs(output.Episodes)...)
+		if output.NextToken == "" {
+			break
+		}
+		query["next_token"] = output.NextToken
+	}
+
+	if e, a := []string{"3", "2", "1"}, ids; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v episodes, got %v", e, a)
+	}
+}
+
+func TestHandle_SortedPages(t *testing.T) {
+	episodes := append([]workshop.Episode{}, testEpisodes...)
+	episodes = append(episodes,
+		workshop.Episode{ID: "5", Title: "Go fuzzing", Podcast: "go", PublishedAt: "2021-11-08T00:00:00Z",
+			Status: workshop.EpisodeStatusFailure},
+		workshop.Episode{ID: "6", Title: "Rust async", Podcast: "rust", PublishedAt: "2021-11-20T00:00:00Z",
+			Status: workshop.EpisodeStatusTranscribing},
+	)
+
+	cases := map[string]struct {
+		Query     map[string]string
+		ExpectIDs []string
+	}{
+		"newest first": {
+			Query:     map[string]string{"sort": "newest"},
+			ExpectIDs: []string{"6", "3", "2", "5", "4", "1"},
+		},
+		"oldest first": {
+			Query:     map[string]string{"sort": "oldest"},
+			ExpectIDs: []string{"1", "4", "2", "5", "3", "6"},
+		},
+		"in title": {
+			Query:     map[string]string{"sort": "newest", "in-title": "Go"},
+			ExpectIDs: []string{"3", "2", "5", "1"},
+		},
+	}
+
+	for name, c := range cases {
+		for _, limit := range []string{"1", "2", "4"} {
+			t.Run(name+" limit "+limit, func(t *testing.T) {
+				h := newTestHandler(t, episodes)
+
+				query := map[string]string{"limit": limit}
+				for k, v := range c.Query {
+					query[k] = v
+				}
+				var ids []string
+				for i := 0; ; i++ {
+					if i > len(episodes) {
+						t.Fatalf("expect listing to finish, got %v pages", i)
+					}
+					status, output := listEpisodes(t, h, query)
+					if e, a := 200, status; e != a {
+						t.Fatalf("expect %v status, got %v", e, a)
+					}
+					ids = append(ids, episodeIDs(output.Episodes)...)
+					if output.NextToken == "" {
+						break
+					}
+					query["next_token"] = output.NextToken
+				}
+
+				if e, a := c.ExpectIDs, ids; !reflect.DeepEqual(e, a) {
+					t.Errorf("expect %v episodes, got %v", e, a)
+				}
+			})
+		}
+	}
+}
+
+func TestHandle_SortWithoutIndex(t *testing.T) {
+	h := newTestHandler(t, testEpisodes)
+	h.StatusIndexName = ""
+
+	status, _ := listEpisodes(t, h, map[string]string{"sort": "newest"})
+	if e, a := 400, status; e != a {
+		t.Errorf("expect %v status, got %v", e, a)
+	}
+
+	// The podcast index still supports sorting episodes of a podcast.
+	status, output := listEpisodes(t, h, map[string]string{"podcast": "go", "sort": "oldest"})
+	if e, a := 200, status; e != a {
+		t.Fatalf("expect %v status, got %v", e, a)
+	}
+	if e, a := []string{"1", "2", "3"}, episodeIDs(output.Episodes); !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v episodes, got %v", e, a)
+	}
+}
+
+func TestHandle_InvalidNextToken(t *testing.T) {
+	h := newTestHandler(t, testEpisodes)
+
+	status, output := listEpisodes(t, h, map[string]string{"podcast": "go", "limit": "1"})
+	if e, a := 200, status; e != a {
+		t.Fatalf("expect %v status, got %v", e, a)
+	}
+
+	// Tokens are only valid for the query they were created for.
+	status, _ = listEpisodes(t, h, map[string]string{"podcast": "rust", "next_token": output.NextToken})
+	if e, a := 400, status; e != a {
+		t.Errorf("expect %v status, got %v", e, a)
+	}
+}
+
+func TestHandle_NoPageTokenKey(t *testing.T) {
+	h := newTestHandler(t, testEpisodes)
+	h.PageTokenKey = nil
+
+	// Listings that fit in a single page do not need a page token.
+	status, output := listEpisodes(t, h, map[string]string{"podcast": "rust"})
+	if e, a := 200, status; e != a {
+		t.Fatalf("expect %v status, got %v", e, a)
+	}
+	if e, a := []string{"4"}, episodeIDs(output.Episodes); !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v episodes, got %v", e, a)
+	}
+
+	_, err := h.Handle(context.Background(), events.APIGatewayV2HTTPRequest{
+		QueryStringParameters: map[string]string{"podcast": "go", "limit": "1"},
+	})
+	if err == nil {
+		t.Errorf("expect error signing next_token without a key")
+	}
+}
+
+func TestHandle_PartialPage(t *testing.T) {
+	var episodes []workshop.Episode
+	for i := 0; i < maxListCallsPerPage+10; i++ {
+		episodes = append(episodes, workshop.Episode{
+			ID: fmt.Sprintf("a%02d", i), Title: "Go", Podcast: "go",
+			Status: workshop.EpisodeStatusComplete,
+		})
+	}
+	episodes = append(episodes, workshop.Episode{
+		ID: "z", Title: "Rust traits", Podcast: "rust",
+		Status: workshop.EpisodeStatusComplete,
+	})
+	h := newTestHandler(t, episodes)
+
+	// The selective filter exhausts the page's list calls before a match is
+	// found, so an empty page is returned with a token to continue from.
+	query := map[string]string{"in-title": "Rust", "limit": "1"}
+	status, output := listEpisodes(t, h, query)
+	if e, a := 200, status; e != a {
+		t.Fatalf("expect %v status, got %v", e, a)
+	}
+	if e, a := 0, len(output.Episodes); e != a {
+		t.Errorf("expect %v episodes, got %v", e, a)
+	}
+	if output.NextToken == "" {
+		t.Fatalf("expect next token for partial page")
+	}
+
+	query["next_token"] = output.NextToken
+	status, output = listEpisodes(t, h, query)
+	if e, a := 200, status; e != a {
+		t.Fatalf("expect %v status, got %v", e, a)
+	}
+	if e, a := []string{"z"}, episodeIDs(output.Episodes); !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v episodes, got %v", e, a)
+	}
+}
+
+func TestHandle_SortedPartialPage(t *testing.T) {
+	var episodes []workshop.Episode
+	for i := 0; i < maxListCallsPerPage+10; i++ {
+		episodes = append(episodes, workshop.Episode{
+			ID: fmt.Sprintf("a%02d", i), Title: "Go", Podcast: "go",
+			PublishedAt: fmt.Sprintf("2021-10-%02dT00:00:00Z", i+1),
+			Status:      workshop.EpisodeStatusComplete,
+		})
+	}
+	episodes = append(episodes, workshop.Episode{
+		ID: "z", Title: "Rust traits", Podcast: "rust", PublishedAt: "2021-09-01T00:00:00Z",
+		Status: workshop.EpisodeStatusPending,
+	})
+	h := newTestHandler(t, episodes)
+
+	// The complete partition exhausts the page's list calls before its
+	// episodes are known, so the pending partition's episode cannot be
+	// included until a later page.
+	query := map[string]string{"in-title": "Rust", "sort": "newest", "limit": "1"}
+	var ids []string
+	var pages int
+	for {
+		if pages > len(episodes) {
+			t.Fatalf("expect listing to finish, got %v pages", pages)
+		}
+		status, output := listEpisodes(t, h, query)
+		if e, a := 200, status; e != a {
+			t.Fatalf("expect %v status, got %v", e, a)
+		}
+		pages++
+		ids = append(ids, episodeIDs(output.Episodes)...)
+		if output.NextToken == "" {
+			break
+		}
+		query["next_token"] = output.NextToken
+	}
+
+	if e, a := []string{"z"}, ids; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v episodes, got %v", e, a)
+	}
+	if pages < 2 {
+		t.Errorf("expect partial pages, got %v pages", pages)
+	}
+}
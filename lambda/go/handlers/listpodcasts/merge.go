@@ -0,0 +1,147 @@
+package listpodcasts
+
+import (
+	"context"
+
+	workshop "aws-workshop"
+
+	"github.com/aws/aws-lambda-go/events"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// listStatuses are the status index partitions sorted listings without a
+// podcast or status filter are merged from. Every episode has a status, so
+// together the partitions include all episodes.
+var listStatuses = []workshop.EpisodeStatus{
+	workshop.EpisodeStatusPending,
+	workshop.EpisodeStatusUploading,
+	workshop.EpisodeStatusTranscribing,
+	workshop.EpisodeStatusProcessing,
+	workshop.EpisodeStatusComplete,
+	workshop.EpisodeStatusFailure,
+}
+
+// partitionPage is the episodes listed from a status partition for a page of
+// a merged listing.
+type partitionPage struct {
+	Status   string
+	StartKey map[string]ddbtypes.AttributeValue
+	Episodes []workshop.ListEpisodeItem
+	LastKey  map[string]ddbtypes.AttributeValue
+
+	// Number of Episodes included in the page.
+	Used int
+}
+
+// getMergedEpisodes returns a page of up to limit episodes in published
+// date order, merged from the queries of each status partition of the status
+// index. Returns the cursor to resume each partition from.
+func (h *Handler) getMergedEpisodes(
+	ctx context.Context, budget *listBudget, q listEpisodesQuery, cursor pageCursor, limit int,
+) (
+	[]workshop.ListEpisodeItem, pageCursor, *events.APIGatewayV2HTTPResponse, error,
+) {
+	var pages []*partitionPage
+	for _, status := range listStatuses {
+		startKey, ok := cursor.Partitions[status.String()]
+		if !cursor.empty() && !ok {
+			// Partition has no more episodes.
+			continue
+		}
+		if len(startKey) == 0 {
+			startKey = nil
+		}
+
+		index := listIndex{Name: h.StatusIndexName, PartitionKey: "status", Value: status.String()}
+		expr, err := q.buildExpression(&index)
+		if err != nil {
+			return nil, pageCursor{}, nil, err
+		}
+
+		// Every partition is listed at least once, even if an earlier
+		// partition exhausted the budget, so the merge can make progress.
+		listPage := h.queryPage(expr, index.Name, q.Sort == sortOldest)
+		episodes, lastKey, resp, err := getEpisodes(ctx, budget, listPage, startKey, limit)
+		if err != nil || resp != nil {
+			return nil, pageCursor{}, resp, err
+		}
+		pages = append(pages, &partitionPage{
+			Status:   status.String(),
+			StartKey: startKey,
+			Episodes: episodes,
+			LastKey:  lastKey,
+		})
+	}
+
+	episodes := make([]workshop.ListEpisodeItem, 0, limit)
+	for len(episodes) < limit {
+		page, ok := nextPartitionPage(pages, q.Sort == sortOldest)
+		if !ok {
+			break
+		}
+		episodes = append(episodes, page.Episodes[page.Used])
+		page.Used++
+	}
+
+	next := pageCursor{Partitions: map[string]map[string]ddbtypes.AttributeValue{}}
+	for _, page := range pages {
+		switch {
+		case page.Used == len(page.Episodes) && len(page.LastKey) == 0:
+			// Partition has no more episodes.
+			continue
+		case page.Used == len(page.Episodes):
+			next.Partitions[page.Status] = page.LastKey
+		case page.Used != 0:
+			next.Partitions[page.Status] = statusIndexKey(page.Episodes[page.Used-1])
+		default:
+			// Partitions not started yet have an empty key.
+			key := page.StartKey
+			if key == nil {
+				key = map[string]ddbtypes.AttributeValue{}
+			}
+			next.Partitions[page.Status] = key
+		}
+	}
+	if len(next.Partitions) == 0 {
+		return episodes, pageCursor{}, nil, nil
+	}
+
+	return episodes, next, nil, nil
+}
+
+// nextPartitionPage returns the partition page with the next episode in
+// published date order. Returns false if there are no more episodes, or a
+// partition's episodes after those listed are not known because the page's
+// budget was exhausted. Ties are ordered by status partition.
+func nextPartitionPage(pages []*partitionPage, ascending bool) (*partitionPage, bool) {
+	var next *partitionPage
+	for _, page := range pages {
+		if page.Used == len(page.Episodes) {
+			if len(page.LastKey) != 0 {
+				return nil, false
+			}
+			continue
+		}
+
+		if next == nil {
+			next = page
+			continue
+		}
+		a, b := page.Episodes[page.Used].PublishedAt, next.Episodes[next.Used].PublishedAt
+		if (ascending && a < b) || (!ascending && a > b) {
+			next = page
+		}
+	}
+
+	return next, next != nil
+}
+
+// statusIndexKey returns the status index key of the episode, to resume a
+// status partition query after the episode.
+func statusIndexKey(episode workshop.ListEpisodeItem) map[string]ddbtypes.AttributeValue {
+	return map[string]ddbtypes.AttributeValue{
+		"id":           &ddbtypes.AttributeValueMemberS{Value: episode.ID},
+		"status":       &ddbtypes.AttributeValueMemberS{Value: episode.Status.String()},
+		"published_at": &ddbtypes.AttributeValueMemberS{Value: episode.PublishedAt},
+	}
+}
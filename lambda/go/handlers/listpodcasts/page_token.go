@@ -0,0 +1,264 @@
+package listpodcasts
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// Default and maximum number of episodes returned in a page of the episode
+// listing.
+const (
+	defaultPageLimit = 25
+	maxPageLimit     = 100
+)
+
+// pageToken is the state needed to resume listing episodes where the
+// previous page stopped. The token is opaque to clients, and signed so that
+// modified tokens are rejected.
+type pageToken struct {
+	// DynamoDB LastEvaluatedKey of the previous page.
+	Key map[string]pageTokenAttribute `json:"k,omitempty"`
+
+	// Keys to resume each status partition from of a sorted listing merged
+	// across all statuses.
+	Partitions map[string]map[string]pageTokenAttribute `json:"p,omitempty"`
+
+	// Canonical form of the filter query parameters the token was created
+	// for. Prevents a token being used with a different query.
+	Query string `json:"q"`
+}
+
+// pageTokenAttribute is a key attribute value. DynamoDB keys can only be
+// string, number, or binary.
+type pageTokenAttribute struct {
+	S *string `json:"S,omitempty"`
+	N *string `json:"N,omitempty"`
+	B []byte  `json:"B,omitempty"`
+}
+
+// LoadPageTokenKey returns the key page tokens are signed with from the
+// secret. The key is loaded once when the function starts, so every request
+// uses the same key without calling Secrets Manager.
+func LoadPageTokenKey(ctx context.Context, client SecretsAPI, secretID string) ([]byte, error) {
+	if secretID == "" {
+		return nil, fmt.Errorf("page token key secret not configured")
+	}
+
+	resp, err := client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: &secretID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get page token key secret, %w", err)
+	}
+
+	key := resp.SecretBinary
+	if resp.SecretString != nil {
+		key = []byte(*resp.SecretString)
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("page token key secret %v is empty", secretID)
+	}
+	return key, nil
+}
+
+// pageCursor is the position a page of the episode listing resumes from.
+// Listings of a single table or index resume from StartKey. Sorted listings
+// merged across the status partitions resume each partition from its key in
+// Partitions. A partition with an empty key has not been started, and
+// partitions not in Partitions have no more episodes. The zero value starts
+// from the beginning of the listing.
+type pageCursor struct {
+	StartKey   map[string]ddbtypes.AttributeValue
+	Partitions map[string]map[string]ddbtypes.AttributeValue
+}
+
+// empty returns if the cursor has no position to resume from, i.e. the
+// listing has no more pages.
+func (c pageCursor) empty() bool {
+	return len(c.StartKey) == 0 && len(c.Partitions) == 0
+}
+
+// encodePageToken returns the signed token for the cursor and query. The
+// token is made up of the base64 encoded JSON payload, and the base64
+// encoded HMAC-SHA256 signature of the payload, separated by a dot.
+func encodePageToken(signingKey []byte, cursor pageCursor, query string) (string, error) {
+	token := pageToken{Query: query}
+
+	var err error
+	if len(cursor.StartKey) != 0 {
+		if token.Key, err = encodePageTokenKey(cursor.StartKey); err != nil {
+			return "", err
+		}
+	}
+	if len(cursor.Partitions) != 0 {
+		token.Partitions = make(map[string]map[string]pageTokenAttribute, len(cursor.Partitions))
+		for partition, key := range cursor.Partitions {
+			if token.Partitions[partition], err = encodePageTokenKey(key); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	payload, err := json.Marshal(token)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal page token, %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(signPageToken(signingKey, payload)), nil
+}
+
+func encodePageTokenKey(key map[string]ddbtypes.AttributeValue) (map[string]pageTokenAttribute, error) {
+	attrs := make(map[string]pageTokenAttribute, len(key))
+	for name, av := range key {
+		switch tv := av.(type) {
+		case *ddbtypes.AttributeValueMemberS:
+			attrs[name] = pageTokenAttribute{S: &tv.Value}
+		case *ddbtypes.AttributeValueMemberN:
+			attrs[name] = pageTokenAttribute{N: &tv.Value}
+		case *ddbtypes.AttributeValueMemberB:
+			attrs[name] = pageTokenAttribute{B: tv.Value}
+		default:
+			return nil, fmt.Errorf("unsupported key attribute %v type, %T", name, av)
+		}
+	}
+	return attrs, nil
+}
+
+// decodePageToken verifies the token's signature and that it was created
+// for the query, returning the cursor the token encodes.
+func decodePageToken(signingKey []byte, v string, query string) (pageCursor, error) {
+	parts := strings.Split(v, ".")
+	if len(parts) != 2 {
+		return pageCursor{}, fmt.Errorf("malformed page token")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return pageCursor{}, fmt.Errorf("malformed page token payload, %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return pageCursor{}, fmt.Errorf("malformed page token signature, %w", err)
+	}
+	if !hmac.Equal(signature, signPageToken(signingKey, payload)) {
+		return pageCursor{}, fmt.Errorf("page token signature mismatch")
+	}
+
+	var token pageToken
+	if err := json.Unmarshal(payload, &token); err != nil {
+		return pageCursor{}, fmt.Errorf("failed to unmarshal page token, %w", err)
+	}
+	if token.Query != query {
+		return pageCursor{}, fmt.Errorf("page token not valid for query")
+	}
+	if len(token.Key) == 0 && len(token.Partitions) == 0 {
+		return pageCursor{}, fmt.Errorf("page token has no key")
+	}
+
+	var cursor pageCursor
+	if len(token.Key) != 0 {
+		if cursor.StartKey, err = decodePageTokenKey(token.Key); err != nil {
+			return pageCursor{}, err
+		}
+	}
+	if len(token.Partitions) != 0 {
+		cursor.Partitions = make(map[string]map[string]ddbtypes.AttributeValue, len(token.Partitions))
+		for partition, attrs := range token.Partitions {
+			if cursor.Partitions[partition], err = decodePageTokenKey(attrs); err != nil {
+				return pageCursor{}, err
+			}
+		}
+	}
+
+	return cursor, nil
+}
+
+func decodePageTokenKey(attrs map[string]pageTokenAttribute) (map[string]ddbtypes.AttributeValue, error) {
+	key := make(map[string]ddbtypes.AttributeValue, len(attrs))
+	for name, attr := range attrs {
+		switch {
+		case attr.S != nil:
+			key[name] = &ddbtypes.AttributeValueMemberS{Value: *attr.S}
+		case attr.N != nil:
+			key[name] = &ddbtypes.AttributeValueMemberN{Value: *attr.N}
+		case attr.B != nil:
+			key[name] = &ddbtypes.AttributeValueMemberB{Value: attr.B}
+		default:
+			return nil, fmt.Errorf("page token key attribute %v has no value", name)
+		}
+	}
+	return key, nil
+}
+
+func signPageToken(signingKey, payload []byte) []byte {
+	mac := hmac.New(sha256.New, signingKey)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// getPageLimitFromQueryString returns the number of episodes to list from the
+// limit query parameter, or the default if not set.
+func getPageLimitFromQueryString(query map[string]string) (int, error) {
+	v, ok := query["limit"]
+	if !ok || v == "" {
+		return defaultPageLimit, nil
+	}
+
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit < 1 || limit > maxPageLimit {
+		return 0, fmt.Errorf("limit must be a number between 1 and %d", maxPageLimit)
+	}
+	return limit, nil
+}
+
+// canonicalFilterQuery returns the query parameters that select which
+// episodes are listed in a stable form, excluding the paging parameters.
+func canonicalFilterQuery(query map[string]string) string {
+	values := url.Values{}
+	for k, v := range query {
+		if k == "limit" || k == "next_token" {
+			continue
+		}
+		values.Set(k, v)
+	}
+	return values.Encode()
+}
+
+// makeNextPageURL returns the URL of the request with the next_token query
+// parameter replaced by the token of the next page.
+func makeNextPageURL(input events.APIGatewayV2HTTPRequest, nextToken string) string {
+	values := url.Values{}
+	for k, v := range input.QueryStringParameters {
+		values.Set(k, v)
+	}
+	values.Set("next_token", nextToken)
+
+	scheme := input.Headers["x-forwarded-proto"]
+	if scheme == "" {
+		scheme = "https"
+	}
+	host := input.RequestContext.DomainName
+	if host == "" {
+		host = input.Headers["host"]
+	}
+
+	u := url.URL{
+		Scheme:   scheme,
+		Host:     host,
+		Path:     input.RequestContext.HTTP.Path,
+		RawQuery: values.Encode(),
+	}
+	return u.String()
+}
@@ -0,0 +1,306 @@
+package listpodcasts
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	workshop "aws-workshop"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ddbexp "github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Sort orders of the episode listing by published date.
+const (
+	sortNewest = "newest"
+	sortOldest = "oldest"
+)
+
+// listEpisodesQuery is the filter and sort order query string parameters of
+// the episode listing.
+type listEpisodesQuery struct {
+	Podcast string
+	InTitle string
+	Status  workshop.EpisodeStatus
+
+	// RFC 3339 UTC timestamps of the published date range. The range
+	// includes PublishedAfter, and excludes PublishedBefore.
+	PublishedAfter  string
+	PublishedBefore string
+
+	Sort string
+}
+
+// parseListEpisodesQuery returns the listing query from the query string
+// parameters, or error describing the first invalid parameter.
+func parseListEpisodesQuery(query map[string]string) (listEpisodesQuery, error) {
+	q := listEpisodesQuery{
+		Podcast: query["podcast"],
+		InTitle: query["in-title"],
+	}
+
+	if v := query["status"]; v != "" {
+		status, err := workshop.ParseEpisodeStatus(v)
+		if err != nil || status == workshop.EpisodeStatusUnknown {
+			return listEpisodesQuery{}, fmt.Errorf("unknown status, %v", v)
+		}
+		q.Status = status
+	}
+
+	var err error
+	if q.PublishedAfter, err = parseDateQueryParameter(query, "published_after"); err != nil {
+		return listEpisodesQuery{}, err
+	}
+	if q.PublishedBefore, err = parseDateQueryParameter(query, "published_before"); err != nil {
+		return listEpisodesQuery{}, err
+	}
+	if q.PublishedAfter != "" && q.PublishedBefore != "" && q.PublishedAfter >= q.PublishedBefore {
+		return listEpisodesQuery{}, fmt.Errorf("published_after must be before published_before")
+	}
+
+	switch v := query["sort"]; v {
+	case "", sortNewest, sortOldest:
+		q.Sort = v
+	default:
+		return listEpisodesQuery{}, fmt.Errorf("sort must be %v or %v", sortNewest, sortOldest)
+	}
+
+	return q, nil
+}
+
+// parseDateQueryParameter returns the date query parameter as a RFC 3339 UTC
+// timestamp. The parameter can be either a RFC 3339 timestamp, or a date,
+// e.g. 2021-11-29.
+func parseDateQueryParameter(query map[string]string, name string) (string, error) {
+	v := query[name]
+	if v == "" {
+		return "", nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t.UTC().Format(time.RFC3339), nil
+		}
+	}
+	return "", fmt.Errorf("%v must be a date, e.g. 2021-11-29, or RFC 3339 timestamp", name)
+}
+
+// listIndex is the table index episodes are queried from, and the partition
+// key value episodes are queried for.
+type listIndex struct {
+	Name         string
+	PartitionKey string
+	Value        string
+}
+
+// keyCondition returns the condition for querying the index for episodes in
+// the published date range. Key conditions only support a single condition
+// on the sort key, so a range with both dates also needs the filter returned
+// by filterCondition.
+func (q listEpisodesQuery) keyCondition(index listIndex) ddbexp.KeyConditionBuilder {
+	keyCond := ddbexp.Key(index.PartitionKey).Equal(ddbexp.Value(index.Value))
+
+	publishedAt := ddbexp.Key("published_at")
+	switch {
+	case q.PublishedAfter != "" && q.PublishedBefore != "":
+		keyCond = keyCond.And(publishedAt.Between(
+			ddbexp.Value(q.PublishedAfter), ddbexp.Value(q.PublishedBefore)))
+	case q.PublishedAfter != "":
+		keyCond = keyCond.And(publishedAt.GreaterThanEqual(ddbexp.Value(q.PublishedAfter)))
+	case q.PublishedBefore != "":
+		keyCond = keyCond.And(publishedAt.LessThan(ddbexp.Value(q.PublishedBefore)))
+	}
+
+	return keyCond
+}
+
+// getListIndex returns the index to query for the episodes listed, if the
+// query filters by podcast or status, and the table has the index.
+func (h *Handler) getListIndex(q listEpisodesQuery) (listIndex, bool) {
+	switch {
+	case q.Podcast != "" && h.PodcastIndexName != "":
+		return listIndex{Name: h.PodcastIndexName, PartitionKey: "podcast", Value: q.Podcast}, true
+	case q.Status != workshop.EpisodeStatusUnknown && h.StatusIndexName != "":
+		return listIndex{Name: h.StatusIndexName, PartitionKey: "status", Value: q.Status.String()}, true
+	default:
+		return listIndex{}, false
+	}
+}
+
+// listPageFunc returns up to limit items evaluated after the start key, and
+// the LastEvaluatedKey to resume from, if any.
+type listPageFunc func(ctx context.Context, startKey map[string]ddbtypes.AttributeValue, limit int32) (
+	[]map[string]ddbtypes.AttributeValue, map[string]ddbtypes.AttributeValue, error,
+)
+
+func (h *Handler) scanPage(expr ddbexp.Expression) listPageFunc {
+	return func(ctx context.Context, startKey map[string]ddbtypes.AttributeValue, limit int32) (
+		[]map[string]ddbtypes.AttributeValue, map[string]ddbtypes.AttributeValue, error,
+	) {
+		result, err := h.DDBClient.Scan(ctx, &ddb.ScanInput{
+			TableName:                 &h.EpisodeTableName,
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			FilterExpression:          expr.Filter(),
+			ProjectionExpression:      expr.Projection(),
+			ExclusiveStartKey:         startKey,
+			Limit:                     aws.Int32(limit),
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to scan table, %w", err)
+		}
+		return result.Items, result.LastEvaluatedKey, nil
+	}
+}
+
+func (h *Handler) queryPage(expr ddbexp.Expression, indexName string, ascending bool) listPageFunc {
+	return func(ctx context.Context, startKey map[string]ddbtypes.AttributeValue, limit int32) (
+		[]map[string]ddbtypes.AttributeValue, map[string]ddbtypes.AttributeValue, error,
+	) {
+		result, err := h.DDBClient.Query(ctx, &ddb.QueryInput{
+			TableName:                 &h.EpisodeTableName,
+			IndexName:                 &indexName,
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			KeyConditionExpression:    expr.KeyCondition(),
+			FilterExpression:          expr.Filter(),
+			ProjectionExpression:      expr.Projection(),
+			ScanIndexForward:          aws.Bool(ascending),
+			ExclusiveStartKey:         startKey,
+			Limit:                     aws.Int32(limit),
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to query index %v, %w", indexName, err)
+		}
+		return result.Items, result.LastEvaluatedKey, nil
+	}
+}
+
+// Maximum number of list calls made, and time spent listing, for a page of
+// the episode listing. A selective filter may evaluate many episodes without
+// a match, so the page is returned partially filled instead of exceeding the
+// API Gateway integration timeout. The page's next_token resumes the listing.
+const (
+	maxListCallsPerPage = 20
+	maxListTimePerPage  = 10 * time.Second
+)
+
+// listBudget is the list calls made, and time left, for a page of the
+// episode listing. Shared by the partitions of a merged listing.
+type listBudget struct {
+	calls  int
+	stopAt time.Time
+}
+
+func newListBudget(ctx context.Context) *listBudget {
+	stopAt := time.Now().Add(maxListTimePerPage)
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(stopAt) {
+		stopAt = deadline
+	}
+	return &listBudget{stopAt: stopAt}
+}
+
+func (b *listBudget) exhausted() bool {
+	return b.calls >= maxListCallsPerPage || time.Now().After(b.stopAt)
+}
+
+// listEpisodes returns a page of up to limit episodes matching the query,
+// starting from the cursor, and the cursor to resume the listing from. The
+// cursor is empty if there are no more episodes.
+func (h *Handler) listEpisodes(ctx context.Context, q listEpisodesQuery, cursor pageCursor, limit int) (
+	[]workshop.ListEpisodeItem, pageCursor, *events.APIGatewayV2HTTPResponse, error,
+) {
+	budget := newListBudget(ctx)
+
+	// Episodes of a podcast or status are found with Query on the podcast or
+	// status index, ordered by published date, newest first by default.
+	// Sorted listings without either filter are merged from the queries of
+	// each status. Otherwise all episodes are listed using Scan of the table.
+	index, haveIndex := h.getListIndex(q)
+	if !haveIndex && q.Sort != "" {
+		return h.getMergedEpisodes(ctx, budget, q, cursor, limit)
+	}
+
+	var indexPtr *listIndex
+	if haveIndex {
+		indexPtr = &index
+	}
+	expr, err := q.buildExpression(indexPtr)
+	if err != nil {
+		return nil, pageCursor{}, nil, err
+	}
+
+	listPage := h.scanPage(expr)
+	if haveIndex {
+		listPage = h.queryPage(expr, index.Name, q.Sort == sortOldest)
+	}
+	episodes, lastKey, resp, err := getEpisodes(ctx, budget, listPage, cursor.StartKey, limit)
+	return episodes, pageCursor{StartKey: lastKey}, resp, err
+}
+
+// buildExpression returns the DynamoDB expression for listing the episodes
+// from the index, or table if nil. Only the fields of ListEpisodeItem are
+// retrieved from the item.
+func (q listEpisodesQuery) buildExpression(index *listIndex) (ddbexp.Expression, error) {
+	builder := ddbexp.NewBuilder().
+		WithProjection(workshop.ListEpisodesProjection())
+	if index != nil {
+		builder = builder.WithKeyCondition(q.keyCondition(*index))
+	}
+	if filterExp, haveFilter := q.filterCondition(index); haveFilter {
+		builder = builder.WithFilter(filterExp)
+	}
+
+	expr, err := builder.Build()
+	if err != nil {
+		return ddbexp.Expression{}, fmt.Errorf("failed to build expression projection, %w", err)
+	}
+	return expr, nil
+}
+
+// getEpisodes lists pages until limit episodes matching the filter are found,
+// there are no more episodes to evaluate, or the page's list call or time
+// budget is exhausted. Returns the episodes found, and the LastEvaluatedKey
+// to resume listing from, if any.
+func getEpisodes(
+	ctx context.Context, budget *listBudget, listPage listPageFunc,
+	startKey map[string]ddbtypes.AttributeValue, limit int,
+) (
+	[]workshop.ListEpisodeItem, map[string]ddbtypes.AttributeValue, *events.APIGatewayV2HTTPResponse, error,
+) {
+	episodes := make([]workshop.ListEpisodeItem, 0, limit)
+	for {
+		// Limit is the number of items evaluated before the filter is
+		// applied, so the page may need multiple calls to fill. Limiting each
+		// call to the remaining page size ensures the LastEvaluatedKey is
+		// never beyond the last episode returned.
+		items, lastKey, err := listPage(ctx, startKey, int32(limit-len(episodes)))
+		if err != nil {
+			resp, err := handleListError(err)
+			return nil, nil, resp, err
+		}
+		budget.calls++
+		printResponseDebugInformation(len(items), lastKey)
+
+		// Convert the DynamoDB AttributeValue datatype into our ListEpisodeItem type.
+		page, err := unmarshalEpisodeItems(items)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		episodes = append(episodes, page...)
+
+		startKey = lastKey
+		if len(startKey) == 0 || len(episodes) >= limit {
+			return episodes, startKey, nil, nil
+		}
+		if budget.exhausted() {
+			log.Printf("page budget exhausted after %v calls, returning %v episodes", budget.calls, len(episodes))
+			return episodes, startKey, nil, nil
+		}
+	}
+}
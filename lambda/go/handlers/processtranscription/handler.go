@@ -0,0 +1,115 @@
+package processtranscription
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+
+	workshop "aws-workshop"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ddbav "github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+type Handler struct {
+	S3Uploader   S3UploadAPI
+	S3Downloader S3DownloadAPI
+	DDBClient    DDBAPI
+
+	BucketName       string
+	MediaKeyPrefix   string
+	EpisodeTableName string
+}
+
+func (h *Handler) Handle(ctx context.Context, input workshop.TranscribeStateMachineInput) (
+	workshop.TranscribeStateMachineOutput, error,
+) {
+	log.Println("processing transcription,", input)
+	episode := input.Episode
+
+	transcribeOutput := manager.NewWriteAtBuffer(make([]byte, 0, 1*1024*1024))
+	_, err := h.S3Downloader.Download(ctx, transcribeOutput, &s3.GetObjectInput{
+		Bucket: &h.BucketName,
+		Key:    &episode.TranscribeMetadataKey,
+	})
+	if err != nil {
+		return workshop.TranscribeStateMachineOutput{},
+			fmt.Errorf("failed to download transcribe metadata, %w", err)
+	}
+
+	var transcribeMetadata = struct {
+		Results struct {
+			LanguageCode string `json:"language_code"`
+			Transcripts  []struct {
+				Transcript string `json:"transcript"`
+			} `json:"transcripts"`
+		} `json:"results"`
+	}{}
+	if err = json.Unmarshal(transcribeOutput.Bytes(), &transcribeMetadata); err != nil {
+		return workshop.TranscribeStateMachineOutput{},
+			fmt.Errorf("failed to decode transcribe metadata, %w", err)
+	}
+	if len(transcribeMetadata.Results.Transcripts) == 0 {
+		return workshop.TranscribeStateMachineOutput{},
+			fmt.Errorf("transcribe metadata did not contain transcription, %v", transcribeMetadata)
+	}
+
+	// TODO Do some kind of processing on transcription metadata
+	var transcriptBuffer bytes.Buffer
+	for _, result := range transcribeMetadata.Results.Transcripts {
+		transcriptBuffer.WriteString(result.Transcript)
+		transcriptBuffer.WriteString("\n\n")
+	}
+
+	episode.TranscriptionKey = workshop.MakeEpisodeTranscriptionPath(
+		h.MediaKeyPrefix, episode.ID,
+	)
+
+	_, err = h.S3Uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket:      &h.BucketName,
+		Key:         &episode.TranscriptionKey,
+		ContentType: aws.String("text/plain"),
+		Body:        bytes.NewReader(transcriptBuffer.Bytes()),
+	})
+	if err != nil {
+		return workshop.TranscribeStateMachineOutput{},
+			fmt.Errorf("failed to upload transcription file, %w", err)
+	}
+	log.Println("uploaded media transcription,", episode.TranscriptionKey)
+
+	av, err := ddbav.MarshalMap(episode)
+	if err != nil {
+		return workshop.TranscribeStateMachineOutput{},
+			fmt.Errorf("failed to marshal episode, %w", err)
+	}
+
+	log.Println("updating episode table,", episode)
+	_, err = h.DDBClient.PutItem(ctx, &ddb.PutItemInput{
+		TableName: &h.EpisodeTableName,
+		Item:      av,
+	})
+	if err != nil {
+		return workshop.TranscribeStateMachineOutput{},
+			fmt.Errorf("failed to put episode to metadata table, %w", err)
+	}
+
+	return workshop.TranscribeStateMachineOutput{
+		Episode: input.Episode,
+	}, nil
+}
+
+type S3UploadAPI interface {
+	Upload(context.Context, *s3.PutObjectInput, ...func(*manager.Uploader)) (*manager.UploadOutput, error)
+}
+type S3DownloadAPI interface {
+	Download(context.Context, io.WriterAt, *s3.GetObjectInput, ...func(*manager.Downloader)) (int64, error)
+}
+type DDBAPI interface {
+	PutItem(context.Context, *ddb.PutItemInput, ...func(*ddb.Options)) (*ddb.PutItemOutput, error)
+}
@@ -0,0 +1,162 @@
+package starttranscription
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	workshop "aws-workshop"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	tr "github.com/aws/aws-sdk-go-v2/service/transcribe"
+	trtypes "github.com/aws/aws-sdk-go-v2/service/transcribe/types"
+)
+
+type Handler struct {
+	S3EndpointResolver s3.EndpointResolver
+	TranscribeClient   TranscribeAPI
+	DDBClient          DDBAPI
+
+	Region           string
+	BucketAccessRole string
+	BucketName       string
+	MediaKeyPrefix   string
+
+	// Table the episode's transcribe started, and failure reason are
+	// recorded in.
+	EpisodeTableName string
+
+	// Table the podcast's episodes transcribed today are counted in. The
+	// podcast's episodes per day are not limited if empty.
+	QuotaTableName string
+
+	// Limits on the episodes transcribed. Episodes over the limits fail with
+	// a QuotaExceededError, and the limit is recorded as the episode's
+	// failure reason.
+	Quotas workshop.MediaQuotas
+
+	UUIDProvider UUIDProvider
+}
+
+func (h *Handler) Handle(ctx context.Context, input workshop.TranscribeStateMachineInput) (
+	workshop.TranscribeStateMachineOutput, error,
+) {
+	log.Println("staring transcription,", input)
+	episode := input.Episode
+
+	mediaFormat, err := contentTypeToMediaFormat(episode.MediaContentType)
+	if err != nil {
+		return workshop.TranscribeStateMachineOutput{}, err
+	}
+
+	mediaURI, err := h.getS3Endpoint(episode.MediaKey)
+	if err != nil {
+		return workshop.TranscribeStateMachineOutput{}, err
+	}
+
+	episode.TranscribeMetadataKey = workshop.MakeEpisodeTranscribeMetadataPath(
+		h.MediaKeyPrefix, episode.ID,
+	)
+
+	if episode.TranscribeJobID != "" {
+		log.Println("transcription already started,", episode.TranscribeJobID)
+		return workshop.TranscribeStateMachineOutput{Episode: episode}, nil
+	}
+
+	if err := h.checkQuotas(ctx, episode); err != nil {
+		var quotaErr *workshop.QuotaExceededError
+		if errors.As(err, &quotaErr) {
+			return workshop.TranscribeStateMachineOutput{}, h.failQuota(ctx, episode.ID, quotaErr)
+		}
+		return workshop.TranscribeStateMachineOutput{}, err
+	}
+
+	episode.TranscribeJobID, err = h.UUIDProvider.GetUUID()
+	if err != nil {
+		h.uncountEpisode(ctx, episode)
+		return workshop.TranscribeStateMachineOutput{}, err
+	}
+	resp, err := h.TranscribeClient.StartTranscriptionJob(ctx,
+		&tr.StartTranscriptionJobInput{
+			TranscriptionJobName: &episode.TranscribeJobID,
+			IdentifyLanguage:     aws.Bool(true),
+			MediaFormat:          mediaFormat,
+			Media: &trtypes.Media{
+				MediaFileUri: &mediaURI,
+			},
+			Settings: &trtypes.Settings{
+				MaxSpeakerLabels:  aws.Int32(10),
+				ShowSpeakerLabels: aws.Bool(true),
+			},
+			JobExecutionSettings: &trtypes.JobExecutionSettings{
+				AllowDeferredExecution: aws.Bool(true),
+				DataAccessRoleArn:      &h.BucketAccessRole,
+			},
+			OutputBucketName: &h.BucketName,
+			OutputKey:        &episode.TranscribeMetadataKey,
+		},
+	)
+	if err != nil {
+		h.uncountEpisode(ctx, episode)
+		return workshop.TranscribeStateMachineOutput{},
+			fmt.Errorf("failed to start transcription job, %w", err)
+	}
+
+	log.Println("transcription started,", episode.TranscribeJobID, resp)
+
+	if err := h.recordTranscribeStarted(ctx, &episode); err != nil {
+		log.Printf("ERROR: %v", err)
+	}
+
+	return workshop.TranscribeStateMachineOutput{
+		Episode: episode,
+	}, nil
+}
+
+func (h *Handler) getS3Endpoint(key string) (string, error) {
+	endpoint, err := h.S3EndpointResolver.ResolveEndpoint(h.Region, s3.EndpointResolverOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get S3 endpoint for region %v, %w", h.Region, err)
+	}
+
+	// TODO this does not escape bucket or key names.
+	return endpoint.URL + "/" + h.BucketName + "/" + key, nil
+}
+
+type UUIDProvider interface {
+	GetUUID() (string, error)
+}
+type TranscribeAPI interface {
+	StartTranscriptionJob(ctx context.Context, params *tr.StartTranscriptionJobInput, optFns ...func(*tr.Options)) (*tr.StartTranscriptionJobOutput, error)
+}
+type DDBAPI interface {
+	workshop.UpdateItemAPI
+	workshop.GetItemAPI
+}
+
+// mediaFormats are the Transcribe media formats of the canonical media
+// content types, see workshop.MediaContentTypes.
+var mediaFormats = map[string]trtypes.MediaFormat{
+	"audio/mpeg":      trtypes.MediaFormatMp3,
+	"audio/mp4a-latm": trtypes.MediaFormatMp4,
+	"video/mp4":       trtypes.MediaFormatMp4,
+	"audio/wav":       trtypes.MediaFormatWav,
+	"audio/flac":      trtypes.MediaFormatFlac,
+	"audio/ogg":       trtypes.MediaFormatOgg,
+	"audio/amr":       trtypes.MediaFormatAmr,
+	"audio/webm":      trtypes.MediaFormatWebm,
+	"video/webm":      trtypes.MediaFormatWebm,
+}
+
+// contentTypeToMediaFormat returns the Transcribe media format of the
+// content type. Aliases of the content type, e.g. audio/x-m4a, and the
+// content type's parameters, e.g. audio/mpeg; charset=binary, are accepted.
+func contentTypeToMediaFormat(v string) (trtypes.MediaFormat, error) {
+	format, ok := mediaFormats[workshop.NormalizeMediaContentType(v)]
+	if !ok {
+		return "", fmt.Errorf("unsupported media content type, %v", v)
+	}
+	return format, nil
+}
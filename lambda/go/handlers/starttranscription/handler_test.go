@@ -0,0 +1,76 @@
+package starttranscription
+
+import (
+	"strings"
+	"testing"
+
+	workshop "aws-workshop"
+
+	trtypes "github.com/aws/aws-sdk-go-v2/service/transcribe/types"
+)
+
+func TestContentTypeToMediaFormat(t *testing.T) {
+	cases := map[string]struct {
+		ContentType string
+		Expect      trtypes.MediaFormat
+		ExpectErr   bool
+	}{
+		"mpeg":          {ContentType: "audio/mpeg", Expect: trtypes.MediaFormatMp3},
+		"mp4 audio":     {ContentType: "audio/mp4a-latm", Expect: trtypes.MediaFormatMp4},
+		"mp4 video":     {ContentType: "video/mp4", Expect: trtypes.MediaFormatMp4},
+		"wav":           {ContentType: "audio/wav", Expect: trtypes.MediaFormatWav},
+		"flac":          {ContentType: "audio/flac", Expect: trtypes.MediaFormatFlac},
+		"ogg":           {ContentType: "audio/ogg", Expect: trtypes.MediaFormatOgg},
+		"amr":           {ContentType: "audio/amr", Expect: trtypes.MediaFormatAmr},
+		"webm audio":    {ContentType: "audio/webm", Expect: trtypes.MediaFormatWebm},
+		"webm video":    {ContentType: "video/webm", Expect: trtypes.MediaFormatWebm},
+		"mp3 alias":     {ContentType: "audio/mp3", Expect: trtypes.MediaFormatMp3},
+		"m4a alias":     {ContentType: "audio/x-m4a", Expect: trtypes.MediaFormatMp4},
+		"opus alias":    {ContentType: "audio/opus", Expect: trtypes.MediaFormatOgg},
+		"parameters":    {ContentType: "audio/mpeg; charset=binary", Expect: trtypes.MediaFormatMp3},
+		"upper case":    {ContentType: "Audio/FLAC", Expect: trtypes.MediaFormatFlac},
+		"unknown":       {ContentType: "audio/aac", ExpectErr: true},
+		"not media":     {ContentType: "text/html", ExpectErr: true},
+		"generic":       {ContentType: "application/octet-stream", ExpectErr: true},
+		"empty":         {ContentType: "", ExpectErr: true},
+		"whitespace":    {ContentType: "  ", ExpectErr: true},
+		"invalid media": {ContentType: "audio/", ExpectErr: true},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			format, err := contentTypeToMediaFormat(c.ContentType)
+			if c.ExpectErr {
+				if err == nil {
+					t.Fatalf("expect error, got %v format", format)
+				}
+				if e, a := "unsupported media content type", err.Error(); !strings.Contains(a, e) {
+					t.Errorf("expect %q error, got %q", e, a)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expect no error, got %v", err)
+			}
+			if e, a := c.Expect, format; e != a {
+				t.Errorf("expect %v format, got %v", e, a)
+			}
+		})
+	}
+}
+
+func TestMediaFormats(t *testing.T) {
+	// Every content type episodes can be imported with must have a
+	// Transcribe media format, and every media format's content type must be
+	// accepted on import.
+	for _, contentType := range workshop.MediaContentTypes {
+		if _, ok := mediaFormats[contentType]; !ok {
+			t.Errorf("expect %v to have media format", contentType)
+		}
+	}
+	for contentType := range mediaFormats {
+		if !workshop.IsMediaContentType(contentType) {
+			t.Errorf("expect %v to be a media content type", contentType)
+		}
+	}
+}
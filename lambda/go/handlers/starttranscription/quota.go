@@ -0,0 +1,92 @@
+package starttranscription
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	workshop "aws-workshop"
+
+	ddbexp "github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// checkQuotas returns a QuotaExceededError if the episode's media is larger,
+// or longer than the quotas, or the maximum number of episodes of its podcast
+// have been transcribed today. Otherwise the episode is counted in its
+// podcast's episodes transcribed today. The media's duration is used if
+// known, otherwise the duration published in the episode's feed.
+func (h *Handler) checkQuotas(ctx context.Context, episode workshop.Episode) error {
+	if err := h.Quotas.CheckMediaSize(episode.MediaSize); err != nil {
+		return err
+	}
+
+	duration := episode.MediaDurationSeconds
+	if duration == 0 {
+		duration = float64(episode.DurationSeconds)
+	}
+	if err := h.Quotas.CheckMediaDuration(duration); err != nil {
+		return err
+	}
+
+	if h.QuotaTableName == "" {
+		return nil
+	}
+	return h.Quotas.CountPodcastEpisodePerDay(ctx, h.DDBClient, h.QuotaTableName, episode)
+}
+
+// uncountEpisode removes the episode from its podcast's episodes transcribed
+// today, because the episode's transcribe failed to start. Failing to remove
+// the episode is logged.
+func (h *Handler) uncountEpisode(ctx context.Context, episode workshop.Episode) {
+	if h.QuotaTableName == "" {
+		return
+	}
+	if err := h.Quotas.UncountPodcastEpisodePerDay(ctx, h.DDBClient, h.QuotaTableName, episode); err != nil {
+		log.Printf("ERROR: %v", err)
+	}
+}
+
+// failQuota records the reason the episode exceeded the quota as the
+// episode's failure reason, and returns the error.
+func (h *Handler) failQuota(ctx context.Context, episodeID string, err error) error {
+	log.Printf("episode %v exceeded quota, %v", episodeID, err)
+	if h.EpisodeTableName != "" {
+		if recordErr := workshop.RecordEpisodeFailureReason(ctx, h.DDBClient, h.EpisodeTableName,
+			episodeID, err.Error()); recordErr != nil {
+			log.Printf("ERROR: %v", recordErr)
+		}
+	}
+	return err
+}
+
+// recordTranscribeStarted records the time the episode's transcribe was
+// started in the episode's item.
+func (h *Handler) recordTranscribeStarted(ctx context.Context, episode *workshop.Episode) error {
+	episode.TranscribeStartedAt = time.Now().UTC().Format(time.RFC3339)
+	if h.EpisodeTableName == "" {
+		return nil
+	}
+
+	exp, err := ddbexp.NewBuilder().
+		WithUpdate(ddbexp.Set(ddbexp.Name("transcribe_started_at"), ddbexp.Value(episode.TranscribeStartedAt))).
+		WithCondition(ddbexp.AttributeExists(ddbexp.Name("id"))).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression, %w", err)
+	}
+
+	_, err = h.DDBClient.UpdateItem(ctx, &ddb.UpdateItemInput{
+		TableName:                 &h.EpisodeTableName,
+		Key:                       episode.AttributeValuePrimaryKey(),
+		UpdateExpression:          exp.Update(),
+		ConditionExpression:       exp.Condition(),
+		ExpressionAttributeNames:  exp.Names(),
+		ExpressionAttributeValues: exp.Values(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record episode transcribe started, %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package updateepisodestatus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	workshop "aws-workshop"
+
+	ddbav "github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	ddbexp "github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+type Handler struct {
+	DDBClient DDBAPI
+	S3Client  S3API
+
+	EpisodeTableName string
+	BucketName       string
+}
+
+type InputEvent struct {
+	EpisodeID string `json:"id"`
+	Status    string `json:"status"`
+}
+
+func (h *Handler) Handle(ctx context.Context, input InputEvent) (
+	string, error,
+) {
+	log.Println("updating episode status,", input)
+
+	// The multipart upload of a failed episode's media is removed from the
+	// episode, and aborted below. The upload step leaves the upload for its
+	// retries to resume, so uploads still incomplete when the retries are
+	// exhausted would otherwise never be completed or aborted.
+	failed := input.Status == string(workshop.EpisodeStatusFailure)
+	update := ddbexp.Set(
+		ddbexp.Name("status"),
+		ddbexp.Value(input.Status),
+	)
+	returnValues := ddbtypes.ReturnValueNone
+	if failed {
+		update = update.Remove(ddbexp.Name("media_upload"))
+		returnValues = ddbtypes.ReturnValueAllOld
+	}
+
+	exp, err := ddbexp.NewBuilder().WithUpdate(update).Build()
+	if err != nil {
+		return "", fmt.Errorf("failed to build update expression, %w", err)
+	}
+
+	resp, err := h.DDBClient.UpdateItem(ctx, &ddb.UpdateItemInput{
+		TableName: &h.EpisodeTableName,
+		Key: workshop.Episode{
+			ID: input.EpisodeID,
+		}.AttributeValuePrimaryKey(),
+		UpdateExpression:          exp.Update(),
+		ExpressionAttributeNames:  exp.Names(),
+		ExpressionAttributeValues: exp.Values(),
+		ReturnValues:              returnValues,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to update episode, %w", err)
+	}
+
+	log.Printf("episode %v updated, %v", input.EpisodeID, input.Status)
+
+	if failed {
+		h.abortMediaUpload(ctx, resp.Attributes)
+	}
+
+	return input.Status, nil
+}
+
+// mediaUpload is the multipart upload of the episode's media recorded by the
+// upload podcast step.
+type mediaUpload struct {
+	Key      string `dynamodbav:"key"`
+	UploadID string `dynamodbav:"upload_id"`
+}
+
+// abortMediaUpload aborts the multipart upload of the episode's media, if
+// the episode had one. Errors are logged, and do not fail the status update.
+func (h *Handler) abortMediaUpload(ctx context.Context, item map[string]ddbtypes.AttributeValue) {
+	var episode struct {
+		MediaUpload *mediaUpload `dynamodbav:"media_upload"`
+	}
+	if err := ddbav.UnmarshalMap(item, &episode); err != nil {
+		log.Printf("ERROR: failed to unmarshal media upload, %v", err)
+		return
+	}
+	upload := episode.MediaUpload
+	if upload == nil || upload.UploadID == "" {
+		return
+	}
+
+	log.Printf("aborting media upload %v", upload.UploadID)
+	_, err := h.S3Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   &h.BucketName,
+		Key:      &upload.Key,
+		UploadId: &upload.UploadID,
+	})
+	var noSuchUpload *s3types.NoSuchUpload
+	if err != nil && !errors.As(err, &noSuchUpload) {
+		log.Printf("ERROR: failed to abort media upload %v, %v", upload.UploadID, err)
+	}
+}
+
+type DDBAPI interface {
+	UpdateItem(context.Context, *ddb.UpdateItemInput, ...func(*ddb.Options)) (
+		*ddb.UpdateItemOutput, error,
+	)
+}
+
+type S3API interface {
+	AbortMultipartUpload(context.Context, *s3.AbortMultipartUploadInput, ...func(*s3.Options)) (
+		*s3.AbortMultipartUploadOutput, error,
+	)
+}
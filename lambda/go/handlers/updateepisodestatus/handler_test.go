@@ -0,0 +1,109 @@
+package updateepisodestatus
+
+import (
+	"context"
+	"testing"
+
+	workshop "aws-workshop"
+	"aws-workshop/fakes"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ddbav "github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	testEpisodeTableName = "PodcastEpisode"
+	testBucketName       = "podcast-data"
+	testMediaKey         = "podcasts/1/media"
+)
+
+func TestHandle_MediaUpload(t *testing.T) {
+	cases := map[string]struct {
+		Status        string
+		UploadAborted bool
+	}{
+		"failure": {
+			Status:        string(workshop.EpisodeStatusFailure),
+			UploadAborted: true,
+		},
+		"transcribing": {
+			Status: "transcribing",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			s3Client := fakes.NewS3(testBucketName)
+			created, err := s3Client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+				Bucket: aws.String(testBucketName),
+				Key:    aws.String(testMediaKey),
+			})
+			if err != nil {
+				t.Fatalf("failed to create multipart upload, %v", err)
+			}
+			uploadID := aws.ToString(created.UploadId)
+
+			ddbClient := fakes.NewDynamoDB()
+			ddbClient.CreateTable(testEpisodeTableName, "id", "")
+			item, err := ddbav.MarshalMap(struct {
+				ID          string      `dynamodbav:"id"`
+				Status      string      `dynamodbav:"status"`
+				MediaUpload mediaUpload `dynamodbav:"media_upload"`
+			}{
+				ID:          "1",
+				Status:      "uploading",
+				MediaUpload: mediaUpload{Key: testMediaKey, UploadID: uploadID},
+			})
+			if err != nil {
+				t.Fatalf("failed to marshal episode, %v", err)
+			}
+			_, err = ddbClient.PutItem(ctx, &ddb.PutItemInput{
+				TableName: aws.String(testEpisodeTableName),
+				Item:      item,
+			})
+			if err != nil {
+				t.Fatalf("failed to put episode, %v", err)
+			}
+
+			h := &Handler{
+				DDBClient:        ddbClient,
+				S3Client:         s3Client,
+				EpisodeTableName: testEpisodeTableName,
+				BucketName:       testBucketName,
+			}
+			status, err := h.Handle(ctx, InputEvent{EpisodeID: "1", Status: c.Status})
+			if err != nil {
+				t.Fatalf("expect no error, got %v", err)
+			}
+			if e, a := c.Status, status; e != a {
+				t.Errorf("expect %v status, got %v", e, a)
+			}
+
+			if _, inProgress := s3Client.MultipartUploadParts(uploadID); inProgress == c.UploadAborted {
+				t.Errorf("expect upload aborted %v, got in progress %v", c.UploadAborted, inProgress)
+			}
+
+			resp, err := ddbClient.GetItem(ctx, &ddb.GetItemInput{
+				TableName: aws.String(testEpisodeTableName),
+				Key:       workshop.Episode{ID: "1"}.AttributeValuePrimaryKey(),
+			})
+			if err != nil {
+				t.Fatalf("failed to get episode, %v", err)
+			}
+			var episode workshop.Episode
+			if err := ddbav.UnmarshalMap(resp.Item, &episode); err != nil {
+				t.Fatalf("failed to unmarshal episode, %v", err)
+			}
+			if e, a := workshop.EpisodeStatus(c.Status), episode.Status; e != a {
+				t.Errorf("expect %v status recorded, got %v", e, a)
+			}
+			if _, recorded := resp.Item["media_upload"]; recorded == c.UploadAborted {
+				t.Errorf("expect upload removed %v, got recorded %v", c.UploadAborted, recorded)
+			}
+		})
+	}
+}
@@ -0,0 +1,748 @@
+package uploadpodcast
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"strings"
+
+	workshop "aws-workshop"
+
+	ddbexp "github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	// probeHeadLen is the number of bytes from the start of the media the
+	// probe buffers to parse the media's headers.
+	probeHeadLen = 256 * 1024
+
+	// maxProbeHeadLen is the maximum number of bytes from the start of the
+	// media the probe buffers, when the media starts with an ID3 tag larger
+	// than probeHeadLen, e.g. with embedded artwork.
+	maxProbeHeadLen = 16 * 1024 * 1024
+
+	// maxMP4MoovLen is the maximum size of an MP4 moov box the probe
+	// buffers.
+	maxMP4MoovLen = 16 * 1024 * 1024
+)
+
+// audioMetadata is the metadata of the media parsed from its headers, and
+// tags. Fields not known for the media's container are zero.
+type audioMetadata struct {
+	DurationSeconds float64
+	Bitrate         int
+	SampleRate      int
+	Channels        int
+
+	Title    string
+	Artist   string
+	Chapters []workshop.Chapter
+	Artwork  *artwork
+}
+
+// audioProbe collects the headers of the media as the media is streamed. The
+// start of the media is buffered, and for MP4 the moov box, wherever it is in
+// the media.
+type audioProbe struct {
+	head      []byte
+	headLimit int
+	off       int64
+
+	mp4 mp4BoxScanner
+}
+
+func newAudioProbe() *audioProbe {
+	return &audioProbe{headLimit: probeHeadLen}
+}
+
+// Write writes the next bytes of the media to the probe.
+func (p *audioProbe) Write(b []byte) (int, error) {
+	p.writeAt(b, p.off)
+	return len(b), nil
+}
+
+// writeAt writes the bytes of the media at the offset to the probe. The
+// probe ignores bytes it has already seen, and stops buffering the parts of
+// the media it needs if bytes are skipped, e.g. when an upload is resumed.
+func (p *audioProbe) writeAt(b []byte, off int64) {
+	if off == int64(len(p.head)) && len(p.head) < p.headLimit {
+		n := p.headLimit - len(p.head)
+		if n > len(b) {
+			n = len(b)
+		}
+		p.head = append(p.head, b[:n]...)
+
+		// Buffer the media after the ID3 tag, if the tag is larger than the
+		// head, so the audio's headers are parsed.
+		if n := id3TagLen(p.head) + probeHeadLen; n > int64(p.headLimit) {
+			if n > maxProbeHeadLen {
+				n = maxProbeHeadLen
+			}
+			p.headLimit = int(n)
+		}
+	}
+	p.mp4.writeAt(b, off)
+	if end := off + int64(len(b)); end > p.off {
+		p.off = end
+	}
+}
+
+// headFull returns if the probe has buffered all of the start of the media
+// it needs.
+func (p *audioProbe) headFull() bool {
+	return len(p.head) >= p.headLimit
+}
+
+// metadata returns the metadata of the media parsed from the media's
+// headers. The size of the media is used to estimate the duration of media
+// without a duration in its headers, e.g. constant bitrate MP3.
+func (p *audioProbe) metadata(size int64) audioMetadata {
+	var meta audioMetadata
+	switch workshop.SniffAudioContentType(p.head) {
+	case "audio/mpeg":
+		meta = parseMPEGAudio(p.head, size)
+	case "audio/wav":
+		meta = parseWAV(p.head, size)
+	case "audio/flac":
+		meta = parseFLAC(p.head)
+	case "audio/mp4a-latm":
+		meta = parseMP4Moov(p.mp4.moov)
+	}
+
+	if meta.Bitrate == 0 && meta.DurationSeconds > 0 {
+		meta.Bitrate = int(float64(size) * 8 / meta.DurationSeconds)
+	}
+	return meta
+}
+
+// probeMediaHead writes the start of the media to the probe, for media whose
+// start is not downloaded, e.g. the upload is resumed. Errors are logged,
+// the media's metadata is not required.
+func (h *Handler) probeMediaHead(ctx context.Context, mediaURL string, probe *audioProbe) {
+	resp, err := h.getMediaRange(ctx, mediaURL, 0, "")
+	if err != nil {
+		log.Printf("ERROR: failed to get start of media for metadata, %v", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	buf := make([]byte, 32*1024)
+	for !probe.headFull() {
+		n, err := resp.Body.Read(buf)
+		probe.Write(buf[:n])
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			log.Printf("ERROR: failed to read start of media for metadata, %v", err)
+			return
+		}
+	}
+}
+
+// recordAudioMetadata sets the media's metadata on the episode, uploads the
+// media's embedded artwork, and records the metadata in the episode's item,
+// so it is known before the episode is transcribed. The episode's duration
+// is set from the media if the feed did not provide it. Errors are logged,
+// the media's metadata is not required to transcribe the episode.
+func (h *Handler) recordAudioMetadata(ctx context.Context, episode *workshop.Episode, meta audioMetadata) {
+	episode.MediaDurationSeconds = math.Round(meta.DurationSeconds*1000) / 1000
+	episode.MediaBitrate = meta.Bitrate
+	episode.MediaSampleRate = meta.SampleRate
+	episode.MediaChannels = meta.Channels
+	episode.MediaTitle = meta.Title
+	episode.MediaArtist = meta.Artist
+	episode.MediaChapters = meta.Chapters
+	if episode.DurationSeconds == 0 {
+		episode.DurationSeconds = int64(math.Round(meta.DurationSeconds))
+	}
+	log.Printf("media duration %vs, bitrate %v, sample rate %v, channels %v",
+		episode.MediaDurationSeconds, episode.MediaBitrate, episode.MediaSampleRate, episode.MediaChannels)
+
+	if meta.Artwork != nil {
+		key := workshop.MakeEpisodeArtworkPath(h.MediaKeyPrefix, episode.ID)
+		_, err := h.S3Uploader.Upload(ctx, &s3.PutObjectInput{
+			Bucket:      &h.BucketName,
+			Key:         &key,
+			Body:        bytes.NewReader(meta.Artwork.Data),
+			ContentType: &meta.Artwork.ContentType,
+		})
+		if err != nil {
+			log.Printf("ERROR: failed to upload media artwork, %v", err)
+		} else {
+			episode.MediaArtworkKey = key
+		}
+	}
+
+	if err := h.updateAudioMetadata(ctx, *episode); err != nil {
+		log.Printf("ERROR: %v", err)
+	}
+}
+
+// updateAudioMetadata records the episode's media metadata in the episode's
+// item, if the item exists.
+func (h *Handler) updateAudioMetadata(ctx context.Context, episode workshop.Episode) error {
+	if h.EpisodeTableName == "" {
+		return nil
+	}
+
+	var update ddbexp.UpdateBuilder
+	var hasUpdate bool
+	set := func(name string, v interface{}, zero bool) {
+		if !zero {
+			update = update.Set(ddbexp.Name(name), ddbexp.Value(v))
+			hasUpdate = true
+		}
+	}
+	set("media_duration_seconds", episode.MediaDurationSeconds, episode.MediaDurationSeconds == 0)
+	set("media_bitrate", episode.MediaBitrate, episode.MediaBitrate == 0)
+	set("media_sample_rate", episode.MediaSampleRate, episode.MediaSampleRate == 0)
+	set("media_channels", episode.MediaChannels, episode.MediaChannels == 0)
+	set("media_title", episode.MediaTitle, episode.MediaTitle == "")
+	set("media_artist", episode.MediaArtist, episode.MediaArtist == "")
+	set("media_chapters", episode.MediaChapters, len(episode.MediaChapters) == 0)
+	set("media_artwork_key", episode.MediaArtworkKey, episode.MediaArtworkKey == "")
+	set("duration_seconds", episode.DurationSeconds, episode.DurationSeconds == 0)
+	if !hasUpdate {
+		return nil
+	}
+
+	exp, err := ddbexp.NewBuilder().
+		WithUpdate(update).
+		WithCondition(ddbexp.AttributeExists(ddbexp.Name("id"))).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression, %w", err)
+	}
+
+	_, err = h.DDBClient.UpdateItem(ctx, &ddb.UpdateItemInput{
+		TableName:                 &h.EpisodeTableName,
+		Key:                       episode.AttributeValuePrimaryKey(),
+		UpdateExpression:          exp.Update(),
+		ConditionExpression:       exp.Condition(),
+		ExpressionAttributeNames:  exp.Names(),
+		ExpressionAttributeValues: exp.Values(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update episode media metadata, %w", err)
+	}
+	return nil
+}
+
+// mp4BoxScanner walks the top-level boxes of MP4 media as the media is
+// streamed, and buffers the moov box.
+type mp4BoxScanner struct {
+	pos  int64 // offset of the next byte of the media
+	next int64 // offset of the next top-level box
+	hdr  []byte
+
+	moov     []byte
+	moovLeft int64
+	stopped  bool
+}
+
+func (s *mp4BoxScanner) writeAt(b []byte, off int64) {
+	if s.stopped {
+		return
+	}
+	if off > s.pos {
+		// Bytes were skipped, the scanner can only continue if they were
+		// within the body of a box that is not buffered.
+		if s.moovLeft > 0 || len(s.hdr) > 0 || off > s.next {
+			s.stopped = true
+			return
+		}
+		s.pos = off
+	}
+	if end := off + int64(len(b)); end <= s.pos {
+		return
+	}
+	b = b[s.pos-off:]
+
+	for len(b) > 0 && !s.stopped {
+		switch {
+		case s.moovLeft > 0:
+			n := int64(len(b))
+			if n > s.moovLeft {
+				n = s.moovLeft
+			}
+			s.moov = append(s.moov, b[:n]...)
+			s.moovLeft -= n
+			s.pos += n
+			b = b[n:]
+			if s.moovLeft == 0 {
+				s.stopped = true
+			}
+
+		case s.pos < s.next:
+			n := int64(len(b))
+			if n > s.next-s.pos {
+				n = s.next - s.pos
+			}
+			s.pos += n
+			b = b[n:]
+
+		default:
+			need := 8
+			if len(s.hdr) >= 8 && binary.BigEndian.Uint32(s.hdr) == 1 {
+				need = 16
+			}
+			n := need - len(s.hdr)
+			if n > len(b) {
+				n = len(b)
+			}
+			s.hdr = append(s.hdr, b[:n]...)
+			s.pos += int64(n)
+			b = b[n:]
+			if len(s.hdr) == need && (need == 16 || binary.BigEndian.Uint32(s.hdr) != 1) {
+				s.startBox()
+			}
+		}
+	}
+}
+
+// startBox starts the top-level box of the header read.
+func (s *mp4BoxScanner) startBox() {
+	start := s.pos - int64(len(s.hdr))
+	size := int64(binary.BigEndian.Uint32(s.hdr))
+	typ := string(s.hdr[4:8])
+	if size == 1 {
+		size = int64(binary.BigEndian.Uint64(s.hdr[8:16]))
+	}
+	hdr := s.hdr
+	s.hdr = nil
+
+	// Media that does not start with a ftyp box is not MP4, and boxes that
+	// extend to the end of the media, size 0, or are larger than any media,
+	// are the last box.
+	if (start == 0 && typ != "ftyp") || (size != 0 && size < int64(len(hdr))) {
+		s.stopped = true
+		return
+	}
+	if size == 0 || size > math.MaxInt64-start {
+		size = math.MaxInt64 - start
+	}
+	s.next = start + size
+
+	if typ == "moov" {
+		if size > maxMP4MoovLen {
+			s.stopped = true
+			return
+		}
+		s.moov = append([]byte{}, hdr...)
+		s.moovLeft = size - int64(len(hdr))
+	}
+}
+
+// mp4Child returns the body of the first child box of the type.
+func mp4Child(body []byte, typ string) []byte {
+	for len(body) >= 8 {
+		size := int(binary.BigEndian.Uint32(body))
+		hdrLen := 8
+		if size == 1 && len(body) >= 16 {
+			size, hdrLen = int(binary.BigEndian.Uint64(body[8:16])), 16
+		} else if size == 0 {
+			size = len(body)
+		}
+		if size < hdrLen || size > len(body) {
+			return nil
+		}
+		if string(body[4:8]) == typ {
+			return body[hdrLen:size]
+		}
+		body = body[size:]
+	}
+	return nil
+}
+
+// mp4Path returns the body of the box at the path of child box types.
+func mp4Path(body []byte, path ...string) []byte {
+	for _, typ := range path {
+		if body = mp4Child(body, typ); body == nil {
+			return nil
+		}
+	}
+	return body
+}
+
+// parseMP4Moov returns the duration of the moov box's mvhd box, and the
+// sample rate, and channels of the first sound track's sample description.
+func parseMP4Moov(moov []byte) audioMetadata {
+	var meta audioMetadata
+	if len(moov) < 16 {
+		return meta
+	}
+	if binary.BigEndian.Uint32(moov) == 1 {
+		moov = moov[16:]
+	} else {
+		moov = moov[8:]
+	}
+
+	if mvhd := mp4Child(moov, "mvhd"); len(mvhd) >= 20 {
+		var timescale, duration uint64
+		if mvhd[0] == 1 && len(mvhd) >= 32 {
+			timescale = uint64(binary.BigEndian.Uint32(mvhd[20:24]))
+			duration = binary.BigEndian.Uint64(mvhd[24:32])
+		} else {
+			timescale = uint64(binary.BigEndian.Uint32(mvhd[12:16]))
+			duration = uint64(binary.BigEndian.Uint32(mvhd[16:20]))
+		}
+		if timescale > 0 && duration != math.MaxUint32 && duration != math.MaxUint64 {
+			meta.DurationSeconds = float64(duration) / float64(timescale)
+		}
+	}
+
+	for body := moov; len(body) >= 8; {
+		size := int(binary.BigEndian.Uint32(body))
+		if size < 8 || size > len(body) {
+			break
+		}
+		if string(body[4:8]) == "trak" {
+			trak := body[8:size]
+			hdlr := mp4Path(trak, "mdia", "hdlr")
+			if len(hdlr) >= 12 && string(hdlr[8:12]) == "soun" {
+				stsd := mp4Path(trak, "mdia", "minf", "stbl", "stsd")
+				// Full box header, entry count, then the first sample
+				// entry's header, reserved, and data reference index.
+				if len(stsd) >= 8+8+8+20 {
+					entry := stsd[16:]
+					meta.Channels = int(binary.BigEndian.Uint16(entry[16:18]))
+					meta.SampleRate = int(binary.BigEndian.Uint32(entry[24:28]) >> 16)
+				}
+				break
+			}
+		}
+		body = body[size:]
+	}
+	return meta
+}
+
+// parseWAV returns the format of the WAV media's fmt chunk, and the duration
+// of its data chunk.
+func parseWAV(b []byte, size int64) audioMetadata {
+	var meta audioMetadata
+	var byteRate int64
+	for off := 12; off+8 <= len(b); {
+		id := string(b[off : off+4])
+		chunkLen := int64(binary.LittleEndian.Uint32(b[off+4:]))
+		body := b[off+8:]
+
+		switch id {
+		case "fmt ":
+			if len(body) >= 16 {
+				meta.Channels = int(binary.LittleEndian.Uint16(body[2:]))
+				meta.SampleRate = int(binary.LittleEndian.Uint32(body[4:]))
+				byteRate = int64(binary.LittleEndian.Uint32(body[8:]))
+				meta.Bitrate = int(byteRate * 8)
+			}
+		case "data":
+			// Streamed WAV media may not know the length of its data.
+			if remaining := size - int64(off+8); chunkLen == 0 || chunkLen == math.MaxUint32 || chunkLen > remaining {
+				chunkLen = remaining
+			}
+			if byteRate > 0 {
+				meta.DurationSeconds = float64(chunkLen) / float64(byteRate)
+			}
+			return meta
+		}
+		off += 8 + int(chunkLen) + int(chunkLen&1)
+	}
+	return meta
+}
+
+// parseFLAC returns the stream info, Vorbis comment title, and artist, and
+// front cover picture of the FLAC media's metadata blocks.
+func parseFLAC(b []byte) audioMetadata {
+	var meta audioMetadata
+	for off := 4; off+4 <= len(b); {
+		last := b[off]&0x80 != 0
+		typ := b[off] & 0x7F
+		blockLen := int(b[off+1])<<16 | int(b[off+2])<<8 | int(b[off+3])
+		off += 4
+		if off+blockLen > len(b) {
+			break
+		}
+		block := b[off : off+blockLen]
+		off += blockLen
+
+		switch typ {
+		case 0: // STREAMINFO
+			if len(block) >= 18 {
+				info := binary.BigEndian.Uint64(block[10:18])
+				meta.SampleRate = int(info >> 44)
+				meta.Channels = int((info>>41)&0x7) + 1
+				samples := info & 0xFFFFFFFFF
+				if meta.SampleRate > 0 && samples > 0 {
+					meta.DurationSeconds = float64(samples) / float64(meta.SampleRate)
+				}
+			}
+		case 4: // VORBIS_COMMENT
+			meta.Title, meta.Artist = parseVorbisComment(block)
+		case 6: // PICTURE
+			if pic, front := parseFLACPicture(block); pic != nil && (meta.Artwork == nil || front) {
+				meta.Artwork = pic
+			}
+		}
+		if last {
+			break
+		}
+	}
+	return meta
+}
+
+// parseVorbisComment returns the TITLE, and ARTIST comments of the Vorbis
+// comment block.
+func parseVorbisComment(b []byte) (title, artist string) {
+	if len(b) < 4 {
+		return "", ""
+	}
+	vendorLen := int(binary.LittleEndian.Uint32(b))
+	if 4+vendorLen+4 > len(b) {
+		return "", ""
+	}
+	b = b[4+vendorLen:]
+	count := int(binary.LittleEndian.Uint32(b))
+	b = b[4:]
+	for i := 0; i < count && len(b) >= 4; i++ {
+		n := int(binary.LittleEndian.Uint32(b))
+		if 4+n > len(b) {
+			break
+		}
+		comment := string(b[4 : 4+n])
+		b = b[4+n:]
+
+		parts := strings.SplitN(comment, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		switch strings.ToUpper(parts[0]) {
+		case "TITLE":
+			if title == "" {
+				title = parts[1]
+			}
+		case "ARTIST":
+			if artist == "" {
+				artist = parts[1]
+			}
+		}
+	}
+	return title, artist
+}
+
+// parseFLACPicture returns the picture of the FLAC picture block, and if the
+// picture is the front cover.
+func parseFLACPicture(b []byte) (*artwork, bool) {
+	field := func() []byte {
+		if len(b) < 4 {
+			return nil
+		}
+		n := int(binary.BigEndian.Uint32(b))
+		if 4+n > len(b) {
+			b = nil
+			return nil
+		}
+		v := b[4 : 4+n]
+		b = b[4+n:]
+		return v
+	}
+	if len(b) < 4 {
+		return nil, false
+	}
+	front := binary.BigEndian.Uint32(b) == 3
+	b = b[4:]
+	contentType := string(field())
+	field() // description
+	if len(b) < 16 {
+		return nil, false
+	}
+	b = b[16:] // width, height, depth, and colors
+	data := field()
+	if contentType == "" || len(data) == 0 {
+		return nil, false
+	}
+	return &artwork{ContentType: contentType, Data: data}, front
+}
+
+// mpegBitrates are the bitrates, in kbit/s, of MPEG audio frame headers'
+// bitrate index, by MPEG-1 layer I, II, III, and MPEG-2/2.5 layer I, and II
+// or III.
+var mpegBitrates = [5][16]int{
+	{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+	{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+	{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+	{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+}
+
+// mpegSampleRates are the sample rates of MPEG-1 audio frame headers' sample
+// rate index. MPEG-2 is half, and MPEG-2.5 a quarter.
+var mpegSampleRates = [3]int{44100, 48000, 32000}
+
+// mpegFrame is an MPEG audio frame header.
+type mpegFrame struct {
+	mpeg1      bool
+	layer      int
+	bitrate    int
+	sampleRate int
+	channels   int
+	length     int
+}
+
+// samples returns the number of samples of each frame.
+func (f mpegFrame) samples() int {
+	switch {
+	case f.layer == 1:
+		return 384
+	case f.layer == 3 && !f.mpeg1:
+		return 576
+	default:
+		return 1152
+	}
+}
+
+// parseMPEGFrame returns the frame header the bytes start with, and false if
+// the bytes do not start with a valid frame header.
+func parseMPEGFrame(b []byte) (mpegFrame, bool) {
+	if len(b) < 4 || b[0] != 0xFF || b[1]&0xE0 != 0xE0 {
+		return mpegFrame{}, false
+	}
+	version := (b[1] >> 3) & 0x3
+	layerBits := (b[1] >> 1) & 0x3
+	bitrateIdx := b[2] >> 4
+	rateIdx := (b[2] >> 2) & 0x3
+	if version == 0x1 || layerBits == 0 || bitrateIdx == 0 || bitrateIdx == 0xF || rateIdx == 0x3 {
+		return mpegFrame{}, false
+	}
+
+	f := mpegFrame{
+		mpeg1:    version == 0x3,
+		layer:    4 - int(layerBits),
+		channels: 2,
+	}
+	if b[3]>>6 == 0x3 {
+		f.channels = 1
+	}
+
+	table := f.layer - 1
+	if !f.mpeg1 {
+		table = 3
+		if f.layer > 1 {
+			table = 4
+		}
+	}
+	f.bitrate = mpegBitrates[table][bitrateIdx] * 1000
+
+	f.sampleRate = mpegSampleRates[rateIdx]
+	switch version {
+	case 0x2:
+		f.sampleRate /= 2
+	case 0x0:
+		f.sampleRate /= 4
+	}
+
+	padding := int(b[2]>>1) & 0x1
+	if f.layer == 1 {
+		f.length = (12*f.bitrate/f.sampleRate + padding) * 4
+	} else {
+		f.length = f.samples()/8*f.bitrate/f.sampleRate + padding
+	}
+	return f, true
+}
+
+// parseMPEGAudio returns the metadata of the MP3 media's ID3 tag, and first
+// frame. The duration is from the frame's Xing, Info, or VBRI header if
+// present, otherwise estimated from the media's size, and the frame's
+// bitrate.
+func parseMPEGAudio(b []byte, size int64) audioMetadata {
+	var meta audioMetadata
+	start := id3TagLen(b)
+	if start > 0 {
+		tag := parseID3(b)
+		meta.Title, meta.Artist = tag.Title, tag.Artist
+		meta.Chapters, meta.Artwork = tag.Chapters, tag.Artwork
+	}
+
+	// Find the first frame, skipping padding between the tag and audio. The
+	// frame must be followed by another frame, to avoid false syncs.
+	var frame mpegFrame
+	found := false
+	for ; start+4 <= int64(len(b)); start++ {
+		f, ok := parseMPEGFrame(b[start:])
+		if !ok {
+			continue
+		}
+		next := start + int64(f.length)
+		if next+4 <= int64(len(b)) {
+			if _, ok := parseMPEGFrame(b[next:]); !ok {
+				continue
+			}
+		}
+		frame, found = f, true
+		break
+	}
+	if !found {
+		return meta
+	}
+	meta.SampleRate = frame.sampleRate
+	meta.Channels = frame.channels
+
+	audioSize := size - start
+	frameBytes := b[start:]
+	if end := frame.length; end < len(frameBytes) {
+		frameBytes = frameBytes[:end]
+	}
+
+	// Side information follows the frame header, and the Xing header
+	// follows the side information.
+	sideInfo := 32
+	switch {
+	case frame.mpeg1 && frame.channels == 1:
+		sideInfo = 17
+	case !frame.mpeg1 && frame.channels == 2:
+		sideInfo = 17
+	case !frame.mpeg1:
+		sideInfo = 9
+	}
+	var frames, bytesLen int64
+	if xing := frameBytesAt(frameBytes, 4+sideInfo); len(xing) >= 8 &&
+		(bytes.HasPrefix(xing, []byte("Xing")) || bytes.HasPrefix(xing, []byte("Info"))) {
+		flags := binary.BigEndian.Uint32(xing[4:])
+		xing = xing[8:]
+		if flags&0x1 != 0 && len(xing) >= 4 {
+			frames = int64(binary.BigEndian.Uint32(xing))
+			xing = xing[4:]
+		}
+		if flags&0x2 != 0 && len(xing) >= 4 {
+			bytesLen = int64(binary.BigEndian.Uint32(xing))
+		}
+	} else if vbri := frameBytesAt(frameBytes, 36); len(vbri) >= 18 && bytes.HasPrefix(vbri, []byte("VBRI")) {
+		bytesLen = int64(binary.BigEndian.Uint32(vbri[10:]))
+		frames = int64(binary.BigEndian.Uint32(vbri[14:]))
+	}
+	if bytesLen > 0 {
+		audioSize = bytesLen
+	}
+
+	if frames > 0 {
+		meta.DurationSeconds = float64(frames) * float64(frame.samples()) / float64(frame.sampleRate)
+		meta.Bitrate = int(float64(audioSize) * 8 / meta.DurationSeconds)
+	} else if audioSize > 0 {
+		meta.Bitrate = frame.bitrate
+		meta.DurationSeconds = float64(audioSize) * 8 / float64(frame.bitrate)
+	}
+	return meta
+}
+
+// frameBytesAt returns the bytes of the frame from the offset, or nil if the
+// frame is shorter.
+func frameBytesAt(frame []byte, off int) []byte {
+	if off > len(frame) {
+		return nil
+	}
+	return frame[off:]
+}
@@ -0,0 +1,558 @@
+package uploadpodcast
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+
+	workshop "aws-workshop"
+)
+
+// mp3FrameHeader is an MPEG-1 layer III, 128 kbit/s, 44.1 kHz, stereo frame
+// header, of frames mp3FrameLen long.
+var mp3FrameHeader = []byte{0xFF, 0xFB, 0x90, 0x00}
+
+const mp3FrameLen = 417
+
+// mp3Frames returns n frames of silent MP3 audio.
+func mp3Frames(n int) []byte {
+	var b []byte
+	for i := 0; i < n; i++ {
+		frame := make([]byte, mp3FrameLen)
+		copy(frame, mp3FrameHeader)
+		b = append(b, frame...)
+	}
+	return b
+}
+
+// mp3HeaderFrame returns an MP3 frame with the header, e.g. Xing, at the
+// offset of the frame.
+func mp3HeaderFrame(off int, header []byte) []byte {
+	frame := make([]byte, mp3FrameLen)
+	copy(frame, mp3FrameHeader)
+	copy(frame[off:], header)
+	return frame
+}
+
+func xingFrame(frames, bytesLen uint32) []byte {
+	header := []byte("Xing")
+	header = appendUint32(header, 0x3)
+	header = appendUint32(header, frames)
+	header = appendUint32(header, bytesLen)
+	return mp3HeaderFrame(4+32, header)
+}
+
+func vbriFrame(frames, bytesLen uint32) []byte {
+	header := []byte("VBRI")
+	header = append(header, 0, 1, 0, 0, 0, 50)
+	header = appendUint32(header, bytesLen)
+	header = appendUint32(header, frames)
+	return mp3HeaderFrame(36, header)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendUint32LE(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func concat(bs ...[]byte) []byte {
+	return bytes.Join(bs, nil)
+}
+
+// wavMedia returns WAV media of 16 bit PCM, with the chunks between the fmt,
+// and data chunks, and the data chunk's length.
+func wavMedia(channels, sampleRate uint32, dataLen uint32, data []byte, chunks ...[]byte) []byte {
+	fmtChunk := []byte("fmt ")
+	fmtChunk = appendUint32LE(fmtChunk, 16)
+	fmtChunk = append(fmtChunk, 1, 0, byte(channels), 0)
+	fmtChunk = appendUint32LE(fmtChunk, sampleRate)
+	fmtChunk = appendUint32LE(fmtChunk, sampleRate*channels*2)
+	fmtChunk = append(fmtChunk, byte(channels*2), 0, 16, 0)
+
+	dataChunk := appendUint32LE([]byte("data"), dataLen)
+
+	body := concat(append([][]byte{[]byte("WAVE"), fmtChunk}, chunks...)...)
+	body = concat(body, dataChunk, data)
+	return concat(appendUint32LE([]byte("RIFF"), uint32(len(body))), body)
+}
+
+func wavChunk(id string, chunkLen uint32, body []byte) []byte {
+	return concat(appendUint32LE([]byte(id), chunkLen), body)
+}
+
+// flacMedia returns FLAC media of the metadata blocks. The last block is
+// marked as the last.
+func flacMedia(blocks ...[]byte) []byte {
+	media := []byte("fLaC")
+	for i, block := range blocks {
+		if i == len(blocks)-1 {
+			block = append([]byte{block[0] | 0x80}, block[1:]...)
+		}
+		media = append(media, block...)
+	}
+	return media
+}
+
+func flacBlock(typ byte, body []byte) []byte {
+	n := len(body)
+	return concat([]byte{typ, byte(n >> 16), byte(n >> 8), byte(n)}, body)
+}
+
+func flacStreamInfo(sampleRate, channels, samples uint64) []byte {
+	body := make([]byte, 34)
+	info := sampleRate<<44 | (channels-1)<<41 | 15<<36 | samples
+	binary.BigEndian.PutUint64(body[10:], info)
+	return flacBlock(0, body)
+}
+
+func flacVorbisComment(comments ...string) []byte {
+	body := appendUint32LE(nil, 4)
+	body = append(body, "test"...)
+	body = appendUint32LE(body, uint32(len(comments)))
+	for _, c := range comments {
+		body = appendUint32LE(body, uint32(len(c)))
+		body = append(body, c...)
+	}
+	return flacBlock(4, body)
+}
+
+func flacPicture(typ uint32, contentType string, data []byte) []byte {
+	body := appendUint32(nil, typ)
+	body = appendUint32(body, uint32(len(contentType)))
+	body = append(body, contentType...)
+	body = appendUint32(body, 0)
+	body = append(body, make([]byte, 16)...)
+	body = appendUint32(body, uint32(len(data)))
+	body = append(body, data...)
+	return flacBlock(6, body)
+}
+
+func mp4Box(typ string, bodies ...[]byte) []byte {
+	body := concat(bodies...)
+	return concat(appendUint32(nil, uint32(8+len(body))), []byte(typ), body)
+}
+
+// mp4LargeBox returns a box with a 64-bit size, of the size if set.
+func mp4LargeBox(typ string, size uint64, body []byte) []byte {
+	if size == 0 {
+		size = uint64(16 + len(body))
+	}
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], size)
+	return concat(appendUint32(nil, 1), []byte(typ), buf[:], body)
+}
+
+var mp4Ftyp = mp4Box("ftyp", []byte("M4A "), make([]byte, 4), []byte("M4A isom"))
+
+func mp4Mvhd(timescale, duration uint32) []byte {
+	body := make([]byte, 100)
+	binary.BigEndian.PutUint32(body[12:], timescale)
+	binary.BigEndian.PutUint32(body[16:], duration)
+	return mp4Box("mvhd", body)
+}
+
+func mp4MvhdV1(timescale uint32, duration uint64) []byte {
+	body := make([]byte, 112)
+	body[0] = 1
+	binary.BigEndian.PutUint32(body[20:], timescale)
+	binary.BigEndian.PutUint64(body[24:], duration)
+	return mp4Box("mvhd", body)
+}
+
+func mp4Trak(handler string, channels uint16, sampleRate uint32) []byte {
+	hdlr := make([]byte, 24)
+	copy(hdlr[8:], handler)
+
+	entry := make([]byte, 28)
+	binary.BigEndian.PutUint16(entry[6:], 1)
+	binary.BigEndian.PutUint16(entry[16:], channels)
+	binary.BigEndian.PutUint16(entry[18:], 16)
+	binary.BigEndian.PutUint32(entry[24:], sampleRate<<16)
+	stsd := concat(make([]byte, 4), appendUint32(nil, 1), mp4Box("mp4a", entry))
+
+	return mp4Box("trak",
+		mp4Box("mdia",
+			mp4Box("hdlr", hdlr),
+			mp4Box("minf", mp4Box("stbl", mp4Box("stsd", stsd))),
+		),
+	)
+}
+
+var mp4Moov = mp4Box("moov",
+	mp4Mvhd(1000, 60500),
+	mp4Trak("vide", 0, 0),
+	mp4Trak("soun", 2, 44100),
+)
+
+func mp4Mdat(n int) []byte {
+	return mp4Box("mdat", make([]byte, n))
+}
+
+func TestAudioProbe_Metadata(t *testing.T) {
+	id3 := id3v2(3, 0, concat(
+		id3Frame(3, "TIT2", 0, id3Text("Intro to Go")),
+		id3Frame(3, "TPE1", 0, id3Text("Gopher")),
+		id3Frame(3, "CHAP", 0, id3Chapter("ch0", 0, 30000,
+			id3Frame(3, "TIT2", 0, id3Text("Welcome")))),
+	))
+	largeID3 := id3v2(4, 0, concat(
+		id3Frame(4, "TIT2", 0, id3Text("Intro to Go")),
+		id3Frame(4, "APIC", 0, id3Picture("image/jpeg", 3, make([]byte, probeHeadLen))),
+	))
+	xingDuration, vbriDuration := 1000*1152/44100.0, 2000*1152/44100.0
+	mp4Media := concat(mp4Ftyp, mp4Moov, mp4Mdat(1000))
+	streamedMP4 := concat(mp4Ftyp, mp4Mdat(probeHeadLen*2), mp4Moov)
+
+	cases := map[string]struct {
+		Media []byte
+		// Size of the media, if larger than the media.
+		Size int64
+		// Bytes of the media not written to the probe.
+		Skip [2]int
+
+		Expect audioMetadata
+	}{
+		"empty": {},
+		"unknown": {
+			Media: []byte("not audio media"),
+		},
+		"mp3 cbr": {
+			Media: mp3Frames(10),
+			Expect: audioMetadata{
+				DurationSeconds: 10 * mp3FrameLen * 8 / 128000.0,
+				Bitrate:         128000, SampleRate: 44100, Channels: 2,
+			},
+		},
+		"mp3 cbr media larger than head": {
+			Media: mp3Frames(10),
+			Size:  10 * 1024 * 1024,
+			Expect: audioMetadata{
+				DurationSeconds: 10 * 1024 * 1024 * 8 / 128000.0,
+				Bitrate:         128000, SampleRate: 44100, Channels: 2,
+			},
+		},
+		"mp3 xing": {
+			Media: concat(xingFrame(1000, 500000), mp3Frames(2)),
+			Expect: audioMetadata{
+				DurationSeconds: xingDuration,
+				Bitrate:         int(500000 * 8 / xingDuration),
+				SampleRate:      44100, Channels: 2,
+			},
+		},
+		"mp3 vbri": {
+			Media: concat(vbriFrame(2000, 800000), mp3Frames(2)),
+			Expect: audioMetadata{
+				DurationSeconds: vbriDuration,
+				Bitrate:         int(800000 * 8 / vbriDuration),
+				SampleRate:      44100, Channels: 2,
+			},
+		},
+		"mp3 id3": {
+			Media: concat(id3, make([]byte, 16), mp3Frames(10)),
+			Expect: audioMetadata{
+				DurationSeconds: 10 * mp3FrameLen * 8 / 128000.0,
+				Bitrate:         128000, SampleRate: 44100, Channels: 2,
+				Title: "Intro to Go", Artist: "Gopher",
+				Chapters: []workshop.Chapter{{Title: "Welcome", StartSeconds: 0, EndSeconds: 30}},
+			},
+		},
+		"mp3 id3 larger than head": {
+			Media: concat(largeID3, mp3Frames(10)),
+			Expect: audioMetadata{
+				DurationSeconds: 10 * mp3FrameLen * 8 / 128000.0,
+				Bitrate:         128000, SampleRate: 44100, Channels: 2,
+				Title:   "Intro to Go",
+				Artwork: &artwork{ContentType: "image/jpeg", Data: make([]byte, probeHeadLen)},
+			},
+		},
+		"mp3 truncated id3": {
+			Media: largeID3[:1024],
+			Expect: audioMetadata{
+				Title: "Intro to Go",
+			},
+		},
+		"mp3 false sync": {
+			Media: concat([]byte{0xFF, 0xFB, 0x90, 0x00, 0, 0}, mp3Frames(10)),
+			Expect: audioMetadata{
+				DurationSeconds: 10 * mp3FrameLen * 8 / 128000.0,
+				Bitrate:         128000, SampleRate: 44100, Channels: 2,
+			},
+		},
+		"wav": {
+			Media: wavMedia(2, 44100, 17640, make([]byte, 17640)),
+			Expect: audioMetadata{
+				DurationSeconds: 0.1,
+				Bitrate:         1411200, SampleRate: 44100, Channels: 2,
+			},
+		},
+		"wav odd chunk": {
+			Media: wavMedia(1, 8000, 1600, make([]byte, 1600),
+				wavChunk("LIST", 3, []byte{1, 2, 3, 0})),
+			Expect: audioMetadata{
+				DurationSeconds: 0.1,
+				Bitrate:         128000, SampleRate: 8000, Channels: 1,
+			},
+		},
+		"wav streamed data length": {
+			Media: wavMedia(1, 8000, 0, make([]byte, 1600)),
+			Size:  44 + 16000,
+			Expect: audioMetadata{
+				DurationSeconds: 1,
+				Bitrate:         128000, SampleRate: 8000, Channels: 1,
+			},
+		},
+		"wav max data length": {
+			Media: wavMedia(1, 8000, math.MaxUint32, make([]byte, 1600)),
+			Expect: audioMetadata{
+				DurationSeconds: 0.1,
+				Bitrate:         128000, SampleRate: 8000, Channels: 1,
+			},
+		},
+		"wav huge chunk": {
+			Media: wavMedia(1, 8000, 1600, make([]byte, 1600),
+				wavChunk("LIST", math.MaxUint32-1, nil)),
+			Expect: audioMetadata{
+				Bitrate: 128000, SampleRate: 8000, Channels: 1,
+			},
+		},
+		"wav truncated fmt": {
+			Media: wavMedia(1, 8000, 1600, nil)[:30],
+		},
+		"flac": {
+			Media: flacMedia(
+				flacStreamInfo(44100, 2, 441000),
+				flacPicture(4, "image/png", []byte("back")),
+				flacVorbisComment("title=Intro to Go", "ARTIST=Gopher", "invalid", "TITLE=Other"),
+				flacPicture(3, "image/jpeg", []byte("front")),
+				flacPicture(4, "image/png", []byte("other")),
+			),
+			Expect: audioMetadata{
+				DurationSeconds: 10,
+				Bitrate:         0, SampleRate: 44100, Channels: 2,
+				Title: "Intro to Go", Artist: "Gopher",
+				Artwork: &artwork{ContentType: "image/jpeg", Data: []byte("front")},
+			},
+		},
+		"flac truncated block": {
+			Media: flacMedia(
+				flacStreamInfo(48000, 1, 96000),
+				flacVorbisComment("TITLE=Intro to Go"),
+			)[:4+38+10],
+			Expect: audioMetadata{
+				DurationSeconds: 2, SampleRate: 48000, Channels: 1,
+			},
+		},
+		"flac zero samples": {
+			Media: flacMedia(flacStreamInfo(48000, 1, 0)),
+			Expect: audioMetadata{
+				SampleRate: 48000, Channels: 1,
+			},
+		},
+		"mp4": {
+			Media: mp4Media,
+			Expect: audioMetadata{
+				DurationSeconds: 60.5,
+				SampleRate:      44100, Channels: 2,
+			},
+		},
+		"mp4 moov after mdat": {
+			Media: streamedMP4,
+			Expect: audioMetadata{
+				DurationSeconds: 60.5,
+				SampleRate:      44100, Channels: 2,
+			},
+		},
+		"mp4 skipped mdat": {
+			Media: streamedMP4,
+			Skip:  [2]int{len(mp4Ftyp) + 1024, len(mp4Ftyp) + probeHeadLen*2},
+			Expect: audioMetadata{
+				DurationSeconds: 60.5,
+				SampleRate:      44100, Channels: 2,
+			},
+		},
+		"mp4 skipped moov": {
+			Media: streamedMP4,
+			Skip:  [2]int{len(mp4Ftyp) + 1024, len(streamedMP4) - 10},
+		},
+		"mp4 large mdat": {
+			Media: concat(mp4Ftyp, mp4LargeBox("mdat", 0, make([]byte, 1000)), mp4Moov),
+			Expect: audioMetadata{
+				DurationSeconds: 60.5,
+				SampleRate:      44100, Channels: 2,
+			},
+		},
+		"mp4 large moov": {
+			Media: concat(mp4Ftyp, mp4LargeBox("moov", 0, concat(mp4Moov[8:]))),
+			Expect: audioMetadata{
+				DurationSeconds: 60.5,
+				SampleRate:      44100, Channels: 2,
+			},
+		},
+		"mp4 mvhd version 1": {
+			Media: concat(mp4Ftyp, mp4Box("moov", mp4MvhdV1(48000, 48000*90), mp4Trak("soun", 1, 48000))),
+			Expect: audioMetadata{
+				DurationSeconds: 90,
+				SampleRate:      48000, Channels: 1,
+			},
+		},
+		"mp4 unknown duration": {
+			Media: concat(mp4Ftyp, mp4Box("moov", mp4Mvhd(1000, math.MaxUint32), mp4Trak("soun", 1, 48000))),
+			Expect: audioMetadata{
+				SampleRate: 48000, Channels: 1,
+			},
+		},
+		"mp4 truncated moov": {
+			Media: concat(mp4Ftyp, mp4Moov)[:len(mp4Ftyp)+20],
+		},
+		"mp4 truncated child box": {
+			Media: concat(mp4Ftyp, mp4Box("moov", mp4Mvhd(1000, 60500)[:50])),
+		},
+		"mp4 zero size mdat": {
+			Media: concat(mp4Ftyp, appendUint32(nil, 0), []byte("mdat"), make([]byte, 100), mp4Moov),
+		},
+		"mp4 huge mdat": {
+			Media: concat(mp4Ftyp, mp4LargeBox("mdat", math.MaxInt64-10, make([]byte, 100)), mp4Moov),
+		},
+		"mp4 invalid large size": {
+			Media: concat(mp4Ftyp, mp4LargeBox("mdat", math.MaxUint64, make([]byte, 100)), mp4Moov),
+		},
+		"mp4 box smaller than header": {
+			Media: concat(mp4Ftyp, appendUint32(nil, 4), []byte("mdat"), mp4Moov),
+		},
+		"mp4 moov too large": {
+			Media: concat(mp4Ftyp, mp4LargeBox("moov", maxMP4MoovLen+1, mp4Moov[8:])),
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			size := c.Size
+			if size == 0 {
+				size = int64(len(c.Media))
+			}
+
+			// The media is written in chunks, as it is streamed.
+			probe := newAudioProbe()
+			if c.Skip[1] == 0 {
+				writeProbeChunks(probe, c.Media, 0, len(c.Media))
+			} else {
+				writeProbeChunks(probe, c.Media, 0, c.Skip[0])
+				writeProbeChunks(probe, c.Media, c.Skip[1], len(c.Media))
+			}
+
+			meta := probe.metadata(size)
+			if c.Expect.Bitrate == 0 && c.Expect.DurationSeconds > 0 {
+				c.Expect.Bitrate = int(float64(size) * 8 / c.Expect.DurationSeconds)
+			}
+			assertAudioMetadata(t, c.Expect, meta)
+		})
+	}
+}
+
+// writeProbeChunks writes the media from start to end to the probe, in
+// chunks.
+func writeProbeChunks(probe *audioProbe, media []byte, start, end int) {
+	for off := start; off < end; off += 1000 {
+		n := off + 1000
+		if n > end {
+			n = end
+		}
+		probe.writeAt(media[off:n], int64(off))
+	}
+}
+
+func assertAudioMetadata(t *testing.T, expect, actual audioMetadata) {
+	t.Helper()
+
+	if e, a := expect.DurationSeconds, actual.DurationSeconds; math.Abs(e-a) > 1e-9 {
+		t.Errorf("expect %v duration, got %v", e, a)
+	}
+	expect.DurationSeconds, actual.DurationSeconds = 0, 0
+	if !reflect.DeepEqual(expect, actual) {
+		t.Errorf("expect %+v metadata, got %+v", expect, actual)
+	}
+}
+
+func TestMP4BoxScanner_MoovHeader(t *testing.T) {
+	// The moov box's header split across writes.
+	media := concat(mp4Ftyp, mp4LargeBox("mdat", 0, make([]byte, 10)), mp4Moov)
+
+	cases := map[string]int{
+		"byte at a time": 1,
+		"odd chunks":     7,
+		"whole media":    len(media),
+	}
+
+	for name, chunkLen := range cases {
+		t.Run(name, func(t *testing.T) {
+			var s mp4BoxScanner
+			for off := 0; off < len(media); off += chunkLen {
+				end := off + chunkLen
+				if end > len(media) {
+					end = len(media)
+				}
+				s.writeAt(media[off:end], int64(off))
+			}
+			if !bytes.Equal(mp4Moov, s.moov) {
+				t.Errorf("expect moov box buffered, got %v bytes", len(s.moov))
+			}
+		})
+	}
+}
+
+func FuzzProbeAudio(f *testing.F) {
+	f.Add(mp3Frames(3), uint16(100))
+	f.Add(concat(xingFrame(1000, 500000), mp3Frames(2)), uint16(7))
+	f.Add(concat(id3v2(4, 0x80, id3Frame(4, "CHAP", 0x02, id3Chapter("ch0", 0, 1000,
+		id3Frame(4, "TIT2", 0, id3Text("Welcome"))))), mp3Frames(2)), uint16(13))
+	f.Add(wavMedia(2, 44100, 400, make([]byte, 400), wavChunk("LIST", 3, []byte{1, 2, 3, 0})), uint16(9))
+	f.Add(flacMedia(flacStreamInfo(44100, 2, 441000), flacVorbisComment("TITLE=Go"),
+		flacPicture(3, "image/png", []byte("png"))), uint16(5))
+	f.Add(concat(mp4Ftyp, mp4Mdat(100), mp4LargeBox("moov", 0, mp4Moov[8:])), uint16(11))
+
+	f.Fuzz(func(t *testing.T, media []byte, chunkLen uint16) {
+		size := int64(len(media))
+
+		whole := newAudioProbe()
+		whole.Write(media)
+		meta := whole.metadata(size)
+
+		// Media written in chunks has the same metadata.
+		chunked := newAudioProbe()
+		n := int(chunkLen) + 1
+		for off := 0; off < len(media); off += n {
+			end := off + n
+			if end > len(media) {
+				end = len(media)
+			}
+			chunked.Write(media[off:end])
+		}
+		if !reflect.DeepEqual(meta, chunked.metadata(size)) {
+			t.Errorf("expect chunked metadata to match, %+v, got %+v", meta, chunked.metadata(size))
+		}
+
+		if d := meta.DurationSeconds; d < 0 || math.IsNaN(d) || math.IsInf(d, 0) {
+			t.Errorf("expect valid duration, got %v", d)
+		}
+		if meta.SampleRate < 0 || meta.Channels < 0 {
+			t.Errorf("expect valid sample rate, and channels, got %v, %v", meta.SampleRate, meta.Channels)
+		}
+
+		// The parsers are also given the media directly, as the probe only
+		// parses media of the sniffed container.
+		parseID3(media)
+		parseMPEGAudio(media, size)
+		parseWAV(media, size)
+		parseFLAC(media)
+		parseMP4Moov(media)
+	})
+}
@@ -0,0 +1,102 @@
+package uploadpodcast
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	workshop "aws-workshop"
+
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+type Handler struct {
+	HTTPClient HTTPDoer
+	S3Uploader S3UploadAPI
+	S3Client   S3API
+	DDBClient  DDBAPI
+
+	BucketName     string
+	MediaKeyPrefix string
+
+	// Table the progress of multipart media uploads is recorded in, in the
+	// episode's item. Uploads are not resumed if empty.
+	EpisodeTableName string
+
+	// Table the podcast's episodes transcribed today are counted in. The
+	// podcast's episodes per day are not checked if empty.
+	QuotaTableName string
+
+	// Limits on the episode's media. Episodes over the limits fail with a
+	// QuotaExceededError, and the limit is recorded as the episode's failure
+	// reason.
+	Quotas workshop.MediaQuotas
+
+	// Size of the parts media is downloaded, and uploaded in. Media larger
+	// than a part is uploaded with a multipart upload that can be resumed.
+	// Defaults to 16 MiB if 0, and is at least 5 MiB.
+	PartSize int64
+}
+
+func (h *Handler) Handle(ctx context.Context, input workshop.TranscribeStateMachineInput) (
+	*workshop.TranscribeStateMachineOutput, error,
+) {
+	log.Println("staring upload,", input)
+	log.Printf("Downloading podcast from: %v", input.Episode.MediaURL)
+	episode := input.Episode
+
+	episode.MediaKey = workshop.MakeEpisodeRawMediaPath(h.MediaKeyPrefix, episode.ID)
+
+	if err := h.uploadEpisodeMedia(ctx, &episode); err != nil {
+		return nil, err
+	}
+
+	return &workshop.TranscribeStateMachineOutput{
+		Episode: episode,
+	}, nil
+}
+
+// uploadMedia streams the media content to the bucket's media key.
+func (h *Handler) uploadMedia(ctx context.Context, mediaKey, mediaContentType string, mediaContent io.Reader) error {
+	_, err := h.S3Uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket:      &h.BucketName,
+		Key:         &mediaKey,
+		ContentType: &mediaContentType,
+		Body:        mediaContent,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload media %v, %w", mediaKey, err)
+	}
+	return nil
+}
+
+type HTTPDoer interface {
+	Do(*http.Request) (*http.Response, error)
+}
+type S3UploadAPI interface {
+	Upload(context.Context, *s3.PutObjectInput, ...func(*manager.Uploader)) (*manager.UploadOutput, error)
+}
+type S3API interface {
+	HeadObject(context.Context, *s3.HeadObjectInput, ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	CreateMultipartUpload(context.Context, *s3.CreateMultipartUploadInput, ...func(*s3.Options)) (
+		*s3.CreateMultipartUploadOutput, error,
+	)
+	UploadPart(context.Context, *s3.UploadPartInput, ...func(*s3.Options)) (*s3.UploadPartOutput, error)
+	CompleteMultipartUpload(context.Context, *s3.CompleteMultipartUploadInput, ...func(*s3.Options)) (
+		*s3.CompleteMultipartUploadOutput, error,
+	)
+	AbortMultipartUpload(context.Context, *s3.AbortMultipartUploadInput, ...func(*s3.Options)) (
+		*s3.AbortMultipartUploadOutput, error,
+	)
+	ListMultipartUploads(context.Context, *s3.ListMultipartUploadsInput, ...func(*s3.Options)) (
+		*s3.ListMultipartUploadsOutput, error,
+	)
+}
+type DDBAPI interface {
+	GetItem(context.Context, *ddb.GetItemInput, ...func(*ddb.Options)) (*ddb.GetItemOutput, error)
+	UpdateItem(context.Context, *ddb.UpdateItemInput, ...func(*ddb.Options)) (*ddb.UpdateItemOutput, error)
+}
@@ -0,0 +1,215 @@
+package uploadpodcast
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	workshop "aws-workshop"
+	"aws-workshop/fakes"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ddbav "github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	testBucketName       = "podcasts"
+	testEpisodeTableName = "PodcastEpisode"
+)
+
+// testMediaServer serves the media with its ETag, supporting Range and
+// If-Range requests. If failAt is set, the connection is closed once the
+// media up to failAt is written.
+type testMediaServer struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	media  []byte
+	etag   string
+	failAt int64
+}
+
+func newTestMediaServer(t *testing.T, media []byte, etag string) *testMediaServer {
+	t.Helper()
+
+	s := &testMediaServer{media: media, etag: etag}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		media, etag, failAt := s.media, s.etag, s.failAt
+		s.mu.Unlock()
+
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Header().Set("ETag", etag)
+		if failAt == 0 {
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(media))
+			return
+		}
+
+		fw := &failingResponseWriter{ResponseWriter: w, offset: -1, failAt: failAt}
+		http.ServeContent(fw, r, "", time.Time{}, bytes.NewReader(media))
+		if fw.failed {
+			panic(http.ErrAbortHandler)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testMediaServer) setMedia(media []byte, etag string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.media, s.etag = media, etag
+}
+
+func (s *testMediaServer) setFailAt(failAt int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failAt = failAt
+}
+
+// failingResponseWriter fails writes of the media at or after failAt.
+type failingResponseWriter struct {
+	http.ResponseWriter
+
+	offset int64
+	failAt int64
+	failed bool
+}
+
+func (w *failingResponseWriter) Write(p []byte) (int, error) {
+	if w.offset < 0 {
+		w.offset = 0
+		if v := w.Header().Get("Content-Range"); v != "" {
+			start, _, err := parseContentRange(v)
+			if err != nil {
+				return 0, err
+			}
+			w.offset = start
+		}
+	}
+
+	if remaining := w.failAt - w.offset; int64(len(p)) > remaining {
+		if remaining < 0 {
+			remaining = 0
+		}
+		n, _ := w.ResponseWriter.Write(p[:remaining])
+		w.offset += int64(n)
+		w.failed = true
+		return n, fmt.Errorf("media connection failed at %v", w.failAt)
+	}
+
+	n, err := w.ResponseWriter.Write(p)
+	w.offset += int64(n)
+	return n, err
+}
+
+// countingUploader counts the objects uploaded.
+type countingUploader struct {
+	S3UploadAPI
+
+	mu      sync.Mutex
+	uploads int
+}
+
+func (u *countingUploader) Upload(ctx context.Context, input *s3.PutObjectInput, opts ...func(*manager.Uploader)) (
+	*manager.UploadOutput, error,
+) {
+	u.mu.Lock()
+	u.uploads++
+	u.mu.Unlock()
+	return u.S3UploadAPI.Upload(ctx, input, opts...)
+}
+
+func newTestHandler(t *testing.T, episode workshop.Episode) (*Handler, *fakes.S3) {
+	t.Helper()
+
+	client := fakes.NewDynamoDB()
+	client.CreateTable(testEpisodeTableName, "id", "")
+	item, err := ddbav.MarshalMap(episode)
+	if err != nil {
+		t.Fatalf("failed to marshal episode, %v", err)
+	}
+	_, err = client.PutItem(context.Background(), &ddb.PutItemInput{
+		TableName: aws.String(testEpisodeTableName),
+		Item:      item,
+	})
+	if err != nil {
+		t.Fatalf("failed to put episode, %v", err)
+	}
+	s3Client := fakes.NewS3(testBucketName)
+
+	return &Handler{
+		HTTPClient:       http.DefaultClient,
+		S3Uploader:       s3Client,
+		S3Client:         s3Client,
+		DDBClient:        client,
+		BucketName:       testBucketName,
+		MediaKeyPrefix:   "media",
+		EpisodeTableName: testEpisodeTableName,
+	}, s3Client
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestHandle_StoredMedia(t *testing.T) {
+	media := bytes.Repeat([]byte("podcast media "), 1024)
+	server := newTestMediaServer(t, media, `"v1"`)
+
+	episode := workshop.Episode{ID: "1", Title: "Intro to Go", MediaURL: server.URL + "/1.mp3",
+		Status: workshop.EpisodeStatusUploading}
+	h, s3Client := newTestHandler(t, episode)
+	uploader := &countingUploader{S3UploadAPI: h.S3Uploader}
+	h.S3Uploader = uploader
+
+	upload := func(expectMedia []byte, expectUploads int) {
+		t.Helper()
+
+		output, err := h.Handle(context.Background(), workshop.TranscribeStateMachineInput{Episode: episode})
+		if err != nil {
+			t.Fatalf("expect no error, got %v", err)
+		}
+		if e, a := sha256Hex(expectMedia), output.Episode.MediaSHA256; e != a {
+			t.Errorf("expect %v sha256, got %v", e, a)
+		}
+		if e, a := int64(len(expectMedia)), output.Episode.MediaSize; e != a {
+			t.Errorf("expect %v size, got %v", e, a)
+		}
+		if e, a := expectUploads, uploader.uploads; e != a {
+			t.Errorf("expect %v media uploads, got %v", e, a)
+		}
+
+		obj, ok := s3Client.GetObject(testBucketName, output.Episode.MediaKey)
+		if !ok {
+			t.Fatalf("expect media object uploaded")
+		}
+		if !bytes.Equal(expectMedia, obj.Body) {
+			t.Errorf("expect media object to match media")
+		}
+		if len(obj.Metadata) != 0 {
+			t.Errorf("expect no object metadata, got %v", obj.Metadata)
+		}
+	}
+
+	upload(media, 1)
+
+	// Unchanged media is not uploaded again.
+	upload(media, 1)
+
+	// Changed media is uploaded again.
+	changed := bytes.Repeat([]byte("changed media "), 1024)
+	server.setMedia(changed, `"v2"`)
+	upload(changed, 2)
+}
@@ -0,0 +1,301 @@
+package uploadpodcast
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"unicode/utf16"
+
+	workshop "aws-workshop"
+)
+
+// id3Tag is the tags of an ID3v2 tag the episode's metadata is recorded
+// from.
+type id3Tag struct {
+	Title    string
+	Artist   string
+	Chapters []workshop.Chapter
+	Artwork  *artwork
+}
+
+// artwork is a picture embedded in the media.
+type artwork struct {
+	ContentType string
+	Data        []byte
+}
+
+// id3TagLen returns the length of the ID3v2 tag the media starts with,
+// including its header, and footer. Returns 0 if the media does not start
+// with an ID3v2 tag.
+func id3TagLen(b []byte) int64 {
+	if len(b) < 10 || !bytes.HasPrefix(b, []byte("ID3")) {
+		return 0
+	}
+	n := 10 + int64(syncsafeInt(b[6:10]))
+	if b[5]&0x10 != 0 {
+		n += 10
+	}
+	return n
+}
+
+// parseID3 returns the title, artist, chapters, and front cover of the ID3v2
+// tag the media starts with. Versions 2.2, 2.3, and 2.4 are supported. Frames
+// that are truncated, e.g. the tag is larger than the media read, are
+// ignored.
+func parseID3(b []byte) id3Tag {
+	var tag id3Tag
+	tagLen := id3TagLen(b)
+	if tagLen == 0 {
+		return tag
+	}
+	major, flags := b[3], b[5]
+	end := int64(len(b))
+	if tagLen < end {
+		end = tagLen
+	}
+	frames := b[10:end]
+
+	// Tags unsynchronised as a whole only in versions before 2.4, 2.4
+	// unsynchronises each frame.
+	if flags&0x80 != 0 && major < 4 {
+		frames = bytes.ReplaceAll(frames, []byte{0xFF, 0x00}, []byte{0xFF})
+	}
+	if flags&0x40 != 0 && major >= 3 && len(frames) >= 4 {
+		extLen := int(binary.BigEndian.Uint32(frames))
+		if major == 3 {
+			extLen += 4
+		} else {
+			extLen = syncsafeInt(frames[:4])
+		}
+		if extLen > len(frames) {
+			return tag
+		}
+		frames = frames[extLen:]
+	}
+
+	tag.parseFrames(major, frames)
+	return tag
+}
+
+func (tag *id3Tag) parseFrames(major byte, frames []byte) {
+	for {
+		id, body, rest, ok := nextID3Frame(major, frames)
+		if !ok {
+			return
+		}
+		frames = rest
+
+		switch id {
+		case "TIT2", "TT2":
+			if tag.Title == "" {
+				tag.Title = decodeID3Text(body)
+			}
+		case "TPE1", "TP1":
+			if tag.Artist == "" {
+				tag.Artist = decodeID3Text(body)
+			}
+		case "APIC", "PIC":
+			if pic, front := parseID3Picture(major, body); pic != nil && (tag.Artwork == nil || front) {
+				tag.Artwork = pic
+			}
+		case "CHAP":
+			if chapter, ok := parseID3Chapter(major, body); ok {
+				tag.Chapters = append(tag.Chapters, chapter)
+			}
+		}
+	}
+}
+
+// nextID3Frame returns the ID, and body of the first frame, and the frames
+// after it. Returns false if there are no more frames, e.g. the tag's
+// padding is reached.
+func nextID3Frame(major byte, frames []byte) (id string, body, rest []byte, ok bool) {
+	var size, headerLen int
+	if major == 2 {
+		headerLen = 6
+		if len(frames) < headerLen {
+			return "", nil, nil, false
+		}
+		id = string(frames[:3])
+		size = int(frames[3])<<16 | int(frames[4])<<8 | int(frames[5])
+	} else {
+		headerLen = 10
+		if len(frames) < headerLen {
+			return "", nil, nil, false
+		}
+		id = string(frames[:4])
+		if major == 4 {
+			size = syncsafeInt(frames[4:8])
+		} else {
+			size = int(binary.BigEndian.Uint32(frames[4:8]))
+		}
+	}
+	if id[0] == 0 || size < 0 || headerLen+size > len(frames) {
+		return "", nil, nil, false
+	}
+	body = frames[headerLen : headerLen+size]
+	if major == 4 {
+		body = id3v24FrameData(frames[9], body)
+	}
+	return id, body, frames[headerLen+size:], true
+}
+
+// id3v24FrameData returns the data of the 2.4 frame's body, without the
+// grouping identity, and data length indicator added by the frame's format
+// flags, and with the frame's unsynchronisation removed.
+func id3v24FrameData(format byte, body []byte) []byte {
+	if format&0x40 != 0 && len(body) >= 1 {
+		body = body[1:]
+	}
+	if format&0x01 != 0 && len(body) >= 4 {
+		body = body[4:]
+	}
+	if format&0x02 != 0 {
+		body = bytes.ReplaceAll(body, []byte{0xFF, 0x00}, []byte{0xFF})
+	}
+	return body
+}
+
+// parseID3Picture returns the picture of an APIC, or PIC frame, and if the
+// picture is the front cover.
+func parseID3Picture(major byte, body []byte) (*artwork, bool) {
+	if len(body) < 2 {
+		return nil, false
+	}
+	enc := body[0]
+	body = body[1:]
+
+	var contentType string
+	if major == 2 {
+		if len(body) < 3 {
+			return nil, false
+		}
+		switch strings.ToUpper(string(body[:3])) {
+		case "JPG":
+			contentType = "image/jpeg"
+		case "PNG":
+			contentType = "image/png"
+		}
+		body = body[3:]
+	} else {
+		i := bytes.IndexByte(body, 0)
+		if i < 0 {
+			return nil, false
+		}
+		contentType = strings.ToLower(string(body[:i]))
+		body = body[i+1:]
+	}
+	if contentType == "" || contentType == "-->" || len(body) < 1 {
+		return nil, false
+	}
+	if !strings.Contains(contentType, "/") {
+		contentType = "image/" + contentType
+	}
+	front := body[0] == 3
+	_, data := splitID3String(enc, body[1:])
+	if len(data) == 0 {
+		return nil, false
+	}
+	return &artwork{ContentType: contentType, Data: data}, front
+}
+
+// parseID3Chapter returns the chapter of a CHAP frame. The chapter's title
+// is the TIT2 frame embedded in the CHAP frame.
+func parseID3Chapter(major byte, body []byte) (workshop.Chapter, bool) {
+	i := bytes.IndexByte(body, 0)
+	if i < 0 || len(body) < i+17 {
+		return workshop.Chapter{}, false
+	}
+	times := body[i+1:]
+	startMS := binary.BigEndian.Uint32(times[0:4])
+	endMS := binary.BigEndian.Uint32(times[4:8])
+
+	var sub id3Tag
+	sub.parseFrames(major, times[16:])
+
+	chapter := workshop.Chapter{
+		Title:        sub.Title,
+		StartSeconds: float64(startMS) / 1000,
+	}
+	if endMS > startMS {
+		chapter.EndSeconds = float64(endMS) / 1000
+	}
+	return chapter, true
+}
+
+// decodeID3Text returns the text of a text information frame. Only the first
+// string of frames with multiple strings is returned.
+func decodeID3Text(body []byte) string {
+	if len(body) < 1 {
+		return ""
+	}
+	text, _ := splitID3String(body[0], body[1:])
+	return strings.TrimSpace(text)
+}
+
+// splitID3String returns the decoded null-terminated string the bytes start
+// with, and the bytes after the string's terminator.
+func splitID3String(enc byte, b []byte) (string, []byte) {
+	switch enc {
+	case 1, 2:
+		// UTF-16 strings are terminated by two null bytes, aligned to the
+		// string's code units.
+		end := len(b)
+		for i := 0; i+1 < len(b); i += 2 {
+			if b[i] == 0 && b[i+1] == 0 {
+				end = i
+				break
+			}
+		}
+		rest := b[end:]
+		if len(rest) >= 2 {
+			rest = rest[2:]
+		}
+		return decodeUTF16(enc, b[:end]), rest
+
+	default:
+		end := bytes.IndexByte(b, 0)
+		if end < 0 {
+			return decodeLatin1OrUTF8(enc, b), nil
+		}
+		return decodeLatin1OrUTF8(enc, b[:end]), b[end+1:]
+	}
+}
+
+func decodeUTF16(enc byte, b []byte) string {
+	var order binary.ByteOrder = binary.BigEndian
+	if enc == 1 && len(b) >= 2 {
+		switch {
+		case b[0] == 0xFF && b[1] == 0xFE:
+			order, b = binary.LittleEndian, b[2:]
+		case b[0] == 0xFE && b[1] == 0xFF:
+			b = b[2:]
+		}
+	}
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, order.Uint16(b[i:]))
+	}
+	return string(utf16.Decode(units))
+}
+
+func decodeLatin1OrUTF8(enc byte, b []byte) string {
+	if enc == 3 {
+		return string(b)
+	}
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// syncsafeInt returns the integer of the ID3v2 syncsafe integer, which uses
+// only the low 7 bits of each byte.
+func syncsafeInt(b []byte) int {
+	var n int
+	for _, c := range b[:4] {
+		n = n<<7 | int(c&0x7F)
+	}
+	return n
+}
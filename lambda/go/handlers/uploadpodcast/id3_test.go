@@ -0,0 +1,304 @@
+package uploadpodcast
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+
+	workshop "aws-workshop"
+)
+
+func syncsafe(n int) []byte {
+	return []byte{byte(n>>21) & 0x7F, byte(n>>14) & 0x7F, byte(n>>7) & 0x7F, byte(n) & 0x7F}
+}
+
+// id3v2 returns an ID3v2 tag of the version's frames.
+func id3v2(major, flags byte, frames []byte) []byte {
+	return concat([]byte("ID3"), []byte{major, 0, flags}, syncsafe(len(frames)), frames)
+}
+
+// id3Frame returns a frame of the version. The format flags are ignored for
+// version 2.2, which has no frame flags.
+func id3Frame(major byte, id string, format byte, body []byte) []byte {
+	switch major {
+	case 2:
+		n := len(body)
+		return concat([]byte(id), []byte{byte(n >> 16), byte(n >> 8), byte(n)}, body)
+	case 3:
+		return concat([]byte(id), appendUint32(nil, uint32(len(body))), []byte{0, format}, body)
+	default:
+		return concat([]byte(id), syncsafe(len(body)), []byte{0, format}, body)
+	}
+}
+
+func id3Text(text string) []byte {
+	return append([]byte{0}, text...)
+}
+
+func id3TextUTF16(text string) []byte {
+	b := []byte{1, 0xFF, 0xFE}
+	for _, u := range utf16.Encode([]rune(text)) {
+		b = append(b, byte(u), byte(u>>8))
+	}
+	return b
+}
+
+func id3Picture(contentType string, picType byte, data []byte) []byte {
+	return concat([]byte{0}, []byte(contentType), []byte{0, picType}, []byte("cover\x00"), data)
+}
+
+func id3Chapter(elementID string, startMS, endMS uint32, frames ...[]byte) []byte {
+	b := append([]byte(elementID), 0)
+	b = appendUint32(b, startMS)
+	b = appendUint32(b, endMS)
+	b = append(b, bytes.Repeat([]byte{0xFF}, 8)...)
+	return concat(append([][]byte{b}, frames...)...)
+}
+
+// id3Unsync returns the bytes unsynchronised, with a zero byte inserted after
+// every 0xFF byte.
+func id3Unsync(b []byte) []byte {
+	return bytes.ReplaceAll(b, []byte{0xFF}, []byte{0xFF, 0x00})
+}
+
+func TestParseID3(t *testing.T) {
+	jpeg := []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0xFF, 0x00, 0xFF}
+	frontJPEG := &artwork{ContentType: "image/jpeg", Data: jpeg}
+
+	textFrames := func(major byte) []byte {
+		return concat(
+			id3Frame(major, "TIT2", 0, id3Text("Intro to Go")),
+			id3Frame(major, "TPE1", 0, id3Text("Gopher")),
+		)
+	}
+	v23Frames := textFrames(3)
+
+	cases := map[string]struct {
+		Tag    []byte
+		Expect id3Tag
+	}{
+		"not id3": {
+			Tag: []byte("RIFF\x00\x00\x00\x00WAVE"),
+		},
+		"v2.2": {
+			Tag: id3v2(2, 0, concat(
+				id3Frame(2, "TT2", 0, id3Text("Intro to Go")),
+				id3Frame(2, "TP1", 0, id3Text("Gopher")),
+				id3Frame(2, "PIC", 0, concat([]byte{0}, []byte("PNG"), []byte{3, 0}, []byte("png"))),
+			)),
+			Expect: id3Tag{
+				Title: "Intro to Go", Artist: "Gopher",
+				Artwork: &artwork{ContentType: "image/png", Data: []byte("png")},
+			},
+		},
+		"v2.2 unknown picture format": {
+			Tag: id3v2(2, 0, concat(
+				id3Frame(2, "PIC", 0, concat([]byte{0}, []byte("GIF"), []byte{3, 0}, []byte("gif"))),
+			)),
+		},
+		"v2.3": {
+			Tag: id3v2(3, 0, concat(
+				id3Frame(3, "TIT2", 0, id3TextUTF16("Café\x00ignored")),
+				id3Frame(3, "TPE1", 0, []byte{0, 'G', 'o', 'p', 'h', 0xE9, 'r', ' ', ' '}),
+				id3Frame(3, "APIC", 0, id3Picture("image/png", 4, []byte("back"))),
+				id3Frame(3, "APIC", 0, id3Picture("jpeg", 3, jpeg)),
+				id3Frame(3, "APIC", 0, id3Picture("image/png", 0, []byte("other"))),
+				id3Frame(3, "TIT2", 0, id3Text("Other")),
+			)),
+			Expect: id3Tag{
+				Title: "Café", Artist: "Gophér",
+				Artwork: frontJPEG,
+			},
+		},
+		"v2.3 invalid pictures": {
+			Tag: id3v2(3, 0, concat(
+				id3Frame(3, "APIC", 0, id3Picture("-->", 3, []byte("https://example.com/cover.jpg"))),
+				id3Frame(3, "APIC", 0, id3Picture("image/png", 3, nil)),
+				id3Frame(3, "APIC", 0, []byte{0, 'i', 'm', 'a', 'g', 'e'}),
+			)),
+		},
+		"v2.3 unsynchronised": {
+			Tag: id3v2(3, 0x80, id3Unsync(concat(
+				v23Frames,
+				id3Frame(3, "APIC", 0, id3Picture("image/jpeg", 3, jpeg)),
+			))),
+			Expect: id3Tag{
+				Title: "Intro to Go", Artist: "Gopher",
+				Artwork: frontJPEG,
+			},
+		},
+		"v2.3 extended header": {
+			Tag: id3v2(3, 0x40, concat(appendUint32(nil, 6), make([]byte, 6), v23Frames)),
+			Expect: id3Tag{
+				Title: "Intro to Go", Artist: "Gopher",
+			},
+		},
+		"v2.3 invalid extended header": {
+			Tag: id3v2(3, 0x40, concat(appendUint32(nil, 1<<20), v23Frames)),
+		},
+		"v2.3 chapters": {
+			Tag: id3v2(3, 0, concat(
+				id3Frame(3, "CHAP", 0, id3Chapter("ch0", 0, 30500,
+					id3Frame(3, "TIT2", 0, id3Text("Welcome")))),
+				id3Frame(3, "CHAP", 0, id3Chapter("ch1", 30500, 0)),
+			)),
+			Expect: id3Tag{
+				Chapters: []workshop.Chapter{
+					{Title: "Welcome", StartSeconds: 0, EndSeconds: 30.5},
+					{StartSeconds: 30.5},
+				},
+			},
+		},
+		"v2.4": {
+			Tag: id3v2(4, 0, concat(
+				id3Frame(4, "TIT2", 0, append([]byte{3}, "Ünïcode"...)),
+				id3Frame(4, "TPE1", 0, append([]byte{2}, 0, 'G', 0, 'o')),
+			)),
+			Expect: id3Tag{
+				Title: "Ünïcode", Artist: "Go",
+			},
+		},
+		"v2.4 extended header": {
+			Tag: id3v2(4, 0x40, concat(syncsafe(6), []byte{1, 0}, textFrames(4))),
+			Expect: id3Tag{
+				Title: "Intro to Go", Artist: "Gopher",
+			},
+		},
+		"v2.4 unsynchronised frames": {
+			Tag: id3v2(4, 0x80, concat(
+				id3Frame(4, "TIT2", 0x02, id3Unsync(append(id3Text("Intro to Go "), 0xFF))),
+				id3Frame(4, "APIC", 0x03, concat(
+					syncsafe(len(id3Picture("image/jpeg", 3, jpeg))),
+					id3Unsync(id3Picture("image/jpeg", 3, jpeg)),
+				)),
+				id3Frame(4, "TPE1", 0x40, concat([]byte{1}, id3Text("Gopher"))),
+			)),
+			Expect: id3Tag{
+				Title: "Intro to Go ÿ", Artist: "Gopher",
+				Artwork: frontJPEG,
+			},
+		},
+		"v2.4 chapters": {
+			Tag: id3v2(4, 0, concat(
+				id3Frame(4, "CHAP", 0, id3Chapter("ch0", 1000, 2000,
+					id3Frame(4, "TIT2", 0, id3Text("Welcome")),
+					id3Frame(4, "TPE1", 0, id3Text("Gopher")))),
+				id3Frame(4, "CHAP", 0, []byte("truncated\x00")),
+			)),
+			Expect: id3Tag{
+				Chapters: []workshop.Chapter{
+					{Title: "Welcome", StartSeconds: 1, EndSeconds: 2},
+				},
+			},
+		},
+		"truncated": {
+			Tag: id3v2(3, 0, v23Frames)[:10+len(v23Frames)-2],
+			Expect: id3Tag{
+				Title: "Intro to Go",
+			},
+		},
+		"padding": {
+			Tag: id3v2(3, 0, concat(v23Frames, make([]byte, 64), id3Frame(3, "TIT2", 0, id3Text("Other")))),
+			Expect: id3Tag{
+				Title: "Intro to Go", Artist: "Gopher",
+			},
+		},
+		"frame larger than tag": {
+			Tag: concat(id3v2(3, 0, concat(
+				id3Frame(3, "TIT2", 0, id3Text("Intro to Go")),
+				appendUint32([]byte("TPE1"), 100), []byte{0, 0},
+			)), id3Text("Gopher")),
+			Expect: id3Tag{
+				Title: "Intro to Go",
+			},
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			tag := parseID3(c.Tag)
+			if !reflect.DeepEqual(c.Expect, tag) {
+				t.Errorf("expect %+v tag, got %+v", c.Expect, tag)
+			}
+		})
+	}
+}
+
+func TestID3TagLen(t *testing.T) {
+	cases := map[string]struct {
+		Media  []byte
+		Expect int64
+	}{
+		"empty": {},
+		"not id3": {
+			Media: mp3Frames(1),
+		},
+		"short": {
+			Media: []byte("ID3\x03\x00"),
+		},
+		"tag": {
+			Media:  id3v2(3, 0, make([]byte, 300)),
+			Expect: 310,
+		},
+		"footer": {
+			Media:  id3v2(4, 0x10, make([]byte, 300)),
+			Expect: 320,
+		},
+		"syncsafe size": {
+			Media:  concat([]byte("ID3\x04\x00\x00"), []byte{0x7F, 0xFF, 0xFF, 0xFF}),
+			Expect: 10 + 1<<28 - 1,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			if e, a := c.Expect, id3TagLen(c.Media); e != a {
+				t.Errorf("expect %v tag length, got %v", e, a)
+			}
+		})
+	}
+}
+
+func TestDecodeUTF16(t *testing.T) {
+	cases := map[string]struct {
+		Enc    byte
+		Text   []byte
+		Expect string
+	}{
+		"little endian bom": {
+			Enc: 1, Text: []byte{0xFF, 0xFE, 'G', 0, 'o', 0}, Expect: "Go",
+		},
+		"big endian bom": {
+			Enc: 1, Text: []byte{0xFE, 0xFF, 0, 'G', 0, 'o'}, Expect: "Go",
+		},
+		"big endian without bom": {
+			Enc: 2, Text: []byte{0, 'G', 0, 'o'}, Expect: "Go",
+		},
+		"odd length": {
+			Enc: 2, Text: []byte{0, 'G', 0}, Expect: "G",
+		},
+		"surrogate pair": {
+			Enc: 2, Text: utf16BE("🎙"), Expect: "🎙",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			if e, a := c.Expect, decodeUTF16(c.Enc, c.Text); e != a {
+				t.Errorf("expect %q text, got %q", e, a)
+			}
+		})
+	}
+}
+
+func utf16BE(s string) []byte {
+	var b []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		var buf [2]byte
+		binary.BigEndian.PutUint16(buf[:], u)
+		b = append(b, buf[:]...)
+	}
+	return b
+}
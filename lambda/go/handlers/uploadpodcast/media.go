@@ -0,0 +1,258 @@
+package uploadpodcast
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+
+	workshop "aws-workshop"
+)
+
+// uploadEpisodeMedia uploads the episode's media to the episode's media key,
+// and records the media's size, SHA-256, content type, and audio metadata on
+// the episode. Episodes over the quotas fail with a QuotaExceededError.
+func (h *Handler) uploadEpisodeMedia(ctx context.Context, episode *workshop.Episode) error {
+	if err := h.checkEpisodeQuotas(ctx, *episode); err != nil {
+		return h.failQuota(ctx, episode.ID, err)
+	}
+
+	// Media already uploaded, e.g. by a previous import attempt, is not
+	// downloaded again if the source media is unchanged.
+	if stored := h.unchangedStoredMedia(ctx, *episode); stored != nil {
+		log.Printf("media unchanged since uploaded, skipping download, %v", episode.MediaKey)
+		if mediaContentType(episode.MediaContentType, "", nil) == "" {
+			episode.MediaContentType = workshop.NormalizeMediaContentType(stored.ContentType)
+		}
+		episode.MediaSize = stored.Size
+		episode.MediaSHA256 = stored.SHA256
+		if err := h.Quotas.CheckMediaSize(episode.MediaSize); err != nil {
+			return h.failQuota(ctx, episode.ID, err)
+		}
+
+		probe := newAudioProbe()
+		h.probeMediaHead(ctx, episode.MediaURL, probe)
+		h.recordAudioMetadata(ctx, episode, probe.metadata(episode.MediaSize))
+		if err := h.Quotas.CheckMediaDuration(episode.MediaDurationSeconds); err != nil {
+			return h.failQuota(ctx, episode.ID, err)
+		}
+
+		return nil
+	}
+
+	// Resume the multipart upload of the media started by a previous
+	// attempt of the step, if any.
+	upload, err := h.getMediaUpload(ctx, *episode)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+	}
+	if upload != nil && (upload.ifRange() == "" || upload.PartSize != h.partSize()) {
+		log.Printf("media upload %v cannot be resumed", upload.UploadID)
+		h.abortMediaUpload(ctx, episode.ID, upload)
+		upload = nil
+	}
+
+	// The media's headers are parsed as the media is uploaded. The start of
+	// the media is requested separately if the upload is resumed.
+	probe := newAudioProbe()
+	var offset int64
+	var ifRange string
+	if upload != nil {
+		offset, ifRange = upload.uploaded(), upload.ifRange()
+		h.probeMediaHead(ctx, episode.MediaURL, probe)
+	}
+	resp, err := h.getMediaRange(ctx, episode.MediaURL, offset, ifRange)
+	if err != nil {
+		if upload != nil {
+			h.abortMediaUpload(ctx, episode.ID, upload)
+		}
+		return err
+	}
+
+	// The size of the media is checked before it is downloaded, if known.
+	size := resp.ContentLength
+	if resp.StatusCode == http.StatusPartialContent {
+		if _, total, err := parseContentRange(resp.Header.Get("Content-Range")); err == nil {
+			size = total
+		}
+	}
+	if err := h.Quotas.CheckMediaSize(size); err != nil {
+		resp.Body.Close()
+		if upload != nil {
+			h.abortMediaUpload(ctx, episode.ID, upload)
+		}
+		return h.failQuota(ctx, episode.ID, err)
+	}
+
+	var source mediaSource
+	if resp.StatusCode == http.StatusPartialContent && (upload != nil || resp.ContentLength > h.partSize()) {
+		// Media larger than a part is downloaded, and uploaded in parts, so
+		// the upload can be resumed if it is stopped.
+		upload, err = h.uploadMediaParts(ctx, episode, upload, resp, probe)
+		if err != nil {
+			// Incomplete uploads are resumed by the step's retry, and
+			// aborted by the update episode status step if the episode
+			// fails.
+			var incomplete *MediaUploadIncompleteError
+			if errors.As(err, &incomplete) {
+				log.Printf("ERROR: %v", incomplete)
+				return incomplete
+			}
+			if upload != nil {
+				h.abortMediaUpload(ctx, episode.ID, upload)
+			}
+			return fmt.Errorf("upload episode media failed, %w", err)
+		}
+		source = mediaSource{
+			ETag:          upload.SourceETag,
+			LastModified:  upload.SourceLastModified,
+			ContentLength: upload.Size,
+		}
+	} else {
+		if upload != nil {
+			log.Printf("media changed since upload %v started", upload.UploadID)
+			h.abortMediaUpload(ctx, episode.ID, upload)
+		}
+		defer resp.Body.Close()
+		if err := h.uploadMediaStream(ctx, episode, resp, probe); err != nil {
+			var quotaErr *workshop.QuotaExceededError
+			if errors.As(err, &quotaErr) {
+				return h.failQuota(ctx, episode.ID, quotaErr)
+			}
+			return err
+		}
+		source = newMediaSource(resp)
+	}
+	log.Printf("uploaded %v bytes of media, sha256 %v", episode.MediaSize, episode.MediaSHA256)
+
+	h.recordStoredMedia(ctx, *episode, source)
+	h.recordAudioMetadata(ctx, episode, probe.metadata(episode.MediaSize))
+	if err := h.Quotas.CheckMediaDuration(episode.MediaDurationSeconds); err != nil {
+		return h.failQuota(ctx, episode.ID, err)
+	}
+
+	return nil
+}
+
+// uploadMediaStream uploads the media of the response, as it is read. The
+// media is hashed, and written to the probe as it is uploaded, and the upload
+// fails if the media is not the length of the response's Content-Length, if
+// known.
+func (h *Handler) uploadMediaStream(ctx context.Context, episode *workshop.Episode, resp *http.Response,
+	probe *audioProbe,
+) error {
+	var respBody io.Reader = resp.Body
+
+	// The start of the media is read to sniff the content type, if the
+	// episode's or response's content type is not known.
+	var head []byte
+	if mediaContentType(episode.MediaContentType, resp.Header.Get("Content-Type"), nil) == "" {
+		var buf bytes.Buffer
+		_, err := io.Copy(&buf, io.LimitReader(resp.Body, workshop.AudioSniffLen))
+		if err != nil {
+			return fmt.Errorf("failed to read media to detect content-type %w", err)
+		}
+		head = buf.Bytes()
+
+		// Wrap buffered bytes and remaining response body together to be
+		// uploaded together.
+		respBody = io.MultiReader(&buf, resp.Body)
+	}
+	episode.MediaContentType = detectMediaContentType(episode.MediaContentType,
+		resp.Header.Get("Content-Type"), head)
+
+	media := newMediaReader(io.TeeReader(respBody, probe), resp.ContentLength)
+	media.maxSize = h.Quotas.MaxMediaSize
+	if err := h.uploadMedia(ctx, episode.MediaKey, episode.MediaContentType, media); err != nil {
+		// Media of unknown length is only known to be over the maximum size
+		// once read.
+		if quotaErr := h.Quotas.CheckMediaSize(media.n); quotaErr != nil {
+			return quotaErr
+		}
+		return fmt.Errorf("upload episode media failed, %w", err)
+	}
+	episode.MediaSize = media.n
+	episode.MediaSHA256 = media.sum()
+	return nil
+}
+
+// mediaContentType returns the canonical content type of the episode's, or
+// the response's content type, whichever is first one of the
+// MediaContentTypes, otherwise the audio content type sniffed from the start
+// of the media. Returns an empty string if none are known.
+func mediaContentType(episodeType, respType string, head []byte) string {
+	for _, v := range []string{episodeType, respType} {
+		if v = workshop.NormalizeMediaContentType(v); workshop.IsMediaContentType(v) {
+			return v
+		}
+	}
+	return workshop.SniffAudioContentType(head)
+}
+
+// detectMediaContentType returns the content type of the media, see
+// mediaContentType. If the media is not a known audio container the
+// episode's, or response's content type is used, if not generic, otherwise
+// the content type is guessed from the start of the media.
+func detectMediaContentType(episodeType, respType string, head []byte) string {
+	if v := mediaContentType(episodeType, respType, head); v != "" {
+		return v
+	}
+	for _, v := range []string{episodeType, respType} {
+		if v = workshop.NormalizeMediaContentType(v); v != "" && v != "application/octet-stream" {
+			return v
+		}
+	}
+	return http.DetectContentType(head)
+}
+
+// mediaReader counts and hashes the media read. If the expected length of
+// the media is known, reads fail if the media is truncated, or longer than
+// expected. Reads fail if the media is longer than the max size, if set.
+type mediaReader struct {
+	r        io.Reader
+	hash     hash.Hash
+	n        int64
+	expected int64
+	maxSize  int64
+}
+
+// newMediaReader returns a mediaReader for the media. The expected length is
+// unknown if less than 0.
+func newMediaReader(r io.Reader, expected int64) *mediaReader {
+	return &mediaReader{
+		r:        r,
+		hash:     sha256.New(),
+		expected: expected,
+	}
+}
+
+func (m *mediaReader) Read(p []byte) (int, error) {
+	n, err := m.r.Read(p)
+	m.hash.Write(p[:n])
+	m.n += int64(n)
+
+	if m.maxSize > 0 && m.n > m.maxSize {
+		return n, fmt.Errorf("media longer than maximum size %v", m.maxSize)
+	}
+	if m.expected >= 0 {
+		if m.n > m.expected {
+			return n, fmt.Errorf("media longer than Content-Length %v", m.expected)
+		}
+		if err == io.EOF && m.n < m.expected {
+			return n, fmt.Errorf("media truncated, read %v of Content-Length %v bytes, %w",
+				m.n, m.expected, io.ErrUnexpectedEOF)
+		}
+	}
+	return n, err
+}
+
+// sum returns the SHA-256 of the media read, hex encoded.
+func (m *mediaReader) sum() string {
+	return hex.EncodeToString(m.hash.Sum(nil))
+}
@@ -0,0 +1,519 @@
+package uploadpodcast
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	workshop "aws-workshop"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ddbav "github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	ddbexp "github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	// DefaultPartSize is the size of the parts media is downloaded, and
+	// uploaded in, if the Handler's PartSize is not set.
+	DefaultPartSize = 16 * 1024 * 1024
+
+	// MinPartSize is the minimum size of the parts of a multipart upload.
+	MinPartSize = 5 * 1024 * 1024
+
+	// maxPartAttempts is the number of times downloading a part is attempted
+	// before the upload is stopped, to be resumed when the step is retried.
+	maxPartAttempts = 3
+
+	// uploadFinishTime is the time reserved at the end of the invocation to
+	// record the upload's progress.
+	uploadFinishTime = 10 * time.Second
+)
+
+// MediaUploadIncompleteError is returned when the media upload is stopped
+// before it is complete, e.g. before the Lambda's timeout, or because the
+// media's connection failed. The upload is resumed from the last part
+// uploaded when the upload step is retried.
+type MediaUploadIncompleteError struct {
+	Uploaded int64
+	Size     int64
+	Err      error
+}
+
+func (e *MediaUploadIncompleteError) Error() string {
+	msg := fmt.Sprintf("media upload incomplete, %v of %v bytes uploaded", e.Uploaded, e.Size)
+	if e.Err != nil {
+		msg += ", " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *MediaUploadIncompleteError) Unwrap() error { return e.Err }
+
+// mediaUpload is the progress of the multipart upload of an episode's media.
+// Persisted in the episode's media_upload attribute after each part, so the
+// upload can be resumed by a retry.
+type mediaUpload struct {
+	Key         string `dynamodbav:"key"`
+	UploadID    string `dynamodbav:"upload_id"`
+	ContentType string `dynamodbav:"content_type"`
+	PartSize    int64  `dynamodbav:"part_size"`
+
+	// Size, and validators of the source media.
+	Size               int64  `dynamodbav:"size"`
+	SourceETag         string `dynamodbav:"source_etag,omitempty"`
+	SourceLastModified string `dynamodbav:"source_last_modified,omitempty"`
+
+	Parts []uploadedPart `dynamodbav:"parts"`
+
+	// State of the SHA-256 of the parts uploaded, encoded by the hash's
+	// MarshalBinary.
+	HashState []byte `dynamodbav:"hash_state,omitempty"`
+}
+
+// uploadedPart is a part of the media uploaded.
+type uploadedPart struct {
+	PartNumber int32  `dynamodbav:"part_number"`
+	ETag       string `dynamodbav:"etag"`
+}
+
+// completedParts returns the parts uploaded, for completing the upload.
+func (u *mediaUpload) completedParts() []s3types.CompletedPart {
+	parts := make([]s3types.CompletedPart, 0, len(u.Parts))
+	for _, part := range u.Parts {
+		parts = append(parts, s3types.CompletedPart{
+			PartNumber: part.PartNumber,
+			ETag:       aws.String(part.ETag),
+		})
+	}
+	return parts
+}
+
+// uploaded returns the number of bytes of the media uploaded.
+func (u *mediaUpload) uploaded() int64 {
+	n := int64(len(u.Parts)) * u.PartSize
+	if n > u.Size {
+		return u.Size
+	}
+	return n
+}
+
+// ifRange returns the validator of the source media for If-Range requests
+// resuming the upload. Weak ETags cannot be used with If-Range. Empty if the
+// source has no validator, and the upload cannot be resumed.
+func (u *mediaUpload) ifRange() string {
+	if u.SourceETag != "" && !strings.HasPrefix(u.SourceETag, "W/") {
+		return u.SourceETag
+	}
+	return u.SourceLastModified
+}
+
+func (h *Handler) partSize() int64 {
+	if h.PartSize == 0 {
+		return DefaultPartSize
+	}
+	if h.PartSize < MinPartSize {
+		return MinPartSize
+	}
+	return h.PartSize
+}
+
+// getMediaRange requests the media from the offset to the end. If ifRange
+// is set, the media is only requested from the offset if the media's
+// validator matches, otherwise the whole media is returned.
+func (h *Handler) getMediaRange(ctx context.Context, mediaURL string, offset int64, ifRange string) (
+	*http.Response, error,
+) {
+	req, err := http.NewRequestWithContext(ctx, "GET", mediaURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	if ifRange != "" {
+		req.Header.Set("If-Range", ifRange)
+	}
+
+	resp, err := h.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request for media, %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to get media %v", resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// parseContentRange returns the first byte, and the complete length of the
+// Content-Range of a partial response.
+func parseContentRange(v string) (start, size int64, err error) {
+	var end int64
+	if _, err := fmt.Sscanf(v, "bytes %d-%d/%d", &start, &end, &size); err != nil {
+		return 0, 0, fmt.Errorf("invalid media Content-Range %q, %w", v, err)
+	}
+	if start > end || end >= size {
+		return 0, 0, fmt.Errorf("invalid media Content-Range %q", v)
+	}
+	return start, size, nil
+}
+
+// uploadMediaParts downloads the media of the partial response in parts, and
+// uploads each part as a part of a multipart upload. Each part is written to
+// the probe as it is read. If upload is nil a new multipart upload is
+// started, otherwise the upload is resumed from its last part, and the
+// response must start at that part. The upload's progress is recorded after
+// each part.
+//
+// A MediaUploadIncompleteError is returned if the upload is stopped before
+// it is complete, and can be resumed. Other errors are terminal, and the
+// upload should be aborted.
+func (h *Handler) uploadMediaParts(ctx context.Context, episode *workshop.Episode, upload *mediaUpload,
+	resp *http.Response, probe *audioProbe,
+) (*mediaUpload, error) {
+	body := resp.Body
+	defer func() { body.Close() }()
+
+	start, size, err := parseContentRange(resp.Header.Get("Content-Range"))
+	if err != nil {
+		return upload, err
+	}
+
+	hash := sha256.New()
+	if upload == nil {
+		if start != 0 {
+			return nil, fmt.Errorf("media response starts at %v, expected 0", start)
+		}
+		upload = &mediaUpload{
+			Key:                episode.MediaKey,
+			PartSize:           h.partSize(),
+			Size:               size,
+			SourceETag:         resp.Header.Get("ETag"),
+			SourceLastModified: resp.Header.Get("Last-Modified"),
+		}
+	} else {
+		if start != upload.uploaded() || size != upload.Size {
+			return upload, fmt.Errorf("media response range %v-/%v does not match upload, %v-/%v",
+				start, size, upload.uploaded(), upload.Size)
+		}
+		if err := hash.(encoding.BinaryUnmarshaler).UnmarshalBinary(upload.HashState); err != nil {
+			return upload, fmt.Errorf("failed to restore media hash, %w", err)
+		}
+		log.Printf("resuming media upload %v at part %v, %v of %v bytes",
+			upload.UploadID, len(upload.Parts)+1, upload.uploaded(), upload.Size)
+	}
+
+	buf := make([]byte, upload.PartSize)
+	var lastPartDur time.Duration
+	for offset := upload.uploaded(); offset < upload.Size; offset = upload.uploaded() {
+		// Stop before the invocation's deadline, so the upload's progress is
+		// recorded, and the upload can be resumed.
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < uploadFinishTime+lastPartDur {
+			return upload, &MediaUploadIncompleteError{
+				Uploaded: offset, Size: upload.Size,
+				Err: fmt.Errorf("stopped before timeout"),
+			}
+		}
+		partStart := time.Now()
+
+		part := buf[:upload.PartSize]
+		if remaining := upload.Size - offset; remaining < upload.PartSize {
+			part = buf[:remaining]
+		}
+		if body, err = h.readPart(ctx, episode.MediaURL, upload, body, part); err != nil {
+			return upload, err
+		}
+		probe.writeAt(part, offset)
+
+		// The upload is only started once the first part is read, so the
+		// media's content type can be detected.
+		if upload.UploadID == "" {
+			if err := h.createMediaUpload(ctx, episode, upload, resp, part); err != nil {
+				return upload, err
+			}
+		}
+
+		partNumber := int32(len(upload.Parts) + 1)
+		partResp, err := h.S3Client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:        &h.BucketName,
+			Key:           &upload.Key,
+			UploadId:      &upload.UploadID,
+			PartNumber:    partNumber,
+			Body:          bytes.NewReader(part),
+			ContentLength: int64(len(part)),
+		})
+		if err != nil {
+			var noSuchUpload *s3types.NoSuchUpload
+			if errors.As(err, &noSuchUpload) {
+				return upload, fmt.Errorf("media upload %v no longer exists, %w", upload.UploadID, err)
+			}
+			return upload, &MediaUploadIncompleteError{
+				Uploaded: offset, Size: upload.Size,
+				Err: fmt.Errorf("failed to upload media part %v, %w", partNumber, err),
+			}
+		}
+
+		hash.Write(part)
+		if upload.HashState, err = hash.(encoding.BinaryMarshaler).MarshalBinary(); err != nil {
+			return upload, fmt.Errorf("failed to save media hash, %w", err)
+		}
+		upload.Parts = append(upload.Parts, uploadedPart{
+			PartNumber: partNumber,
+			ETag:       aws.ToString(partResp.ETag),
+		})
+
+		// The part is uploaded, so a failure to record the progress only
+		// means the part will be uploaded again if the upload is resumed.
+		// The last part is not recorded, so a resumed upload always has
+		// media left to request.
+		if upload.uploaded() < upload.Size {
+			if err := h.putMediaUpload(ctx, episode.ID, upload); err != nil {
+				log.Printf("ERROR: failed to record media upload progress, %v", err)
+			}
+		}
+		lastPartDur = time.Since(partStart)
+	}
+
+	if err := h.completeMediaUpload(ctx, episode, upload); err != nil {
+		return upload, err
+	}
+	episode.MediaSHA256 = hex.EncodeToString(hash.Sum(nil))
+	return upload, nil
+}
+
+// readPart reads the part of the media from the body. If reading the body
+// fails the media is requested again from the part, up to maxPartAttempts
+// times. Returns the body the rest of the media is read from.
+func (h *Handler) readPart(ctx context.Context, mediaURL string, upload *mediaUpload,
+	body io.ReadCloser, part []byte,
+) (io.ReadCloser, error) {
+	offset := upload.uploaded()
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if _, err = io.ReadFull(body, part); err == nil {
+			return body, nil
+		}
+		if attempt == maxPartAttempts || ctx.Err() != nil {
+			break
+		}
+		log.Printf("failed to read media part %v, attempt %v, %v", len(upload.Parts)+1, attempt, err)
+
+		body.Close()
+		body = ioutil.NopCloser(strings.NewReader(""))
+
+		resp, reqErr := h.getMediaRange(ctx, mediaURL, offset, upload.ifRange())
+		if reqErr != nil {
+			err = reqErr
+			break
+		}
+		body = resp.Body
+		if resp.StatusCode != http.StatusPartialContent {
+			return body, fmt.Errorf("media changed while uploading, status %v", resp.StatusCode)
+		}
+		start, size, rangeErr := parseContentRange(resp.Header.Get("Content-Range"))
+		if rangeErr != nil {
+			return body, rangeErr
+		}
+		if start != offset || size != upload.Size {
+			return body, fmt.Errorf("media changed while uploading, range %v-/%v", start, size)
+		}
+	}
+
+	return body, &MediaUploadIncompleteError{
+		Uploaded: offset, Size: upload.Size,
+		Err: fmt.Errorf("failed to read media part %v, %w", len(upload.Parts)+1, err),
+	}
+}
+
+// createMediaUpload starts the multipart upload of the media. The episode's
+// content type is detected with the first part. Other multipart uploads of
+// the media key, e.g. orphaned by a failed upload, are aborted.
+func (h *Handler) createMediaUpload(ctx context.Context, episode *workshop.Episode, upload *mediaUpload,
+	resp *http.Response, firstPart []byte,
+) error {
+	episode.MediaContentType = detectMediaContentType(episode.MediaContentType,
+		resp.Header.Get("Content-Type"), firstPart)
+	upload.ContentType = episode.MediaContentType
+
+	h.abortOrphanedUploads(ctx, upload.Key)
+
+	createResp, err := h.S3Client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      &h.BucketName,
+		Key:         &upload.Key,
+		ContentType: &upload.ContentType,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create media upload, %w", err)
+	}
+	upload.UploadID = aws.ToString(createResp.UploadId)
+	log.Printf("created media upload %v, %v parts of %v bytes", upload.UploadID,
+		(upload.Size+upload.PartSize-1)/upload.PartSize, upload.PartSize)
+
+	return nil
+}
+
+// completeMediaUpload completes the multipart upload of the media, and
+// removes the upload's progress from the episode.
+func (h *Handler) completeMediaUpload(ctx context.Context, episode *workshop.Episode, upload *mediaUpload) error {
+	_, err := h.S3Client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:   &h.BucketName,
+		Key:      &upload.Key,
+		UploadId: &upload.UploadID,
+		MultipartUpload: &s3types.CompletedMultipartUpload{
+			Parts: upload.completedParts(),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to complete media upload %v, %w", upload.UploadID, err)
+	}
+	episode.MediaContentType = upload.ContentType
+	episode.MediaSize = upload.Size
+
+	if err := h.deleteMediaUpload(ctx, episode.ID); err != nil {
+		log.Printf("ERROR: failed to remove completed media upload, %v", err)
+	}
+	return nil
+}
+
+// abortMediaUpload aborts the multipart upload, and removes the upload's
+// progress from the episode. Errors are logged, the parts of uploads not
+// aborted are removed by the bucket's lifecycle rule.
+func (h *Handler) abortMediaUpload(ctx context.Context, episodeID string, upload *mediaUpload) {
+	if upload.UploadID != "" {
+		log.Printf("aborting media upload %v", upload.UploadID)
+		_, err := h.S3Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   &h.BucketName,
+			Key:      &upload.Key,
+			UploadId: &upload.UploadID,
+		})
+		var noSuchUpload *s3types.NoSuchUpload
+		if err != nil && !errors.As(err, &noSuchUpload) {
+			log.Printf("ERROR: failed to abort media upload %v, %v", upload.UploadID, err)
+		}
+	}
+
+	if err := h.deleteMediaUpload(ctx, episodeID); err != nil {
+		log.Printf("ERROR: failed to remove media upload, %v", err)
+	}
+}
+
+// abortOrphanedUploads aborts all multipart uploads of the media key. Errors
+// are logged.
+func (h *Handler) abortOrphanedUploads(ctx context.Context, key string) {
+	input := &s3.ListMultipartUploadsInput{
+		Bucket: &h.BucketName,
+		Prefix: &key,
+	}
+	for {
+		resp, err := h.S3Client.ListMultipartUploads(ctx, input)
+		if err != nil {
+			log.Printf("ERROR: failed to list orphaned media uploads, %v", err)
+			return
+		}
+
+		for _, upload := range resp.Uploads {
+			if aws.ToString(upload.Key) != key {
+				continue
+			}
+			h.abortMediaUpload(ctx, "", &mediaUpload{
+				Key:      key,
+				UploadID: aws.ToString(upload.UploadId),
+			})
+		}
+
+		if !resp.IsTruncated {
+			return
+		}
+		input.KeyMarker = resp.NextKeyMarker
+		input.UploadIdMarker = resp.NextUploadIdMarker
+	}
+}
+
+// getMediaUpload returns the progress of the multipart upload of the
+// episode's media, or nil if there is none.
+func (h *Handler) getMediaUpload(ctx context.Context, episode workshop.Episode) (*mediaUpload, error) {
+	if h.EpisodeTableName == "" {
+		return nil, nil
+	}
+
+	exp, err := ddbexp.NewBuilder().WithProjection(
+		ddbexp.NamesList(ddbexp.Name("media_upload")),
+	).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build projection expression, %w", err)
+	}
+
+	resp, err := h.DDBClient.GetItem(ctx, &ddb.GetItemInput{
+		TableName:                &h.EpisodeTableName,
+		Key:                      workshop.Episode{ID: episode.ID}.AttributeValuePrimaryKey(),
+		ProjectionExpression:     exp.Projection(),
+		ExpressionAttributeNames: exp.Names(),
+		ConsistentRead:           aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get media upload, %w", err)
+	}
+
+	var item struct {
+		MediaUpload *mediaUpload `dynamodbav:"media_upload"`
+	}
+	if err := ddbav.UnmarshalMap(resp.Item, &item); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal media upload, %w", err)
+	}
+	if item.MediaUpload == nil || item.MediaUpload.Key != episode.MediaKey {
+		return nil, nil
+	}
+	return item.MediaUpload, nil
+}
+
+// putMediaUpload records the progress of the multipart upload in the
+// episode.
+func (h *Handler) putMediaUpload(ctx context.Context, episodeID string, upload *mediaUpload) error {
+	return h.updateMediaUpload(ctx, episodeID,
+		ddbexp.Set(ddbexp.Name("media_upload"), ddbexp.Value(upload)))
+}
+
+// deleteMediaUpload removes the progress of the multipart upload from the
+// episode.
+func (h *Handler) deleteMediaUpload(ctx context.Context, episodeID string) error {
+	if episodeID == "" {
+		return nil
+	}
+	return h.updateMediaUpload(ctx, episodeID, ddbexp.Remove(ddbexp.Name("media_upload")))
+}
+
+func (h *Handler) updateMediaUpload(ctx context.Context, episodeID string, update ddbexp.UpdateBuilder) error {
+	if h.EpisodeTableName == "" {
+		return nil
+	}
+
+	exp, err := ddbexp.NewBuilder().WithUpdate(update).Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression, %w", err)
+	}
+
+	_, err = h.DDBClient.UpdateItem(ctx, &ddb.UpdateItemInput{
+		TableName:                 &h.EpisodeTableName,
+		Key:                       workshop.Episode{ID: episodeID}.AttributeValuePrimaryKey(),
+		UpdateExpression:          exp.Update(),
+		ExpressionAttributeNames:  exp.Names(),
+		ExpressionAttributeValues: exp.Values(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update episode media upload, %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package uploadpodcast
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"testing"
+
+	workshop "aws-workshop"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// recordingS3 records the parts uploaded, and the multipart uploads
+// completed.
+type recordingS3 struct {
+	S3API
+
+	mu        sync.Mutex
+	parts     []int32
+	completed []*s3.CompleteMultipartUploadInput
+}
+
+func (s *recordingS3) UploadPart(ctx context.Context, input *s3.UploadPartInput, optFns ...func(*s3.Options)) (
+	*s3.UploadPartOutput, error,
+) {
+	s.mu.Lock()
+	s.parts = append(s.parts, input.PartNumber)
+	s.mu.Unlock()
+	return s.S3API.UploadPart(ctx, input, optFns...)
+}
+
+func (s *recordingS3) CompleteMultipartUpload(ctx context.Context, input *s3.CompleteMultipartUploadInput,
+	optFns ...func(*s3.Options),
+) (*s3.CompleteMultipartUploadOutput, error) {
+	s.mu.Lock()
+	s.completed = append(s.completed, input)
+	s.mu.Unlock()
+	return s.S3API.CompleteMultipartUpload(ctx, input, optFns...)
+}
+
+// testMedia returns media of the size with distinct bytes, so misplaced
+// parts change the media's SHA-256.
+func testMedia(size int) []byte {
+	media := make([]byte, size)
+	for i := range media {
+		media[i] = byte(i * 7 / 3)
+	}
+	return media
+}
+
+func md5ETag(b []byte) string {
+	sum := md5.Sum(b)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// uploadSingleShot returns the episode, and media object uploaded by a single
+// upload of the media, not in parts.
+func uploadSingleShot(t *testing.T, episode workshop.Episode, media []byte) (*workshop.Episode, []byte) {
+	t.Helper()
+
+	server := newTestMediaServer(t, media, `"single"`)
+	episode.MediaURL = server.URL + "/1.mp3"
+	h, s3Client := newTestHandler(t, episode)
+	h.PartSize = int64(len(media)) * 2
+
+	output, err := h.Handle(context.Background(), workshop.TranscribeStateMachineInput{Episode: episode})
+	if err != nil {
+		t.Fatalf("expect no single upload error, got %v", err)
+	}
+	obj, ok := s3Client.GetObject(testBucketName, output.Episode.MediaKey)
+	if !ok {
+		t.Fatalf("expect single upload media object")
+	}
+	return &output.Episode, obj.Body
+}
+
+func TestHandle_MultipartResume(t *testing.T) {
+	media := testMedia(2*MinPartSize + MinPartSize/2)
+
+	cases := map[string]struct {
+		// Media served to the retry, if changed.
+		Retry []byte
+
+		ExpectMedia          []byte
+		ExpectRetryParts     []int32
+		ExpectCompletedParts int
+	}{
+		"unchanged media": {
+			ExpectMedia:          media,
+			ExpectRetryParts:     []int32{2, 3},
+			ExpectCompletedParts: 3,
+		},
+		"changed media": {
+			Retry:       testMedia(MinPartSize / 2),
+			ExpectMedia: testMedia(MinPartSize / 2),
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			server := newTestMediaServer(t, media, `"v1"`)
+			episode := workshop.Episode{ID: "1", Title: "Intro to Go", MediaURL: server.URL + "/1.mp3",
+				Status: workshop.EpisodeStatusUploading}
+			h, s3Client := newTestHandler(t, episode)
+			h.PartSize = MinPartSize
+			recorder := &recordingS3{S3API: h.S3Client}
+			h.S3Client = recorder
+
+			// The media's connection fails during the second part, every
+			// time the part is requested.
+			server.setFailAt(MinPartSize + MinPartSize/2)
+			_, err := h.Handle(context.Background(), workshop.TranscribeStateMachineInput{Episode: episode})
+			var incomplete *MediaUploadIncompleteError
+			if !errors.As(err, &incomplete) {
+				t.Fatalf("expect MediaUploadIncompleteError, got %v", err)
+			}
+			if e, a := int64(MinPartSize), incomplete.Uploaded; e != a {
+				t.Errorf("expect %v bytes uploaded, got %v", e, a)
+			}
+			if e, a := int64(len(media)), incomplete.Size; e != a {
+				t.Errorf("expect %v size, got %v", e, a)
+			}
+
+			episode.MediaKey = workshop.MakeEpisodeRawMediaPath(h.MediaKeyPrefix, episode.ID)
+			upload, err := h.getMediaUpload(context.Background(), episode)
+			if err != nil {
+				t.Fatalf("expect no error, got %v", err)
+			}
+			if upload == nil {
+				t.Fatalf("expect media upload progress recorded")
+			}
+			if e, a := 1, len(upload.Parts); e != a {
+				t.Errorf("expect %v parts recorded, got %v", e, a)
+			}
+			if n, ok := s3Client.MultipartUploadParts(upload.UploadID); !ok || n != 1 {
+				t.Errorf("expect upload in progress with 1 part, got %v, %v", n, ok)
+			}
+
+			// The step is retried after the connection recovers.
+			server.setFailAt(0)
+			if c.Retry != nil {
+				server.setMedia(c.Retry, `"v2"`)
+			}
+			recorder.parts = nil
+			output, err := h.Handle(context.Background(), workshop.TranscribeStateMachineInput{Episode: episode})
+			if err != nil {
+				t.Fatalf("expect no error, got %v", err)
+			}
+
+			if e, a := c.ExpectRetryParts, recorder.parts; !equalInt32s(e, a) {
+				t.Errorf("expect %v parts uploaded by retry, got %v", e, a)
+			}
+			if _, ok := s3Client.MultipartUploadParts(upload.UploadID); ok {
+				t.Errorf("expect upload %v not in progress", upload.UploadID)
+			}
+			if resumed, err := h.getMediaUpload(context.Background(), episode); err != nil || resumed != nil {
+				t.Errorf("expect media upload progress removed, got %v, %v", resumed, err)
+			}
+
+			expectCompleted := 0
+			if c.ExpectCompletedParts != 0 {
+				expectCompleted = 1
+			}
+			if e, a := expectCompleted, len(recorder.completed); e != a {
+				t.Fatalf("expect %v completed uploads, got %v", e, a)
+			}
+			if expectCompleted != 0 {
+				parts := recorder.completed[0].MultipartUpload.Parts
+				if e, a := c.ExpectCompletedParts, len(parts); e != a {
+					t.Fatalf("expect %v completed parts, got %v", e, a)
+				}
+				for i, part := range parts {
+					start := int64(i) * MinPartSize
+					end := start + MinPartSize
+					if end > int64(len(media)) {
+						end = int64(len(media))
+					}
+					if e, a := int32(i+1), part.PartNumber; e != a {
+						t.Errorf("expect part %v number, got %v", e, a)
+					}
+					if e, a := md5ETag(media[start:end]), aws.ToString(part.ETag); e != a {
+						t.Errorf("expect part %v %v ETag, got %v", i+1, e, a)
+					}
+				}
+			}
+
+			// The resumed upload matches a single upload of the media.
+			expect, expectBody := uploadSingleShot(t, episode, c.ExpectMedia)
+			if e, a := expect.MediaSHA256, output.Episode.MediaSHA256; e != a {
+				t.Errorf("expect %v sha256, got %v", e, a)
+			}
+			if e, a := expect.MediaSize, output.Episode.MediaSize; e != a {
+				t.Errorf("expect %v size, got %v", e, a)
+			}
+			if e, a := expect.MediaContentType, output.Episode.MediaContentType; e != a {
+				t.Errorf("expect %v content type, got %v", e, a)
+			}
+			obj, ok := s3Client.GetObject(testBucketName, output.Episode.MediaKey)
+			if !ok {
+				t.Fatalf("expect media object uploaded")
+			}
+			if !bytes.Equal(expectBody, obj.Body) {
+				t.Errorf("expect media object to match single upload")
+			}
+		})
+	}
+}
+
+func equalInt32s(a, b []int32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,44 @@
+package uploadpodcast
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	workshop "aws-workshop"
+)
+
+// checkEpisodeQuotas returns a QuotaExceededError if the episode's duration
+// published in its feed, or the number of episodes of its podcast
+// transcribed today exceed the quotas, so the media is not downloaded.
+// The episode is not counted, start-transcription counts the episode, and
+// checks the quota again. Failing to get the podcast's episodes is logged.
+func (h *Handler) checkEpisodeQuotas(ctx context.Context, episode workshop.Episode) error {
+	if err := h.Quotas.CheckMediaDuration(float64(episode.DurationSeconds)); err != nil {
+		return err
+	}
+	if h.QuotaTableName == "" {
+		return nil
+	}
+
+	err := h.Quotas.CheckPodcastEpisodesPerDay(ctx, h.DDBClient, h.QuotaTableName, episode)
+	var quotaErr *workshop.QuotaExceededError
+	if err != nil && !errors.As(err, &quotaErr) {
+		log.Printf("ERROR: %v", err)
+		return nil
+	}
+	return err
+}
+
+// failQuota records the reason the episode exceeded the quota as the
+// episode's failure reason, and returns the error.
+func (h *Handler) failQuota(ctx context.Context, episodeID string, err error) error {
+	log.Printf("episode %v exceeded quota, %v", episodeID, err)
+	if h.EpisodeTableName != "" {
+		if recordErr := workshop.RecordEpisodeFailureReason(ctx, h.DDBClient, h.EpisodeTableName,
+			episodeID, err.Error()); recordErr != nil {
+			log.Printf("ERROR: %v", recordErr)
+		}
+	}
+	return err
+}
@@ -0,0 +1,226 @@
+package uploadpodcast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	workshop "aws-workshop"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ddbav "github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	ddbexp "github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+// mediaSource is the validators of the source media's response, used to
+// determine if the media changed since it was uploaded.
+type mediaSource struct {
+	ETag          string
+	LastModified  string
+	ContentLength int64 // -1 if unknown
+}
+
+// newMediaSource returns the validators of the source media's response.
+func newMediaSource(resp *http.Response) mediaSource {
+	return mediaSource{
+		ETag:          resp.Header.Get("ETag"),
+		LastModified:  resp.Header.Get("Last-Modified"),
+		ContentLength: resp.ContentLength,
+	}
+}
+
+// unchanged returns if the source is the same media as the stored source.
+// The ETag or Last-Modified of both must be known, and every validator known
+// of both must match.
+func (s mediaSource) unchanged(stored mediaSource) bool {
+	var validated bool
+	if s.ETag != "" && stored.ETag != "" {
+		if s.ETag != stored.ETag {
+			return false
+		}
+		validated = true
+	}
+	if s.LastModified != "" && stored.LastModified != "" {
+		if s.LastModified != stored.LastModified {
+			return false
+		}
+		validated = true
+	}
+	if s.ContentLength >= 0 && stored.ContentLength >= 0 && s.ContentLength != stored.ContentLength {
+		return false
+	}
+	return validated
+}
+
+// storedMedia is the media object already uploaded for the episode.
+// Recorded in the episode's media_stored attribute once the media is
+// uploaded, so a retry does not download unchanged media again.
+type storedMedia struct {
+	Key         string `dynamodbav:"key"`
+	ContentType string `dynamodbav:"content_type"`
+	Size        int64  `dynamodbav:"size"`
+	SHA256      string `dynamodbav:"sha256"`
+
+	// Validators of the source media's response. SourceContentLength is -1
+	// if unknown.
+	SourceETag          string `dynamodbav:"source_etag,omitempty"`
+	SourceLastModified  string `dynamodbav:"source_last_modified,omitempty"`
+	SourceContentLength int64  `dynamodbav:"source_content_length"`
+}
+
+// source returns the validators of the source media the object was
+// uploaded from.
+func (s storedMedia) source() mediaSource {
+	return mediaSource{
+		ETag:          s.SourceETag,
+		LastModified:  s.SourceLastModified,
+		ContentLength: s.SourceContentLength,
+	}
+}
+
+// recordStoredMedia records the episode's uploaded media, and the validators
+// of the source media it was uploaded from, in the episode's item. Errors
+// are logged, the record only prevents unchanged media being downloaded
+// again.
+func (h *Handler) recordStoredMedia(ctx context.Context, episode workshop.Episode, source mediaSource) {
+	if h.EpisodeTableName == "" {
+		return
+	}
+
+	stored := storedMedia{
+		Key:                 episode.MediaKey,
+		ContentType:         episode.MediaContentType,
+		Size:                episode.MediaSize,
+		SHA256:              episode.MediaSHA256,
+		SourceETag:          source.ETag,
+		SourceLastModified:  source.LastModified,
+		SourceContentLength: source.ContentLength,
+	}
+	exp, err := ddbexp.NewBuilder().
+		WithUpdate(ddbexp.Set(ddbexp.Name("media_stored"), ddbexp.Value(stored))).
+		WithCondition(ddbexp.AttributeExists(ddbexp.Name("id"))).
+		Build()
+	if err != nil {
+		log.Printf("ERROR: failed to build update expression, %v", err)
+		return
+	}
+
+	_, err = h.DDBClient.UpdateItem(ctx, &ddb.UpdateItemInput{
+		TableName:                 &h.EpisodeTableName,
+		Key:                       episode.AttributeValuePrimaryKey(),
+		UpdateExpression:          exp.Update(),
+		ConditionExpression:       exp.Condition(),
+		ExpressionAttributeNames:  exp.Names(),
+		ExpressionAttributeValues: exp.Values(),
+	})
+	if err != nil {
+		log.Printf("ERROR: failed to record episode %v stored media, %v", episode.ID, err)
+	}
+}
+
+// getStoredMedia returns the media object already uploaded to the episode's
+// media key, or nil if there is none. The object must still exist, and be
+// the size recorded.
+func (h *Handler) getStoredMedia(ctx context.Context, episode workshop.Episode) (*storedMedia, error) {
+	if h.EpisodeTableName == "" {
+		return nil, nil
+	}
+
+	exp, err := ddbexp.NewBuilder().WithProjection(
+		ddbexp.NamesList(ddbexp.Name("media_stored")),
+	).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build projection expression, %w", err)
+	}
+
+	resp, err := h.DDBClient.GetItem(ctx, &ddb.GetItemInput{
+		TableName:                &h.EpisodeTableName,
+		Key:                      workshop.Episode{ID: episode.ID}.AttributeValuePrimaryKey(),
+		ProjectionExpression:     exp.Projection(),
+		ExpressionAttributeNames: exp.Names(),
+		ConsistentRead:           aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stored media, %w", err)
+	}
+
+	var item struct {
+		MediaStored *storedMedia `dynamodbav:"media_stored"`
+	}
+	if err := ddbav.UnmarshalMap(resp.Item, &item); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal stored media, %w", err)
+	}
+	stored := item.MediaStored
+	if stored == nil || stored.Key != episode.MediaKey || stored.SHA256 == "" {
+		return nil, nil
+	}
+
+	headResp, err := h.S3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: &h.BucketName,
+		Key:    &stored.Key,
+	})
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NotFound" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get stored media %v, %w", stored.Key, err)
+	}
+	if headResp.ContentLength != stored.Size {
+		log.Printf("stored media %v size %v, expected %v", stored.Key, headResp.ContentLength, stored.Size)
+		return nil, nil
+	}
+
+	return stored, nil
+}
+
+// headMediaSource returns the validators of the media at the URL, without
+// downloading the media.
+func (h *Handler) headMediaSource(ctx context.Context, mediaURL string) (mediaSource, error) {
+	req, err := http.NewRequestWithContext(ctx, "HEAD", mediaURL, nil)
+	if err != nil {
+		return mediaSource{}, err
+	}
+
+	resp, err := h.HTTPClient.Do(req)
+	if err != nil {
+		return mediaSource{}, fmt.Errorf("failed to make HEAD request for media, %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return mediaSource{}, fmt.Errorf("failed to HEAD media, status %v", resp.StatusCode)
+	}
+	return newMediaSource(resp), nil
+}
+
+// unchangedStoredMedia returns the media already uploaded for the episode,
+// if the source media is unchanged since it was uploaded. Otherwise nil is
+// returned, and the media should be downloaded. Errors checking the media
+// are logged, and the media is downloaded again.
+func (h *Handler) unchangedStoredMedia(ctx context.Context, episode workshop.Episode) *storedMedia {
+	stored, err := h.getStoredMedia(ctx, episode)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		return nil
+	}
+	if stored == nil {
+		return nil
+	}
+
+	source, err := h.headMediaSource(ctx, episode.MediaURL)
+	if err != nil {
+		log.Printf("unable to check if media changed, %v", err)
+		return nil
+	}
+	if !source.unchanged(stored.source()) {
+		log.Printf("media changed since uploaded, %v", episode.MediaURL)
+		return nil
+	}
+	return stored
+}
@@ -2,6 +2,7 @@ package workshop
 
 import (
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
 	"net/http"
 	"strings"
@@ -29,6 +30,17 @@ func NewBadRequestErrorResponse(message string) (*events.APIGatewayV2HTTPRespons
 	})
 }
 
+// NewValidationErrorResponse returns an API gateway HTTP error response for
+// HTTP 400 BadRequest message, listing the errors of each invalid field of
+// the request.
+func NewValidationErrorResponse(errs FieldErrors) (*events.APIGatewayV2HTTPResponse, error) {
+	return NewJSONResponse(400, nil, ErrorMessageResponse{
+		Code:        "BadRequestError",
+		Message:     "BadRequestError: invalid request fields",
+		FieldErrors: errs,
+	})
+}
+
 // NewNotFoundErrorResponse returns an API gateway HTTP error response for
 // HTTP 404 NotFound message.
 func NewNotFoundErrorResponse(message string) (*events.APIGatewayV2HTTPResponse, error) {
@@ -76,9 +88,45 @@ func NewJSONResponse(status int, header http.Header, payload interface{}) (
 	}, nil
 }
 
+// NewXMLResponse constructs an API Gateway HTTP response value for the
+// parameters provided. Serializing the payload as a XML document in the
+// response. The Content-Type is application/xml, unless set in the header.
+func NewXMLResponse(status int, header http.Header, payload interface{}) (
+	*events.APIGatewayV2HTTPResponse, error,
+) {
+	body, err := xml.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		return nil,
+			fmt.Errorf("failed to serialize response, %w", err)
+	}
+	if header == nil {
+		header = http.Header{}
+	}
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", "application/xml")
+	}
+
+	headers := map[string]string{}
+	for k, vs := range header {
+		if len(vs) == 0 {
+			continue
+		}
+		headers[strings.ToLower(k)] = vs[0]
+	}
+	return &events.APIGatewayV2HTTPResponse{
+		StatusCode: status,
+		Headers:    headers,
+		Body:       xml.Header + string(body),
+	}, nil
+}
+
 // ErrorMessageResponse provides the structured message for API errors sent
 // to the client.
 type ErrorMessageResponse struct {
 	Code    string `json:"Code"`
 	Message string `json:"Message"`
+
+	// Errors of each invalid field of the request, if the request failed
+	// validation.
+	FieldErrors FieldErrors `json:"FieldErrors,omitempty"`
 }
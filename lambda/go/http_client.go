@@ -0,0 +1,273 @@
+package workshop
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Defaults of the HTTPClientOptions.
+const (
+	DefaultHTTPMaxRedirects   = 5
+	DefaultHTTPConnectTimeout = 5 * time.Second
+	DefaultHTTPReadTimeout    = 30 * time.Second
+)
+
+// HTTPClientOptions provides the options of the HTTP client returned by
+// NewHTTPClient.
+type HTTPClientOptions struct {
+	// Hosts requests are allowed to even if the host's addresses are blocked,
+	// e.g. an internal feed host. Matched against the request's host name,
+	// or IP address, case insensitively.
+	AllowedHosts []string
+
+	// Maximum number of redirects followed. Defaults to 5 if 0. If less than
+	// 0 redirects are not followed, and the redirect response is returned.
+	MaxRedirects int
+
+	// Maximum time to connect, defaults to 5 seconds if 0.
+	ConnectTimeout time.Duration
+
+	// Maximum time to wait for the response's headers, and between reads of
+	// the response's body. Defaults to 30 seconds if 0.
+	ReadTimeout time.Duration
+}
+
+func (o HTTPClientOptions) withDefaults() HTTPClientOptions {
+	if o.MaxRedirects == 0 {
+		o.MaxRedirects = DefaultHTTPMaxRedirects
+	}
+	if o.ConnectTimeout == 0 {
+		o.ConnectTimeout = DefaultHTTPConnectTimeout
+	}
+	if o.ReadTimeout == 0 {
+		o.ReadTimeout = DefaultHTTPReadTimeout
+	}
+	return o
+}
+
+// BlockedAddressError is the error returned when a request's host resolves
+// to an address requests are not allowed to, e.g. a private, loopback, or
+// the instance metadata service's address.
+type BlockedAddressError struct {
+	Host string
+	IP   net.IP
+}
+
+func (e *BlockedAddressError) Error() string {
+	return fmt.Sprintf("requests to %v are not allowed, address %v is blocked", e.Host, e.IP)
+}
+
+// NewHTTPClient returns an HTTP client for fetching user provided URLs, such
+// as podcast feeds and media. Only http and https requests are allowed, and
+// connections to private, loopback, link-local, and metadata service
+// addresses are blocked unless the host is allowed. Addresses are checked
+// after the host is resolved, when connecting, so redirects, and hosts
+// resolving to different addresses are checked too.
+//
+// Proxies are not used, because the proxy's address would be checked
+// instead of the request's host.
+func NewHTTPClient(opts HTTPClientOptions) *http.Client {
+	opts = opts.withDefaults()
+
+	allowed := map[string]bool{}
+	for _, host := range opts.AllowedHosts {
+		if host = strings.TrimSpace(host); host != "" {
+			allowed[strings.ToLower(host)] = true
+		}
+	}
+
+	dialer := &safeDialer{
+		dialer: &net.Dialer{
+			Timeout:   opts.ConnectTimeout,
+			KeepAlive: 30 * time.Second,
+		},
+		resolver:    net.DefaultResolver,
+		allowed:     allowed,
+		readTimeout: opts.ReadTimeout,
+	}
+
+	transport := &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   opts.ConnectTimeout,
+		ResponseHeaderTimeout: opts.ReadTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+
+	return &http.Client{
+		Transport: schemeCheckTransport{transport},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if opts.MaxRedirects < 0 {
+				return http.ErrUseLastResponse
+			}
+			if len(via) > opts.MaxRedirects {
+				return fmt.Errorf("stopped after %v redirects", opts.MaxRedirects)
+			}
+			return checkHTTPScheme(req)
+		},
+	}
+}
+
+// schemeCheckTransport only allows http and https requests.
+type schemeCheckTransport struct {
+	http.RoundTripper
+}
+
+func (t schemeCheckTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := checkHTTPScheme(req); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return t.RoundTripper.RoundTrip(req)
+}
+
+func checkHTTPScheme(req *http.Request) error {
+	switch req.URL.Scheme {
+	case "http", "https":
+		return nil
+	default:
+		return fmt.Errorf("unsupported URL scheme %q, must be http or https", req.URL.Scheme)
+	}
+}
+
+// safeDialer resolves the host, and only connects to the host's addresses
+// that are not blocked. Hosts that are allowed are connected to without
+// checking their addresses.
+type safeDialer struct {
+	dialer      *net.Dialer
+	resolver    *net.Resolver
+	allowed     map[string]bool
+	readTimeout time.Duration
+}
+
+func (d *safeDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.allowed[strings.ToLower(host)] {
+		return d.dial(ctx, network, address)
+	}
+
+	ips, err := d.resolver.LookupIP(ctx, ipNetwork(network), host)
+	if err != nil {
+		return nil, err
+	}
+
+	// Connect to the addresses resolved, not the host, so the host cannot
+	// resolve to a different address after it is checked.
+	var dialErr error
+	for _, ip := range ips {
+		if isBlockedIP(ip) {
+			if dialErr == nil {
+				dialErr = &BlockedAddressError{Host: host, IP: ip}
+			}
+			continue
+		}
+		conn, err := d.dial(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		dialErr = err
+	}
+	if dialErr == nil {
+		dialErr = fmt.Errorf("no addresses found for %v", host)
+	}
+	return nil, dialErr
+}
+
+func (d *safeDialer) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := d.dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	return &readTimeoutConn{Conn: conn, timeout: d.readTimeout}, nil
+}
+
+// ipNetwork returns the IP network to resolve addresses for, for the dialed
+// network.
+func ipNetwork(network string) string {
+	switch network {
+	case "tcp4", "udp4":
+		return "ip4"
+	case "tcp6", "udp6":
+		return "ip6"
+	default:
+		return "ip"
+	}
+}
+
+// readTimeoutConn fails reads that do not complete within the timeout.
+type readTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *readTimeoutConn) Read(p []byte) (int, error) {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(p)
+}
+
+// blockedNetworks are the networks not covered by the net.IP methods that
+// requests are not allowed to.
+var blockedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",       // "This" network
+	"100.64.0.0/10",   // Shared address space, carrier-grade NAT
+	"192.0.0.0/24",    // IETF protocol assignments
+	"192.0.2.0/24",    // Documentation, TEST-NET-1
+	"198.18.0.0/15",   // Benchmarking
+	"198.51.100.0/24", // Documentation, TEST-NET-2
+	"203.0.113.0/24",  // Documentation, TEST-NET-3
+	"240.0.0.0/4",     // Reserved
+	"64:ff9b::/96",    // IPv4/IPv6 translation
+	"2001::/32",       // Teredo, tunnels to an embedded IPv4 address
+	"2001:db8::/32",   // Documentation
+	"2002::/16",       // 6to4, tunnels to an embedded IPv4 address
+)
+
+// isBlockedIP returns if requests are not allowed to the address. Private,
+// loopback, link-local, which includes the instance metadata service's
+// 169.254.169.254, multicast, and reserved addresses are blocked.
+func isBlockedIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return true
+	}
+	if ip.Equal(net.IPv4bcast) {
+		return true
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(fmt.Sprintf("invalid CIDR %v, %v", cidr, err))
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
@@ -0,0 +1,40 @@
+package workshop
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsBlockedIP(t *testing.T) {
+	cases := map[string]struct {
+		IP     string
+		Expect bool
+	}{
+		"public v4":             {IP: "93.184.216.34"},
+		"public v6":             {IP: "2606:2800:220:1:248:1893:25c8:1946"},
+		"loopback":              {IP: "127.0.0.1", Expect: true},
+		"private":               {IP: "10.1.2.3", Expect: true},
+		"instance metadata":     {IP: "169.254.169.254", Expect: true},
+		"carrier-grade nat":     {IP: "100.64.0.1", Expect: true},
+		"v4 mapped loopback":    {IP: "::ffff:127.0.0.1", Expect: true},
+		"v6 loopback":           {IP: "::1", Expect: true},
+		"unique local":          {IP: "fd00::1", Expect: true},
+		"nat64":                 {IP: "64:ff9b::a9fe:a9fe", Expect: true},
+		"6to4 metadata":         {IP: "2002:a9fe:a9fe::1", Expect: true},
+		"teredo":                {IP: "2001:0:4136:e378:8000:63bf:3fff:fdd2", Expect: true},
+		"documentation v6":      {IP: "2001:db8::1", Expect: true},
+		"global unicast 2001::": {IP: "2001:4860:4860::8888"},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			ip := net.ParseIP(c.IP)
+			if ip == nil {
+				t.Fatalf("invalid IP %v", c.IP)
+			}
+			if e, a := c.Expect, isBlockedIP(ip); e != a {
+				t.Errorf("expect %v blocked %v, got %v", c.IP, e, a)
+			}
+		})
+	}
+}
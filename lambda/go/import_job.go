@@ -0,0 +1,137 @@
+package workshop
+
+import (
+	"time"
+
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ImportJob provides the structure for storing an asynchronous import of
+// podcast episodes in Amazon DynamoDB. The job is created by the add-podcasts
+// Lambda, and run by the import-worker Lambda when the job's item is
+// inserted.
+type ImportJob struct {
+	ID     string          `json:"id" dynamodbav:"id"`
+	Status ImportJobStatus `json:"status" dynamodbav:"status"`
+
+	// Add podcasts request body of the import, JSON encoded.
+	Request string `json:"-" dynamodbav:"request"`
+
+	CreatedAt   string `json:"created_at" dynamodbav:"created_at"`
+	UpdatedAt   string `json:"updated_at,omitempty" dynamodbav:"updated_at,omitempty"`
+	ClaimedAt   string `json:"claimed_at,omitempty" dynamodbav:"claimed_at,omitempty"`
+	CompletedAt string `json:"completed_at,omitempty" dynamodbav:"completed_at,omitempty"`
+
+	// Time the running job's claim expires, in Unix epoch seconds. A worker
+	// stopped before the job finished, e.g. crashed, leaves the job running.
+	// Once the claim expires, the job can be claimed by a retry.
+	LeaseExpiresAt int64 `json:"-" dynamodbav:"lease_expires_at,omitempty"`
+
+	// Time the job's item expires, and is deleted by the table's TTL, in Unix
+	// epoch seconds.
+	ExpiresAt int64 `json:"-" dynamodbav:"expires_at,omitempty"`
+
+	Progress ImportJobProgress `json:"progress" dynamodbav:"progress"`
+
+	// Outcome of each episode imported, and each feed imported, updated when
+	// the job is finished. Error is set if the job failed.
+	Message string          `json:"message,omitempty" dynamodbav:"message,omitempty"`
+	Results []EpisodeResult `json:"results,omitempty" dynamodbav:"results,omitempty"`
+	Feeds   []ImportJobFeed `json:"feeds,omitempty" dynamodbav:"feeds,omitempty"`
+	Error   string          `json:"error,omitempty" dynamodbav:"error,omitempty"`
+
+	// Number of results, and feeds, not recorded to keep the job's item
+	// within the DynamoDB item size limit. Progress counts every episode.
+	ResultsOmitted int `json:"results_omitted,omitempty" dynamodbav:"results_omitted,omitempty"`
+	FeedsOmitted   int `json:"feeds_omitted,omitempty" dynamodbav:"feeds_omitted,omitempty"`
+}
+
+// LeaseExpired returns if the job is running, but its claim has expired,
+// i.e. the worker running the job stopped before the job finished.
+func (j ImportJob) LeaseExpired(now time.Time) bool {
+	return j.Status == ImportJobStatusRunning && j.LeaseExpiresAt != 0 &&
+		now.Unix() >= j.LeaseExpiresAt
+}
+
+// AttributeValuePrimaryKey returns the DynamoDB key for the import job.
+func (j ImportJob) AttributeValuePrimaryKey() map[string]ddbtypes.AttributeValue {
+	return map[string]ddbtypes.AttributeValue{
+		"id": &ddbtypes.AttributeValueMemberS{Value: j.ID},
+	}
+}
+
+// ImportJobStatus provides the enumeration of import job statuses.
+type ImportJobStatus string
+
+// Enumeration of import job statuses.
+const (
+	ImportJobStatusQueued   ImportJobStatus = "queued"
+	ImportJobStatusRunning  ImportJobStatus = "running"
+	ImportJobStatusComplete ImportJobStatus = "complete"
+	ImportJobStatusFailed   ImportJobStatus = "failed"
+)
+
+// ImportJobProgress provides the counters of episodes imported by a job.
+// Total is the number of episodes found so far, and Done the number with an
+// outcome.
+type ImportJobProgress struct {
+	Total            int `json:"total" dynamodbav:"total"`
+	Done             int `json:"done" dynamodbav:"done"`
+	Started          int `json:"started" dynamodbav:"started"`
+	SkippedDuplicate int `json:"skipped_duplicate" dynamodbav:"skipped_duplicate"`
+	SkippedNoMedia   int `json:"skipped_no_media" dynamodbav:"skipped_no_media"`
+	Failed           int `json:"failed" dynamodbav:"failed"`
+}
+
+// Add counts the episode's outcome.
+func (p *ImportJobProgress) Add(outcome EpisodeOutcome) {
+	p.Done++
+	switch outcome {
+	case EpisodeOutcomeStarted:
+		p.Started++
+	case EpisodeOutcomeSkippedDuplicate:
+		p.SkippedDuplicate++
+	case EpisodeOutcomeSkippedNoMedia:
+		p.SkippedNoMedia++
+	case EpisodeOutcomeFailed:
+		p.Failed++
+	}
+}
+
+// ImportJobFeed is the result of importing a feed in an import job. Error is
+// set if the feed's episodes could not be imported.
+type ImportJobFeed struct {
+	Title       string `json:"title,omitempty" dynamodbav:"title,omitempty"`
+	URL         string `json:"url" dynamodbav:"url"`
+	NumEpisodes int    `json:"num_episodes" dynamodbav:"num_episodes"`
+	Error       string `json:"error,omitempty" dynamodbav:"error,omitempty"`
+}
+
+// EpisodeOutcome is the outcome of adding an episode.
+type EpisodeOutcome string
+
+// Enumeration of episode outcomes.
+const (
+	// Episode was recorded, and its transcribe started.
+	EpisodeOutcomeStarted EpisodeOutcome = "started"
+
+	// Episode was already imported, and has not failed.
+	EpisodeOutcomeSkippedDuplicate EpisodeOutcome = "skipped-duplicate"
+
+	// Episode was recorded as complete, because it has no media to
+	// transcribe.
+	EpisodeOutcomeSkippedNoMedia EpisodeOutcome = "skipped-no-media"
+
+	// Episode was recorded, but its transcribe could not be started. The
+	// episode's status is failed, so it can be imported again.
+	EpisodeOutcomeFailed EpisodeOutcome = "failed"
+)
+
+// EpisodeResult is the outcome of adding an episode. Error is the reason the
+// episode failed.
+type EpisodeResult struct {
+	ID      string         `json:"id" dynamodbav:"id"`
+	Title   string         `json:"title,omitempty" dynamodbav:"title,omitempty"`
+	Outcome EpisodeOutcome `json:"outcome" dynamodbav:"outcome"`
+	Error   string         `json:"error,omitempty" dynamodbav:"error,omitempty"`
+}
@@ -0,0 +1,266 @@
+package local
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/smithy-go/rand"
+)
+
+// APIGatewayV2HTTPHandler is the signature of the Lambda handlers invoked by
+// the API Gateway HTTP API routes.
+type APIGatewayV2HTTPHandler func(context.Context, events.APIGatewayV2HTTPRequest) (
+	*events.APIGatewayV2HTTPResponse, error,
+)
+
+// APIGatewayV2Router is a net/http handler that translates HTTP requests into
+// API Gateway HTTP API version 2.0 payload events, invokes the Lambda handler
+// of the matching route, and writes the handler's response back to the client.
+type APIGatewayV2Router struct {
+	routes []apiGatewayV2Route
+}
+
+type apiGatewayV2Route struct {
+	method   string
+	path     string
+	segments []string
+	handler  APIGatewayV2HTTPHandler
+}
+
+// NewAPIGatewayV2Router returns a router without any routes.
+func NewAPIGatewayV2Router() *APIGatewayV2Router {
+	return &APIGatewayV2Router{}
+}
+
+// Handle adds a route for the HTTP method and path. Path segments wrapped in
+// braces, e.g. /podcast/{id}, are path parameters matching any segment value.
+func (r *APIGatewayV2Router) Handle(method, path string, handler APIGatewayV2HTTPHandler) {
+	r.routes = append(r.routes, apiGatewayV2Route{
+		method:   strings.ToUpper(method),
+		path:     path,
+		segments: splitPath(path),
+		handler:  handler,
+	})
+}
+
+func (r *APIGatewayV2Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	route, pathParams, ok := r.match(req.Method, req.URL.Path)
+	if !ok {
+		writeAPIGatewayV2Message(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	event, err := newAPIGatewayV2HTTPRequest(req, route, pathParams)
+	if err != nil {
+		log.Printf("ERROR: failed to build API Gateway request event, %v", err)
+		writeAPIGatewayV2Message(w, http.StatusBadRequest, "Bad Request")
+		return
+	}
+
+	resp, err := route.handler(req.Context(), event)
+	if err != nil {
+		// API Gateway responds with a generic error if the Lambda handler
+		// fails, the error is only visible in the handler's logs.
+		log.Printf("ERROR: %v %v handler failed, %v", route.method, route.path, err)
+		writeAPIGatewayV2Message(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	if err := writeAPIGatewayV2HTTPResponse(w, resp); err != nil {
+		log.Printf("ERROR: invalid %v %v handler response, %v", route.method, route.path, err)
+		writeAPIGatewayV2Message(w, http.StatusInternalServerError, "Internal Server Error")
+	}
+}
+
+func (r *APIGatewayV2Router) match(method, path string) (apiGatewayV2Route, map[string]string, bool) {
+	segments := splitPath(path)
+
+	for _, route := range r.routes {
+		if route.method != method || len(route.segments) != len(segments) {
+			continue
+		}
+
+		params := map[string]string{}
+		matched := true
+		for i, s := range route.segments {
+			if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+				if segments[i] == "" {
+					matched = false
+					break
+				}
+				params[s[1:len(s)-1]] = segments[i]
+				continue
+			}
+			if s != segments[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return route, params, true
+		}
+	}
+
+	return apiGatewayV2Route{}, nil, false
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// newAPIGatewayV2HTTPRequest returns the event API Gateway would send to the
+// Lambda handler for the request. Headers are lower cased, and repeated
+// headers and query parameters are combined with commas.
+func newAPIGatewayV2HTTPRequest(req *http.Request, route apiGatewayV2Route, pathParams map[string]string) (
+	events.APIGatewayV2HTTPRequest, error,
+) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return events.APIGatewayV2HTTPRequest{}, fmt.Errorf("failed to read request body, %w", err)
+	}
+
+	headers := map[string]string{}
+	var cookies []string
+	for k, vs := range req.Header {
+		if strings.EqualFold(k, "Cookie") {
+			for _, v := range vs {
+				for _, c := range strings.Split(v, ";") {
+					if c = strings.TrimSpace(c); c != "" {
+						cookies = append(cookies, c)
+					}
+				}
+			}
+			continue
+		}
+		headers[strings.ToLower(k)] = strings.Join(vs, ",")
+	}
+	if req.Host != "" {
+		headers["host"] = req.Host
+	}
+
+	sourceIP := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		sourceIP = host
+	}
+
+	// API Gateway adds the forwarded headers for the client connection.
+	headers["x-forwarded-for"] = sourceIP
+	headers["x-forwarded-proto"] = "http"
+	if req.TLS != nil {
+		headers["x-forwarded-proto"] = "https"
+	}
+
+	var queryParams map[string]string
+	if query := req.URL.Query(); len(query) != 0 {
+		queryParams = make(map[string]string, len(query))
+		for k, vs := range query {
+			queryParams[k] = strings.Join(vs, ",")
+		}
+	}
+	if len(pathParams) == 0 {
+		pathParams = nil
+	}
+
+	requestID, err := rand.NewUUID(rand.Reader).GetUUID()
+	if err != nil {
+		return events.APIGatewayV2HTTPRequest{}, fmt.Errorf("failed to get request ID, %w", err)
+	}
+
+	now := time.Now().UTC()
+	routeKey := route.method + " " + route.path
+	event := events.APIGatewayV2HTTPRequest{
+		Version:               "2.0",
+		RouteKey:              routeKey,
+		RawPath:               req.URL.EscapedPath(),
+		RawQueryString:        req.URL.RawQuery,
+		Cookies:               cookies,
+		Headers:               headers,
+		QueryStringParameters: queryParams,
+		PathParameters:        pathParams,
+		RequestContext: events.APIGatewayV2HTTPRequestContext{
+			RouteKey:   routeKey,
+			AccountID:  "anonymous",
+			Stage:      "$default",
+			RequestID:  requestID,
+			APIID:      "local",
+			DomainName: req.Host,
+			Time:       now.Format("02/Jan/2006:15:04:05 -0700"),
+			TimeEpoch:  now.UnixNano() / int64(time.Millisecond),
+			HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{
+				Method:    req.Method,
+				Path:      req.URL.Path,
+				Protocol:  req.Proto,
+				SourceIP:  sourceIP,
+				UserAgent: req.UserAgent(),
+			},
+		},
+	}
+	if len(body) != 0 {
+		if utf8.Valid(body) {
+			event.Body = string(body)
+		} else {
+			event.Body = base64.StdEncoding.EncodeToString(body)
+			event.IsBase64Encoded = true
+		}
+	}
+
+	return event, nil
+}
+
+func writeAPIGatewayV2HTTPResponse(w http.ResponseWriter, resp *events.APIGatewayV2HTTPResponse) error {
+	if resp == nil {
+		resp = &events.APIGatewayV2HTTPResponse{}
+	}
+
+	body := []byte(resp.Body)
+	if resp.IsBase64Encoded {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(resp.Body); err != nil {
+			return fmt.Errorf("failed to decode base64 response body, %w", err)
+		}
+	}
+
+	header := w.Header()
+	for k, vs := range resp.MultiValueHeaders {
+		for _, v := range vs {
+			header.Add(k, v)
+		}
+	}
+	for k, v := range resp.Headers {
+		header.Set(k, v)
+	}
+	for _, c := range resp.Cookies {
+		header.Add("Set-Cookie", c)
+	}
+
+	status := resp.StatusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	if _, err := w.Write(body); err != nil {
+		log.Printf("failed to write response body, %v", err)
+	}
+	return nil
+}
+
+// writeAPIGatewayV2Message writes the JSON message body API Gateway responds
+// with for errors not produced by a Lambda handler.
+func writeAPIGatewayV2Message(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "{\"message\":%q}", message)
+}
@@ -0,0 +1,141 @@
+package local
+
+import (
+	workshop "aws-workshop"
+	"aws-workshop/fakes"
+	"aws-workshop/handlers/checktranscription"
+	"aws-workshop/handlers/processtranscription"
+	"aws-workshop/handlers/starttranscription"
+	"aws-workshop/handlers/updateepisodestatus"
+	"aws-workshop/handlers/uploadpodcast"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/rand"
+)
+
+// Default resource names used by the in-memory services if the EnvConfig does
+// not provide them.
+const (
+	InMemoryEpisodeTableName          = "PodcastEpisode"
+	InMemoryPodcastIndexName          = "podcast-published"
+	InMemoryStatusIndexName           = "status-published"
+	InMemoryFeedTableName             = "PodcastFeed"
+	InMemoryImportJobTableName        = "PodcastImportJob"
+	InMemoryQuotaTableName            = "PodcastQuota"
+	InMemoryDataBucketName            = "podcast-data"
+	InMemoryTranscribeStateMachineARN = "arn:aws:states:us-west-2:123456789012:stateMachine:TranscribeStateMachine"
+
+	InMemoryRegion        = "us-west-2"
+	inMemoryS3EndpointURL = "https://s3.localhost"
+)
+
+// InMemoryServices are in-memory fakes of the AWS services used by the Lambda
+// handlers. Handlers created with the same InMemoryServices share state.
+type InMemoryServices struct {
+	DynamoDB      *fakes.DynamoDB
+	S3            *fakes.S3
+	StepFunctions *fakes.StepFunctions
+	Transcribe    *fakes.Transcribe
+}
+
+// NewInMemoryServices returns in-memory services with the episode, feed,
+// import job, and quota tables, and data bucket of the EnvConfig created. The episode
+// table has the podcast and status indexes. Resource names not set in the
+// EnvConfig are updated to the in-memory defaults.
+func NewInMemoryServices(envCfg *workshop.EnvConfig) *InMemoryServices {
+	if envCfg.PodcastEpisodeTableName == "" {
+		envCfg.PodcastEpisodeTableName = InMemoryEpisodeTableName
+	}
+	if envCfg.PodcastIndexName == "" {
+		envCfg.PodcastIndexName = InMemoryPodcastIndexName
+	}
+	if envCfg.StatusIndexName == "" {
+		envCfg.StatusIndexName = InMemoryStatusIndexName
+	}
+	if envCfg.PodcastFeedTableName == "" {
+		envCfg.PodcastFeedTableName = InMemoryFeedTableName
+	}
+	if envCfg.ImportJobTableName == "" {
+		envCfg.ImportJobTableName = InMemoryImportJobTableName
+	}
+	if envCfg.QuotaTableName == "" {
+		envCfg.QuotaTableName = InMemoryQuotaTableName
+	}
+	if envCfg.PodcastDataBucketName == "" {
+		envCfg.PodcastDataBucketName = InMemoryDataBucketName
+	}
+	if envCfg.TranscribeStateMachineARN == "" {
+		envCfg.TranscribeStateMachineARN = InMemoryTranscribeStateMachineARN
+	}
+
+	ddbClient := fakes.NewDynamoDB()
+	ddbClient.CreateTable(envCfg.PodcastEpisodeTableName, "id", "")
+	ddbClient.CreateGlobalSecondaryIndex(envCfg.PodcastEpisodeTableName,
+		envCfg.PodcastIndexName, "podcast", "published_at")
+	ddbClient.CreateGlobalSecondaryIndex(envCfg.PodcastEpisodeTableName,
+		envCfg.StatusIndexName, "status", "published_at")
+	ddbClient.CreateTable(envCfg.PodcastFeedTableName, "url", "")
+	ddbClient.CreateTable(envCfg.ImportJobTableName, "id", "")
+	ddbClient.CreateTable(envCfg.QuotaTableName, "id", "")
+	s3Client := fakes.NewS3(envCfg.PodcastDataBucketName)
+
+	return &InMemoryServices{
+		DynamoDB:      ddbClient,
+		S3:            s3Client,
+		StepFunctions: fakes.NewStepFunctions(),
+		Transcribe:    fakes.NewTranscribe(s3Client),
+	}
+}
+
+// TranscribeStateMachine returns a state machine with the handlers using the
+// in-memory services. Podcast media is still downloaded from the episode's
+// media URL.
+func (s *InMemoryServices) TranscribeStateMachine(envCfg workshop.EnvConfig) *TranscribeStateMachine {
+	return &TranscribeStateMachine{
+		UpdateEpisodeStatus: &updateepisodestatus.Handler{
+			DDBClient:        s.DynamoDB,
+			S3Client:         s.S3,
+			EpisodeTableName: envCfg.PodcastEpisodeTableName,
+			BucketName:       envCfg.PodcastDataBucketName,
+		},
+		UploadPodcast: &uploadpodcast.Handler{
+			HTTPClient:     workshop.NewHTTPClient(envCfg.HTTPClientOptions()),
+			S3Uploader:     s.S3,
+			S3Client:       s.S3,
+			DDBClient:      s.DynamoDB,
+			BucketName:     envCfg.PodcastDataBucketName,
+			MediaKeyPrefix: envCfg.PodcastDataKeyPrefix,
+
+			EpisodeTableName: envCfg.PodcastEpisodeTableName,
+			QuotaTableName:   envCfg.QuotaTableName,
+			Quotas:           envCfg.MediaQuotas(),
+		},
+		StartTranscription: &starttranscription.Handler{
+			S3EndpointResolver: s3.EndpointResolverFromURL(inMemoryS3EndpointURL),
+			Region:             InMemoryRegion,
+			TranscribeClient:   s.Transcribe,
+			BucketAccessRole:   envCfg.TranscribeAccessRoleARN,
+			BucketName:         envCfg.PodcastDataBucketName,
+			MediaKeyPrefix:     envCfg.PodcastDataKeyPrefix,
+			DDBClient:          s.DynamoDB,
+
+			EpisodeTableName: envCfg.PodcastEpisodeTableName,
+			QuotaTableName:   envCfg.QuotaTableName,
+			Quotas:           envCfg.MediaQuotas(),
+
+			UUIDProvider: rand.NewUUID(rand.Reader),
+		},
+		CheckTranscription: &checktranscription.Handler{
+			TranscribeClient: s.Transcribe,
+		},
+		ProcessTranscription: &processtranscription.Handler{
+			S3Uploader:   s.S3,
+			S3Downloader: s.S3,
+			DDBClient:    s.DynamoDB,
+
+			BucketName:       envCfg.PodcastDataBucketName,
+			MediaKeyPrefix:   envCfg.PodcastDataKeyPrefix,
+			EpisodeTableName: envCfg.PodcastEpisodeTableName,
+		},
+	}
+}
@@ -0,0 +1,248 @@
+// Package local provides utilities for running the workshop's Lambda
+// handlers on the local host, without deploying them to AWS.
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"time"
+
+	workshop "aws-workshop"
+	"aws-workshop/handlers/checktranscription"
+	"aws-workshop/handlers/processtranscription"
+	"aws-workshop/handlers/starttranscription"
+	"aws-workshop/handlers/updateepisodestatus"
+	"aws-workshop/handlers/uploadpodcast"
+)
+
+// TranscribeStateMachine mirrors the states, transitions, and catch behavior
+// of the TranscribeStateMachine construct in lib/transcribe-statemachine.ts,
+// but invokes the Lambda handlers in-process instead of through AWS Step
+// Functions.
+type TranscribeStateMachine struct {
+	UpdateEpisodeStatus  *updateepisodestatus.Handler
+	UploadPodcast        *uploadpodcast.Handler
+	StartTranscription   *starttranscription.Handler
+	CheckTranscription   *checktranscription.Handler
+	ProcessTranscription *processtranscription.Handler
+
+	// Amount of time to wait between checks of the transcription job status.
+	TranscribeWait time.Duration
+
+	// Amount of time to wait before the first retry of the upload step while
+	// its media upload is incomplete. Defaults to the step's retry interval
+	// if 0.
+	UploadRetryInterval time.Duration
+}
+
+// Retry of the upload step while its media upload is incomplete, the same as
+// the UploadPodcastStep's retry in lib/transcribe-statemachine.ts. The wait
+// between retries is multiplied by the backoff rate after each retry.
+const (
+	uploadRetryInterval    = 1 * time.Second
+	uploadRetryMaxAttempts = 5
+	uploadRetryBackoffRate = 2
+)
+
+// ExecutionState is the JSON document passed between states of the state
+// machine. Fields match the paths the state machine definition reads and
+// writes.
+type ExecutionState struct {
+	Episode          workshop.Episode                `json:"episode"`
+	TranscribeStatus *checktranscription.OutputEvent `json:"transcribeStatus,omitempty"`
+	TaskFailed       *TaskFailure                    `json:"taskFailed,omitempty"`
+}
+
+// TaskFailure is the error output a Catch adds to the state when a Lambda task
+// fails.
+type TaskFailure struct {
+	Error string `json:"Error"`
+	Cause string `json:"Cause"`
+}
+
+// ExecutionFailedError is returned when the execution reaches the state
+// machine's Fail state.
+type ExecutionFailedError struct {
+	State ExecutionState
+}
+
+func (e *ExecutionFailedError) Error() string {
+	if e.State.TaskFailed != nil {
+		return fmt.Sprintf("execution failed for episode %v, %v",
+			e.State.Episode.ID, e.State.TaskFailed.Cause)
+	}
+	if e.State.TranscribeStatus != nil {
+		return fmt.Sprintf("execution failed for episode %v, transcription %v, %v",
+			e.State.Episode.ID, e.State.TranscribeStatus.Status,
+			e.State.TranscribeStatus.FailureReason)
+	}
+	return fmt.Sprintf("execution failed for episode %v", e.State.Episode.ID)
+}
+
+// Execute runs the state machine to completion for the input. Returns the
+// final state of the execution, and error if the execution did not succeed.
+func (m *TranscribeStateMachine) Execute(ctx context.Context, input workshop.TranscribeStateMachineInput) (
+	ExecutionState, error,
+) {
+	state := ExecutionState{Episode: input.Episode}
+
+	if err := m.updateStatus(ctx, &state, "Uploading"); err != nil {
+		return state, err
+	}
+
+	var uploadOutput *workshop.TranscribeStateMachineOutput
+	var err error
+	retryWait := m.UploadRetryInterval
+	if retryWait == 0 {
+		retryWait = uploadRetryInterval
+	}
+	for retry := 0; ; retry++ {
+		log.Println("state: UploadPodcastStep")
+		uploadOutput, err = m.UploadPodcast.Handle(ctx, workshop.TranscribeStateMachineInput{
+			Episode: state.Episode,
+		})
+		var incomplete *uploadpodcast.MediaUploadIncompleteError
+		if !errors.As(err, &incomplete) || retry == uploadRetryMaxAttempts {
+			break
+		}
+
+		log.Printf("retrying upload in %v, %v", retryWait, err)
+		select {
+		case <-ctx.Done():
+			return state, ctx.Err()
+		case <-time.After(retryWait):
+		}
+		retryWait *= uploadRetryBackoffRate
+	}
+	if err != nil {
+		return m.failure(ctx, state, err)
+	}
+	state.Episode = uploadOutput.Episode
+
+	if err := m.updateStatus(ctx, &state, "Transcribing"); err != nil {
+		return state, err
+	}
+
+	log.Println("state: StartTranscriptionStep")
+	startOutput, err := m.StartTranscription.Handle(ctx, workshop.TranscribeStateMachineInput{
+		Episode: state.Episode,
+	})
+	if err != nil {
+		return m.failure(ctx, state, err)
+	}
+	state.Episode = startOutput.Episode
+
+	for {
+		log.Println("state: CheckTranscriptionStep")
+		status, err := m.CheckTranscription.Handle(ctx, workshop.TranscribeStateMachineInput{
+			Episode: state.Episode,
+		})
+		if err != nil {
+			return m.failure(ctx, state, err)
+		}
+		state.TranscribeStatus = &status
+
+		log.Println("state: IsTranscribeComplete")
+		switch status.Status {
+		case "COMPLETED":
+			return m.processing(ctx, state)
+		case "FAILED":
+			return m.failure(ctx, state, nil)
+		}
+
+		log.Println("state: WaitForTranscription")
+		select {
+		case <-ctx.Done():
+			return state, ctx.Err()
+		case <-time.After(m.TranscribeWait):
+		}
+	}
+}
+
+func (m *TranscribeStateMachine) processing(ctx context.Context, state ExecutionState) (
+	ExecutionState, error,
+) {
+	if err := m.updateStatus(ctx, &state, "Processing"); err != nil {
+		return state, err
+	}
+
+	// The state machine discards the result of the process transcription step.
+	log.Println("state: ProcessTranscriptionStep")
+	_, err := m.ProcessTranscription.Handle(ctx, workshop.TranscribeStateMachineInput{
+		Episode: state.Episode,
+	})
+	if err != nil {
+		return m.failure(ctx, state, err)
+	}
+
+	if err := m.updateStatus(ctx, &state, "Complete"); err != nil {
+		return state, err
+	}
+
+	log.Println("state: Complete")
+	return state, nil
+}
+
+// failure records the task error, if any, in the state the same as the
+// state machine's catch does, and transitions to the failure states.
+func (m *TranscribeStateMachine) failure(ctx context.Context, state ExecutionState, taskErr error) (
+	ExecutionState, error,
+) {
+	if taskErr != nil {
+		log.Printf("task failed, %v", taskErr)
+		state.TaskFailed = newTaskFailure(taskErr)
+	}
+
+	if err := m.updateStatus(ctx, &state, "Failure"); err != nil {
+		return state, err
+	}
+
+	log.Println("state: Failure")
+	return state, &ExecutionFailedError{State: state}
+}
+
+// updateStatus invokes the update episode status handler with the same
+// payload as the state machine's UpdateStatus<status>Lambda states, and
+// stores the result at the episode's status. These states do not have a
+// catch, so an error fails the execution.
+func (m *TranscribeStateMachine) updateStatus(ctx context.Context, state *ExecutionState, status string) error {
+	log.Printf("state: UpdateStatus%vLambda", status)
+
+	result, err := m.UpdateEpisodeStatus.Handle(ctx, updateepisodestatus.InputEvent{
+		EpisodeID: state.Episode.ID,
+		Status:    strings.ToLower(status),
+	})
+	if err != nil {
+		return fmt.Errorf("update episode status %v failed, %w", status, err)
+	}
+	state.Episode.Status = workshop.EpisodeStatus(result)
+
+	return nil
+}
+
+// newTaskFailure returns the error output for a failed Lambda task in the
+// same shape Step Functions provides the Catch of a Lambda invoke task.
+func newTaskFailure(err error) *TaskFailure {
+	errType := reflect.TypeOf(err)
+	if errType.Kind() == reflect.Ptr {
+		errType = errType.Elem()
+	}
+
+	cause, _ := json.Marshal(struct {
+		ErrorMessage string `json:"errorMessage"`
+		ErrorType    string `json:"errorType"`
+	}{
+		ErrorMessage: err.Error(),
+		ErrorType:    errType.Name(),
+	})
+
+	return &TaskFailure{
+		Error: errType.Name(),
+		Cause: string(cause),
+	}
+}
@@ -0,0 +1,50 @@
+package workshop
+
+import "encoding/xml"
+
+// OPML provides the structure of an OPML 2.0 document listing podcast feed
+// subscriptions.
+type OPML struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    OPMLHead `xml:"head"`
+	Body    OPMLBody `xml:"body"`
+}
+
+type OPMLHead struct {
+	Title       string `xml:"title,omitempty"`
+	DateCreated string `xml:"dateCreated,omitempty"`
+}
+
+type OPMLBody struct {
+	Outlines []OPMLOutline `xml:"outline"`
+}
+
+// OPMLOutline is an outline of an OPML document. Outlines of feeds have the
+// feed's URL in XMLURL. Other outlines group the outlines they contain.
+type OPMLOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	Type     string        `xml:"type,attr,omitempty"`
+	XMLURL   string        `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string        `xml:"htmlUrl,attr,omitempty"`
+	Outlines []OPMLOutline `xml:"outline"`
+}
+
+// FeedOutlines returns the outlines of the document that have a feed URL,
+// including outlines grouped within other outlines.
+func (o OPML) FeedOutlines() []OPMLOutline {
+	var feeds []OPMLOutline
+	var add func([]OPMLOutline)
+	add = func(outlines []OPMLOutline) {
+		for _, outline := range outlines {
+			if outline.XMLURL != "" {
+				feeds = append(feeds, outline)
+			}
+			add(outline.Outlines)
+		}
+	}
+	add(o.Body.Outlines)
+
+	return feeds
+}
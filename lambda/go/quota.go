@@ -0,0 +1,287 @@
+package workshop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ddbav "github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	ddbexp "github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// UpdateItemAPI is the Amazon DynamoDB client API for UpdateItem.
+type UpdateItemAPI interface {
+	UpdateItem(context.Context, *ddb.UpdateItemInput, ...func(*ddb.Options)) (
+		*ddb.UpdateItemOutput, error,
+	)
+}
+
+// GetItemAPI is the Amazon DynamoDB client API for GetItem.
+type GetItemAPI interface {
+	GetItem(context.Context, *ddb.GetItemInput, ...func(*ddb.Options)) (
+		*ddb.GetItemOutput, error,
+	)
+}
+
+// PodcastQuotaAPI is the Amazon DynamoDB client API the podcast's episodes
+// per day are counted with.
+type PodcastQuotaAPI interface {
+	UpdateItemAPI
+	GetItemAPI
+}
+
+// MediaQuotas provides the limits on the episodes transcribed, so importing
+// very long, or many episodes does not exceed the Transcribe budget. Zero
+// values are unlimited.
+type MediaQuotas struct {
+	// Maximum size of an episode's media, in bytes.
+	MaxMediaSize int64
+
+	// Maximum duration of an episode's media.
+	MaxMediaDuration time.Duration
+
+	// Maximum number of episodes of a podcast whose transcribe is started in
+	// a UTC day.
+	MaxEpisodesPerPodcastPerDay int
+}
+
+// QuotaExceededError is returned when an episode exceeds one of the
+// MediaQuotas. The error's message is the episode's failure reason.
+type QuotaExceededError struct {
+	Reason string
+}
+
+func (e *QuotaExceededError) Error() string { return e.Reason }
+
+// CheckMediaSize returns a QuotaExceededError if the media is larger than
+// the maximum media size.
+func (q MediaQuotas) CheckMediaSize(size int64) error {
+	if q.MaxMediaSize > 0 && size > q.MaxMediaSize {
+		return &QuotaExceededError{
+			Reason: fmt.Sprintf("episode media is %v bytes, larger than the maximum of %v bytes",
+				size, q.MaxMediaSize),
+		}
+	}
+	return nil
+}
+
+// CheckMediaDuration returns a QuotaExceededError if the media is longer than
+// the maximum media duration.
+func (q MediaQuotas) CheckMediaDuration(seconds float64) error {
+	if q.MaxMediaDuration > 0 && seconds > q.MaxMediaDuration.Seconds() {
+		return &QuotaExceededError{
+			Reason: fmt.Sprintf("episode is %v long, longer than the maximum of %v",
+				time.Duration(math.Round(seconds))*time.Second, q.MaxMediaDuration),
+		}
+	}
+	return nil
+}
+
+// podcastDayCounter is the item of the quota table counting the episodes of
+// a podcast whose transcribe was started in a UTC day. The item expires the
+// day after.
+type podcastDayCounter struct {
+	ID        string   `dynamodbav:"id"`
+	Count     int      `dynamodbav:"count"`
+	Episodes  []string `dynamodbav:"episodes,stringset,omitempty"`
+	ExpiresAt int64    `dynamodbav:"expires_at"`
+}
+
+// podcastDayCounterKey returns the key of the podcast's counter item for
+// the day of the time.
+func podcastDayCounterKey(podcast string, t time.Time) map[string]ddbtypes.AttributeValue {
+	return map[string]ddbtypes.AttributeValue{
+		"id": &ddbtypes.AttributeValueMemberS{
+			Value: "episodes-per-day#" + t.UTC().Format("2006-01-02") + "#" + podcast,
+		},
+	}
+}
+
+// getPodcastDayCounter returns the podcast's counter item for the day of the
+// time, or a zero count if the item does not exist.
+func getPodcastDayCounter(ctx context.Context, client GetItemAPI, tableName, podcast string, t time.Time) (
+	podcastDayCounter, error,
+) {
+	resp, err := client.GetItem(ctx, &ddb.GetItemInput{
+		TableName:      &tableName,
+		Key:            podcastDayCounterKey(podcast, t),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return podcastDayCounter{}, fmt.Errorf("failed to get podcast episodes transcribed today, %w", err)
+	}
+
+	var counter podcastDayCounter
+	if err := ddbav.UnmarshalMap(resp.Item, &counter); err != nil {
+		return podcastDayCounter{}, fmt.Errorf("failed to unmarshal podcast episodes transcribed today, %w", err)
+	}
+	return counter, nil
+}
+
+// counted returns if the episode is counted in the counter.
+func (c podcastDayCounter) counted(episodeID string) bool {
+	for _, id := range c.Episodes {
+		if id == episodeID {
+			return true
+		}
+	}
+	return false
+}
+
+func (q MediaQuotas) podcastEpisodesPerDayError(count int) error {
+	return &QuotaExceededError{
+		Reason: fmt.Sprintf("podcast has %v episodes transcribed today, the maximum is %v",
+			count, q.MaxEpisodesPerPodcastPerDay),
+	}
+}
+
+// CheckPodcastEpisodesPerDay returns a QuotaExceededError if the maximum
+// number of episodes of the podcast have started transcribing today, and
+// the episode is not one of them. The episodes are not counted, see
+// CountPodcastEpisodePerDay. Episodes without a podcast are not limited.
+func (q MediaQuotas) CheckPodcastEpisodesPerDay(ctx context.Context, client GetItemAPI,
+	tableName string, episode Episode,
+) error {
+	if q.MaxEpisodesPerPodcastPerDay <= 0 || episode.Podcast == "" {
+		return nil
+	}
+
+	counter, err := getPodcastDayCounter(ctx, client, tableName, episode.Podcast, time.Now())
+	if err != nil {
+		return err
+	}
+	if counter.Count >= q.MaxEpisodesPerPodcastPerDay && !counter.counted(episode.ID) {
+		return q.podcastEpisodesPerDayError(counter.Count)
+	}
+	return nil
+}
+
+// CountPodcastEpisodePerDay counts the episode in the episodes of its podcast
+// transcribed today, in the podcast's counter item of the quota table.
+// Returns a QuotaExceededError if the maximum number of episodes have
+// already been counted. The counter is incremented atomically, so concurrent
+// episodes cannot exceed the maximum. An episode already counted today, e.g.
+// the step is retried, is not counted again. Episodes without a podcast are
+// not limited.
+func (q MediaQuotas) CountPodcastEpisodePerDay(ctx context.Context, client PodcastQuotaAPI,
+	tableName string, episode Episode,
+) error {
+	if q.MaxEpisodesPerPodcastPerDay <= 0 || episode.Podcast == "" {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	exp, err := ddbexp.NewBuilder().
+		WithUpdate(ddbexp.
+			Add(ddbexp.Name("count"), ddbexp.Value(1)).
+			Add(ddbexp.Name("episodes"), ddbexp.Value(&ddbtypes.AttributeValueMemberSS{
+				Value: []string{episode.ID},
+			})).
+			Set(ddbexp.Name("expires_at"), ddbexp.Value(day.Add(48*time.Hour).Unix()))).
+		WithCondition(ddbexp.And(
+			ddbexp.Or(
+				ddbexp.AttributeNotExists(ddbexp.Name("count")),
+				ddbexp.Name("count").LessThan(ddbexp.Value(q.MaxEpisodesPerPodcastPerDay)),
+			),
+			ddbexp.Not(ddbexp.Contains(ddbexp.Name("episodes"), episode.ID)),
+		)).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression, %w", err)
+	}
+
+	_, err = client.UpdateItem(ctx, &ddb.UpdateItemInput{
+		TableName:                 &tableName,
+		Key:                       podcastDayCounterKey(episode.Podcast, day),
+		UpdateExpression:          exp.Update(),
+		ConditionExpression:       exp.Condition(),
+		ExpressionAttributeNames:  exp.Names(),
+		ExpressionAttributeValues: exp.Values(),
+	})
+	if err == nil {
+		return nil
+	}
+	var condErr *ddbtypes.ConditionalCheckFailedException
+	if !errors.As(err, &condErr) {
+		return fmt.Errorf("failed to count podcast episode transcribed, %w", err)
+	}
+
+	// The condition fails if the episode is already counted, or the podcast
+	// is over the quota.
+	counter, err := getPodcastDayCounter(ctx, client, tableName, episode.Podcast, day)
+	if err != nil {
+		return err
+	}
+	if counter.counted(episode.ID) {
+		return nil
+	}
+	return q.podcastEpisodesPerDayError(counter.Count)
+}
+
+// UncountPodcastEpisodePerDay removes the episode from the episodes of its
+// podcast transcribed today, e.g. the episode's transcribe failed to start
+// after it was counted. Episodes not counted today are ignored.
+func (q MediaQuotas) UncountPodcastEpisodePerDay(ctx context.Context, client UpdateItemAPI,
+	tableName string, episode Episode,
+) error {
+	if q.MaxEpisodesPerPodcastPerDay <= 0 || episode.Podcast == "" {
+		return nil
+	}
+
+	exp, err := ddbexp.NewBuilder().
+		WithUpdate(ddbexp.
+			Add(ddbexp.Name("count"), ddbexp.Value(-1)).
+			Delete(ddbexp.Name("episodes"), ddbexp.Value(&ddbtypes.AttributeValueMemberSS{
+				Value: []string{episode.ID},
+			}))).
+		WithCondition(ddbexp.Contains(ddbexp.Name("episodes"), episode.ID)).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression, %w", err)
+	}
+
+	_, err = client.UpdateItem(ctx, &ddb.UpdateItemInput{
+		TableName:                 &tableName,
+		Key:                       podcastDayCounterKey(episode.Podcast, time.Now()),
+		UpdateExpression:          exp.Update(),
+		ConditionExpression:       exp.Condition(),
+		ExpressionAttributeNames:  exp.Names(),
+		ExpressionAttributeValues: exp.Values(),
+	})
+	var condErr *ddbtypes.ConditionalCheckFailedException
+	if err != nil && !errors.As(err, &condErr) {
+		return fmt.Errorf("failed to uncount podcast episode transcribed, %w", err)
+	}
+	return nil
+}
+
+// RecordEpisodeFailureReason records the user-visible reason the episode
+// failed in the episode's failure_reason, if the episode exists.
+func RecordEpisodeFailureReason(ctx context.Context, client UpdateItemAPI, tableName, episodeID, reason string) error {
+	exp, err := ddbexp.NewBuilder().
+		WithUpdate(ddbexp.Set(ddbexp.Name("failure_reason"), ddbexp.Value(reason))).
+		WithCondition(ddbexp.AttributeExists(ddbexp.Name("id"))).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression, %w", err)
+	}
+
+	_, err = client.UpdateItem(ctx, &ddb.UpdateItemInput{
+		TableName:                 &tableName,
+		Key:                       Episode{ID: episodeID}.AttributeValuePrimaryKey(),
+		UpdateExpression:          exp.Update(),
+		ConditionExpression:       exp.Condition(),
+		ExpressionAttributeNames:  exp.Names(),
+		ExpressionAttributeValues: exp.Values(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record episode failure reason, %w", err)
+	}
+	return nil
+}
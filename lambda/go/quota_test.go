@@ -0,0 +1,116 @@
+package workshop_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	workshop "aws-workshop"
+	"aws-workshop/fakes"
+)
+
+const testQuotaTableName = "PodcastQuota"
+
+func TestCountPodcastEpisodePerDay(t *testing.T) {
+	quotas := workshop.MediaQuotas{MaxEpisodesPerPodcastPerDay: 2}
+	episode := func(id, podcast string) workshop.Episode {
+		return workshop.Episode{ID: id, Podcast: podcast}
+	}
+
+	cases := map[string]struct {
+		Counted  []workshop.Episode
+		Episode  workshop.Episode
+		ExpectOK bool
+	}{
+		"first episode": {
+			Episode:  episode("1", "go"),
+			ExpectOK: true,
+		},
+		"under quota": {
+			Counted:  []workshop.Episode{episode("1", "go")},
+			Episode:  episode("2", "go"),
+			ExpectOK: true,
+		},
+		"over quota": {
+			Counted: []workshop.Episode{episode("1", "go"), episode("2", "go")},
+			Episode: episode("3", "go"),
+		},
+		"already counted": {
+			Counted:  []workshop.Episode{episode("1", "go"), episode("2", "go")},
+			Episode:  episode("2", "go"),
+			ExpectOK: true,
+		},
+		"other podcast": {
+			Counted:  []workshop.Episode{episode("1", "rust"), episode("2", "rust")},
+			Episode:  episode("3", "go"),
+			ExpectOK: true,
+		},
+		"no podcast": {
+			Counted:  []workshop.Episode{episode("1", "go"), episode("2", "go")},
+			Episode:  episode("3", ""),
+			ExpectOK: true,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			client := fakes.NewDynamoDB()
+			client.CreateTable(testQuotaTableName, "id", "")
+
+			for _, counted := range c.Counted {
+				if err := quotas.CountPodcastEpisodePerDay(ctx, client, testQuotaTableName, counted); err != nil {
+					t.Fatalf("expect no error counting %v, got %v", counted.ID, err)
+				}
+			}
+
+			checkErr := quotas.CheckPodcastEpisodesPerDay(ctx, client, testQuotaTableName, c.Episode)
+			countErr := quotas.CountPodcastEpisodePerDay(ctx, client, testQuotaTableName, c.Episode)
+			for _, err := range []error{checkErr, countErr} {
+				if c.ExpectOK {
+					if err != nil {
+						t.Errorf("expect no error, got %v", err)
+					}
+					continue
+				}
+				var quotaErr *workshop.QuotaExceededError
+				if !errors.As(err, &quotaErr) {
+					t.Errorf("expect QuotaExceededError, got %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestUncountPodcastEpisodePerDay(t *testing.T) {
+	ctx := context.Background()
+	quotas := workshop.MediaQuotas{MaxEpisodesPerPodcastPerDay: 1}
+	client := fakes.NewDynamoDB()
+	client.CreateTable(testQuotaTableName, "id", "")
+
+	first := workshop.Episode{ID: "1", Podcast: "go"}
+	second := workshop.Episode{ID: "2", Podcast: "go"}
+
+	if err := quotas.CountPodcastEpisodePerDay(ctx, client, testQuotaTableName, first); err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+
+	// Episodes not counted are not removed, and do not free the count.
+	if err := quotas.UncountPodcastEpisodePerDay(ctx, client, testQuotaTableName, second); err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	var quotaErr *workshop.QuotaExceededError
+	if err := quotas.CountPodcastEpisodePerDay(ctx, client, testQuotaTableName, second); !errors.As(err, &quotaErr) {
+		t.Fatalf("expect QuotaExceededError, got %v", err)
+	}
+
+	if err := quotas.UncountPodcastEpisodePerDay(ctx, client, testQuotaTableName, first); err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if err := quotas.UncountPodcastEpisodePerDay(ctx, client, testQuotaTableName, first); err != nil {
+		t.Fatalf("expect no error uncounting twice, got %v", err)
+	}
+	if err := quotas.CountPodcastEpisodePerDay(ctx, client, testQuotaTableName, second); err != nil {
+		t.Errorf("expect no error, got %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	workshop "aws-workshop"
+	"aws-workshop/handlers/addpodcasts"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/sfn"
+	"github.com/aws/smithy-go/rand"
+)
+
+func main() {
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		log.Fatalf("failed to load config, %v", err)
+	}
+
+	envCfg := workshop.LoadEnvConfig()
+	handler := &addpodcasts.Handler{
+		SFNClient: sfn.NewFromConfig(cfg),
+		DDBClient: ddb.NewFromConfig(cfg),
+
+		MaxNumEpisodes:            envCfg.MaxNumEpisodeImport,
+		ImportConcurrency:         envCfg.ImportConcurrency,
+		EpisodeTableName:          envCfg.PodcastEpisodeTableName,
+		TranscribeStateMachineARN: envCfg.TranscribeStateMachineARN,
+		FeedTableName:             envCfg.PodcastFeedTableName,
+
+		HTTPClient:   workshop.NewHTTPClient(envCfg.HTTPClientOptions()),
+		UUIDProvider: rand.NewUUID(rand.Reader),
+	}
+
+	lambda.Start(handler.HandleRefresh)
+}
@@ -0,0 +1,229 @@
+package workshop
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// MediaContentTypes are the media content types episodes can be transcribed
+// from, see the start-transcription Lambda.
+var MediaContentTypes = []string{
+	"audio/mpeg",
+	"audio/wav",
+	"audio/flac",
+	"audio/mp4a-latm",
+	"audio/ogg",
+	"audio/amr",
+	"audio/webm",
+	"video/mp4",
+	"video/webm",
+}
+
+// IsMediaContentType returns if the content type, or the canonical content
+// type of its alias, is one of the MediaContentTypes.
+func IsMediaContentType(v string) bool {
+	v = NormalizeMediaContentType(v)
+	for _, t := range MediaContentTypes {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+// FieldError is a validation error of a field of a request. The field is the
+// path of the field's JSON name, e.g. import_episode.url.
+type FieldError struct {
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// FieldErrors is the list of validation errors of a request.
+type FieldErrors []FieldError
+
+func (es FieldErrors) Error() string {
+	msgs := make([]string, 0, len(es))
+	for _, e := range es {
+		if e.Field == "" {
+			msgs = append(msgs, e.Message)
+			continue
+		}
+		msgs = append(msgs, e.Field+": "+e.Message)
+	}
+	return "invalid request, " + strings.Join(msgs, ", ")
+}
+
+// Validator is implemented by types with validation rules that cannot be
+// declared with field tags, such as rules between fields. Field names of the
+// errors returned are relative to the type.
+type Validator interface {
+	Validate() FieldErrors
+}
+
+// Validate validates the struct, or pointer to struct, with the rules
+// declared in the "validate" tag of its fields. Fields of struct, and
+// pointer to struct, types, and the elements of slice fields, are validated
+// recursively. Returns the errors of all invalid fields, or nil if v is
+// valid. The field of an error in a slice element includes the element's
+// index, e.g. items[1].url.
+//
+// The rules of the "validate" tag are comma separated:
+//
+//	required            field must not be the zero value, or only whitespace.
+//	max=N               string must not be longer than N characters, or
+//	                    number not greater than N.
+//	min=N               number must not be less than N.
+//	url                 string must be an absolute http or https URL.
+//	media_content_type  string must be one of the MediaContentTypes, or an alias.
+//
+// Rules other than required are not checked for fields with the zero value.
+func Validate(v interface{}) FieldErrors {
+	var errs FieldErrors
+	validateValue(reflect.ValueOf(v), "", &errs)
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func validateValue(v reflect.Value, path string, errs *FieldErrors) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		// Only elements that may be structs can have invalid fields.
+		switch v.Type().Elem().Kind() {
+		case reflect.Struct, reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Array:
+			for i := 0; i < v.Len(); i++ {
+				validateValue(v.Index(i), fmt.Sprintf("%v[%v]", path, i), errs)
+			}
+		}
+		return
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		fieldPath := joinFieldPath(path, jsonFieldName(field))
+
+		validateField(v.Field(i), fieldPath, field.Tag.Get("validate"), errs)
+		validateValue(v.Field(i), fieldPath, errs)
+	}
+
+	if validator, ok := v.Interface().(Validator); ok {
+		for _, e := range validator.Validate() {
+			e.Field = joinFieldPath(path, e.Field)
+			*errs = append(*errs, e)
+		}
+	}
+}
+
+func validateField(v reflect.Value, path, tag string, errs *FieldErrors) {
+	if tag == "" {
+		return
+	}
+
+	isZero := v.IsZero()
+	if v.Kind() == reflect.String {
+		isZero = strings.TrimSpace(v.String()) == ""
+	}
+
+	for _, rule := range strings.Split(tag, ",") {
+		name, param := rule, ""
+		if idx := strings.Index(rule, "="); idx != -1 {
+			name, param = rule[:idx], rule[idx+1:]
+		}
+
+		if name == "required" {
+			if isZero {
+				*errs = append(*errs, FieldError{Field: path, Message: "is required"})
+				return
+			}
+			continue
+		}
+		if isZero {
+			continue
+		}
+
+		if msg := validateRule(v, name, param); msg != "" {
+			*errs = append(*errs, FieldError{Field: path, Message: msg})
+		}
+	}
+}
+
+func validateRule(v reflect.Value, name, param string) string {
+	switch name {
+	case "max", "min":
+		n, err := strconv.ParseInt(param, 10, 64)
+		if err != nil {
+			panic(fmt.Sprintf("invalid validate rule %v=%v", name, param))
+		}
+		switch v.Kind() {
+		case reflect.String:
+			if name == "max" && int64(utf8.RuneCountInString(v.String())) > n {
+				return fmt.Sprintf("must be at most %v characters", n)
+			}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if name == "max" && v.Int() > n {
+				return fmt.Sprintf("must be at most %v", n)
+			}
+			if name == "min" && v.Int() < n {
+				return fmt.Sprintf("must be at least %v", n)
+			}
+		}
+
+	case "url":
+		u, err := url.Parse(v.String())
+		if err != nil {
+			return "must be a valid URL"
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return "must be a http or https URL"
+		}
+		if u.Hostname() == "" {
+			return "must have a host"
+		}
+
+	case "media_content_type":
+		if !IsMediaContentType(v.String()) {
+			return "must be one of " + strings.Join(MediaContentTypes, ", ")
+		}
+
+	default:
+		panic(fmt.Sprintf("unknown validate rule %v", name))
+	}
+
+	return ""
+}
+
+// jsonFieldName returns the name of the field in JSON documents.
+func jsonFieldName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+func joinFieldPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	if name == "" {
+		return path
+	}
+	return path + "." + name
+}
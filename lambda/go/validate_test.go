@@ -0,0 +1,248 @@
+package workshop_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	workshop "aws-workshop"
+)
+
+type validateRequired struct {
+	Name  string `json:"name" validate:"required"`
+	Count int    `json:"count" validate:"required"`
+}
+
+type validateMax struct {
+	Name  string `json:"name" validate:"max=5"`
+	Count int    `json:"count" validate:"max=3"`
+}
+
+type validateMin struct {
+	Count int `json:"count" validate:"min=1"`
+}
+
+type validateURL struct {
+	URL string `json:"url,omitempty" validate:"url"`
+}
+
+type validateContentType struct {
+	ContentType string `json:"content_type" validate:"max=256,media_content_type"`
+}
+
+type validateNoJSONName struct {
+	Name string `validate:"required"`
+}
+
+type validateEither struct {
+	A string `json:"a"`
+	B string `json:"b"`
+}
+
+func (v validateEither) Validate() workshop.FieldErrors {
+	if (v.A == "") == (v.B == "") {
+		return workshop.FieldErrors{{Field: "a", Message: "one of a or b is required"}}
+	}
+	return nil
+}
+
+type validateNested struct {
+	Required *validateRequired `json:"required,omitempty"`
+	Inline   validateMin       `json:"inline"`
+	URLs     []validateURL     `json:"urls"`
+	Pointers []*validateURL    `json:"pointers"`
+	Either   *validateEither   `json:"either,omitempty"`
+	Tags     []string          `json:"tags" validate:"required"`
+}
+
+func TestValidate(t *testing.T) {
+	mediaContentTypes := "must be one of " + strings.Join(workshop.MediaContentTypes, ", ")
+
+	cases := map[string]struct {
+		Value  interface{}
+		Expect workshop.FieldErrors
+	}{
+		"required missing": {
+			Value: validateRequired{},
+			Expect: workshop.FieldErrors{
+				{Field: "name", Message: "is required"},
+				{Field: "count", Message: "is required"},
+			},
+		},
+		"required whitespace": {
+			Value: validateRequired{Name: " \t", Count: 1},
+			Expect: workshop.FieldErrors{
+				{Field: "name", Message: "is required"},
+			},
+		},
+		"required set": {
+			Value: validateRequired{Name: "Go Time", Count: 1},
+		},
+		"max string": {
+			Value: validateMax{Name: "héllo!"},
+			Expect: workshop.FieldErrors{
+				{Field: "name", Message: "must be at most 5 characters"},
+			},
+		},
+		"max string counts characters": {
+			Value: validateMax{Name: "héllo"},
+		},
+		"max number": {
+			Value: validateMax{Count: 4},
+			Expect: workshop.FieldErrors{
+				{Field: "count", Message: "must be at most 3"},
+			},
+		},
+		"min number": {
+			Value: validateMin{Count: -1},
+			Expect: workshop.FieldErrors{
+				{Field: "count", Message: "must be at least 1"},
+			},
+		},
+		"min not checked for zero value": {
+			Value: validateMin{},
+		},
+		"url": {
+			Value: validateURL{URL: "https://example.com/feed.xml"},
+		},
+		"url not http": {
+			Value: validateURL{URL: "ftp://example.com/feed.xml"},
+			Expect: workshop.FieldErrors{
+				{Field: "url", Message: "must be a http or https URL"},
+			},
+		},
+		"url relative": {
+			Value: validateURL{URL: "/feed.xml"},
+			Expect: workshop.FieldErrors{
+				{Field: "url", Message: "must be a http or https URL"},
+			},
+		},
+		"url without host": {
+			Value: validateURL{URL: "https:///feed.xml"},
+			Expect: workshop.FieldErrors{
+				{Field: "url", Message: "must have a host"},
+			},
+		},
+		"url invalid": {
+			Value: validateURL{URL: "https://exa mple.com/feed.xml"},
+			Expect: workshop.FieldErrors{
+				{Field: "url", Message: "must be a valid URL"},
+			},
+		},
+		"media content type": {
+			Value: validateContentType{ContentType: "audio/mpeg"},
+		},
+		"media content type alias": {
+			Value: validateContentType{ContentType: "audio/mp3"},
+		},
+		"media content type unknown": {
+			Value: validateContentType{ContentType: "text/html"},
+			Expect: workshop.FieldErrors{
+				{Field: "content_type", Message: mediaContentTypes},
+			},
+		},
+		"field without json name": {
+			Value: validateNoJSONName{},
+			Expect: workshop.FieldErrors{
+				{Field: "Name", Message: "is required"},
+			},
+		},
+		"nil pointer": {
+			Value: (*validateRequired)(nil),
+		},
+		"pointer": {
+			Value: &validateRequired{Count: 1},
+			Expect: workshop.FieldErrors{
+				{Field: "name", Message: "is required"},
+			},
+		},
+		"nested nil pointers and slices": {
+			Value: validateNested{Tags: []string{"go"}},
+		},
+		"nested structs": {
+			Value: validateNested{
+				Required: &validateRequired{Count: 1},
+				Inline:   validateMin{Count: -1},
+				Tags:     []string{"go"},
+			},
+			Expect: workshop.FieldErrors{
+				{Field: "required.name", Message: "is required"},
+				{Field: "inline.count", Message: "must be at least 1"},
+			},
+		},
+		"nested slices": {
+			Value: validateNested{
+				URLs: []validateURL{
+					{URL: "https://example.com/1.xml"},
+					{URL: "ftp://example.com/2.xml"},
+				},
+				Pointers: []*validateURL{
+					nil,
+					{URL: "https:///3.xml"},
+				},
+				Tags: []string{"go"},
+			},
+			Expect: workshop.FieldErrors{
+				{Field: "urls[1].url", Message: "must be a http or https URL"},
+				{Field: "pointers[1].url", Message: "must have a host"},
+			},
+		},
+		"nested slice required": {
+			Value: validateNested{},
+			Expect: workshop.FieldErrors{
+				{Field: "tags", Message: "is required"},
+			},
+		},
+		"nested validator": {
+			Value: validateNested{
+				Either: &validateEither{},
+				Tags:   []string{"go"},
+			},
+			Expect: workshop.FieldErrors{
+				{Field: "either.a", Message: "one of a or b is required"},
+			},
+		},
+		"validator": {
+			Value: validateEither{A: "a", B: "b"},
+			Expect: workshop.FieldErrors{
+				{Field: "a", Message: "one of a or b is required"},
+			},
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			errs := workshop.Validate(c.Value)
+			if e, a := c.Expect, errs; !reflect.DeepEqual(e, a) {
+				t.Errorf("expect %v errors, got %v", e, a)
+			}
+		})
+	}
+}
+
+func TestValidate_UnknownRule(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("expect panic for unknown rule")
+		}
+	}()
+
+	workshop.Validate(struct {
+		Name string `validate:"maximum=5"`
+	}{Name: "Go Time"})
+}
+
+func TestFieldErrors_Error(t *testing.T) {
+	errs := workshop.FieldErrors{
+		{Field: "import_episode.url", Message: "is required"},
+		{Field: "items[1].url", Message: "must have a host"},
+		{Message: "one of import_episode, import_rss_feed, or import_opml is required"},
+	}
+
+	expect := "invalid request, import_episode.url: is required, " +
+		"items[1].url: must have a host, " +
+		"one of import_episode, import_rss_feed, or import_opml is required"
+	if e, a := expect, errs.Error(); e != a {
+		t.Errorf("expect %q, got %q", e, a)
+	}
+}
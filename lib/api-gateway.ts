@@ -8,6 +8,8 @@ export interface ApiGatewayFrontEndProps {
   addPodcastFn: lambda.IFunction;
   getPodcastFn: lambda.IFunction;
   playPodcastFn: lambda.IFunction;
+  exportPodcastsFn: lambda.IFunction;
+  getImportFn: lambda.IFunction;
 }
 
 export class ApiGatewayFrontend extends cdk.Construct {
@@ -53,5 +55,21 @@ export class ApiGatewayFrontend extends cdk.Construct {
         handler: props.playPodcastFn,
       }),
     });
+
+    this.httpApi.addRoutes({
+      path: '/opml',
+      methods: [apiv2.HttpMethod.GET],
+      integration: new apiv2Integ.LambdaProxyIntegration({
+        handler: props.exportPodcastsFn,
+      }),
+    });
+
+    this.httpApi.addRoutes({
+      path: '/imports/{id}',
+      methods: [apiv2.HttpMethod.GET],
+      integration: new apiv2Integ.LambdaProxyIntegration({
+        handler: props.getImportFn,
+      }),
+    });
   }
 }
@@ -1,9 +1,13 @@
 import * as cdk from 'monocdk';
 import * as ddb from 'monocdk/aws-dynamodb';
+import * as events from 'monocdk/aws-events';
+import * as events_targets from 'monocdk/aws-events-targets';
 import * as iam from 'monocdk/aws-iam';
 import * as lambda from 'monocdk/aws-lambda';
+import * as lambda_event_sources from 'monocdk/aws-lambda-event-sources';
 import * as lambda_nodejs from 'monocdk/aws-lambda-nodejs';
 import * as s3 from 'monocdk/aws-s3';
+import * as secretsmanager from 'monocdk/aws-secretsmanager';
 import * as sfn from 'monocdk/aws-stepfunctions';
 import { ApiGatewayFrontend } from './api-gateway';
 import * as iamUtils from './iam-utils';
@@ -42,18 +46,44 @@ const ENV_KEY_TRANSCRIBE_STATEMACHINE_ARN =
   ENV_KEY_PREFIX + 'TRANSCRIBE_STATEMACHINE_ARN';
 const ENV_KEY_PODCAST_EPISODE_TABLE_NAME =
   ENV_KEY_PREFIX + 'PODCAST_EPISODE_TABLE_NAME';
+const ENV_KEY_PODCAST_EPISODE_PODCAST_INDEX_NAME =
+  ENV_KEY_PREFIX + 'PODCAST_EPISODE_PODCAST_INDEX_NAME';
+const ENV_KEY_PODCAST_EPISODE_STATUS_INDEX_NAME =
+  ENV_KEY_PREFIX + 'PODCAST_EPISODE_STATUS_INDEX_NAME';
+const ENV_KEY_PODCAST_FEED_TABLE_NAME =
+  ENV_KEY_PREFIX + 'PODCAST_FEED_TABLE_NAME';
+const ENV_KEY_PODCAST_IMPORT_JOB_TABLE_NAME =
+  ENV_KEY_PREFIX + 'PODCAST_IMPORT_JOB_TABLE_NAME';
+const ENV_KEY_PODCAST_QUOTA_TABLE_NAME =
+  ENV_KEY_PREFIX + 'PODCAST_QUOTA_TABLE_NAME';
 const ENV_KEY_PODCAST_DATA_BUCKET_NAME =
   ENV_KEY_PREFIX + 'PODCAST_DATA_BUCKET_NAME';
 const ENV_KEY_TRANSCRIBE_ACCESS_ROLE_ARN =
   ENV_KEY_PREFIX + 'TRANSCRIBE_ACCESS_ROLE_ARN';
+const ENV_KEY_PAGE_TOKEN_KEY_SECRET_ARN =
+  ENV_KEY_PREFIX + 'PAGE_TOKEN_KEY_SECRET_ARN';
 
 const ENV_KEY_PODCAST_DATA_KEY_PREFIX =
   ENV_KEY_PREFIX + 'PODCAST_DATA_KEY_PREFIX';
 const ENV_KEY_MAX_NUM_EPISODE_IMPORT =
   ENV_KEY_PREFIX + 'MAX_NUM_EPISODE_IMPORT';
+const ENV_KEY_IMPORT_CONCURRENCY = ENV_KEY_PREFIX + 'IMPORT_CONCURRENCY';
+const ENV_KEY_MAX_MEDIA_SIZE = ENV_KEY_PREFIX + 'MAX_MEDIA_SIZE';
+const ENV_KEY_MAX_MEDIA_DURATION_SECONDS =
+  ENV_KEY_PREFIX + 'MAX_MEDIA_DURATION_SECONDS';
+const ENV_KEY_MAX_EPISODES_PER_PODCAST_PER_DAY =
+  ENV_KEY_PREFIX + 'MAX_EPISODES_PER_PODCAST_PER_DAY';
 
 const PODCAST_DATA_KEY_PREFIX = 'podcasts/';
+const PODCAST_EPISODE_PODCAST_INDEX_NAME = 'podcast-published';
+const PODCAST_EPISODE_STATUS_INDEX_NAME = 'status-published';
 const MAX_NUM_EPISODE_IMPORT = '5';
+const IMPORT_CONCURRENCY = '8';
+// Limits of the episodes transcribed. Transcribe does not accept media
+// larger than 2 GB, or longer than 4 hours.
+const MAX_MEDIA_SIZE = String(2 * 1024 * 1024 * 1024);
+const MAX_MEDIA_DURATION_SECONDS = String(4 * 60 * 60);
+const MAX_EPISODES_PER_PODCAST_PER_DAY = '20';
 
 export interface CdkStackProps extends cdk.StackProps {
   workshopLanguage: WorkshopLanguage;
@@ -65,6 +95,10 @@ export class CdkStack extends cdk.Stack {
 
     const podcastBucket = new s3.Bucket(this, 'PodcastData', {
       blockPublicAccess: s3.BlockPublicAccess.BLOCK_ALL,
+      lifecycleRules: [
+        // Remove the parts of media uploads that were never completed.
+        { abortIncompleteMultipartUploadAfter: cdk.Duration.days(1) },
+      ],
     });
     const transcribeAccessRole = makeTranscribeAccessBucketRole(
       this,
@@ -75,6 +109,45 @@ export class CdkStack extends cdk.Stack {
     const podcastEpisodeTable = new ddb.Table(this, 'PodcastEpisode', {
       partitionKey: { type: ddb.AttributeType.STRING, name: 'id' },
     });
+    // Index for listing the episodes of a podcast by published date.
+    podcastEpisodeTable.addGlobalSecondaryIndex({
+      indexName: PODCAST_EPISODE_PODCAST_INDEX_NAME,
+      partitionKey: { type: ddb.AttributeType.STRING, name: 'podcast' },
+      sortKey: { type: ddb.AttributeType.STRING, name: 'published_at' },
+    });
+    // Index for listing the episodes with a status by published date.
+    podcastEpisodeTable.addGlobalSecondaryIndex({
+      indexName: PODCAST_EPISODE_STATUS_INDEX_NAME,
+      partitionKey: { type: ddb.AttributeType.STRING, name: 'status' },
+      sortKey: { type: ddb.AttributeType.STRING, name: 'published_at' },
+    });
+
+    // Feeds subscribed to, refreshed periodically for new episodes.
+    const podcastFeedTable = new ddb.Table(this, 'PodcastFeed', {
+      partitionKey: { type: ddb.AttributeType.STRING, name: 'url' },
+    });
+
+    // Asynchronous import jobs, run by the import worker when inserted.
+    const podcastImportJobTable = new ddb.Table(this, 'PodcastImportJob', {
+      partitionKey: { type: ddb.AttributeType.STRING, name: 'id' },
+      stream: ddb.StreamViewType.KEYS_ONLY,
+      timeToLiveAttribute: 'expires_at',
+    });
+
+    // Counters of the episodes of a podcast transcribed per day, expired
+    // the day after.
+    const podcastQuotaTable = new ddb.Table(this, 'PodcastQuota', {
+      partitionKey: { type: ddb.AttributeType.STRING, name: 'id' },
+      timeToLiveAttribute: 'expires_at',
+    });
+
+    // Key the list podcasts handler signs pagination tokens with.
+    const pageTokenKey = new secretsmanager.Secret(this, 'PageTokenKey', {
+      generateSecretString: {
+        excludePunctuation: true,
+        passwordLength: 64,
+      },
+    });
 
     const transcribeStateMachine = new TranscribeStateMachine(
       this,
@@ -84,6 +157,7 @@ export class CdkStack extends cdk.Stack {
           workshopLanguage: props.workshopLanguage,
           podcastBucket: podcastBucket,
           podcastEpisodeTable: podcastEpisodeTable,
+          podcastQuotaTable: podcastQuotaTable,
           transcribeAccessRole: transcribeAccessRole,
         }),
       }
@@ -94,9 +168,23 @@ export class CdkStack extends cdk.Stack {
         workshopLanguage: props.workshopLanguage,
         podcastBucket: podcastBucket,
         podcastEpisodeTable: podcastEpisodeTable,
+        podcastFeedTable: podcastFeedTable,
+        podcastImportJobTable: podcastImportJobTable,
         transcribeStateMachine: transcribeStateMachine,
+        pageTokenKey: pageTokenKey,
       }),
     });
+    makeFeedRefreshLambda(this, 'FeedRefreshHandler', {
+      podcastEpisodeTable: podcastEpisodeTable,
+      podcastFeedTable: podcastFeedTable,
+      transcribeStateMachine: transcribeStateMachine,
+    });
+    makeImportWorkerLambda(this, 'ImportWorkerHandler', {
+      podcastEpisodeTable: podcastEpisodeTable,
+      podcastFeedTable: podcastFeedTable,
+      podcastImportJobTable: podcastImportJobTable,
+      transcribeStateMachine: transcribeStateMachine,
+    });
     new cdk.CfnOutput(this, 'APIUrl', {
       value: frontend.httpApi.apiEndpoint,
     });
@@ -136,19 +224,32 @@ interface podcastHandlers {
   addPodcastFn: lambda.IFunction;
   getPodcastFn: lambda.IFunction;
   playPodcastFn: lambda.IFunction;
+  exportPodcastsFn: lambda.IFunction;
+  getImportFn: lambda.IFunction;
 }
 
 interface makeApiEndpointLambdasProps {
   podcastBucket: s3.IBucket;
   podcastEpisodeTable: ddb.ITable;
+  podcastFeedTable: ddb.ITable;
+  podcastImportJobTable: ddb.ITable;
   transcribeStateMachine: sfn.IStateMachine;
+  pageTokenKey: secretsmanager.ISecret;
 
   workshopLanguage: WorkshopLanguage;
 }
 
 const commonStaticLambdaEnvs = {
+  [ENV_KEY_PODCAST_EPISODE_PODCAST_INDEX_NAME]:
+    PODCAST_EPISODE_PODCAST_INDEX_NAME,
+  [ENV_KEY_PODCAST_EPISODE_STATUS_INDEX_NAME]:
+    PODCAST_EPISODE_STATUS_INDEX_NAME,
   [ENV_KEY_PODCAST_DATA_KEY_PREFIX]: PODCAST_DATA_KEY_PREFIX,
   [ENV_KEY_MAX_NUM_EPISODE_IMPORT]: MAX_NUM_EPISODE_IMPORT,
+  [ENV_KEY_IMPORT_CONCURRENCY]: IMPORT_CONCURRENCY,
+  [ENV_KEY_MAX_MEDIA_SIZE]: MAX_MEDIA_SIZE,
+  [ENV_KEY_MAX_MEDIA_DURATION_SECONDS]: MAX_MEDIA_DURATION_SECONDS,
+  [ENV_KEY_MAX_EPISODES_PER_PODCAST_PER_DAY]: MAX_EPISODES_PER_PODCAST_PER_DAY,
   AWS_RETRY_MODE: 'standard',
   AWS_MAX_ATTEMPTS: '3',
 };
@@ -167,7 +268,11 @@ function makeApiEndpointLambdas(
       [ENV_KEY_TRANSCRIBE_STATEMACHINE_ARN]:
         props.transcribeStateMachine.stateMachineArn,
       [ENV_KEY_PODCAST_EPISODE_TABLE_NAME]: props.podcastEpisodeTable.tableName,
+      [ENV_KEY_PODCAST_FEED_TABLE_NAME]: props.podcastFeedTable.tableName,
+      [ENV_KEY_PODCAST_IMPORT_JOB_TABLE_NAME]:
+        props.podcastImportJobTable.tableName,
       [ENV_KEY_PODCAST_DATA_BUCKET_NAME]: props.podcastBucket.bucketName,
+      [ENV_KEY_PAGE_TOKEN_KEY_SECRET_ARN]: props.pageTokenKey.secretArn,
       ...commonStaticLambdaEnvs,
     },
     memorySize: 1024,
@@ -181,6 +286,18 @@ function makeApiEndpointLambdas(
     code: lambda.Code.fromAsset('lambda/go/add-podcasts'),
     ...commonProps,
   });
+  const exportPodcastsFn = new lambda.Function(scope, id + 'ExportPodcasts', {
+    runtime: lambda.Runtime.GO_1_X,
+    handler: 'main',
+    code: lambda.Code.fromAsset('lambda/go/export-podcasts'),
+    ...commonProps,
+  });
+  const getImportFn = new lambda.Function(scope, id + 'GetImport', {
+    runtime: lambda.Runtime.GO_1_X,
+    handler: 'main',
+    code: lambda.Code.fromAsset('lambda/go/get-import'),
+    ...commonProps,
+  });
 
   let handlers: podcastHandlers;
   switch (props.workshopLanguage) {
@@ -188,6 +305,8 @@ function makeApiEndpointLambdas(
       handlers = {
         // Common handlers
         addPodcastFn: addPodcastFn,
+        exportPodcastsFn: exportPodcastsFn,
+        getImportFn: getImportFn,
 
         // language specific handlers
         listPodcastsFn: new lambda.Function(scope, listPodcastsId, {
@@ -215,6 +334,8 @@ function makeApiEndpointLambdas(
       handlers = {
         // Common handlers
         addPodcastFn: addPodcastFn,
+        exportPodcastsFn: exportPodcastsFn,
+        getImportFn: getImportFn,
 
         // language specific handlers
         listPodcastsFn: new lambda.Function(scope, listPodcastsId, {
@@ -242,6 +363,8 @@ function makeApiEndpointLambdas(
       handlers = {
         // Common handlers
         addPodcastFn: addPodcastFn,
+        exportPodcastsFn: exportPodcastsFn,
+        getImportFn: getImportFn,
 
         // language specific handlers
         listPodcastsFn: new lambda.Function(scope, listPodcastsId, {
@@ -269,6 +392,8 @@ function makeApiEndpointLambdas(
       handlers = {
         // Common handlers
         addPodcastFn: addPodcastFn,
+        exportPodcastsFn: exportPodcastsFn,
+        getImportFn: getImportFn,
 
         // language specific handlers
         listPodcastsFn: new lambda_nodejs.NodejsFunction(scope, listPodcastsId, {
@@ -299,8 +424,18 @@ function makeApiEndpointLambdas(
   handlers.listPodcastsFn.addToRolePolicy(
     iamUtils.makePolicyStatement({
       effect: iam.Effect.ALLOW,
-      actions: ['dynamodb:Scan'],
-      resources: [props.podcastEpisodeTable.tableArn],
+      actions: ['dynamodb:Scan', 'dynamodb:Query'],
+      resources: [
+        props.podcastEpisodeTable.tableArn,
+        props.podcastEpisodeTable.tableArn + '/index/*',
+      ],
+    })
+  );
+  handlers.listPodcastsFn.addToRolePolicy(
+    iamUtils.makePolicyStatement({
+      effect: iam.Effect.ALLOW,
+      actions: ['secretsmanager:GetSecretValue'],
+      resources: [props.pageTokenKey.secretArn],
     })
   );
 
@@ -325,6 +460,42 @@ function makeApiEndpointLambdas(
       resources: [props.podcastEpisodeTable.tableArn],
     })
   );
+  handlers.addPodcastFn.addToRolePolicy(
+    iamUtils.makePolicyStatement({
+      effect: iam.Effect.ALLOW,
+      actions: ['dynamodb:UpdateItem'],
+      resources: [props.podcastFeedTable.tableArn],
+    })
+  );
+  handlers.addPodcastFn.addToRolePolicy(
+    iamUtils.makePolicyStatement({
+      effect: iam.Effect.ALLOW,
+      actions: ['dynamodb:PutItem'],
+      resources: [props.podcastImportJobTable.tableArn],
+    })
+  );
+
+  //------------------------------
+  // Get Import
+  //------------------------------
+  handlers.getImportFn.addToRolePolicy(
+    iamUtils.makePolicyStatement({
+      effect: iam.Effect.ALLOW,
+      actions: ['dynamodb:GetItem'],
+      resources: [props.podcastImportJobTable.tableArn],
+    })
+  );
+
+  //------------------------------
+  // Export Podcasts
+  //------------------------------
+  handlers.exportPodcastsFn.addToRolePolicy(
+    iamUtils.makePolicyStatement({
+      effect: iam.Effect.ALLOW,
+      actions: ['dynamodb:Scan'],
+      resources: [props.podcastEpisodeTable.tableArn],
+    })
+  );
 
   //------------------------------
   // Get Podcasts
@@ -364,6 +535,139 @@ function makeApiEndpointLambdas(
   return handlers;
 }
 
+interface makeFeedRefreshLambdaProps {
+  podcastEpisodeTable: ddb.ITable;
+  podcastFeedTable: ddb.ITable;
+  transcribeStateMachine: sfn.IStateMachine;
+}
+
+// makeFeedRefreshLambda creates the Lambda refreshing subscribed feeds on a
+// schedule, importing new episodes of the feeds.
+function makeFeedRefreshLambda(
+  scope: cdk.Construct,
+  id: string,
+  props: makeFeedRefreshLambdaProps
+): lambda.IFunction {
+  const refreshFeedsFn = new lambda.Function(scope, id + 'RefreshFeeds', {
+    runtime: lambda.Runtime.GO_1_X,
+    handler: 'main',
+    code: lambda.Code.fromAsset('lambda/go/refresh-feeds'),
+    environment: {
+      [ENV_KEY_TRANSCRIBE_STATEMACHINE_ARN]:
+        props.transcribeStateMachine.stateMachineArn,
+      [ENV_KEY_PODCAST_EPISODE_TABLE_NAME]: props.podcastEpisodeTable.tableName,
+      [ENV_KEY_PODCAST_FEED_TABLE_NAME]: props.podcastFeedTable.tableName,
+      ...commonStaticLambdaEnvs,
+    },
+    memorySize: 1024,
+    timeout: cdk.Duration.minutes(5),
+  });
+
+  new events.Rule(scope, id + 'Schedule', {
+    schedule: events.Schedule.rate(cdk.Duration.hours(1)),
+    targets: [new events_targets.LambdaFunction(refreshFeedsFn)],
+  });
+
+  refreshFeedsFn.addToRolePolicy(
+    iamUtils.makePolicyStatement({
+      effect: iam.Effect.ALLOW,
+      actions: ['states:StartExecution'],
+      resources: [props.transcribeStateMachine.stateMachineArn],
+    })
+  );
+  refreshFeedsFn.addToRolePolicy(
+    iamUtils.makePolicyStatement({
+      effect: iam.Effect.ALLOW,
+      actions: [
+        'dynamodb:BatchGetItem',
+        'dynamodb:BatchWriteItem',
+        'dynamodb:UpdateItem',
+      ],
+      resources: [props.podcastEpisodeTable.tableArn],
+    })
+  );
+  refreshFeedsFn.addToRolePolicy(
+    iamUtils.makePolicyStatement({
+      effect: iam.Effect.ALLOW,
+      actions: ['dynamodb:Scan', 'dynamodb:UpdateItem'],
+      resources: [props.podcastFeedTable.tableArn],
+    })
+  );
+
+  return refreshFeedsFn;
+}
+
+interface makeImportWorkerLambdaProps {
+  podcastEpisodeTable: ddb.ITable;
+  podcastFeedTable: ddb.ITable;
+  podcastImportJobTable: ddb.ITable;
+  transcribeStateMachine: sfn.IStateMachine;
+}
+
+// makeImportWorkerLambda creates the Lambda running the asynchronous import
+// jobs inserted into the import job table, invoked by the table's stream.
+function makeImportWorkerLambda(
+  scope: cdk.Construct,
+  id: string,
+  props: makeImportWorkerLambdaProps
+): lambda.IFunction {
+  const importWorkerFn = new lambda.Function(scope, id + 'ImportWorker', {
+    runtime: lambda.Runtime.GO_1_X,
+    handler: 'main',
+    code: lambda.Code.fromAsset('lambda/go/import-worker'),
+    environment: {
+      [ENV_KEY_TRANSCRIBE_STATEMACHINE_ARN]:
+        props.transcribeStateMachine.stateMachineArn,
+      [ENV_KEY_PODCAST_EPISODE_TABLE_NAME]: props.podcastEpisodeTable.tableName,
+      [ENV_KEY_PODCAST_FEED_TABLE_NAME]: props.podcastFeedTable.tableName,
+      [ENV_KEY_PODCAST_IMPORT_JOB_TABLE_NAME]:
+        props.podcastImportJobTable.tableName,
+      ...commonStaticLambdaEnvs,
+    },
+    memorySize: 1024,
+    timeout: cdk.Duration.minutes(15),
+  });
+
+  importWorkerFn.addEventSource(
+    new lambda_event_sources.DynamoEventSource(props.podcastImportJobTable, {
+      startingPosition: lambda.StartingPosition.TRIM_HORIZON,
+      batchSize: 1,
+      retryAttempts: 2,
+    })
+  );
+
+  importWorkerFn.addToRolePolicy(
+    iamUtils.makePolicyStatement({
+      effect: iam.Effect.ALLOW,
+      actions: ['states:StartExecution'],
+      resources: [props.transcribeStateMachine.stateMachineArn],
+    })
+  );
+  importWorkerFn.addToRolePolicy(
+    iamUtils.makePolicyStatement({
+      effect: iam.Effect.ALLOW,
+      actions: [
+        'dynamodb:BatchGetItem',
+        'dynamodb:BatchWriteItem',
+        'dynamodb:UpdateItem',
+      ],
+      resources: [props.podcastEpisodeTable.tableArn],
+    })
+  );
+  importWorkerFn.addToRolePolicy(
+    iamUtils.makePolicyStatement({
+      effect: iam.Effect.ALLOW,
+      actions: ['dynamodb:UpdateItem'],
+      resources: [
+        props.podcastFeedTable.tableArn,
+        props.podcastImportJobTable.tableArn,
+      ],
+    })
+  );
+
+  return importWorkerFn;
+}
+
 interface transcribeStatemachineHandlers {
   updateEpisodeStatus: lambda.IFunction;
   uploadPodcast: lambda.IFunction;
@@ -375,6 +679,7 @@ interface transcribeStatemachineHandlers {
 interface makeTranscribeStatemachineLambdasProps {
   podcastBucket: s3.IBucket;
   podcastEpisodeTable: ddb.ITable;
+  podcastQuotaTable: ddb.ITable;
   transcribeAccessRole: iam.IRole;
 
   workshopLanguage: WorkshopLanguage;
@@ -393,6 +698,7 @@ function makeTranscribeStatemachineLambdas(
   const commonProps = {
     environment: {
       [ENV_KEY_PODCAST_EPISODE_TABLE_NAME]: props.podcastEpisodeTable.tableName,
+      [ENV_KEY_PODCAST_QUOTA_TABLE_NAME]: props.podcastQuotaTable.tableName,
       [ENV_KEY_PODCAST_DATA_BUCKET_NAME]: props.podcastBucket.bucketName,
       [ENV_KEY_TRANSCRIBE_ACCESS_ROLE_ARN]: props.transcribeAccessRole.roleArn,
       ...commonStaticLambdaEnvs,
@@ -525,6 +831,14 @@ function makeTranscribeStatemachineLambdas(
       resources: [props.podcastEpisodeTable.tableArn],
     })
   );
+  // Aborts the media upload of failed episodes.
+  handlers.updateEpisodeStatus.addToRolePolicy(
+    iamUtils.makePolicyStatement({
+      effect: iam.Effect.ALLOW,
+      actions: ['s3:AbortMultipartUpload'],
+      resources: [props.podcastBucket.bucketArn + '/*'],
+    })
+  );
 
   //------------------------------
   // Upload Podcast
@@ -546,6 +860,20 @@ function makeTranscribeStatemachineLambdas(
       ],
     })
   );
+  handlers.uploadPodcast.addToRolePolicy(
+    iamUtils.makePolicyStatement({
+      effect: iam.Effect.ALLOW,
+      actions: ['dynamodb:GetItem', 'dynamodb:UpdateItem'],
+      resources: [props.podcastEpisodeTable.tableArn],
+    })
+  );
+  handlers.uploadPodcast.addToRolePolicy(
+    iamUtils.makePolicyStatement({
+      effect: iam.Effect.ALLOW,
+      actions: ['dynamodb:GetItem'],
+      resources: [props.podcastQuotaTable.tableArn],
+    })
+  );
 
   //------------------------------
   // Start Transcription
@@ -564,6 +892,20 @@ function makeTranscribeStatemachineLambdas(
       resources: ['*'],
     })
   );
+  handlers.startTranscription.addToRolePolicy(
+    iamUtils.makePolicyStatement({
+      effect: iam.Effect.ALLOW,
+      actions: ['dynamodb:UpdateItem'],
+      resources: [props.podcastEpisodeTable.tableArn],
+    })
+  );
+  handlers.startTranscription.addToRolePolicy(
+    iamUtils.makePolicyStatement({
+      effect: iam.Effect.ALLOW,
+      actions: ['dynamodb:GetItem', 'dynamodb:UpdateItem'],
+      resources: [props.podcastQuotaTable.tableArn],
+    })
+  );
 
   //------------------------------
   // Check Transcription
@@ -43,10 +43,20 @@ export class TranscribeStateMachine extends cdk.Construct {
         outputPath: '$.episode',
         resultPath: '$.episode',
       }
-    ).addCatch(failureStep, {
-      errors: ['States.TaskFailed'],
-      resultPath: '$.taskFailed',
-    });
+    )
+      // Resume media uploads stopped before they completed, e.g. by the
+      // Lambda's timeout. Uploads still incomplete once the retries are
+      // exhausted are aborted by the failure status update.
+      .addRetry({
+        errors: ['MediaUploadIncompleteError'],
+        interval: cdk.Duration.seconds(1),
+        maxAttempts: 5,
+        backoffRate: 2,
+      })
+      .addCatch(failureStep, {
+        errors: ['States.TaskFailed'],
+        resultPath: '$.taskFailed',
+      });
 
     const startTranscriptionStep = new sfnTasks.LambdaInvoke(
       this,
@@ -10,16 +10,16 @@ case $WS_LANG in
 	go)
 		case $HANDLER_NAME in
 			GetPodcast)
-				echo "lambda/go/get-podcast/main.go"
+				echo "lambda/go/handlers/getpodcast/handler.go"
 				;;
 			ListPodcasts)
-				echo "lambda/go/list-podcasts/main.go"
+				echo "lambda/go/handlers/listpodcasts/handler.go"
 				;;
 			PlayPodcast)
-				echo "lambda/go/play-podcast/main.go"
+				echo "lambda/go/handlers/playpodcast/handler.go"
 				;;
 			UploadPodcast)
-				echo "lambda/go/upload-podcast/main.go"
+				echo "lambda/go/handlers/uploadpodcast/handler.go"
 				;;
 			*)
 				echo "unknown handler name $HANDLER_NAME"